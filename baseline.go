@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+)
+
+// baselineFile is the layout of the JSON file given to -baseline and written by -write-baseline.
+type baselineFile struct {
+	Fingerprints []string `json:"fingerprints"`
+}
+
+// baselineFingerprint identifies a finding in a baseline. Unlike its fingerprint it leaves out the
+// commit and source, since every new commit still containing a legacy key reports it again.
+func (f Finding) baselineFingerprint() string {
+	return Finding{Repo: f.Repo, File: f.File, Rule: f.Rule, AccessKeyID: f.AccessKeyID, SecretAccessKey: f.SecretAccessKey}.fingerprint()
+}
+
+// baseline holds the fingerprints of known findings that are suppressed. A nil baseline suppresses nothing.
+type baseline map[string]bool
+
+// loadBaseline reads a baseline file, or returns nil when path is empty.
+func loadBaseline(path string) (baseline, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baseline: %v", err)
+	}
+
+	var file baselineFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse baseline %s: %v", path, err)
+	}
+
+	known := make(baseline)
+	for _, fingerprint := range file.Fingerprints {
+		known[fingerprint] = true
+	}
+
+	return known, nil
+}
+
+// suppresses reports whether the finding is in the baseline.
+func (b baseline) suppresses(f Finding) bool {
+	return b[f.baselineFingerprint()]
+}
+
+// apply returns the findings that are not in the baseline, counting the others in stats.
+func (b baseline) apply(findings []Finding, stats *ScanStats) []Finding {
+	if len(b) == 0 {
+		return findings
+	}
+
+	var kept []Finding
+	for _, f := range findings {
+		if b.suppresses(f) {
+			stats.SuppressedByBaseline++
+			continue
+		}
+		kept = append(kept, f)
+	}
+
+	return kept
+}
+
+// writeBaseline writes a baseline file suppressing the findings, keeping the entries of the
+// previous baseline so findings it suppressed stay suppressed.
+func writeBaseline(path string, findings []Finding, previous baseline) error {
+	known := make(map[string]bool)
+	for fingerprint := range previous {
+		known[fingerprint] = true
+	}
+	for _, f := range findings {
+		known[f.baselineFingerprint()] = true
+	}
+
+	file := baselineFile{Fingerprints: []string{}}
+	for fingerprint := range known {
+		file.Fingerprints = append(file.Fingerprints, fingerprint)
+	}
+	sort.Strings(file.Fingerprints)
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode baseline: %v", err)
+	}
+	if err := ioutil.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write baseline: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBaselineSuppressesKnownFindings(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("legacy key", map[string]string{"legacy.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+	path := filepath.Join(t.TempDir(), "baseline.json")
+
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeBaseline(path, result.Findings, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Later commits still holding the legacy key stay suppressed, while the new key is reported
+	repo.commit("new key", map[string]string{"new.env": keyFile(testAccessKeyID2, testSecretAccessKey2)})
+	result, err = Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true, Baseline: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var files []string
+	for _, f := range result.Findings {
+		files = append(files, f.File)
+	}
+	if !reflect.DeepEqual(files, []string{"new.env"}) {
+		t.Errorf("got findings in %v, want only new.env", files)
+	}
+	if result.Stats.SuppressedByBaseline != 2 {
+		t.Errorf("got %d findings suppressed by baseline, want 2", result.Stats.SuppressedByBaseline)
+	}
+}
+
+func TestWriteBaselineKeepsPrevious(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	findings := []Finding{{File: "b.env", Rule: ruleAWSLabelled, AccessKeyID: testAccessKeyID}}
+	if err := writeBaseline(path, findings, baseline{"previous": true}); err != nil {
+		t.Fatal(err)
+	}
+
+	known, err := loadBaseline(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := baseline{"previous": true, findings[0].baselineFingerprint(): true}
+	if !reflect.DeepEqual(known, want) {
+		t.Errorf("got baseline %v, want %v", known, want)
+	}
+
+	// The commit a finding is in does not change its baseline fingerprint
+	moved := findings[0]
+	moved.Commit = "0123456"
+	if !known.suppresses(moved) {
+		t.Error("got the finding in another commit reported, want it suppressed")
+	}
+}
+
+func TestLoadBaselineInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	ioutil.WriteFile(path, []byte("not json"), 0o600)
+
+	if _, err := loadBaseline(path); err == nil || !strings.Contains(err.Error(), "failed to parse baseline") {
+		t.Errorf("got error %v, want a parse error", err)
+	}
+	if known, err := loadBaseline(""); known != nil || err != nil {
+		t.Errorf("got %v, %v, want no baseline", known, err)
+	}
+}
+
+func TestCLIBaseline(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("legacy key", map[string]string{"legacy.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+	path := filepath.Join(t.TempDir(), "baseline.json")
+
+	if got := runScanner(t, "-repo", repo.dir, "-no-validate", "-write-baseline", path); got.code != exitKeysFound {
+		t.Fatalf("got exit code %d writing the baseline, want %d; stderr:\n%s", got.code, exitKeysFound, got.stderr)
+	}
+
+	got := runScanner(t, "-repo", repo.dir, "-no-validate", "-baseline", path)
+	if got.code != 0 || strings.Contains(got.stdout, testAccessKeyID) {
+		t.Errorf("got exit code %d and stdout %q, want the baselined key suppressed", got.code, got.stdout)
+	}
+
+	repo.commit("new key", map[string]string{"new.env": keyFile(testAccessKeyID2, testSecretAccessKey2)})
+	got = runScanner(t, "-repo", repo.dir, "-no-validate", "-baseline", path)
+	if got.code != exitKeysFound || !strings.Contains(got.stdout, "new.env:1: "+testAccessKeyID2) || strings.Contains(got.stdout, "legacy.env") {
+		t.Errorf("got exit code %d and stdout %q, want only the new key failing the build", got.code, got.stdout)
+	}
+}
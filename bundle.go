@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// checkBundle returns the absolute path of a git bundle file, or an error unless it is a bundle that
+// can be cloned and checked out.
+func checkBundle(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve bundle path: %v", err)
+	}
+
+	// Unlike git bundle verify, listing the heads works outside a repository
+	output, err := exec.Command("git", "bundle", "list-heads", abs).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("invalid bundle %s: %w. Output: %s", path, commandError(err), strings.TrimSpace(string(output)))
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.HasSuffix(line, " HEAD") {
+			return abs, nil
+		}
+	}
+
+	return "", fmt.Errorf("invalid bundle %s: it has no HEAD to check out, create it with git bundle create %s --all", path, path)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScanBundle(t *testing.T) {
+	repo := newFixtureRepo(t)
+	added := repo.commit("add key", map[string]string{"config.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+	repo.commit("remove key", map[string]string{"config.env": "AWS_REGION=us-east-1\n"})
+
+	bundle := filepath.Join(t.TempDir(), "repo.bundle")
+	repo.git("bundle", "create", bundle, "--all")
+
+	repoURL, err := checkBundle(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repoURL, NoValidate: true, Diff: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The key was removed before the bundle was made, so it is only found in the history
+	if len(result.Findings) != 1 || result.Findings[0].Commit != added || result.Findings[0].AccessKeyID != testAccessKeyID {
+		t.Errorf("got findings %+v, want the key added in %s", result.Findings, added)
+	}
+}
+
+func TestCheckBundleInvalid(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("readme", map[string]string{"README.md": "hello\n"})
+
+	// A bundle of a branch alone has no HEAD to check out
+	headless := filepath.Join(t.TempDir(), "main.bundle")
+	repo.git("bundle", "create", headless, "main")
+	if _, err := checkBundle(headless); err == nil || !strings.Contains(err.Error(), "has no HEAD") {
+		t.Errorf("got error %v, want the bundle rejected for having no HEAD", err)
+	}
+
+	garbage := filepath.Join(t.TempDir(), "garbage.bundle")
+	if err := ioutil.WriteFile(garbage, []byte("not a bundle\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{garbage, filepath.Join(t.TempDir(), "missing.bundle")} {
+		if _, err := checkBundle(path); err == nil || !strings.HasPrefix(err.Error(), "invalid bundle") {
+			t.Errorf("%s: got error %v, want an invalid bundle error", filepath.Base(path), err)
+		}
+	}
+}
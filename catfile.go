@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// catFileBufferSize bounds the buffer between the cat-file processes and the reader.
+const catFileBufferSize = 64 << 10
+
+// catFile reads objects from a repository through long-running git cat-file processes: one with
+// --batch-check giving the type and size of an object, and one with --batch giving its content, which
+// is only asked for once the object is known to fit the size limit.
+type catFile struct {
+	check *catFileProcess
+	batch *catFileProcess
+}
+
+// catFileProcess is a git cat-file process taking object names on its input.
+type catFileProcess struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+// object is a git object read by catFile.
+type object struct {
+	Hash string
+	Type string
+	Size int64
+	// Content is nil when the object was skipped for exceeding the size limit.
+	Content []byte
+}
+
+// newCatFile starts git cat-file --batch-check and --batch in the repository at the given path.
+func newCatFile(repoPath string) (*catFile, error) {
+	check, err := startCatFile(repoPath, "--batch-check")
+	if err != nil {
+		return nil, err
+	}
+	batch, err := startCatFile(repoPath, "--batch")
+	if err != nil {
+		check.close()
+		return nil, err
+	}
+
+	return &catFile{check: check, batch: batch}, nil
+}
+
+// startCatFile starts git cat-file in the given batch mode.
+func startCatFile(repoPath, mode string) (*catFileProcess, error) {
+	cmd := exec.Command("git", "cat-file", mode)
+	cmd.Dir = repoPath
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cat-file input: %v", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cat-file output: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start cat-file: %w", commandError(err))
+	}
+
+	return &catFileProcess{cmd: cmd, stdin: stdin, stdout: bufio.NewReaderSize(stdout, catFileBufferSize)}, nil
+}
+
+// header requests the object with the given hash and returns its hash, type and size.
+func (p *catFileProcess) header(hash string) (string, string, int64, error) {
+	if _, err := fmt.Fprintln(p.stdin, hash); err != nil {
+		return "", "", 0, fmt.Errorf("failed to request object %s: %v", hash, err)
+	}
+
+	// The header is "<hash> <type> <size>", or "<hash> missing" for unknown objects
+	header, err := p.stdout.ReadString('\n')
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to read object header for %s: %v", hash, err)
+	}
+
+	fields := strings.Fields(header)
+	if len(fields) != 3 {
+		return "", "", 0, fmt.Errorf("object %s not found", hash)
+	}
+
+	size, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("invalid object size for %s: %v", hash, err)
+	}
+
+	return fields[0], fields[1], size, nil
+}
+
+// close stops the process.
+func (p *catFileProcess) close() error {
+	p.stdin.Close()
+	return p.cmd.Wait()
+}
+
+// read returns the object with the given hash. Objects larger than maxSize, when positive, are
+// returned without content, which git is then never asked for, so skipping them reads none of it.
+func (c *catFile) read(hash string, maxSize int64) (*object, error) {
+	name, typ, size, err := c.check.header(hash)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize > 0 && size > maxSize {
+		return &object{Hash: name, Type: typ, Size: size}, nil
+	}
+
+	if name, typ, size, err = c.batch.header(name); err != nil {
+		return nil, err
+	}
+
+	// The content is followed by a newline
+	content := make([]byte, size+1)
+	if _, err := io.ReadFull(c.batch.stdout, content); err != nil {
+		return nil, fmt.Errorf("failed to read object %s: %v", hash, err)
+	}
+
+	return &object{Hash: name, Type: typ, Size: size, Content: content[:size]}, nil
+}
+
+// Close stops the cat-file processes.
+func (c *catFile) Close() error {
+	checkErr := c.check.close()
+	if err := c.batch.close(); err != nil {
+		return err
+	}
+
+	return checkErr
+}
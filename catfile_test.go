@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeBlob writes content as a loose blob of the repository and returns its hash.
+func writeBlob(t *testing.T, repo *fixtureRepo, content string) string {
+	path := filepath.Join(t.TempDir(), "blob")
+	if err := ioutil.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return repo.git("hash-object", "-w", path)
+}
+
+func TestCatFileSkipsOversizeBlobs(t *testing.T) {
+	repo := newFixtureRepo(t)
+	small := writeBlob(t, repo, keyFile(testAccessKeyID, testSecretAccessKey))
+	large := writeBlob(t, repo, strings.Repeat("x", 4<<20))
+
+	c, err := newCatFile(repo.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	blob, err := c.read(large, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blob.Content != nil || blob.Size != 4<<20 || blob.Type != "blob" {
+		t.Errorf("oversize blob read as %s of %d bytes with %d bytes of content, want its size only", blob.Type, blob.Size, len(blob.Content))
+	}
+	// The content was never requested, so none of it is waiting in the pipe
+	if buffered := c.batch.stdout.Buffered(); buffered != 0 {
+		t.Errorf("%d bytes of the oversize blob were read", buffered)
+	}
+
+	blob, err = c.read(small, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(blob.Content) != keyFile(testAccessKeyID, testSecretAccessKey) {
+		t.Errorf("blob read after the oversize one has content %q", blob.Content)
+	}
+
+	blob, err = c.read(large, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blob.Content) != 4<<20 {
+		t.Errorf("blob read without a limit has %d bytes, want all %d", len(blob.Content), 4<<20)
+	}
+}
+
+func TestCatFileMissingObject(t *testing.T) {
+	repo := newFixtureRepo(t)
+	c, err := newCatFile(repo.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.read(strings.Repeat("0", 40), 0); err == nil {
+		t.Error("missing object read without an error")
+	}
+}
+
+func TestScanDanglingSkipsOversizeBlob(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("clean", nil)
+	writeBlob(t, repo, strings.Repeat("x", 2048)+keyFile(testAccessKeyID, testSecretAccessKey))
+
+	walk, err := ScanOptions{MaxFileSize: 1024}.walkOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stats ScanStats
+	findings, err := searchDanglingBlobs(repo.dir, walk, &stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 0 || stats.SkippedOversize != 1 {
+		t.Errorf("got %d findings and %d oversize, want the blob skipped", len(findings), stats.SkippedOversize)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// keyList is a CSV key list with a header, a comment and two key pairs.
+const keyList = "access_key_id,secret_access_key\n# rotated last week\n" +
+	testAccessKeyID + "," + testSecretAccessKey + "\n\n" +
+	testAccessKeyID2 + ", " + testSecretAccessKey2 + "\n"
+
+func TestReadKeyList(t *testing.T) {
+	findings, err := readKeyList(strings.NewReader(keyList), "keys.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 2 {
+		t.Fatalf("got %d keys, want 2", len(findings))
+	}
+	if f := findings[1]; f.AccessKeyID != testAccessKeyID2 || f.SecretAccessKey != testSecretAccessKey2 || f.Line != 5 || f.File != "keys.csv" {
+		t.Errorf("unexpected second key %+v", f)
+	}
+
+	if _, err := readKeyList(strings.NewReader(testAccessKeyID+"\n"), "keys.csv"); err == nil {
+		t.Error("row without a secret accepted")
+	}
+}
+
+func TestCheckKeysWithFakeValidator(t *testing.T) {
+	findings, err := readKeyList(strings.NewReader(keyList), "keys.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validator := &fakeValidator{valid: map[string]bool{testAccessKeyID2: true}}
+	pool := validationPool{validator: validator, byRule: map[string]keyValidator{}, concurrency: 2, timeout: time.Second}
+	pool.run(context.Background(), findings)
+
+	if findings[0].Status != statusInvalid || findings[1].Status != statusValid {
+		t.Errorf("got statuses %q and %q, want invalid and valid", findings[0].Status, findings[1].Status)
+	}
+}
+
+func TestCheckKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.csv")
+	if err := ioutil.WriteFile(path, []byte(keyList), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	stub := newSTSStub(t, testAccessKeyID)
+
+	result, err := CheckKeys(context.Background(), path, ScanOptions{AWSEndpoint: stub.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Findings) != 2 || result.Findings[0].Status != statusValid || result.Findings[1].Status != statusInvalid {
+		t.Errorf("got %+v, want the first key valid and the second invalid", result.Findings)
+	}
+}
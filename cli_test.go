@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// scannerBinary is the path of the scanner built for the CLI tests by TestMain.
+var scannerBinary string
+
+// TestMain builds the scanner into a temporary directory, outside the repository, so the CLI tests
+// run it the way users do.
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "scanner-cli-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	scannerBinary = filepath.Join(dir, "scanner")
+	if output, err := exec.Command("go", "build", "-o", scannerBinary, ".").CombinedOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to build the scanner: %v\n%s", err, output)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// cliResult is the output and exit code of a run of the scanner.
+type cliResult struct {
+	stdout, stderr string
+	code           int
+}
+
+// runScanner runs the scanner with the arguments and returns its output and exit code.
+func runScanner(t *testing.T, args ...string) cliResult {
+	t.Helper()
+	return runScannerEnv(t, nil, args...)
+}
+
+// runScannerEnv runs the scanner like runScanner with the variables of env added to its environment.
+func runScannerEnv(t *testing.T, env []string, args ...string) cliResult {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(scannerBinary, args...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	code := 0
+	switch {
+	case errors.As(err, &exitErr):
+		code = exitErr.ExitCode()
+	case err != nil:
+		t.Fatalf("failed to run the scanner: %v", err)
+	}
+
+	return cliResult{stdout: stdout.String(), stderr: stderr.String(), code: code}
+}
+
+// countOutput matches the output of -count: a single integer and nothing else.
+var countOutput = regexp.MustCompile(`^[0-9]+\n$`)
+
+func TestCLICount(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("add keys", map[string]string{
+		"live.env": keyFile(testAccessKeyID, testSecretAccessKey),
+		"dead.env": keyFile(testAccessKeyID2, testSecretAccessKey2),
+	})
+	stub := newSTSStub(t, testAccessKeyID)
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+		code int
+	}{
+		{"live", []string{"-aws-endpoint", stub.URL}, "1\n", exitKeysFound},
+		{"all", []string{"-aws-endpoint", stub.URL, "-count-all"}, "2\n", exitKeysFound},
+		// Unverified keys are not live, but still fail the build
+		{"unverified", []string{"-no-validate"}, "0\n", exitKeysFound},
+	}
+
+	for _, tt := range tests {
+		got := runScanner(t, append([]string{"-repo", repo.dir, "-count"}, tt.args...)...)
+		if !countOutput.MatchString(got.stdout) || got.stdout != tt.want {
+			t.Errorf("%s: got stdout %q, want only %q", tt.name, got.stdout, tt.want)
+		}
+		if got.code != tt.code {
+			t.Errorf("%s: got exit code %d, want %d; stderr:\n%s", tt.name, got.code, tt.code, got.stderr)
+		}
+	}
+}
+
+func TestCLICountCleanRepo(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("readme", map[string]string{"README.md": "hello\n"})
+
+	got := runScanner(t, "-repo", repo.dir, "-count")
+	if got.stdout != "0\n" || got.code != 0 {
+		t.Errorf("got stdout %q and exit code %d, want only 0 and exit code 0; stderr:\n%s", got.stdout, got.code, got.stderr)
+	}
+}
+
+func TestCLICountRejectsOtherOutput(t *testing.T) {
+	got := runScanner(t, "-repo", t.TempDir(), "-count", "-format", "json")
+	if got.code == 0 || got.stdout != "" {
+		t.Errorf("got stdout %q and exit code %d, want -count with -format json rejected", got.stdout, got.code)
+	}
+}
+
+func TestCLICleanRepo(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("readme", map[string]string{"README.md": "hello\n", "config.env": "AWS_REGION=us-east-1\n"})
+
+	got := runScanner(t, "-repo", repo.dir)
+	if got.code != 0 {
+		t.Errorf("got exit code %d, want 0; stderr:\n%s", got.code, got.stderr)
+	}
+	if !strings.Contains(got.stdout, "No valid IAM keys found.") || strings.Contains(got.stdout, "key found") {
+		t.Errorf("got stdout %q, want no keys reported", got.stdout)
+	}
+	if strings.Contains(got.stderr, "Error") {
+		t.Errorf("got stderr %q, want no errors", got.stderr)
+	}
+}
+
+func TestCLIUnverifiedMatch(t *testing.T) {
+	repo := newFixtureRepo(t)
+	commit := repo.commit("add key", map[string]string{"config.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+
+	got := runScanner(t, "-repo", repo.dir, "-no-validate")
+	if got.code != exitKeysFound {
+		t.Errorf("got exit code %d, want %d; stderr:\n%s", got.code, exitKeysFound, got.stderr)
+	}
+	want := "Unverified IAM key found in commit " + commit + " at config.env:1: " + testAccessKeyID
+	if !strings.Contains(got.stdout, want) || !strings.Contains(got.stdout, "No valid IAM keys found.") {
+		t.Errorf("got stdout %q, want it to report %q", got.stdout, want)
+	}
+	if strings.Contains(got.stdout+got.stderr, testSecretAccessKey) {
+		t.Errorf("the secret was printed:\n%s%s", got.stdout, got.stderr)
+	}
+}
+
+func TestCLILiveKey(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("add keys", map[string]string{
+		"live.env": keyFile(testAccessKeyID, testSecretAccessKey),
+		"dead.env": keyFile(testAccessKeyID2, testSecretAccessKey2),
+	})
+	stub := newSTSStub(t, testAccessKeyID)
+	sarif := filepath.Join(t.TempDir(), "report.sarif")
+
+	got := runScanner(t, "-repo", repo.dir, "-aws-endpoint", stub.URL, "-format", "json", "-output-sarif", sarif)
+	if got.code != exitKeysFound {
+		t.Errorf("got exit code %d, want %d; stderr:\n%s", got.code, exitKeysFound, got.stderr)
+	}
+
+	var report ScanResult
+	if err := json.Unmarshal([]byte(got.stdout), &report); err != nil {
+		t.Fatalf("stdout is not a JSON report: %v\n%s", err, got.stdout)
+	}
+	statuses := make(map[string]string)
+	for _, f := range report.Findings {
+		statuses[f.AccessKeyID] = f.Status
+	}
+	if want := map[string]string{testAccessKeyID: statusValid, testAccessKeyID2: statusInvalid}; !reflect.DeepEqual(statuses, want) {
+		t.Errorf("got statuses %v, want %v", statuses, want)
+	}
+
+	data, err := ioutil.ReadFile(sarif)
+	if err != nil {
+		t.Fatalf("SARIF report not written: %v", err)
+	}
+	if !strings.Contains(string(data), `"ruleId": "`+ruleAWSLabelled+`"`) || !strings.Contains(string(data), `"level": "error"`) {
+		t.Errorf("SARIF report does not hold the live key as an error:\n%s", data)
+	}
+}
+
+func TestCLIDeadKeyPasses(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("add key", map[string]string{"dead.env": keyFile(testAccessKeyID2, testSecretAccessKey2)})
+	stub := newSTSStub(t)
+
+	// A key AWS rejects is neither printed nor fails the build
+	got := runScanner(t, "-repo", repo.dir, "-aws-endpoint", stub.URL)
+	if got.code != 0 {
+		t.Errorf("got exit code %d, want 0; stdout:\n%s\nstderr:\n%s", got.code, got.stdout, got.stderr)
+	}
+	if strings.Contains(got.stdout, testAccessKeyID2) || !strings.Contains(got.stdout, "No valid IAM keys found.") {
+		t.Errorf("got stdout %q, want no keys reported", got.stdout)
+	}
+}
+
+func TestCLIErrors(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("readme", map[string]string{"README.md": "hello\n"})
+
+	tests := []struct {
+		name   string
+		args   []string
+		env    []string
+		code   int
+		stderr string
+	}{
+		{"no target", nil, nil, exitError, "Please provide a GitHub repository URL using the -repo flag"},
+		{"unknown flag", []string{"-no-such-flag"}, nil, 2, "flag provided but not defined: -no-such-flag"},
+		{"missing repository", []string{"-repo", filepath.Join(t.TempDir(), "missing")}, nil, exitCloneFailed, "error cloning repository"},
+		{"git not found", []string{"-repo", repo.dir}, []string{"PATH=" + t.TempDir()}, exitGitNotFound, "git is not installed or not on the PATH"},
+	}
+
+	for _, tt := range tests {
+		got := runScannerEnv(t, tt.env, tt.args...)
+		if got.code != tt.code || !strings.Contains(got.stderr, tt.stderr) {
+			t.Errorf("%s: got exit code %d and stderr %q, want %d and %q", tt.name, got.code, got.stderr, tt.code, tt.stderr)
+		}
+		if got.stdout != "" && tt.code != 2 {
+			t.Errorf("%s: got stdout %q, want none", tt.name, got.stdout)
+		}
+	}
+}
+
+func TestCLIEmptyHistory(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.write(map[string]string{"config.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+
+	res := runScanner(t, "-no-validate", "-repo", repo.dir)
+	if res.code != exitKeysFound {
+		t.Errorf("got exit code %d, want %d\n%s", res.code, exitKeysFound, res.stderr)
+	}
+	if !strings.Contains(res.stdout, "Note: the repository has no commits, so its working tree was scanned instead.") || !strings.Contains(res.stdout, testAccessKeyID) {
+		t.Errorf("got output %q, want the key and the empty history note", res.stdout)
+	}
+}
+
+func TestCLIStrict(t *testing.T) {
+	repo := unreadableFixture(t)
+
+	if res := runScanner(t, "-no-validate", "-path", repo.dir); res.code != exitKeysFound {
+		t.Errorf("by default: got exit code %d, want %d\n%s", res.code, exitKeysFound, res.stderr)
+	}
+	res := runScanner(t, "-no-validate", "-strict", "-path", repo.dir)
+	if res.code != exitError || !strings.Contains(res.stderr, "unreadable.env") {
+		t.Errorf("with -strict: got exit code %d, want %d\n%s", res.code, exitError, res.stderr)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// lockRetryInterval is how often a scan waiting for the lock of a cached repository tries again.
+const lockRetryInterval = 100 * time.Millisecond
+
+// cloneFromCache clones the repository from its mirror in the clone cache at cacheDir into a new
+// directory under tmpDir, and returns its path like cloneRepo, passing the progress of the local clone
+// to onProgress. The mirror is cloned with git clone --mirror on the first scan of the repository and
+// updated with git fetch on later ones, so only the new commits are downloaded. The clone is local,
+// hardlinking the objects of the mirror, and the mirror is locked until it is made, so scans of the
+// same repository, in this process or another, wait for each other instead of fetching into it at
+// the same time.
+func cloneFromCache(ctx context.Context, cacheDir, repoURL, branch, token, tmpDir string, depth int, onProgress func(ProgressEvent)) (string, error) {
+	if err := os.MkdirAll(cacheDir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create clone cache: %v", err)
+	}
+
+	mirror := filepath.Join(cacheDir, cacheKey(repoURL))
+	unlock, err := lockFile(ctx, mirror+".lock")
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	if err := updateMirror(ctx, mirror, repoURL, token); err != nil {
+		return "", err
+	}
+
+	return cloneRepo(ctx, mirror, branch, "", tmpDir, depth, onProgress)
+}
+
+// updateMirror fetches the new commits of the repository into its mirror, or creates the mirror when
+// the repository is not cached yet. A mirror is cloned next to its final path and only moved there
+// once complete, so an interrupted clone is not mistaken for one.
+func updateMirror(ctx context.Context, mirror, repoURL, token string) error {
+	if _, err := os.Stat(mirror); err == nil {
+		cmd := exec.CommandContext(ctx, "git", "fetch", "-q", "--prune", "origin")
+		cmd.Dir = mirror
+		cmd.Env = tokenEnv(token)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to fetch into clone cache %s: %w. Output: %s", mirror, commandError(err), strings.TrimSpace(string(output)))
+		}
+		log.Printf("Fetched the new commits of %s into clone cache %s", repoURL, mirror)
+		return nil
+	}
+
+	tempDir, err := ioutil.TempDir(filepath.Dir(mirror), filepath.Base(mirror)+".tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to create clone cache directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cmd := exec.CommandContext(ctx, "git", "clone", "-q", "--mirror", "--", repoURL, tempDir)
+	cmd.Env = tokenEnv(token)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return &CloneError{URL: repoURL, Output: string(output), Err: commandError(err)}
+	}
+	if err := os.Rename(tempDir, mirror); err != nil {
+		return fmt.Errorf("failed to add %s to clone cache: %v", repoURL, err)
+	}
+	log.Printf("Cloned %s into clone cache %s", repoURL, mirror)
+
+	return nil
+}
+
+// cacheKey returns the directory name of the repository's mirror in the clone cache: the name of the
+// repository, for readability, after a hash of its URL without credentials, so different hosts and
+// owners with repositories of the same name, or URLs differing only in their token, do not collide.
+func cacheKey(repoURL string) string {
+	normalized := strings.TrimSuffix(strings.TrimSuffix(repoURL, "/"), ".git")
+	if u, err := url.Parse(normalized); err == nil && u.User != nil {
+		u.User = nil
+		normalized = u.String()
+	}
+
+	sum := sha256.Sum256([]byte(normalized))
+	name := strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r == '.' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, path.Base(filepath.ToSlash(normalized)))
+
+	return hex.EncodeToString(sum[:8]) + "-" + name + ".git"
+}
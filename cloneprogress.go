@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+)
+
+// cloneProgressPattern matches the progress lines git clone --progress writes to stderr, such as
+// "Receiving objects:  45% (450/1000), 1.20 MiB | 2.00 MiB/s" or the "remote: " lines of the server.
+var cloneProgressPattern = regexp.MustCompile(`^(?:remote: )?([A-Za-z][A-Za-z ]*):\s+\d+% \((\d+)/(\d+)\)`)
+
+// parseCloneProgress converts a progress line of git clone into a "cloning" progress event. Lines in
+// any other format are not progress.
+func parseCloneProgress(line string) (ProgressEvent, bool) {
+	match := cloneProgressPattern.FindStringSubmatch(line)
+	if match == nil {
+		return ProgressEvent{}, false
+	}
+
+	done, err := strconv.Atoi(match[2])
+	if err != nil {
+		return ProgressEvent{}, false
+	}
+	total, err := strconv.Atoi(match[3])
+	if err != nil {
+		return ProgressEvent{}, false
+	}
+
+	return ProgressEvent{Stage: progressCloning, Phase: match[1], Done: done, Total: total}, true
+}
+
+// cloneProgressWriter receives the output of git clone --progress, reporting progress lines to
+// onProgress and keeping every other line for error messages. git redraws progress lines with a
+// carriage return, so both "\r" and "\n" end a line.
+type cloneProgressWriter struct {
+	onProgress func(ProgressEvent)
+	output     bytes.Buffer
+	partial    []byte
+}
+
+// Write implements io.Writer.
+func (w *cloneProgressWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		end := bytes.IndexAny(w.partial, "\r\n")
+		if end < 0 {
+			break
+		}
+		w.line(string(w.partial[:end]))
+		w.partial = w.partial[end+1:]
+	}
+
+	return len(p), nil
+}
+
+// line handles a complete line of output.
+func (w *cloneProgressWriter) line(line string) {
+	if event, ok := parseCloneProgress(line); ok {
+		w.onProgress(event)
+		return
+	}
+	if line != "" {
+		w.output.WriteString(line + "\n")
+	}
+}
+
+// String returns the output that was not progress, including an unterminated last line.
+func (w *cloneProgressWriter) String() string {
+	return w.output.String() + string(w.partial)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// sampleCloneOutput is what git clone --progress writes to stderr, with progress lines redrawn
+// after carriage returns.
+const sampleCloneOutput = "Cloning into '/tmp/repo-clone-1'...\n" +
+	"remote: Enumerating objects: 1000, done.\n" +
+	"remote: Counting objects:  50% (5/10)\rremote: Counting objects: 100% (10/10), done.\n" +
+	"Receiving objects:   0% (0/1000)\rReceiving objects:  45% (450/1000), 1.20 MiB | 2.00 MiB/s\r" +
+	"Receiving objects: 100% (1000/1000), 2.50 MiB | 2.10 MiB/s, done.\n" +
+	"Resolving deltas: 100% (300/300), done.\n" +
+	"warning: unrecognised progress 12/34\n"
+
+func TestCloneProgressWriter(t *testing.T) {
+	var events []ProgressEvent
+	w := &cloneProgressWriter{onProgress: func(e ProgressEvent) { events = append(events, e) }}
+
+	// git writes in arbitrary chunks, so lines are split across writes
+	for i := 0; i < len(sampleCloneOutput); i += 7 {
+		end := i + 7
+		if end > len(sampleCloneOutput) {
+			end = len(sampleCloneOutput)
+		}
+		w.Write([]byte(sampleCloneOutput[i:end]))
+	}
+
+	want := []ProgressEvent{
+		{Stage: progressCloning, Phase: "Counting objects", Done: 5, Total: 10},
+		{Stage: progressCloning, Phase: "Counting objects", Done: 10, Total: 10},
+		{Stage: progressCloning, Phase: "Receiving objects", Done: 0, Total: 1000},
+		{Stage: progressCloning, Phase: "Receiving objects", Done: 450, Total: 1000},
+		{Stage: progressCloning, Phase: "Receiving objects", Done: 1000, Total: 1000},
+		{Stage: progressCloning, Phase: "Resolving deltas", Done: 300, Total: 300},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("got events\n%+v\nwant\n%+v", events, want)
+	}
+
+	// Lines that are not progress are kept for error messages
+	output := w.String()
+	for _, line := range []string{"Cloning into '/tmp/repo-clone-1'...", "remote: Enumerating objects: 1000, done.", "warning: unrecognised progress 12/34"} {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("output %q does not keep %q", output, line)
+		}
+	}
+	if strings.Contains(output, "Receiving") {
+		t.Errorf("output %q keeps progress lines", output)
+	}
+}
+
+func TestParseCloneProgress(t *testing.T) {
+	for _, line := range []string{
+		"",
+		"Receiving objects: done",
+		"Receiving objects: 45%",
+		"Receiving objects:  45% (450/99999999999999999999)",
+		"fatal: repository not found",
+	} {
+		if event, ok := parseCloneProgress(line); ok {
+			t.Errorf("parseCloneProgress(%q) = %+v, want no progress", line, event)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// ResultCollector gathers findings from concurrent scanners, dropping duplicates.
+// It is safe for use by multiple goroutines.
+type ResultCollector struct {
+	mu       sync.Mutex
+	findings []Finding
+	seen     map[findingKey]bool
+	// commitOrder records the order in which commits were first seen, to keep history order in snapshots.
+	commitOrder map[string]int
+	// limit caps the number of findings collected when positive; findings past it are dropped.
+	limit int
+}
+
+// findingKey identifies a finding for deduplication.
+type findingKey struct {
+	source, commit, file string
+	line                 int
+	rule                 string
+	accessKeyID          string
+	secretAccessKey      string
+}
+
+// NewResultCollector returns an empty collector.
+func NewResultCollector() *ResultCollector {
+	return &ResultCollector{
+		seen:        make(map[findingKey]bool),
+		commitOrder: make(map[string]int),
+	}
+}
+
+// Add records the finding and reports whether it was new.
+func (c *ResultCollector) Add(f Finding) bool {
+	key := findingKey{f.Source, f.Commit, f.File, f.Line, f.Rule, f.AccessKeyID, f.SecretAccessKey}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.seen[key] {
+		return false
+	}
+	if c.limit > 0 && len(c.findings) >= c.limit {
+		return false
+	}
+	c.seen[key] = true
+
+	if _, ok := c.commitOrder[f.Commit]; !ok {
+		c.commitOrder[f.Commit] = len(c.commitOrder)
+	}
+	c.findings = append(c.findings, f)
+
+	return true
+}
+
+// AddAll records every finding in the slice.
+func (c *ResultCollector) AddAll(findings []Finding) {
+	for _, f := range findings {
+		c.Add(f)
+	}
+}
+
+// SetLimit caps the number of findings collected at n when positive.
+func (c *ResultCollector) SetLimit(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.limit = n
+}
+
+// Full reports whether the collector holds as many findings as its limit allows.
+func (c *ResultCollector) Full() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.limit > 0 && len(c.findings) >= c.limit
+}
+
+// Len returns the number of findings collected so far.
+func (c *ResultCollector) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.findings)
+}
+
+// Snapshot returns a copy of the collected findings: regular history first, in the order commits
+// were first seen, then by file, line, rule and access key ID.
+func (c *ResultCollector) Snapshot() []Finding {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	findings := append([]Finding(nil), c.findings...)
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		switch {
+		case a.Source != b.Source:
+			return a.Source < b.Source
+		case a.Commit != b.Commit:
+			return c.commitOrder[a.Commit] < c.commitOrder[b.Commit]
+		case a.File != b.File:
+			return a.File < b.File
+		case a.Line != b.Line:
+			return a.Line < b.Line
+		case a.Rule != b.Rule:
+			return a.Rule < b.Rule
+		default:
+			return a.AccessKeyID < b.AccessKeyID
+		}
+	})
+
+	return findings
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestResultCollectorConcurrentAdd(t *testing.T) {
+	const goroutines, perGoroutine = 32, 100
+
+	c := NewResultCollector()
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < perGoroutine; i++ {
+				f := Finding{Commit: fmt.Sprintf("commit-%d", g), File: "a.env", Line: i + 1, AccessKeyID: testAccessKeyID}
+				c.Add(f)
+				// Every finding is added twice, so duplicates race with each other too
+				c.Add(f)
+				c.Len()
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	findings := c.Snapshot()
+	if len(findings) != goroutines*perGoroutine {
+		t.Fatalf("got %d findings, want %d", len(findings), goroutines*perGoroutine)
+	}
+	seen := make(map[string]bool)
+	for _, f := range findings {
+		seen[fmt.Sprintf("%s:%d", f.Commit, f.Line)] = true
+	}
+	if len(seen) != goroutines*perGoroutine {
+		t.Errorf("got %d distinct findings, want %d", len(seen), goroutines*perGoroutine)
+	}
+}
+
+func TestResultCollectorSnapshotOrder(t *testing.T) {
+	c := NewResultCollector()
+	c.AddAll([]Finding{
+		{Commit: "new", File: "b", Line: 2},
+		{Commit: "new", File: "a", Line: 9},
+		{Commit: "old", File: "a", Line: 1},
+		{Commit: "new", File: "a", Line: 3},
+		{Source: sourceDangling, File: "blob", Line: 1},
+	})
+
+	var got []string
+	for _, f := range c.Snapshot() {
+		got = append(got, fmt.Sprintf("%s %s %s:%d", f.Source, f.Commit, f.File, f.Line))
+	}
+	want := []string{" new a:3", " new a:9", " new b:2", " old a:1", "dangling  blob:1"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got order %q, want %q", got, want)
+	}
+}
+
+func TestResultCollectorLimit(t *testing.T) {
+	c := NewResultCollector()
+	c.SetLimit(2)
+	for i := 0; i < 5; i++ {
+		c.Add(Finding{Line: i})
+	}
+	if c.Len() != 2 || !c.Full() {
+		t.Errorf("got %d findings, full %v, want 2 and full", c.Len(), c.Full())
+	}
+}
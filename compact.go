@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// compactCommitLength is the number of hex digits commits are abbreviated to in compact output.
+const compactCommitLength = 12
+
+// compactStatus returns the status label of a finding in compact output.
+func compactStatus(f Finding) string {
+	if f.Status == statusValid {
+		return "live"
+	}
+
+	return f.Status
+}
+
+// compactLine formats the finding as "path:line: rule key [status]", like grep -n, so editors and
+// fuzzy finders can jump to it. Access key IDs are shown as is and other secrets redacted; the
+// notebook cell, Terraform resource, repository and commit follow when the finding has them.
+func compactLine(f Finding) string {
+	key := f.AccessKeyID
+	if key == "" {
+		key = redact(f.SecretAccessKey)
+	}
+
+	line := fmt.Sprintf("%s:%d: %s %s [%s]", f.File, f.Line, f.Rule, key, compactStatus(f))
+	if f.Allowed {
+		line += " (allowed path)"
+	}
+	if f.Exposure == exposurePublic {
+		line += " (" + exposurePublic + ")"
+	}
+	if f.AtHead == headRemoved {
+		line += " (not at HEAD)"
+	}
+	if f.Encoding != "" {
+		line += " (" + f.Encoding + " encoded)"
+	}
+	if f.Synthetic {
+		line += " (synthetic test finding)"
+	}
+	if f.Cell > 0 {
+		line += fmt.Sprintf(" cell %d", f.Cell)
+	}
+	if f.Resource != "" {
+		line += " resource " + joinPath(f.Resource, f.Attribute)
+	}
+	if f.Repo != "" {
+		line += " repo " + f.Repo
+	}
+	if commit := f.Commit; commit != "" {
+		if len(commit) > compactCommitLength {
+			commit = commit[:compactCommitLength]
+		}
+		line += " commit " + commit
+	}
+
+	return line
+}
+
+// writeCompactReport writes one line per finding, leaving out invalid keys like the text output.
+func writeCompactReport(w io.Writer, result *ScanResult) error {
+	for _, f := range result.Findings {
+		if f.Status == statusInvalid {
+			continue
+		}
+		if _, err := fmt.Fprintln(w, compactLine(f)); err != nil {
+			return fmt.Errorf("failed to write compact report: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteCompactReport(t *testing.T) {
+	result := &ScanResult{Findings: []Finding{
+		{File: "config.env", Line: 2, Rule: ruleAWSLabelled, AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey, Status: statusValid, Commit: "0123456789abcdef0123"},
+		{File: "deploy/app.yml", Line: 14, Rule: "acme-token", SecretAccessKey: "acme_9f8e7d6c5b4a39281706", Status: statusUnverified},
+		{File: "old.env", Line: 1, Rule: ruleAWSLabelled, AccessKeyID: testAccessKeyID2, SecretAccessKey: testSecretAccessKey2, Status: statusInvalid},
+		{File: "infra/terraform.tfstate", Line: 13, Rule: ruleTerraformState, AccessKeyID: testAccessKeyID2, Status: statusUnverified, Resource: "aws_iam_access_key.ci", Attribute: "secret", Allowed: true},
+	}}
+
+	var out bytes.Buffer
+	if err := writeCompactReport(&out, result); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "config.env:2: " + ruleAWSLabelled + " " + testAccessKeyID + " [live] commit 0123456789ab\n" +
+		"deploy/app.yml:14: acme-token " + redact("acme_9f8e7d6c5b4a39281706") + " [unverified]\n" +
+		"infra/terraform.tfstate:13: " + ruleTerraformState + " " + testAccessKeyID2 + " [unverified] (allowed path) resource aws_iam_access_key.ci.secret\n"
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+	if strings.Contains(out.String(), "acme_9f8e7d6c5b4a39281706") || strings.Contains(out.String(), testSecretAccessKey) {
+		t.Error("got a secret in compact output, want it redacted")
+	}
+}
+
+func TestCLICompactFormat(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("add keys", map[string]string{
+		"config.env":  "# deploy\n" + keyFile(testAccessKeyID, testSecretAccessKey),
+		"partial.env": "id = " + testAccessKeyID2 + "\n",
+	})
+
+	got := runScanner(t, "-repo", repo.dir, "-no-validate", "-format", "compact", "-min-confidence", "high")
+	if got.code != exitKeysFound {
+		t.Errorf("got exit code %d, want %d; stderr:\n%s", got.code, exitKeysFound, got.stderr)
+	}
+	lines := strings.Split(strings.TrimSuffix(got.stdout, "\n"), "\n")
+	if len(lines) != 1 || !strings.HasPrefix(lines[0], "config.env:2: "+ruleAWSLabelled+" "+testAccessKeyID+" [unverified] commit ") {
+		t.Errorf("got stdout %q, want one compact line for config.env", got.stdout)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// envPrefix is prepended to a flag name to form the environment variable that configures it.
+const envPrefix = "SCANNER_"
+
+// sensitiveFlags lists flags whose values must never be echoed back in messages.
+var sensitiveFlags = map[string]bool{
+	"token":          true,
+	"webhook-secret": true,
+}
+
+// commandLineOnlyFlags lists flags that are never set from the environment: -version, since
+// SCANNER_VERSION often holds a version number for other tools, which is not a bool and would fail
+// every run.
+var commandLineOnlyFlags = map[string]bool{
+	"version": true,
+}
+
+// envName returns the environment variable for the named flag, e.g. skip-merges becomes SCANNER_SKIP_MERGES.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// isFlagSet reports whether the named flag was given on the command line.
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+
+	return set
+}
+
+// applyEnv sets every flag in fs that was not given on the command line from its environment variable.
+// Flags given on the command line take precedence over the environment, and hidden test-only flags
+// and command line only flags are never set from it.
+func applyEnv(fs *flag.FlagSet) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || isFlagSet(fs, f.Name) || hiddenFlags[f.Name] || commandLineOnlyFlags[f.Name] {
+			return
+		}
+
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok {
+			return
+		}
+
+		if setErr := fs.Set(f.Name, value); setErr != nil {
+			if sensitiveFlags[f.Name] {
+				err = fmt.Errorf("invalid value for %s", envName(f.Name))
+			} else {
+				err = fmt.Errorf("invalid value for %s: %v", envName(f.Name), setErr)
+			}
+		}
+	})
+
+	return err
+}
+
+// stringList is a flag that may be repeated, each value optionally holding several comma separated entries.
+type stringList []string
+
+// String returns the entries joined by commas.
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Set appends the comma separated entries in value.
+func (l *stringList) Set(value string) error {
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			*l = append(*l, entry)
+		}
+	}
+
+	return nil
+}
+
+// argList is a command line flag holding arguments, separated by whitespace without any shell
+// quoting, that may be repeated.
+type argList []string
+
+// String returns the arguments joined by spaces.
+func (l *argList) String() string {
+	return strings.Join(*l, " ")
+}
+
+// Set appends the whitespace separated arguments in value.
+func (l *argList) Set(value string) error {
+	*l = append(*l, strings.Fields(value)...)
+	return nil
+}
+
+// Duration is a time.Duration encoded in JSON as a string such as "5s".
+type Duration time.Duration
+
+// MarshalJSON encodes the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON decodes a duration string such as "1m30s".
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"5s\": %v", err)
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+
+	return nil
+}
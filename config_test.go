@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// testFlagSet returns a flag set with a string, int and bool flag, and the token flag.
+func testFlagSet() (*flag.FlagSet, *string, *int, *bool, *string) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	region := fs.String("region", defaultRegion, "")
+	concurrency := fs.Int("concurrency", defaultConcurrency, "")
+	skipMerges := fs.Bool("skip-merges", false, "")
+	token := fs.String("token", "", "")
+
+	return fs, region, concurrency, skipMerges, token
+}
+
+func TestEnvName(t *testing.T) {
+	if got := envName("skip-merges"); got != "SCANNER_SKIP_MERGES" {
+		t.Errorf("envName(skip-merges) = %q", got)
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	t.Setenv("SCANNER_REGION", "eu-west-1")
+	t.Setenv("SCANNER_CONCURRENCY", "3")
+	t.Setenv("SCANNER_SKIP_MERGES", "true")
+	t.Setenv("SCANNER_TOKEN", "env-token")
+
+	fs, region, concurrency, skipMerges, token := testFlagSet()
+	if err := fs.Parse([]string{"-region", "us-east-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyEnv(fs); err != nil {
+		t.Fatal(err)
+	}
+
+	// The flag given on the command line wins over its environment variable
+	if *region != "us-east-1" {
+		t.Errorf("region = %q, want the flag value us-east-1", *region)
+	}
+	if *concurrency != 3 || !*skipMerges || *token != "env-token" {
+		t.Errorf("concurrency %d, skip-merges %v, token %q not set from the environment", *concurrency, *skipMerges, *token)
+	}
+}
+
+func TestApplyEnvInvalidValues(t *testing.T) {
+	t.Setenv("SCANNER_CONCURRENCY", "many")
+	fs, _, _, _, _ := testFlagSet()
+	fs.Parse(nil)
+	if err := applyEnv(fs); err == nil || !strings.Contains(err.Error(), "SCANNER_CONCURRENCY") {
+		t.Errorf("got %v, want an error naming SCANNER_CONCURRENCY", err)
+	}
+}
+
+func TestApplyEnvIgnoresVersion(t *testing.T) {
+	// A version number in SCANNER_VERSION, as build environments set, is not taken for -version
+	t.Setenv("SCANNER_VERSION", "1.2.3")
+	fs, _, _, _, _ := testFlagSet()
+	version := fs.Bool("version", false, "")
+	fs.Parse(nil)
+
+	if err := applyEnv(fs); err != nil || *version {
+		t.Errorf("got %v with version %v, want SCANNER_VERSION ignored", err, *version)
+	}
+}
+
+func TestApplyEnvNeverEchoesSensitiveValues(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int("token", 0, "")
+	t.Setenv("SCANNER_TOKEN", "ghp_secretvalue")
+	fs.Parse(nil)
+
+	err := applyEnv(fs)
+	if err == nil {
+		t.Fatal("invalid token accepted")
+	}
+	if strings.Contains(err.Error(), "ghp_secretvalue") {
+		t.Errorf("error echoes the token: %v", err)
+	}
+}
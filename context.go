@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// ContextLine is a line around a finding, with every secret found by the scan redacted.
+type ContextLine struct {
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// contentSource returns the content of the file a finding is in, or nil when it is not available.
+type contentSource func(f Finding) ([]byte, error)
+
+// addContext sets the n lines before and after every finding as its context, reading each file once
+// from source. Findings whose content cannot be read, and notebook findings whose lines are within a
+// cell, are left without context.
+func addContext(findings []Finding, n int, source contentSource) error {
+	if n <= 0 {
+		return nil
+	}
+
+	// Secrets are redacted from context lines, including those of other findings on the same lines,
+	// the way they are scrubbed from logs
+	redactor := &scrubber{secrets: make(map[string]int)}
+	for _, f := range findings {
+		redactor.add(f.SecretAccessKey, f.encoded)
+	}
+
+	type fileKey struct{ commit, file string }
+	files := make(map[fileKey][]string)
+	for i := range findings {
+		f := &findings[i]
+		if f.Cell > 0 {
+			continue
+		}
+
+		key := fileKey{f.Commit, f.File}
+		lines, ok := files[key]
+		if !ok {
+			content, err := source(*f)
+			if err != nil {
+				return err
+			}
+			// Findings in binary files, such as documents, have no lines to show
+			if !looksBinary(content) {
+				lines = strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+			}
+			files[key] = lines
+		}
+
+		f.Context = contextLines(lines, f.Line, n, redactor)
+	}
+
+	return nil
+}
+
+// contextLines returns the lines from n lines before line to n lines after it, clipped to the start
+// and end of the file.
+func contextLines(lines []string, line, n int, redactor *scrubber) []ContextLine {
+	if line < 1 || line > len(lines) {
+		return nil
+	}
+
+	first, last := line-n, line+n
+	if first < 1 {
+		first = 1
+	}
+	if last > len(lines) {
+		last = len(lines)
+	}
+
+	var context []ContextLine
+	for i := first; i <= last; i++ {
+		context = append(context, ContextLine{Line: i, Text: redactor.scrub(strings.TrimSuffix(lines[i-1], "\r"))})
+	}
+
+	return context
+}
+
+// gitContentSource reads the content of findings from the objects of the repository at the given
+// path: the file at its commit, or the blob itself for dangling blobs. Notes have no file to read.
+// Symlinks in the commit's tree are resolved, so files found under a followed symlink have context.
+func gitContentSource(repoPath string) contentSource {
+	return func(f Finding) ([]byte, error) {
+		switch f.Source {
+		case sourceNotes:
+			return nil, nil
+		case sourceDangling:
+			cmd := exec.Command("git", "cat-file", "-p", f.File)
+			cmd.Dir = repoPath
+			output, err := cmd.Output()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s for context: %w", f.File, commandError(err))
+			}
+			return output, nil
+		}
+
+		object := f.Commit + ":" + f.File
+		cmd := exec.Command("git", "cat-file", "--batch", "--follow-symlinks")
+		cmd.Dir = repoPath
+		cmd.Stdin = strings.NewReader(object + "\n")
+		output, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s for context: %w", object, commandError(err))
+		}
+
+		// The content follows a "<hash> blob <size>" header, which is replaced by a reason such as
+		// "missing" when the path does not resolve to a blob inside the tree
+		header, content, _ := strings.Cut(string(output), "\n")
+		fields := strings.Fields(header)
+		if len(fields) != 3 || fields[1] != "blob" {
+			return nil, nil
+		}
+		size, err := strconv.Atoi(fields[2])
+		if err != nil || size > len(content) {
+			return nil, fmt.Errorf("failed to read %s for context: unexpected output of git cat-file", object)
+		}
+
+		return []byte(content[:size]), nil
+	}
+}
+
+// printContext prints the context lines of the finding under it, marking the line of the match.
+func printContext(f Finding) {
+	for _, line := range f.Context {
+		marker := " "
+		if line.Line == f.Line {
+			marker = ">"
+		}
+		fmt.Printf("  %s %5d | %s\n", marker, line.Line, line.Text)
+	}
+}
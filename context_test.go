@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// contextFixture returns a 9 line file holding the key pair at the given 1-based line.
+func contextFixture(line int) string {
+	var lines []string
+	for i := 1; i <= 9; i++ {
+		if i == line {
+			lines = append(lines, "AWS_ACCESS_KEY_ID="+testAccessKeyID+" AWS_SECRET_ACCESS_KEY="+testSecretAccessKey)
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func TestScanFileContext(t *testing.T) {
+	redacted := "AWS_ACCESS_KEY_ID=" + testAccessKeyID + " AWS_SECRET_ACCESS_KEY=" + redact(testSecretAccessKey)
+	tests := []struct {
+		name string
+		line int
+		want []ContextLine
+	}{
+		{"middle", 5, []ContextLine{{3, "line 3"}, {4, "line 4"}, {5, redacted}, {6, "line 6"}, {7, "line 7"}}},
+		{"first line", 1, []ContextLine{{1, redacted}, {2, "line 2"}, {3, "line 3"}}},
+		{"second line", 2, []ContextLine{{1, "line 1"}, {2, redacted}, {3, "line 3"}, {4, "line 4"}}},
+		{"last line", 9, []ContextLine{{7, "line 7"}, {8, "line 8"}, {9, redacted}}},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "creds.env")
+		if err := ioutil.WriteFile(path, []byte(contextFixture(tt.line)), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := ScanFile(context.Background(), path, ScanOptions{NoValidate: true, Context: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Findings) != 1 {
+			t.Fatalf("%s: got %d findings, want 1", tt.name, len(result.Findings))
+		}
+		if got := result.Findings[0].Context; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got context %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestScanContextDefaultsToNone(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("add key", map[string]string{"config.env": contextFixture(5)})
+
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Findings) != 1 || result.Findings[0].Context != nil {
+		t.Errorf("got findings %+v, want one without context", result.Findings)
+	}
+
+	result, err = Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true, Context: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ContextLine{{4, "line 4"}, {5, "AWS_ACCESS_KEY_ID=" + testAccessKeyID + " AWS_SECRET_ACCESS_KEY=" + redact(testSecretAccessKey)}, {6, "line 6"}}
+	if len(result.Findings) != 1 || !reflect.DeepEqual(result.Findings[0].Context, want) {
+		t.Errorf("got findings %+v, want context %+v", result.Findings, want)
+	}
+}
+
+func TestContextLinesOutOfRange(t *testing.T) {
+	lines := []string{"a", "b"}
+	for _, line := range []int{0, 3} {
+		if got := contextLines(lines, line, 1, &scrubber{secrets: make(map[string]int)}); got != nil {
+			t.Errorf("line %d: got %+v, want no context", line, got)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// iniSectionPattern matches the section header of an AWS credentials or config file, e.g. [default].
+var iniSectionPattern = regexp.MustCompile(`^\s*\[([^\]]+)\]\s*$`)
+
+// iniKeyPattern matches a key = value line of an INI file.
+var iniKeyPattern = regexp.MustCompile(`^\s*([A-Za-z_]+)\s*=\s*(\S+)\s*$`)
+
+// searchCredentialsINI pairs the access key ID and secret of every section of an AWS credentials or
+// config file, e.g. ~/.aws/credentials with [default] and [ci] profiles, where the labelled rule
+// would pair every ID with the last secret of the file. IDs of sections without a secret are reported
+// on their own. It reports false when no section holds an access key ID.
+func searchCredentialsINI(content []byte) ([]keyMatch, bool) {
+	type section struct {
+		accessKeyID, secretAccessKey string
+		line                         int
+	}
+
+	var sections []section
+	for i, line := range strings.Split(string(content), "\n") {
+		if iniSectionPattern.MatchString(line) {
+			sections = append(sections, section{})
+			continue
+		}
+		m := iniKeyPattern.FindStringSubmatch(line)
+		if m == nil || len(sections) == 0 {
+			continue
+		}
+
+		current := &sections[len(sections)-1]
+		switch strings.ToLower(m[1]) {
+		case "aws_access_key_id":
+			current.accessKeyID, current.line = m[2], i+1
+		case "aws_secret_access_key":
+			current.secretAccessKey = m[2]
+		}
+	}
+
+	var matches []keyMatch
+	for _, s := range sections {
+		if s.accessKeyID != "" {
+			matches = append(matches, keyMatch{AccessKeyID: s.accessKeyID, SecretAccessKey: s.secretAccessKey, Rule: ruleAWSLabelled, Line: s.line})
+		}
+	}
+
+	return normalizeMatches(matches), len(matches) > 0
+}
+
+// orphanSecret is a secret found in a file without any access key ID.
+type orphanSecret struct {
+	file, secret string
+}
+
+// pairAcrossFiles pairs an access key ID found without a secret with the secret of a sibling file in
+// the same directory, such as separate id and secret files or a credentials file holding only the
+// secret. Pairs are only formed when a directory holds exactly one such ID and one such secret, so
+// keys are never paired by guesswork. found maps the absolute paths of the files under repoPath to
+// their matches, and scanned lists every file that was searched.
+func pairAcrossFiles(repoPath string, found map[string][]keyMatch, scanned []string, rules *ruleSet) error {
+	type orphanID struct {
+		path  string
+		index int
+	}
+
+	// Long-term access key IDs without a secret, by directory
+	orphanIDs := make(map[string][]orphanID)
+	for path, matches := range found {
+		for i, match := range matches {
+			if match.AccessKeyID != "" && match.SecretAccessKey == "" && classifyKeyType(match.AccessKeyID).validationStrategy() == validateIAM {
+				orphanIDs[filepath.Dir(path)] = append(orphanIDs[filepath.Dir(path)], orphanID{path, i})
+			}
+		}
+	}
+	if len(orphanIDs) == 0 {
+		return nil
+	}
+
+	// Secrets of the sibling files that hold no access key ID at all
+	secrets := make(map[string][]orphanSecret)
+	for _, path := range scanned {
+		dir := filepath.Dir(path)
+		if len(orphanIDs[dir]) != 1 || hasAccessKeyID(found[path]) {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read file: %v", err)
+		}
+		for _, secret := range findOrphanSecrets(content, rules.labelledSecretPattern()) {
+			secrets[dir] = append(secrets[dir], orphanSecret{file: path, secret: secret})
+		}
+	}
+
+	for dir, ids := range orphanIDs {
+		if len(ids) != 1 || len(secrets[dir]) != 1 {
+			continue
+		}
+
+		secret := secrets[dir][0]
+		relPath, err := filepath.Rel(repoPath, secret.file)
+		if err != nil {
+			relPath = secret.file
+		}
+		match := &found[ids[0].path][ids[0].index]
+		match.SecretAccessKey = secret.secret
+		match.SecretFile = filepath.ToSlash(relPath)
+	}
+
+	return nil
+}
+
+// hasAccessKeyID reports whether any of the matches holds an access key ID.
+func hasAccessKeyID(matches []keyMatch) bool {
+	for _, match := range matches {
+		if match.AccessKeyID != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findOrphanSecrets returns the unique secret access keys of a file without access key IDs: the
+// values of secret labels, and the whole content when it is nothing but a secret.
+func findOrphanSecrets(content []byte, secretPattern *regexp.Regexp) []string {
+	seen := make(map[string]bool)
+	if secretPattern != nil {
+		for _, m := range secretPattern.FindAllSubmatch(content, -1) {
+			seen[normalizeKey(string(m[2]))] = true
+		}
+	}
+	if value := string(bytes.TrimSpace(content)); secretAccessKeyShape.MatchString(value) {
+		seen[value] = true
+	}
+	delete(seen, "")
+
+	var secrets []string
+	for secret := range seen {
+		secrets = append(secrets, secret)
+	}
+	sort.Strings(secrets)
+
+	return secrets
+}
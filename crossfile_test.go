@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// credentialsINI is an AWS credentials file with two profiles, where the labelled rule alone would
+// pair both IDs with the secret of the last profile.
+const credentialsINI = "[default]\naws_access_key_id = " + testAccessKeyID + "\naws_secret_access_key = " + testSecretAccessKey + "\n\n" +
+	"[ci]\nregion = us-east-1\naws_access_key_id=" + testAccessKeyID2 + "\naws_secret_access_key=" + testSecretAccessKey2 + "\n"
+
+func TestSearchCredentialsINI(t *testing.T) {
+	matches, ok := searchCredentialsINI([]byte(credentialsINI))
+	if !ok {
+		t.Fatal("got no sections with access keys, want two")
+	}
+
+	want := []keyMatch{
+		{AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey, Rule: ruleAWSLabelled, Line: 2},
+		{AccessKeyID: testAccessKeyID2, SecretAccessKey: testSecretAccessKey2, Rule: ruleAWSLabelled, Line: 7},
+	}
+	if !reflect.DeepEqual(matches, want) {
+		t.Errorf("got %+v, want %+v", matches, want)
+	}
+
+	if _, ok := searchCredentialsINI([]byte(keyFile(testAccessKeyID, testSecretAccessKey))); ok {
+		t.Error("got a file without sections searched as a credentials file")
+	}
+}
+
+func TestScanCredentialsINIValidatesEachPair(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	if err := ioutil.WriteFile(path, []byte(credentialsINI), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	stub := newSTSStub(t, testAccessKeyID, testAccessKeyID2)
+
+	result, err := ScanFile(context.Background(), path, ScanOptions{AWSEndpoint: stub.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both keys are only live with the secret of their own profile
+	secrets := make(map[string]string)
+	for _, f := range result.Findings {
+		if f.Status != statusValid {
+			t.Errorf("got finding %+v, want it valid", f)
+		}
+		secrets[f.AccessKeyID] = f.SecretAccessKey
+	}
+	want := map[string]string{testAccessKeyID: testSecretAccessKey, testAccessKeyID2: testSecretAccessKey2}
+	if !reflect.DeepEqual(secrets, want) {
+		t.Errorf("got pairs %v, want %v", secrets, want)
+	}
+}
+
+func TestScanPairAcrossFiles(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("split key", map[string]string{
+		"deploy/id":         "aws_access_key_id: " + testAccessKeyID + "\n",
+		"deploy/secret":     testSecretAccessKey + "\n",
+		"other/id":          "aws_access_key_id: " + testAccessKeyID2 + "\n",
+		"other/secret.txt":  "aws_secret_access_key: " + testSecretAccessKey + "\n",
+		"other/secret2.txt": "aws_secret_access_key: " + testSecretAccessKey2 + "\n",
+	})
+	stub := newSTSStub(t, testAccessKeyID)
+
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, AWSEndpoint: stub.URL, PairAcrossFiles: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byFile := make(map[string]Finding)
+	for _, f := range result.Findings {
+		if f.AccessKeyID != "" {
+			byFile[f.File] = f
+		}
+	}
+	if f := byFile["deploy/id"]; f.SecretAccessKey != testSecretAccessKey || f.SecretFile != "deploy/secret" || f.Status != statusValid {
+		t.Errorf("got finding %+v, want the ID paired with deploy/secret and validated", f)
+	}
+	// A directory with two candidate secrets is left unpaired rather than guessed
+	if f := byFile["other/id"]; f.SecretAccessKey != "" || f.SecretFile != "" {
+		t.Errorf("got finding %+v, want it left without a secret", f)
+	}
+}
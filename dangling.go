@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// sourceDangling tags findings in blobs that no commit, branch or tag references.
+const sourceDangling = "dangling"
+
+// findDanglingBlobs returns the hashes of blobs in the repository that are not reachable from any ref.
+func findDanglingBlobs(repoPath string) ([]string, error) {
+	cmd := exec.Command("git", "fsck", "--unreachable", "--no-reflogs", "--no-progress")
+	cmd.Dir = repoPath
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unreachable objects: %w", commandError(err))
+	}
+
+	// Each line looks like "unreachable blob <hash>"
+	var hashes []string
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 3 && fields[0] == "unreachable" && fields[1] == "blob" {
+			hashes = append(hashes, fields[2])
+		}
+	}
+
+	return hashes, nil
+}
+
+// searchDanglingBlobs searches every unreachable blob in the repository for AWS IAM keys.
+// Oversize and binary blobs are skipped and counted in stats like files are.
+func searchDanglingBlobs(repoPath string, opts walkOptions, stats *ScanStats) ([]Finding, error) {
+	hashes, err := findDanglingBlobs(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+
+	reader, err := newCatFile(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var findings []Finding
+	for _, hash := range hashes {
+		blob, err := reader.read(hash, opts.MaxFileSize)
+		if err != nil {
+			return nil, err
+		}
+
+		stats.FilesSeen++
+		if opts.MaxFileSize > 0 && blob.Size > opts.MaxFileSize {
+			stats.SkippedOversize++
+			continue
+		}
+		if looksBinary(blob.Content) {
+			stats.SkippedBinary++
+			continue
+		}
+		if !opts.ScanGenerated && looksGenerated(hash, blob.Content) {
+			stats.SkippedGenerated++
+			continue
+		}
+		stats.FilesScanned++
+
+		for _, match := range searchIAMKeys(blob.Content, opts.Rules) {
+			finding := newFinding("", hash, match)
+			finding.Source = sourceDangling
+			findings = append(findings, finding)
+		}
+	}
+
+	return findings, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// danglingFixture returns a repository with a key only in a blob no commit references, and its hash.
+func danglingFixture(t *testing.T) (*fixtureRepo, string) {
+	repo := newFixtureRepo(t)
+	repo.commit("clean", map[string]string{"README.md": "clean\n"})
+
+	path := filepath.Join(t.TempDir(), "orphan.env")
+	if err := ioutil.WriteFile(path, []byte(keyFile(testAccessKeyID, testSecretAccessKey)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return repo, repo.git("hash-object", "-w", path)
+}
+
+func TestSearchDanglingBlobs(t *testing.T) {
+	repo, hash := danglingFixture(t)
+	walk, err := ScanOptions{}.walkOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stats ScanStats
+	findings, err := searchDanglingBlobs(repo.dir, walk, &stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 {
+		t.Fatalf("got %d findings, want 1", len(findings))
+	}
+	if f := findings[0]; f.Source != sourceDangling || f.File != hash || f.Commit != "" || f.AccessKeyID != testAccessKeyID {
+		t.Errorf("unexpected finding %+v", f)
+	}
+}
+
+func TestScanDangling(t *testing.T) {
+	repo, _ := danglingFixture(t)
+
+	for _, dangling := range []bool{false, true} {
+		result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true, Dangling: dangling})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := 0
+		if dangling {
+			want = 1
+		}
+		if len(result.Findings) != want {
+			t.Errorf("dangling %v: got %d findings, want %d", dangling, len(result.Findings), want)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// addedLines holds the lines a commit added to one file, with their line numbers in the new version.
+type addedLines struct {
+	path    string
+	lines   []string
+	numbers []int
+}
+
+// getAddedLines returns the lines each file gained in the given commit. Whitespace-only changes are
+// ignored, so reformatting a file does not count as adding its content again. With followRenames, a
+// renamed file only gains the lines that changed, rather than all of its content under the new path. A
+// non-empty subpath limits the diff to the files under it.
+func getAddedLines(repoPath, commitHash, subpath string, followRenames bool) ([]addedLines, error) {
+	args := []string{"diff-tree", "-p", "-w", "--root", "--no-commit-id", "--no-color", "--unified=0"}
+	if followRenames {
+		args = append(args, "--find-renames")
+	}
+	args = append(args, commitHash)
+	if subpath != "" {
+		args = append(args, "--", subpath)
+	}
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = repoPath
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff commit %s: %w", commitHash, commandError(err))
+	}
+
+	return parseAddedLines(output), nil
+}
+
+// parseDiffRange splits a base..head range into its two revisions.
+func parseDiffRange(diffRange string) (string, string, error) {
+	base, head, ok := strings.Cut(diffRange, "..")
+	if !ok || base == "" || head == "" || strings.HasPrefix(head, ".") {
+		return "", "", fmt.Errorf("invalid diff range %q: must be base..head", diffRange)
+	}
+
+	return base, head, nil
+}
+
+// resolveCommit returns the hash of the commit the revision names in the repository at the given
+// path, fetching it from origin when the clone does not have it, e.g. the head of a pull request.
+func resolveCommit(repoPath, rev string) (string, error) {
+	if !commitExists(repoPath, rev) {
+		cmd := exec.Command("git", "fetch", "-q", "origin", rev)
+		cmd.Dir = repoPath
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("failed to fetch %s: %w. Output: %s", rev, commandError(err), string(output))
+		}
+		rev = "FETCH_HEAD"
+	}
+
+	cmd := exec.Command("git", "rev-parse", "--verify", rev+"^{commit}")
+	cmd.Dir = repoPath
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w. Output: %s", rev, commandError(err), string(output))
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// parseAddedLines extracts the added lines from a unified diff with zero context lines.
+func parseAddedLines(diff []byte) []addedLines {
+	var files []addedLines
+	var current *addedLines
+	next := 0
+
+	scanner := bufio.NewScanner(bytes.NewReader(diff))
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			current = nil
+		case strings.HasPrefix(line, "+++ "):
+			path := diffPath(strings.TrimPrefix(line, "+++ "))
+			if path == "" {
+				current = nil
+				continue
+			}
+			files = append(files, addedLines{path: path})
+			current = &files[len(files)-1]
+		case strings.HasPrefix(line, "@@ "):
+			next = hunkStart(line)
+		case current != nil && strings.HasPrefix(line, "+"):
+			current.lines = append(current.lines, line[1:])
+			current.numbers = append(current.numbers, next)
+			next++
+		}
+	}
+
+	// Drop files that only had lines removed
+	var nonEmpty []addedLines
+	for _, file := range files {
+		if len(file.lines) > 0 {
+			nonEmpty = append(nonEmpty, file)
+		}
+	}
+
+	return nonEmpty
+}
+
+// diffPath returns the repository path from the new side of a diff header, or "" for deleted files.
+func diffPath(header string) string {
+	if header == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(header, `"`) {
+		if unquoted, err := strconv.Unquote(header); err == nil {
+			header = unquoted
+		}
+	}
+
+	return strings.TrimPrefix(header, "b/")
+}
+
+// hunkStart returns the first new line number of a hunk header such as "@@ -3,0 +4,2 @@".
+func hunkStart(header string) int {
+	fields := strings.Fields(header)
+	if len(fields) < 3 || !strings.HasPrefix(fields[2], "+") {
+		return 0
+	}
+
+	start := strings.SplitN(strings.TrimPrefix(fields[2], "+"), ",", 2)[0]
+	n, err := strconv.Atoi(start)
+	if err != nil {
+		return 0
+	}
+
+	return n
+}
+
+// searchCommitDiff searches only the lines the commit added for AWS IAM keys. Excluded paths and
+// generated files are skipped and every changed file is counted in stats.
+func searchCommitDiff(repoPath, commitHash string, opts walkOptions, stats *ScanStats) ([]Finding, error) {
+	files, err := getAddedLines(repoPath, commitHash, opts.Subpath, opts.FollowRenames)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for _, file := range files {
+		stats.FilesSeen++
+		if matchAnyGlob(opts.Exclude, file.path) {
+			stats.SkippedExcluded++
+			continue
+		}
+
+		// Search the added lines as one piece of content so labelled pairs on adjacent lines still match
+		content := []byte(strings.Join(file.lines, "\n"))
+		if !opts.ScanGenerated && looksGenerated(file.path, content) {
+			stats.SkippedGenerated++
+			continue
+		}
+		stats.FilesScanned++
+		if matchAnyGlob(opts.AllowPath, file.path) {
+			stats.FilesAllowed++
+		}
+
+		for _, match := range opts.Rules.searchFile(file.path, content) {
+			if match.Line >= 1 && match.Line <= len(file.numbers) {
+				match.Line = file.numbers[match.Line-1]
+			}
+			findings = append(findings, newFinding(commitHash, file.path, match))
+		}
+	}
+
+	return findings, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestDiffIgnoresWhitespaceChanges(t *testing.T) {
+	repo := newFixtureRepo(t)
+	added := repo.commit("add key", map[string]string{"config.yml": "aws:\n  access_key_id: " + testAccessKeyID + "\n  secret_access_key: " + testSecretAccessKey + "\n"})
+	reformatted := repo.commit("reformat", map[string]string{"config.yml": "aws:\n    access_key_id:   " + testAccessKeyID + "\n    secret_access_key:   " + testSecretAccessKey + "\n"})
+	repo.commit("add another key", map[string]string{"other.env": keyFile(testAccessKeyID2, testSecretAccessKey2)})
+
+	walk, err := ScanOptions{}.walkOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	findings, err := searchCommitDiff(repo.dir, reformatted, walk, &ScanStats{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 0 {
+		t.Errorf("whitespace-only commit: got %+v, want no findings", findings)
+	}
+
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true, Diff: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	commits := make(map[string]string)
+	for _, f := range result.Findings {
+		commits[f.AccessKeyID] = f.Commit
+	}
+	if len(result.Findings) != 2 || commits[testAccessKeyID] != added || commits[testAccessKeyID2] == "" {
+		t.Errorf("got %+v, want each key only in the commit adding it", result.Findings)
+	}
+}
+
+func TestParseAddedLines(t *testing.T) {
+	diff := []byte("diff --git a/a.txt b/a.txt\n--- a/a.txt\n+++ b/a.txt\n@@ -2 +2,2 @@ header\n-removed\n+added one\n+added two\n@@ -10 +11 @@\n+later\n" +
+		"diff --git a/gone.txt b/gone.txt\n--- a/gone.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-gone\n")
+
+	files := parseAddedLines(diff)
+	if len(files) != 1 || files[0].path != "a.txt" {
+		t.Fatalf("got %+v, want only the lines of a.txt", files)
+	}
+	if fmt.Sprint(files[0].lines) != "[added one added two later]" || fmt.Sprint(files[0].numbers) != "[2 3 11]" {
+		t.Errorf("got lines %q at %v, want the three added lines at [2 3 11]", files[0].lines, files[0].numbers)
+	}
+}
+
+func TestScanDiffRange(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("add old key", map[string]string{"old.env": keyFile(testAccessKeyID2, testSecretAccessKey2)})
+	base := repo.commit("readme", map[string]string{"README.md": "hello\n"})
+
+	// The pull request adds a key and edits the file holding the old one
+	repo.git("checkout", "-q", "-b", "pr")
+	added := repo.commit("add key", map[string]string{"new.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+	head := repo.commit("edit old file", map[string]string{"old.env": keyFile(testAccessKeyID2, testSecretAccessKey2) + "AWS_REGION=us-east-1\n"})
+	repo.git("checkout", "-q", "main")
+
+	// The head of the pull request is not a branch of the clone, so it is fetched
+	for _, diffRange := range []string{"main..pr", base + ".." + head} {
+		result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true, DiffRange: diffRange})
+		if err != nil {
+			t.Fatalf("%s: %v", diffRange, err)
+		}
+		if len(result.Findings) != 1 || result.Findings[0].AccessKeyID != testAccessKeyID || result.Findings[0].Commit != added {
+			t.Errorf("%s: got findings %+v, want only the key added in %s", diffRange, result.Findings, added)
+		}
+		if result.Commits != 2 {
+			t.Errorf("%s: scanned %d commits, want the 2 of the pull request", diffRange, result.Commits)
+		}
+	}
+}
+
+func TestParseDiffRange(t *testing.T) {
+	if base, head, err := parseDiffRange("origin/main..abc123"); err != nil || base != "origin/main" || head != "abc123" {
+		t.Errorf("got %q, %q, %v, want origin/main and abc123", base, head, err)
+	}
+	for _, diffRange := range []string{"main", "..pr", "main..", "main...pr"} {
+		if _, _, err := parseDiffRange(diffRange); err == nil {
+			t.Errorf("diff range %q accepted", diffRange)
+		}
+	}
+
+	if _, err := (ScanOptions{DiffRange: "main..pr", TipOnly: true}).historyOptions(); err == nil {
+		t.Error("diff range with tip-only accepted")
+	}
+}
+
+func TestScanFollowRenames(t *testing.T) {
+	repo := newFixtureRepo(t)
+	content := "# deploy credentials\nREGION=us-east-1\nBUCKET=artifacts\n" + keyFile(testAccessKeyID, testSecretAccessKey)
+	added := repo.commit("add key", map[string]string{"config.env": content})
+	repo.git("mv", "config.env", "deploy.env")
+	repo.commit("rename", map[string]string{"deploy.env": content + "TIMEOUT=30\n"})
+
+	tests := []struct {
+		followRenames bool
+		files         []string
+	}{
+		{false, []string{"config.env", "deploy.env"}},
+		{true, []string{"config.env"}},
+	}
+
+	for _, tt := range tests {
+		result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true, Diff: true, FollowRenames: tt.followRenames})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var files []string
+		for _, f := range result.Findings {
+			files = append(files, f.File)
+		}
+		sort.Strings(files)
+		if !reflect.DeepEqual(files, tt.files) {
+			t.Errorf("follow renames %v: got findings in %v, want %v", tt.followRenames, files, tt.files)
+		}
+		if tt.followRenames && (len(result.Findings) != 1 || result.Findings[0].Commit != added) {
+			t.Errorf("got findings %+v, want the key only in the commit adding it", result.Findings)
+		}
+	}
+}
+
+func TestFollowRenamesRequiresDiff(t *testing.T) {
+	if _, err := (ScanOptions{FollowRenames: true}).historyOptions(); err == nil {
+		t.Error("got no error, want follow-renames to require diff or diff-range")
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+)
+
+// doctorTimeout bounds each doctor check that talks to the network.
+const doctorTimeout = 5 * time.Second
+
+// doctorCheck is a single environment check run by the doctor subcommand. run returns a short
+// description of what was found, or an error explaining the failure.
+type doctorCheck struct {
+	name string
+	run  func(ctx context.Context) (string, error)
+}
+
+// doctorChecks returns the checks run by the doctor subcommand for the given scan options.
+func doctorChecks(opts ScanOptions) []doctorCheck {
+	return []doctorCheck{
+		{"git", checkGit},
+		{"aws credentials", func(ctx context.Context) (string, error) {
+			return checkAWSCredentials(ctx, opts)
+		}},
+		{"aws network", func(ctx context.Context) (string, error) {
+			return checkAWSNetwork(ctx, opts)
+		}},
+		{"temp dir", func(ctx context.Context) (string, error) {
+			dir, err := checkTempDir(opts.TmpDir)
+			if err != nil {
+				return "", err
+			}
+			return dir + " is writable", nil
+		}},
+	}
+}
+
+// checkGit reports the installed git version.
+func checkGit(ctx context.Context) (string, error) {
+	output, err := exec.CommandContext(ctx, "git", "--version").CombinedOutput()
+	if err != nil {
+		var gitNotFound *GitNotFoundError
+		if errors.As(commandError(err), &gitNotFound) {
+			return "", fmt.Errorf("git is not installed or not on the PATH")
+		}
+		return "", fmt.Errorf("failed to run git: %v", err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// checkAWSCredentials reports whether credentials to call AWS with can be resolved, when the validation
+// method needs them.
+func checkAWSCredentials(ctx context.Context, opts ScanOptions) (string, error) {
+	if opts.ValidationMethod != validationMethodIAM {
+		if err := opts.awsValidator().(availabilityChecker).Available(ctx); err != nil {
+			return "", err
+		}
+		return "not needed, keys are validated with their own credentials", nil
+	}
+
+	if err := opts.iamValidator().Available(ctx); err != nil {
+		return "", fmt.Errorf("no usable AWS credentials, keys will be reported as unverified: %v", err)
+	}
+
+	return "credentials resolved", nil
+}
+
+// checkAWSNetwork reports whether the AWS endpoint, STS in the configured region and partition by default, can be reached.
+func checkAWSNetwork(ctx context.Context, opts ScanOptions) (string, error) {
+	region, err := opts.awsRegion()
+	if err != nil {
+		return "", err
+	}
+	endpoint, err := endpoints.DefaultResolver().EndpointFor("sts", region, func(o *endpoints.Options) {
+		o.STSRegionalEndpoint = endpoints.RegionalSTSEndpoint
+	})
+	if err != nil {
+		return "", fmt.Errorf("no STS endpoint for region %s: %v", region, err)
+	}
+
+	endpointURL := endpoint.URL
+	if opts.AWSEndpoint != "" {
+		endpointURL = opts.AWSEndpoint
+	}
+	u, err := url.Parse(endpointURL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid AWS endpoint %q", endpointURL)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		port := "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return "", fmt.Errorf("cannot reach %s: %v", addr, err)
+	}
+	conn.Close()
+
+	return "reached " + addr, nil
+}
+
+// runDoctor runs every check, printing a pass or fail line for each, and reports whether all passed.
+func runDoctor(w io.Writer, checks []doctorCheck) bool {
+	ok := true
+	for _, check := range checks {
+		ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+		detail, err := check.run(ctx)
+		cancel()
+
+		if err != nil {
+			ok = false
+			fmt.Fprintf(w, "FAIL  %s: %v\n", check.name, err)
+			continue
+		}
+		fmt.Fprintf(w, "PASS  %s: %s\n", check.name, detail)
+	}
+
+	return ok
+}
+
+// runDoctorCommand parses the doctor subcommand flags and checks the environment the scanner runs in.
+func runDoctorCommand(args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	region := fs.String("region", "", "AWS region whose STS endpoint is checked (default us-west-2, or the default region of -partition)")
+	partition := fs.String("partition", "", "AWS partition whose STS endpoint is checked: aws, aws-us-gov or aws-cn")
+	awsEndpoint := fs.String("aws-endpoint", "", "Custom AWS endpoint URL to check instead of STS")
+	validationMethod := fs.String("validation-method", validationMethodSTS, "Validation method whose credentials are checked: sts or iam")
+	awsProfile := fs.String("aws-profile", "", "Shared config profile whose credentials are checked with -validation-method iam")
+	awsAssumeRoleARN := fs.String("aws-assume-role-arn", "", "Role whose assumed credentials are checked")
+	tmpDir := fs.String("tmp-dir", "", "Directory whose writability is checked instead of the system temporary directory")
+	fs.Parse(args)
+
+	if err := applyEnv(fs); err != nil {
+		log.Fatal(err)
+	}
+
+	if !runDoctor(os.Stdout, doctorChecks(ScanOptions{
+		Region:           *region,
+		Partition:        *partition,
+		AWSEndpoint:      *awsEndpoint,
+		ValidationMethod: *validationMethod,
+		AWSProfile:       *awsProfile,
+		AWSAssumeRoleARN: *awsAssumeRoleARN,
+		TmpDir:           *tmpDir,
+	})) {
+		os.Exit(exitError)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// stubGit puts a git script printing the given version first on the PATH, or leaves git off the PATH
+// entirely when version is empty.
+func stubGit(t *testing.T, version string) {
+	dir := t.TempDir()
+	if version != "" {
+		script := "#!/bin/sh\necho 'git version " + version + "'\n"
+		if err := ioutil.WriteFile(filepath.Join(dir, "git"), []byte(script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir)
+}
+
+func TestDoctorGit(t *testing.T) {
+	tests := []struct {
+		version, want string
+		ok            bool
+	}{
+		{"9.9.9", "PASS  git: git version 9.9.9\n", true},
+		{"", "FAIL  git: git is not installed or not on the PATH\n", false},
+	}
+
+	for _, tt := range tests {
+		stubGit(t, tt.version)
+
+		var out bytes.Buffer
+		ok := runDoctor(&out, []doctorCheck{{"git", checkGit}})
+		if ok != tt.ok || out.String() != tt.want {
+			t.Errorf("git %q: got %v %q, want %v %q", tt.version, ok, out.String(), tt.ok, tt.want)
+		}
+	}
+}
+
+func TestDoctorChecks(t *testing.T) {
+	stub := newSTSStub(t)
+	writable := t.TempDir()
+
+	var out bytes.Buffer
+	ok := runDoctor(&out, doctorChecks(ScanOptions{AWSEndpoint: stub.URL, TmpDir: writable}))
+	if !ok {
+		t.Errorf("checks failed:\n%s", out.String())
+	}
+	for _, want := range []string{"PASS  git: git version", "PASS  aws credentials: not needed", "PASS  aws network: reached 127.0.0.1:", "PASS  temp dir: " + writable} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output does not hold %q:\n%s", want, out.String())
+		}
+	}
+
+	withoutAWSCredentials(t)
+	out.Reset()
+	ok = runDoctor(&out, doctorChecks(ScanOptions{ValidationMethod: validationMethodIAM, AWSEndpoint: "http://127.0.0.1:1", TmpDir: filepath.Join(writable, "missing")}))
+	if ok {
+		t.Errorf("checks passed without credentials, network or temp dir:\n%s", out.String())
+	}
+	for _, want := range []string{"FAIL  aws credentials: no usable AWS credentials", "FAIL  aws network: cannot reach 127.0.0.1:1", "FAIL  temp dir:"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output does not hold %q:\n%s", want, out.String())
+		}
+	}
+}
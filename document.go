@@ -0,0 +1,133 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Magic bytes of the documents whose text is extracted.
+var (
+	pdfMagic = []byte("%PDF-")
+	zipMagic = []byte("PK\x03\x04")
+)
+
+// maxDocumentText bounds how much text and how many decompressed stream bytes are read from one
+// document, since a small compressed document can inflate to far more.
+const maxDocumentText = 64 << 20
+
+// isDocument reports whether the content is a PDF document, or the file a DOCX document.
+func isDocument(path string, content []byte) bool {
+	if bytes.HasPrefix(content, pdfMagic) {
+		return true
+	}
+
+	return strings.EqualFold(filepath.Ext(path), ".docx") && bytes.HasPrefix(content, zipMagic)
+}
+
+// searchDocument runs every rule over the text of a PDF or DOCX document, each page of a PDF or
+// paragraph of a DOCX starting on a line of its own, so labelled keys on separate lines still pair.
+// Matches have the page or paragraph they are in as their line. It returns false when the content
+// cannot be decoded, so it can be searched as is.
+func (rs *ruleSet) searchDocument(content []byte) ([]keyMatch, bool) {
+	var parts []string
+	var ok bool
+	if bytes.HasPrefix(content, pdfMagic) {
+		parts, ok = pdfPages(content)
+	} else {
+		parts, ok = docxParagraphs(content)
+	}
+	if !ok {
+		return nil, false
+	}
+
+	var text strings.Builder
+	var lines []int
+	for i, part := range parts {
+		text.WriteString(part + "\n")
+		for range strings.Split(part, "\n") {
+			lines = append(lines, i+1)
+		}
+	}
+
+	matches := rs.search([]byte(text.String()))
+	for i := range matches {
+		if line := matches[i].Line; line > 0 && line <= len(lines) {
+			matches[i].Line = lines[line-1]
+		}
+	}
+
+	return matches, true
+}
+
+// docxParagraphs returns the text of every paragraph of the body of a DOCX document, which is a zip
+// archive holding it as WordprocessingML in word/document.xml.
+func docxParagraphs(content []byte) ([]string, bool) {
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, false
+	}
+
+	for _, file := range archive.File {
+		if file.Name != "word/document.xml" {
+			continue
+		}
+		r, err := file.Open()
+		if err != nil {
+			return nil, false
+		}
+		defer r.Close()
+
+		return wordParagraphs(io.LimitReader(r, maxDocumentText))
+	}
+
+	return nil, false
+}
+
+// wordParagraphs returns the text of every <w:p> paragraph of WordprocessingML, joining the runs it
+// is split into, which Word does at any formatting or spell checking boundary, even within a word.
+func wordParagraphs(r io.Reader) ([]string, bool) {
+	decoder := xml.NewDecoder(r)
+	var paragraphs []string
+	var paragraph strings.Builder
+	inText := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, false
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				paragraph.WriteString("\t")
+			case "br", "cr":
+				// A break within a paragraph stays on its line, so the paragraph is its line
+				paragraph.WriteString(" ")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				paragraphs = append(paragraphs, paragraph.String())
+				paragraph.Reset()
+			}
+		case xml.CharData:
+			if inText {
+				paragraph.Write(t)
+			}
+		}
+	}
+
+	return paragraphs, true
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// docxFixture returns a DOCX document whose body holds the paragraphs, each split into runs at its
+// spaces the way Word splits text at formatting boundaries.
+func docxFixture(t *testing.T, paragraphs ...string) []byte {
+	t.Helper()
+
+	var body strings.Builder
+	for _, p := range paragraphs {
+		body.WriteString("<w:p>")
+		for i, word := range strings.Split(p, " ") {
+			if i > 0 {
+				word = " " + word
+			}
+			fmt.Fprintf(&body, `<w:r><w:rPr><w:b/></w:rPr><w:t xml:space="preserve">%s</w:t></w:r>`, word)
+		}
+		body.WriteString("</w:p>")
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"[Content_Types].xml": `<?xml version="1.0"?><Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"/>`,
+		"word/document.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` + body.String() + `</w:body></w:document>`,
+	} {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// pdfFixture returns a PDF document with a page for each of the contents, their content streams
+// compressed with FlateDecode and showing every line of the contents with a Tj operator.
+func pdfFixture(t *testing.T, pages ...string) []byte {
+	t.Helper()
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	var kids []string
+	for i := range pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 3+2*i))
+	}
+	fmt.Fprintf(&pdf, "1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	fmt.Fprintf(&pdf, "2 0 obj\n<< /Type /Pages /Kids [%s] /Count %d >>\nendobj\n", strings.Join(kids, " "), len(pages))
+	for i, page := range pages {
+		var stream strings.Builder
+		stream.WriteString("BT /F1 12 Tf 72 720 Td\n")
+		for _, line := range strings.Split(page, "\n") {
+			fmt.Fprintf(&stream, "(%s) Tj 0 -14 Td\n", line)
+		}
+		stream.WriteString("ET\n")
+		var compressed bytes.Buffer
+		w := zlib.NewWriter(&compressed)
+		w.Write([]byte(stream.String()))
+		w.Close()
+
+		fmt.Fprintf(&pdf, "%d 0 obj\n<< /Type /Page /Parent 2 0 R /Contents %d 0 R >>\nendobj\n", 3+2*i, 4+2*i)
+		fmt.Fprintf(&pdf, "%d 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", 4+2*i, compressed.Len())
+		pdf.Write(compressed.Bytes())
+		pdf.WriteString("\nendstream\nendobj\n")
+	}
+	pdf.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+
+	return pdf.Bytes()
+}
+
+func TestDocxParagraphs(t *testing.T) {
+	content := docxFixture(t, "Deploy runbook", "aws_access_key_id = "+testAccessKeyID)
+
+	got, ok := docxParagraphs(content)
+	if !ok {
+		t.Fatal("got the fixture undecodable")
+	}
+	if want := []string{"Deploy runbook", "aws_access_key_id = " + testAccessKeyID}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got paragraphs %q, want %q", got, want)
+	}
+
+	if _, ok := docxParagraphs([]byte("PK\x03\x04 not a zip archive")); ok {
+		t.Error("got a damaged archive decoded")
+	}
+}
+
+func TestPDFPages(t *testing.T) {
+	content := pdfFixture(t, "Onboarding", "Credentials\nkey "+testAccessKeyID)
+
+	got, ok := pdfPages(content)
+	if !ok {
+		t.Fatal("got the fixture undecodable")
+	}
+	if want := []string{"Onboarding\n", "Credentials\nkey " + testAccessKeyID + "\n"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got pages %q, want %q", got, want)
+	}
+
+	if _, ok := pdfPages([]byte("%PDF-1.4\nno objects\n")); ok {
+		t.Error("got a PDF without pages decoded")
+	}
+}
+
+func TestSearchDocumentLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		// line is the page or paragraph of the key pair
+		line int
+	}{
+		{"docx", docxFixture(t, "Deploy runbook", "Use these credentials:", "aws_access_key_id = "+testAccessKeyID, "aws_secret_access_key = "+testSecretAccessKey), 3},
+		{"pdf", pdfFixture(t, "Onboarding", "Credentials\naws_access_key_id = "+testAccessKeyID+"\naws_secret_access_key = "+testSecretAccessKey), 2},
+	}
+
+	rules, err := newRuleSet(nil, ruleSelection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches, ok := rules.searchDocument(tt.content)
+			if !ok {
+				t.Fatal("got the document undecodable")
+			}
+			if len(matches) != 1 || matches[0].AccessKeyID != testAccessKeyID || matches[0].SecretAccessKey != testSecretAccessKey || matches[0].Line != tt.line {
+				t.Errorf("got matches %+v, want the pair at %d", matches, tt.line)
+			}
+		})
+	}
+}
+
+func TestScanDocuments(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("add runbooks", map[string]string{
+		"docs/runbook.docx":   string(docxFixture(t, "Deploy runbook", "aws_access_key_id = "+testAccessKeyID, "aws_secret_access_key = "+testSecretAccessKey)),
+		"docs/onboarding.pdf": string(pdfFixture(t, "Welcome", "aws_access_key_id = "+testAccessKeyID2+"\naws_secret_access_key = "+testSecretAccessKey2)),
+		"docs/unrelated.docx": string(docxFixture(t, "No credentials here")),
+	})
+
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Findings) != 0 || result.Stats.SkippedBinary != 3 {
+		t.Errorf("by default: got findings %+v and %d binary files skipped, want the documents skipped as binary", result.Findings, result.Stats.SkippedBinary)
+	}
+
+	result, err = Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true, Documents: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, f := range result.Findings {
+		got[f.File] = fmt.Sprintf("%s:%d", f.AccessKeyID, f.Line)
+	}
+	want := map[string]string{
+		"docs/runbook.docx":   fmt.Sprintf("%s:2", testAccessKeyID),
+		"docs/onboarding.pdf": fmt.Sprintf("%s:2", testAccessKeyID2),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("with documents: got findings %v, want %v", got, want)
+	}
+}
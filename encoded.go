@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Encodings of the keys found by decoding a token.
+const (
+	encodingBase64 = "base64"
+	encodingHex    = "hex"
+)
+
+// encodedToken matches candidate base64, in the standard or URL alphabet, and hex tokens at least as
+// long as an encoded access key ID: 27 base64, unpadded, or 40 hex characters for its 20 bytes.
+var encodedToken = regexp.MustCompile(`[A-Za-z0-9+/_\-]{27,}={0,2}`)
+
+// Bounds of the tokens that are decoded. Tokens of evenly distributed characters are decoded, while
+// runs such as AAAA... padding are not, and very long tokens, such as embedded images, are left alone.
+// Hex tokens have a lower bound, as the 16 digits of hex encoded text, whose bytes mostly start with
+// the same few digits, hold under 3 bits per character.
+const (
+	minEncodedEntropy = 3.0
+	minHexEntropy     = 2.5
+	maxEncodedToken   = 64 << 10
+)
+
+// searchEncoded decodes every candidate base64 or hex token of the content that decodes to printable
+// text and runs the AWS rules over it, so a key, or a whole .env file, stored encoded is still found.
+// Only the tokens are decoded, never the content around them, which keeps random text from matching.
+// Matches are on the line of their token and record its encoding.
+func (rs *ruleSet) searchEncoded(content []byte) []keyMatch {
+	aws := &ruleSet{}
+	for _, rule := range rs.rules {
+		if rule.Name == ruleAWSLabelled || rule.Name == ruleAWSAccessKeyID {
+			aws.rules = append(aws.rules, rule)
+		}
+	}
+	if len(aws.rules) == 0 {
+		return nil
+	}
+
+	var matches []keyMatch
+	for _, loc := range encodedToken.FindAllIndex(content, -1) {
+		token := string(content[loc[0]:loc[1]])
+		decoded, encoding, ok := decodeToken(token)
+		if !ok {
+			continue
+		}
+
+		line := lineNumber(content, loc[0])
+		for _, match := range aws.search(decoded) {
+			match.Line, match.Encoding, match.Encoded = line, encoding, token
+			matches = append(matches, match)
+		}
+	}
+
+	return matches
+}
+
+// decodeToken decodes a candidate token as hex when it only holds hex digits, and as base64 otherwise.
+// It reports false unless the token has enough entropy and decodes to printable text.
+func decodeToken(token string) ([]byte, string, bool) {
+	if len(token) > maxEncodedToken {
+		return nil, "", false
+	}
+
+	entropy := shannonEntropy(token)
+	if isHex(token) {
+		if entropy < minHexEntropy {
+			return nil, "", false
+		}
+		decoded, err := hex.DecodeString(token)
+		return decoded, encodingHex, err == nil && isPrintableText(decoded)
+	}
+	if entropy < minEncodedEntropy {
+		return nil, "", false
+	}
+
+	trimmed := strings.TrimRight(token, "=")
+	for _, encoding := range []*base64.Encoding{base64.RawStdEncoding, base64.RawURLEncoding} {
+		if decoded, err := encoding.DecodeString(trimmed); err == nil && isPrintableText(decoded) {
+			return decoded, encodingBase64, true
+		}
+	}
+
+	return nil, "", false
+}
+
+// isHex reports whether s is an even number of hex digits.
+func isHex(s string) bool {
+	if len(s)%2 != 0 {
+		return false
+	}
+
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isPrintableText reports whether b only holds printable ASCII and whitespace, as decoded keys and
+// config files do, unlike the bytes other base64 or hex tokens, such as hashes, decode to.
+func isPrintableText(b []byte) bool {
+	for _, c := range b {
+		if (c < ' ' || c > '~') && c != '\t' && c != '\n' && c != '\r' {
+			return false
+		}
+	}
+
+	return len(b) > 0
+}
+
+// shannonEntropy returns the entropy of the characters of s in bits per character.
+func shannonEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	for _, r := range s {
+		counts[r]++
+	}
+
+	var entropy float64
+	for _, count := range counts {
+		p := float64(count) / float64(len(s))
+		entropy -= p * math.Log2(p)
+	}
+
+	return entropy
+}
+
+// encodingNote describes the encoding the finding's key was stored in for console output, when it
+// was found by decoding a token.
+func encodingNote(f Finding) string {
+	if f.Encoding == "" {
+		return ""
+	}
+
+	return " [" + f.Encoding + " encoded]"
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// encodedRules returns the built-in rules decoding base64 and hex tokens.
+func encodedRules(t *testing.T) *ruleSet {
+	t.Helper()
+
+	rules, err := newRuleSet(nil, ruleSelection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules.decodeEncoded = true
+
+	return rules
+}
+
+func TestSearchEncodedKeys(t *testing.T) {
+	envFile := keyFile(testAccessKeyID2, testSecretAccessKey2)
+	tests := []struct {
+		name     string
+		content  string
+		id       string
+		secret   string
+		encoding string
+	}{
+		{"base64 key", "deploy_key: " + base64.StdEncoding.EncodeToString([]byte(testAccessKeyID)) + "\n", testAccessKeyID, "", encodingBase64},
+		{"url base64 key", "token=" + base64.RawURLEncoding.EncodeToString([]byte(testAccessKeyID)) + "\n", testAccessKeyID, "", encodingBase64},
+		{"hex key", "deploy_key: " + hex.EncodeToString([]byte(testAccessKeyID)) + "\n", testAccessKeyID, "", encodingHex},
+		{"upper case hex key", "deploy_key: " + strings.ToUpper(hex.EncodeToString([]byte(testAccessKeyID2))) + "\n", testAccessKeyID2, "", encodingHex},
+		{"base64 env file", "ENV_FILE=" + base64.StdEncoding.EncodeToString([]byte(envFile)) + "\n", testAccessKeyID2, testSecretAccessKey2, encodingBase64},
+	}
+
+	rules := encodedRules(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches := rules.search([]byte("# config\n" + tt.content))
+			if len(matches) != 1 {
+				t.Fatalf("got matches %+v, want 1", matches)
+			}
+			m := matches[0]
+			if m.AccessKeyID != tt.id || m.SecretAccessKey != tt.secret || m.Encoding != tt.encoding || m.Line != 2 || m.Encoded == "" {
+				t.Errorf("got match %+v, want %s %q %s encoded at line 2", m, tt.id, tt.secret, tt.encoding)
+			}
+		})
+	}
+}
+
+func TestSearchEncodedSkipsOtherTokens(t *testing.T) {
+	contents := map[string]string{
+		// A SHA-1 digest decodes to bytes that are not text
+		"digest":  "checksum: da39a3ee5e6b4b0d3255bfef95601890afd80709\n",
+		"padding": "data: " + strings.Repeat("A", 64) + "\n",
+		// Base64 of text that is not a key
+		"text": "note: " + base64.StdEncoding.EncodeToString([]byte("nothing to see in this sentence")) + "\n",
+	}
+
+	rules := encodedRules(t)
+	for name, content := range contents {
+		if matches := rules.search([]byte(content)); len(matches) != 0 {
+			t.Errorf("%s: got matches %+v, want none", name, matches)
+		}
+	}
+}
+
+func TestSearchEncodedDropsPlainDuplicates(t *testing.T) {
+	content := keyFile(testAccessKeyID, testSecretAccessKey) + "backup: " + base64.StdEncoding.EncodeToString([]byte(testAccessKeyID)) + "\n"
+
+	matches := encodedRules(t).search([]byte(content))
+	if len(matches) != 1 || matches[0].Encoding != "" || matches[0].SecretAccessKey != testSecretAccessKey {
+		t.Errorf("got matches %+v, want the plain text pair alone", matches)
+	}
+}
+
+func TestDecodeToken(t *testing.T) {
+	if _, _, ok := decodeToken(strings.Repeat("ab", maxEncodedToken)); ok {
+		t.Error("got a token over the size bound decoded")
+	}
+	decoded, encoding, ok := decodeToken(hex.EncodeToString([]byte(testAccessKeyID)))
+	if !ok || encoding != encodingHex || string(decoded) != testAccessKeyID {
+		t.Errorf("got %q %s %v, want the hex key decoded", decoded, encoding, ok)
+	}
+}
+
+func TestScanFileEncodedKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "values.yaml")
+	ioutil.WriteFile(path, []byte("awsKey: "+base64.StdEncoding.EncodeToString([]byte(testAccessKeyID))+"\n"), 0o600)
+
+	result, err := ScanFile(context.Background(), path, ScanOptions{NoValidate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Findings) != 0 {
+		t.Errorf("by default: got findings %+v, want none", result.Findings)
+	}
+
+	result, err = ScanFile(context.Background(), path, ScanOptions{NoValidate: true, DecodeEncoded: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Findings) != 1 || result.Findings[0].AccessKeyID != testAccessKeyID || result.Findings[0].Encoding != encodingBase64 {
+		t.Fatalf("with decoding: got findings %+v, want the base64 key", result.Findings)
+	}
+	if note := encodingNote(result.Findings[0]); note != " [base64 encoded]" {
+		t.Errorf("got note %q, want the encoding", note)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// KeyOwner is the IAM user an access key belongs to, as found by looking the key up in the account of
+// one of the enrichment profiles.
+type KeyOwner struct {
+	// Profile is the enrichment profile whose account recognized the key, and Account its account ID.
+	Profile string `json:"profile"`
+	Account string `json:"account,omitempty"`
+	User    string `json:"user"`
+	// LastUsed is when the key was last used, with the service and region it was used with; it is
+	// empty when the key was never used.
+	LastUsed        *time.Time `json:"last_used,omitempty"`
+	LastUsedService string     `json:"last_used_service,omitempty"`
+	LastUsedRegion  string     `json:"last_used_region,omitempty"`
+}
+
+// enrichmentProfile is an enrichment profile with the session its IAM lookups are made with.
+type enrichmentProfile struct {
+	name string
+	sess *session.Session
+	// account is the account ID of the profile's credentials, looked up on first use.
+	account *string
+}
+
+// enrichFindings looks the AWS access key of every finding up with IAM GetAccessKeyLastUsed in the
+// account of each of opts.EnrichmentProfiles in turn, and records the IAM user and last use of the key
+// from the first account that recognizes it. A key can only be looked up from its own account, so
+// profiles that do not know it, or fail to ask, are passed over.
+func enrichFindings(ctx context.Context, findings []Finding, opts ScanOptions) {
+	if len(opts.EnrichmentProfiles) == 0 {
+		return
+	}
+
+	var profiles []enrichmentProfile
+	for _, name := range opts.EnrichmentProfiles {
+		// Each profile brings its own credentials and role, so the scanner's are not used
+		profileOpts := opts
+		profileOpts.AWSProfile, profileOpts.AWSAssumeRoleARN = name, ""
+		sess, err := profileOpts.awsSession()
+		if err != nil {
+			log.Printf("Skipping enrichment profile %s: %v", name, err)
+			continue
+		}
+		profiles = append(profiles, enrichmentProfile{name: name, sess: sess})
+	}
+
+	timeout := time.Duration(opts.ValidateTimeout)
+	if timeout <= 0 {
+		timeout = defaultValidateTimeout
+	}
+
+	owners := make(map[string]*KeyOwner)
+	for i := range findings {
+		f := &findings[i]
+		if f.AccessKeyID == "" || f.KeyType.validationStrategy() != validateIAM {
+			continue
+		}
+
+		owner, seen := owners[f.AccessKeyID]
+		if !seen {
+			owner = lookupKeyOwner(ctx, profiles, f.AccessKeyID, timeout)
+			owners[f.AccessKeyID] = owner
+		}
+		f.Owner = owner
+	}
+}
+
+// lookupKeyOwner returns the owner of the access key as recognized by the first of the profiles whose
+// account it belongs to, or nil when none does.
+func lookupKeyOwner(ctx context.Context, profiles []enrichmentProfile, accessKeyID string, timeout time.Duration) *KeyOwner {
+	for i := range profiles {
+		profile := &profiles[i]
+		callCtx, cancel := context.WithTimeout(ctx, timeout)
+		result, err := iam.New(profile.sess).GetAccessKeyLastUsedWithContext(callCtx, &iam.GetAccessKeyLastUsedInput{
+			AccessKeyId: aws.String(accessKeyID),
+		})
+		cancel()
+		if err != nil {
+			var awsErr awserr.Error
+			if !errors.As(err, &awsErr) || (awsErr.Code() != iam.ErrCodeNoSuchEntityException && awsErr.Code() != "AccessDenied") {
+				log.Printf("Failed to look up %s with enrichment profile %s: %v", accessKeyID, profile.name, err)
+			}
+			continue
+		}
+		if result.UserName == nil {
+			continue
+		}
+
+		owner := &KeyOwner{Profile: profile.name, Account: profile.accountID(ctx, timeout), User: aws.StringValue(result.UserName)}
+		if used := result.AccessKeyLastUsed; used != nil && used.LastUsedDate != nil {
+			owner.LastUsed = used.LastUsedDate
+			owner.LastUsedService = aws.StringValue(used.ServiceName)
+			owner.LastUsedRegion = aws.StringValue(used.Region)
+		}
+		return owner
+	}
+
+	return nil
+}
+
+// accountID returns the account ID of the profile's credentials, or "" when STS could not be asked.
+func (p *enrichmentProfile) accountID(ctx context.Context, timeout time.Duration) string {
+	if p.account != nil {
+		return *p.account
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	account := ""
+	identity, err := sts.New(p.sess).GetCallerIdentityWithContext(callCtx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		log.Printf("Failed to get the account of enrichment profile %s: %v", p.name, err)
+	} else {
+		account = aws.StringValue(identity.Account)
+	}
+	p.account = &account
+
+	return account
+}
+
+// ownerNote describes the owner of the finding's key for console output, when it was found.
+func ownerNote(f Finding) string {
+	if f.Owner == nil {
+		return ""
+	}
+
+	account := f.Owner.Account
+	if account == "" {
+		account = "unknown account"
+	}
+	lastUsed := "never used"
+	if f.Owner.LastUsed != nil {
+		lastUsed = fmt.Sprintf("last used %s with %s in %s", f.Owner.LastUsed.UTC().Format(time.RFC3339), f.Owner.LastUsedService, f.Owner.LastUsedRegion)
+	}
+
+	return fmt.Sprintf(" [IAM user %s in %s (profile %s), %s]", f.Owner.User, account, f.Owner.Profile, lastUsed)
+}
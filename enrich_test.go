@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Credentials of the enrichment profiles of the tests, one per account.
+const (
+	devProfileKeyID  = "AKIADEVPROFILE000001"
+	prodProfileKeyID = "AKIAPRODPROFILE00001"
+)
+
+// writeEnrichmentProfiles writes the dev and prod profiles to a temporary AWS configuration.
+func writeEnrichmentProfiles(t *testing.T) {
+	withoutAWSCredentials(t)
+	dir := t.TempDir()
+	credentials := "[dev]\naws_access_key_id = " + devProfileKeyID + "\naws_secret_access_key = devSecretKeyValue0000000000000000000000\n" +
+		"[prod]\naws_access_key_id = " + prodProfileKeyID + "\naws_secret_access_key = prodSecretKeyValue000000000000000000000\n"
+	for name, content := range map[string]string{"config": "", "credentials": credentials} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+}
+
+// iamStub answers IAM GetAccessKeyLastUsed and STS GetCallerIdentity calls for the accounts of the
+// enrichment profiles: the prod account owns testAccessKeyID, and the dev account owns no key.
+// It records every call as "<caller key> <action>".
+type iamStub struct {
+	*httptest.Server
+	mu    sync.Mutex
+	calls []string
+}
+
+// newIAMStub starts an iamStub, closed when the test ends.
+func newIAMStub(t *testing.T) *iamStub {
+	accounts := map[string]string{devProfileKeyID: "111111111111", prodProfileKeyID: "222222222222"}
+	stub := &iamStub{}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		caller := ""
+		if match := signedKeyPattern.FindStringSubmatch(r.Header.Get("Authorization")); match != nil {
+			caller = match[1]
+		}
+		action := r.Form.Get("Action")
+		stub.mu.Lock()
+		stub.calls = append(stub.calls, caller+" "+action)
+		stub.mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/xml")
+		switch {
+		case action == "GetCallerIdentity" && accounts[caller] != "":
+			fmt.Fprintf(w, `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><GetCallerIdentityResult>`+
+				`<Arn>arn:aws:iam::%[1]s:user/scanner</Arn><UserId>AIDAEXAMPLE</UserId><Account>%[1]s</Account>`+
+				`</GetCallerIdentityResult><ResponseMetadata><RequestId>1</RequestId></ResponseMetadata></GetCallerIdentityResponse>`, accounts[caller])
+		case action == "GetAccessKeyLastUsed" && caller == prodProfileKeyID && r.Form.Get("AccessKeyId") == testAccessKeyID:
+			fmt.Fprint(w, `<GetAccessKeyLastUsedResponse xmlns="https://iam.amazonaws.com/doc/2010-05-08/"><GetAccessKeyLastUsedResult>`+
+				`<UserName>deploy</UserName><AccessKeyLastUsed><LastUsedDate>2026-09-01T12:00:00Z</LastUsedDate>`+
+				`<ServiceName>s3</ServiceName><Region>us-east-1</Region></AccessKeyLastUsed>`+
+				`</GetAccessKeyLastUsedResult><ResponseMetadata><RequestId>1</RequestId></ResponseMetadata></GetAccessKeyLastUsedResponse>`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<ErrorResponse><Error><Type>Sender</Type><Code>NoSuchEntity</Code><Message>The user with name cannot be found.</Message></Error><RequestId>1</RequestId></ErrorResponse>`)
+		}
+	}))
+	t.Cleanup(stub.Close)
+
+	return stub
+}
+
+// recorded returns the calls made so far.
+func (s *iamStub) recorded() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.calls...)
+}
+
+func TestEnrichFindingsAcrossProfiles(t *testing.T) {
+	writeEnrichmentProfiles(t)
+	stub := newIAMStub(t)
+	findings := []Finding{
+		newFinding("", "a.env", keyMatch{AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey}),
+		newFinding("", "b.env", keyMatch{AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey}),
+		newFinding("", "c.env", keyMatch{AccessKeyID: testAccessKeyID2, SecretAccessKey: testSecretAccessKey2}),
+	}
+
+	enrichFindings(context.Background(), findings, ScanOptions{AWSEndpoint: stub.URL, EnrichmentProfiles: []string{"dev", "prod"}, ValidateTimeout: Duration(5 * time.Second)})
+
+	lastUsed := time.Date(2026, 9, 1, 12, 0, 0, 0, time.UTC)
+	want := &KeyOwner{Profile: "prod", Account: "222222222222", User: "deploy", LastUsed: &lastUsed, LastUsedService: "s3", LastUsedRegion: "us-east-1"}
+	for _, f := range findings[:2] {
+		if !reflect.DeepEqual(f.Owner, want) {
+			t.Errorf("%s: got owner %+v, want %+v", f.File, f.Owner, want)
+		}
+	}
+	if findings[2].Owner != nil {
+		t.Errorf("got owner %+v for a key no account knows, want none", findings[2].Owner)
+	}
+
+	// Every key is tried with each profile in turn until one recognizes it, and looked up only once
+	wantCalls := []string{
+		devProfileKeyID + " GetAccessKeyLastUsed",
+		prodProfileKeyID + " GetAccessKeyLastUsed",
+		prodProfileKeyID + " GetCallerIdentity",
+		devProfileKeyID + " GetAccessKeyLastUsed",
+		prodProfileKeyID + " GetAccessKeyLastUsed",
+	}
+	if got := stub.recorded(); !reflect.DeepEqual(got, wantCalls) {
+		t.Errorf("got calls %v, want %v", got, wantCalls)
+	}
+}
+
+func TestEnrichFindingsDisabled(t *testing.T) {
+	findings := []Finding{newFinding("", "a.env", keyMatch{AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey})}
+
+	enrichFindings(context.Background(), findings, ScanOptions{})
+
+	if findings[0].Owner != nil {
+		t.Errorf("got owner %+v without enrichment profiles", findings[0].Owner)
+	}
+}
+
+func TestOwnerNote(t *testing.T) {
+	lastUsed := time.Date(2026, 9, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		owner *KeyOwner
+		want  string
+	}{
+		{nil, ""},
+		{&KeyOwner{Profile: "prod", Account: "222222222222", User: "deploy", LastUsed: &lastUsed, LastUsedService: "s3", LastUsedRegion: "us-east-1"},
+			" [IAM user deploy in 222222222222 (profile prod), last used 2026-09-01T12:00:00Z with s3 in us-east-1]"},
+		{&KeyOwner{Profile: "dev", User: "ci"}, " [IAM user ci in unknown account (profile dev), never used]"},
+	}
+
+	for _, tt := range tests {
+		if got := ownerNote(Finding{Owner: tt.owner}); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestScanReportsKeyOwner(t *testing.T) {
+	writeEnrichmentProfiles(t)
+	stub := newIAMStub(t)
+	repo := newFixtureRepo(t)
+	repo.commit("add key", map[string]string{"config.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, AWSEndpoint: stub.URL, ValidationMethod: validationMethodSTS, EnrichmentProfiles: []string{"prod"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Findings) != 1 || result.Findings[0].Owner == nil || result.Findings[0].Owner.Account != "222222222222" {
+		t.Fatalf("got findings %+v, want the key owned by the prod account", result.Findings)
+	}
+	if note := ownerNote(result.Findings[0]); !strings.Contains(note, "IAM user deploy in 222222222222 (profile prod)") {
+		t.Errorf("got note %q, want the owner", note)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// Exit codes used by the CLI for the different kinds of failure.
+const (
+	exitError       = 1
+	exitGitNotFound = 2
+	exitCloneFailed = 3
+	exitKeysFound   = 4
+)
+
+// GitNotFoundError reports that the git executable could not be found.
+type GitNotFoundError struct {
+	Err error
+}
+
+func (e *GitNotFoundError) Error() string {
+	return fmt.Sprintf("git executable not found: %v", e.Err)
+}
+
+func (e *GitNotFoundError) Unwrap() error {
+	return e.Err
+}
+
+// CloneError reports that a repository could not be cloned.
+type CloneError struct {
+	URL    string
+	Output string
+	Err    error
+}
+
+func (e *CloneError) Error() string {
+	return fmt.Sprintf("failed to clone repository: %v. Output: %s", e.Err, e.Output)
+}
+
+func (e *CloneError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError reports that AWS could not be asked whether a key is valid.
+type ValidationError struct {
+	AccessKeyID string
+	Err         error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("failed to validate %s: %v", e.AccessKeyID, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// MissingCommitError reports that a commit to scan is not in the clone, such as one beyond the
+// boundary of a shallow clone.
+type MissingCommitError struct {
+	Commit string
+}
+
+func (e *MissingCommitError) Error() string {
+	return fmt.Sprintf("commit %s is not in the repository", e.Commit)
+}
+
+// unavailableCodes are the AWS error codes caused by the scanner's own credentials rather than the
+// key being validated: missing, expired or unauthorised caller credentials.
+var unavailableCodes = map[string]bool{
+	"NoCredentialProviders":       true,
+	"ExpiredToken":                true,
+	"ExpiredTokenException":       true,
+	"InvalidClientTokenId":        true,
+	"UnrecognizedClientException": true,
+	"AccessDenied":                true,
+}
+
+// validationUnavailable reports whether the validation failed because the scanner could not call
+// AWS at all, in which case the key is neither valid nor invalid.
+func validationUnavailable(err error) bool {
+	var awsErr awserr.Error
+	return errors.As(err, &awsErr) && unavailableCodes[awsErr.Code()]
+}
+
+// validationThrottled reports whether AWS throttled the validation call, in which case it may be
+// retried at a lower rate.
+func validationThrottled(err error) bool {
+	var awsErr awserr.Error
+	return errors.As(err, &awsErr) && request.IsErrorThrottle(awsErr)
+}
+
+// commandError converts a failure to start git into a GitNotFoundError when the executable is missing.
+func commandError(err error) error {
+	if errors.Is(err, exec.ErrNotFound) {
+		return &GitNotFoundError{Err: err}
+	}
+
+	return err
+}
+
+// exitCode returns the CLI exit code for the given error.
+func exitCode(err error) int {
+	var gitNotFound *GitNotFoundError
+	var cloneErr *CloneError
+
+	switch {
+	case errors.As(err, &gitNotFound):
+		return exitGitNotFound
+	case errors.As(err, &cloneErr):
+		return exitCloneFailed
+	default:
+		return exitError
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCloneError(t *testing.T) {
+	_, err := Scan(context.Background(), ScanOptions{RepoURL: filepath.Join(t.TempDir(), "missing"), NoValidate: true})
+
+	var cloneErr *CloneError
+	if !errors.As(err, &cloneErr) {
+		t.Fatalf("got %v, want a CloneError", err)
+	}
+	if !strings.HasSuffix(cloneErr.URL, "missing") || exitCode(err) != exitCloneFailed {
+		t.Errorf("got URL %q and exit code %d, want the repository URL and %d", cloneErr.URL, exitCode(err), exitCloneFailed)
+	}
+}
+
+func TestGitNotFoundError(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("first", nil)
+	t.Setenv("PATH", t.TempDir())
+
+	_, _, err := getCommitHashes(repo.dir, historyOptions{})
+
+	var gitNotFound *GitNotFoundError
+	if !errors.As(err, &gitNotFound) {
+		t.Fatalf("got %v, want a GitNotFoundError", err)
+	}
+	if exitCode(err) != exitGitNotFound {
+		t.Errorf("exit code %d, want %d", exitCode(err), exitGitNotFound)
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	closed := httptest.NewServer(nil)
+	closed.Close()
+
+	_, err := ScanOptions{AWSEndpoint: closed.URL}.awsValidator().Validate(context.Background(), testAccessKeyID, testSecretAccessKey)
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("got %v, want a ValidationError", err)
+	}
+	if validationErr.AccessKeyID != testAccessKeyID || exitCode(err) != exitError {
+		t.Errorf("got %+v and exit code %d", validationErr, exitCode(err))
+	}
+}
+
+func TestMissingCommitError(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("first", nil)
+	missing := strings.Repeat("1", 40)
+
+	_, err := searchCommit(repo.dir, missing, false, walkOptions{}, &ScanStats{})
+
+	var missingErr *MissingCommitError
+	if !errors.As(err, &missingErr) || missingErr.Commit != missing {
+		t.Errorf("got %v, want a MissingCommitError for %s", err, missing)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import "regexp"
+
+// Confidence levels assigned to findings.
+const (
+	confidenceLow    = "low"
+	confidenceMedium = "medium"
+	confidenceHigh   = "high"
+)
+
+// confidenceRank orders the confidence levels so they can be compared.
+var confidenceRank = map[string]int{
+	confidenceLow:    0,
+	confidenceMedium: 1,
+	confidenceHigh:   2,
+}
+
+// Patterns describing the shape of real AWS access key IDs and secret access keys.
+var (
+	accessKeyIDShape     = regexp.MustCompile(`^(A3T[A-Z0-9]|AKIA|ASIA|ABIA|ACCA|AGPA|AIDA|AIPA|ANPA|ANVA|APKA|AROA|ASCA)[A-Z0-9]{16}$`)
+	secretAccessKeyShape = regexp.MustCompile(`^[A-Za-z0-9/+]{40}$`)
+)
+
+// keyConfidence rates how likely a matched key pair is to be a real AWS credential.
+func keyConfidence(accessKeyID, secretAccessKey string) string {
+	if !accessKeyIDShape.MatchString(accessKeyID) {
+		return confidenceLow
+	}
+	if !secretAccessKeyShape.MatchString(secretAccessKey) {
+		return confidenceMedium
+	}
+
+	return confidenceHigh
+}
+
+// findingFilter drops allowlisted and low-confidence findings and marks findings under allowed paths.
+type findingFilter struct {
+	allow         map[string]bool
+	minConfidence string
+	// allowPath marks findings in matching files as informational instead of dropping them.
+	allowPath []globPattern
+}
+
+// apply returns the findings that pass the filter and counts the suppressed ones in stats.
+func (f findingFilter) apply(findings []Finding, stats *ScanStats) []Finding {
+	var kept []Finding
+	for _, finding := range findings {
+		switch {
+		case f.allow[finding.AccessKeyID]:
+			stats.SuppressedByAllowlist++
+		case confidenceRank[finding.Confidence] < confidenceRank[f.minConfidence]:
+			stats.SuppressedByConfidence++
+		default:
+			if matchAnyGlob(f.allowPath, finding.File) {
+				finding.Allowed = true
+				stats.SuppressedByAllowPath++
+			}
+			kept = append(kept, finding)
+		}
+	}
+
+	return kept
+}
+
+// failsBuild reports whether the finding should make the scan exit with a non-zero status: it was
+// confirmed valid or could not be verified, and is not under an allowed path.
+func (f Finding) failsBuild() bool {
+	return !f.Allowed && (f.Status == statusValid || f.Status == statusUnverified)
+}
+
+// countFindings returns the number of findings validated as live that are not allowed, or of every
+// finding when all is set.
+func countFindings(result *ScanResult, all bool) int {
+	if all {
+		return len(result.Findings)
+	}
+
+	count := 0
+	for _, f := range result.Findings {
+		if f.Status == statusValid && !f.Allowed {
+			count++
+		}
+	}
+
+	return count
+}
+
+// validatedOnly returns a copy of the result that only reports the findings validated as live. The
+// number of findings left out is recorded in the copy's stats so summaries still count every match.
+func validatedOnly(result *ScanResult) *ScanResult {
+	shown := *result
+	shown.Findings = nil
+	for _, f := range result.Findings {
+		if f.Status == statusValid {
+			shown.Findings = append(shown.Findings, f)
+		}
+	}
+	shown.Stats.HiddenUnvalidated = len(result.Findings) - len(shown.Findings)
+
+	return &shown
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestKeyConfidence(t *testing.T) {
+	tests := []struct {
+		id, secret, want string
+	}{
+		{testAccessKeyID, testSecretAccessKey, confidenceHigh},
+		{testAccessKeyID, "not-a-secret-access-key-of-forty-chars!!", confidenceMedium},
+		{"AKIAEXAMPLE", testSecretAccessKey, confidenceLow},
+	}
+
+	for _, tt := range tests {
+		if got := keyConfidence(tt.id, tt.secret); got != tt.want {
+			t.Errorf("keyConfidence(%q, %q) = %q, want %q", tt.id, tt.secret, got, tt.want)
+		}
+	}
+}
+
+func TestFindingFilterCountsSuppressions(t *testing.T) {
+	filter := findingFilter{
+		allow:         map[string]bool{testAccessKeyID: true},
+		minConfidence: confidenceHigh,
+		allowPath:     mustCompileGlobs("docs/**"),
+	}
+	findings := []Finding{
+		{AccessKeyID: testAccessKeyID, Confidence: confidenceHigh, File: "a"},
+		{AccessKeyID: testAccessKeyID2, Confidence: confidenceMedium, File: "b"},
+		{AccessKeyID: testAccessKeyID2, Confidence: confidenceHigh, File: "docs/c"},
+		{AccessKeyID: testAccessKeyID2, Confidence: confidenceHigh, File: "d"},
+	}
+
+	var stats ScanStats
+	kept := filter.apply(findings, &stats)
+
+	if stats.SuppressedByAllowlist != 1 || stats.SuppressedByConfidence != 1 || stats.SuppressedByAllowPath != 1 {
+		t.Errorf("got stats %+v, want one suppression of each kind", stats)
+	}
+	if len(kept) != 2 || !kept[0].Allowed || kept[1].Allowed {
+		t.Errorf("got %+v, want docs/c allowed and d kept", kept)
+	}
+}
+
+func TestScanCountsSkippedFiles(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("files", map[string]string{
+		"allowed.env": keyFile(testAccessKeyID, testSecretAccessKey),
+		"binary.bin":  "\x00\x01" + keyFile(testAccessKeyID2, testSecretAccessKey2),
+		"large.txt":   strings.Repeat("x", 2048) + keyFile(testAccessKeyID2, testSecretAccessKey2),
+	})
+
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true, Allow: []string{testAccessKeyID}, MaxFileSize: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Findings) != 0 {
+		t.Errorf("got findings %+v, want none", result.Findings)
+	}
+	stats := result.Stats
+	if stats.SuppressedByAllowlist != 1 || stats.SkippedBinary != 1 || stats.SkippedOversize != 1 {
+		t.Errorf("got stats %+v, want 1 allowlisted, 1 binary and 1 oversize", stats)
+	}
+}
+
+func TestExcludeVersusAllowPath(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("fixtures", map[string]string{"testdata/fake.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+
+	excluded, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true, Exclude: []string{"testdata/**"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(excluded.Findings) != 0 || excluded.Stats.SkippedExcluded != 1 || excluded.Stats.FilesScanned != 0 {
+		t.Errorf("exclude: got %d findings and stats %+v, want the file skipped unscanned", len(excluded.Findings), excluded.Stats)
+	}
+
+	allowed, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true, AllowPath: []string{"testdata/**"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(allowed.Findings) != 1 || allowed.Stats.FilesScanned != 1 || allowed.Stats.FilesAllowed != 1 || allowed.Stats.SuppressedByAllowPath != 1 {
+		t.Fatalf("allow-path: got %d findings and stats %+v, want the file scanned and its finding allowed", len(allowed.Findings), allowed.Stats)
+	}
+	if f := allowed.Findings[0]; !f.Allowed || f.failsBuild() {
+		t.Errorf("allow-path finding %+v should be allowed and not fail the build", f)
+	}
+}
+
+func TestValidatedOnly(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("keys", map[string]string{
+		"live.env": keyFile(testAccessKeyID, testSecretAccessKey),
+		"dead.env": keyFile(testAccessKeyID2, testSecretAccessKey2),
+		"role.txt": "role: AROAIOSFODNN7EXAMPLE\n",
+	})
+	stub := newSTSStub(t, testAccessKeyID)
+
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, AWSEndpoint: stub.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	shown := validatedOnly(result)
+
+	if len(shown.Findings) != 1 || shown.Findings[0].AccessKeyID != testAccessKeyID {
+		t.Errorf("got %+v, want only the live key", shown.Findings)
+	}
+	if len(result.Findings) != 3 || shown.Stats.HiddenUnvalidated != 2 || result.Stats.HiddenUnvalidated != 0 {
+		t.Errorf("got %d findings with %d hidden, want all 3 kept in the result and 2 hidden", len(result.Findings), shown.Stats.HiddenUnvalidated)
+	}
+
+	summary := captureStdout(t, func() { printResult(shown) })
+	if strings.Contains(summary, testAccessKeyID2) || !strings.Contains(summary, testAccessKeyID) {
+		t.Errorf("summary does not report only the live key:\n%s", summary)
+	}
+	if !strings.Contains(summary, "Showing 1 of 3 findings; 2 not validated as live are hidden") {
+		t.Errorf("summary does not count the hidden findings:\n%s", summary)
+	}
+}
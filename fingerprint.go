@@ -0,0 +1,33 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+)
+
+// fingerprint identifies the finding across scans and reports. It covers where the key was found and
+// the key itself, hashing the secret, but not the line so edits around the key keep it stable.
+func (f Finding) fingerprint() string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		f.Repo, f.Source, f.Commit, f.File, f.Rule, f.AccessKeyID, f.SecretAccessKey,
+	}, "\x00")))
+
+	return hex.EncodeToString(sum[:8])
+}
+
+// MarshalJSON encodes the finding with its fingerprint.
+func (f Finding) MarshalJSON() ([]byte, error) {
+	type plain Finding
+	return json.Marshal(struct {
+		plain
+		Fingerprint string `json:"fingerprint"`
+	}{plain(f), f.fingerprint()})
+}
+
+// reportFinding is a finding read back from a JSON report, which carries its fingerprint but not its secret.
+type reportFinding struct {
+	Finding
+	Fingerprint string `json:"fingerprint"`
+}
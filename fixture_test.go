@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fixtureRepo is a git repository created for a test, in a directory removed when the test ends.
+type fixtureRepo struct {
+	t   *testing.T
+	dir string
+}
+
+// newFixtureRepo creates an empty repository whose default branch is main.
+func newFixtureRepo(t *testing.T) *fixtureRepo {
+	t.Helper()
+
+	r := &fixtureRepo{t: t, dir: t.TempDir()}
+	r.git("init", "-q", "-b", "main")
+
+	return r
+}
+
+// git runs git in the repository, with the user configuration of the machine ignored, and returns its
+// trimmed output, failing the test when it fails.
+func (r *fixtureRepo) git(args ...string) string {
+	r.t.Helper()
+
+	cmd := exec.Command("git", append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false"}, args...)...)
+	cmd.Dir = r.dir
+	cmd.Env = append(os.Environ(), "GIT_CONFIG_NOSYSTEM=1", "GIT_CONFIG_GLOBAL="+os.DevNull)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		r.t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, output)
+	}
+
+	return strings.TrimSpace(string(output))
+}
+
+// write writes the files, keyed by their repository relative path, without committing them.
+func (r *fixtureRepo) write(files map[string]string) {
+	r.t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(r.dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			r.t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0o644); err != nil {
+			r.t.Fatal(err)
+		}
+	}
+}
+
+// commit writes the files and commits every change of the working tree, returning the commit hash.
+func (r *fixtureRepo) commit(message string, files map[string]string) string {
+	r.t.Helper()
+
+	return r.commitAs("Test <test@example.com>", message, files)
+}
+
+// commitAs commits like commit with the given "name <email>" author.
+func (r *fixtureRepo) commitAs(author, message string, files map[string]string) string {
+	r.t.Helper()
+
+	r.write(files)
+	r.git("add", "-A")
+	r.git("commit", "-q", "--allow-empty", "--author", author, "-m", message)
+
+	return r.git("rev-parse", "HEAD")
+}
+
+// keyFile returns the content of a file holding the given key pair as shell variables.
+func keyFile(accessKeyID, secretAccessKey string) string {
+	return "AWS_ACCESS_KEY_ID=" + accessKeyID + "\nAWS_SECRET_ACCESS_KEY=" + secretAccessKey + "\n"
+}
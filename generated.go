@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// generatedFileNames are lockfiles and other files written by tools rather than people.
+var generatedFileNames = map[string]bool{
+	"package-lock.json":   true,
+	"npm-shrinkwrap.json": true,
+	"yarn.lock":           true,
+	"pnpm-lock.yaml":      true,
+	"go.sum":              true,
+	"Cargo.lock":          true,
+	"composer.lock":       true,
+	"Gemfile.lock":        true,
+	"Pipfile.lock":        true,
+	"poetry.lock":         true,
+}
+
+// generatedFileSuffixes are the endings of minified assets and generated protobuf code.
+var generatedFileSuffixes = []string{".min.js", ".min.css", ".js.map", ".css.map", ".pb.go", "_pb2.py", ".pb.cc", ".pb.h"}
+
+// generatedMarker matches the markers tools put near the top of the files they write, such as Go's
+// "// Code generated by protoc-gen-go. DO NOT EDIT." and the @generated tag.
+var generatedMarker = regexp.MustCompile(`(?m)^\s*(?://|#|/\*|\*)\s*(?:Code generated .* DO NOT EDIT\.|@generated\b)`)
+
+// minifiedLineLen is the line length from which a file is considered minified. Source written by
+// people rarely has lines this long.
+const minifiedLineLen = 4096
+
+// looksGenerated reports whether the file at the slash-separated path, whose leading bytes are head,
+// is generated or minified: it has a known generated file name, a generated-code marker or a line
+// longer than minifiedLineLen in its leading bytes.
+func looksGenerated(filePath string, head []byte) bool {
+	name := path.Base(filePath)
+	if generatedFileNames[name] {
+		return true
+	}
+	for _, suffix := range generatedFileSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+
+	if len(head) > binarySniffLen {
+		head = head[:binarySniffLen]
+	}
+	if generatedMarker.Match(head) {
+		return true
+	}
+
+	for {
+		end := bytes.IndexByte(head, '\n')
+		if end == -1 {
+			return len(head) >= minifiedLineLen
+		}
+		if end >= minifiedLineLen {
+			return true
+		}
+		head = head[end+1:]
+	}
+}
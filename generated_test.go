@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// minifiedBundle returns a single 50KB line of minified JavaScript holding a key pair.
+func minifiedBundle() string {
+	var b strings.Builder
+	b.WriteString(`var AWS_ACCESS_KEY_ID="` + testAccessKeyID2 + `",AWS_SECRET_ACCESS_KEY="` + testSecretAccessKey2 + `";`)
+	for i := 0; b.Len() < 50<<10; i++ {
+		b.WriteString("function a(b,c){return b+c};")
+	}
+
+	return b.String()
+}
+
+func TestLooksGenerated(t *testing.T) {
+	tests := []struct {
+		path, head string
+		want       bool
+	}{
+		{"web/package-lock.json", "{}\n", true},
+		{"static/app.min.js", "var a=1;\n", true},
+		{"api/service.pb.go", "package api\n", true},
+		{"gen/models.go", "// Code generated by sqlc. DO NOT EDIT.\npackage gen\n", true},
+		{"schema.py", "# @generated by tooling\n", true},
+		{"dist/bundle.js", minifiedBundle(), true},
+		{"src/app.js", "var a = 1;\n" + strings.Repeat("x", minifiedLineLen-1) + "\n", false},
+		{"src/app.js", "const region = \"us-east-1\";\n", false},
+		// The marker has to start a comment, not be quoted in code
+		{"main.go", "package main\n\nconst doc = \"Code generated by x. DO NOT EDIT.\"\n", false},
+	}
+
+	for _, tt := range tests {
+		if got := looksGenerated(tt.path, []byte(tt.head)); got != tt.want {
+			t.Errorf("looksGenerated(%s) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestScanSkipsMinifiedFiles(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("add files", map[string]string{
+		"dist/bundle.js": minifiedBundle(),
+		"config.env":     keyFile(testAccessKeyID, testSecretAccessKey),
+	})
+
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Findings) != 1 || result.Findings[0].File != "config.env" {
+		t.Errorf("got findings %+v, want only the key in config.env", result.Findings)
+	}
+	if result.Stats.SkippedGenerated != 1 {
+		t.Errorf("got %d generated files skipped, want 1", result.Stats.SkippedGenerated)
+	}
+
+	result, err = Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true, ScanGenerated: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Findings) != 2 || result.Stats.SkippedGenerated != 0 {
+		t.Errorf("with ScanGenerated: got %d findings and %d generated files skipped, want 2 and none", len(result.Findings), result.Stats.SkippedGenerated)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// githubAPIURL is the base URL of the GitHub REST API.
+const githubAPIURL = "https://api.github.com"
+
+// githubValidator validates GitHub tokens by fetching the authenticated user.
+type githubValidator struct {
+	baseURL string
+	client  *http.Client
+}
+
+// Validate implements keyValidator. GitHub tokens have no access key ID, so only the secret is used.
+func (v githubValidator) Validate(ctx context.Context, accessKeyID, secretAccessKey string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.baseURL+"/user", nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to build GitHub request: %v", err)
+	}
+	req.Header.Set("Authorization", "token "+secretAccessKey)
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to validate GitHub token: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusUnauthorized:
+		return false, nil
+	default:
+		return false, fmt.Errorf("failed to validate GitHub token: unexpected status %s", resp.Status)
+	}
+}
+
+// githubSearchPageSize is the number of results requested per search page, the API maximum.
+const githubSearchPageSize = 100
+
+// Minimum time between search requests, keeping under GitHub's search rate limits of 30 requests
+// a minute with a token and 10 without.
+const (
+	githubSearchInterval     = 2 * time.Second
+	githubSearchAnonInterval = 6 * time.Second
+)
+
+// githubSearch finds repositories through the GitHub search API.
+type githubSearch struct {
+	baseURL string
+	token   string
+	client  *http.Client
+	// code searches file contents instead of repository names and descriptions.
+	code bool
+	// interval is the minimum time between requests.
+	interval time.Duration
+}
+
+// newGitHubSearch returns a search against the public GitHub API made with the client, authenticated
+// with the token when set.
+func newGitHubSearch(client *http.Client, token string, code bool) githubSearch {
+	interval := githubSearchInterval
+	if token == "" {
+		interval = githubSearchAnonInterval
+	}
+
+	return githubSearch{baseURL: githubAPIURL, token: token, client: client, code: code, interval: interval}
+}
+
+// githubSearchResponse is the part of a repository or code search response the scanner reads.
+type githubSearchResponse struct {
+	Items []struct {
+		FullName   string `json:"full_name"`
+		CloneURL   string `json:"clone_url"`
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+	} `json:"items"`
+}
+
+// repos returns the clone URLs of up to limit distinct repositories matching the query, following
+// pagination and waiting out rate limits.
+func (s githubSearch) repos(ctx context.Context, query string, limit int) ([]string, error) {
+	endpoint := "/search/repositories"
+	if s.code {
+		endpoint = "/search/code"
+	}
+
+	var urls []string
+	seen := make(map[string]bool)
+	for page := 1; len(urls) < limit; page++ {
+		if page > 1 {
+			if err := sleepContext(ctx, s.interval); err != nil {
+				return nil, err
+			}
+		}
+
+		params := url.Values{"q": {query}, "per_page": {strconv.Itoa(githubSearchPageSize)}, "page": {strconv.Itoa(page)}}
+		var resp githubSearchResponse
+		if err := s.get(ctx, endpoint+"?"+params.Encode(), &resp); err != nil {
+			return nil, err
+		}
+
+		for _, item := range resp.Items {
+			// Code search results name the repository containing the match
+			cloneURL := item.CloneURL
+			if s.code {
+				cloneURL = "https://github.com/" + item.Repository.FullName + ".git"
+			}
+			if cloneURL != "" && !seen[cloneURL] && len(urls) < limit {
+				seen[cloneURL] = true
+				urls = append(urls, cloneURL)
+			}
+		}
+
+		if len(resp.Items) < githubSearchPageSize {
+			break
+		}
+	}
+
+	return urls, nil
+}
+
+// get fetches a search API path into v. A rate limited request is retried once the limit resets.
+func (s githubSearch) get(ctx context.Context, path string, v interface{}) error {
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL+path, nil)
+		if err != nil {
+			return fmt.Errorf("failed to build GitHub search request: %v", err)
+		}
+		req.Header.Set("Accept", "application/vnd.github+json")
+		if s.token != "" {
+			req.Header.Set("Authorization", "token "+s.token)
+		}
+
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to search GitHub: %v", err)
+		}
+
+		if wait, limited := rateLimitWait(resp); limited {
+			resp.Body.Close()
+			if err := sleepContext(ctx, wait); err != nil {
+				return err
+			}
+			continue
+		}
+
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("failed to search GitHub: unexpected status %s", resp.Status)
+		}
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			return fmt.Errorf("failed to parse GitHub search response: %v", err)
+		}
+
+		return nil
+	}
+}
+
+// rateLimitWait reports whether the response is a rate limit rejection and how long to wait before
+// retrying, from the Retry-After or X-RateLimit-Reset headers.
+func rateLimitWait(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			wait := time.Until(time.Unix(reset, 0))
+			if wait < time.Second {
+				wait = time.Second
+			}
+			return wait, true
+		}
+	}
+
+	// A 403 without rate limit headers is a permission error
+	return 0, false
+}
+
+// sleepContext waits for the duration or until the context is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
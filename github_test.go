@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Fake tokens in the shape of GitHub, GitLab and npm tokens.
+const (
+	testGitHubToken = "ghp_" + "aBcDeFgHiJkLmNoPqRsTuVwXyZ0123456789"
+	testGitLabToken = "glpat-" + "aBcDeFgHiJ_kLmNoPqRs"
+	testNPMToken    = "npm_" + "aBcDeFgHiJkLmNoPqRsTuVwXyZ0123456789"
+)
+
+func TestTokenRules(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("tokens", map[string]string{
+		".github/token":  "GITHUB_TOKEN=" + testGitHubToken + "\n",
+		".gitlab-ci.yml": "variables:\n  TOKEN: \"" + testGitLabToken + "\"\n",
+		".npmrc":         "//registry.npmjs.org/:_authToken=" + testNPMToken + "\n",
+		"README.md":      "ghp_tooshort glpat-short npm_x\n",
+	})
+
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]Finding)
+	for _, f := range result.Findings {
+		got[f.Rule] = f
+	}
+	want := map[string]struct{ file, token string }{
+		ruleGitHubToken: {".github/token", testGitHubToken},
+		ruleGitLabToken: {".gitlab-ci.yml", testGitLabToken},
+		ruleNPMToken:    {".npmrc", testNPMToken},
+	}
+	if len(result.Findings) != len(want) {
+		t.Errorf("got %d findings %+v, want %d", len(result.Findings), result.Findings, len(want))
+	}
+	for rule, w := range want {
+		f, ok := got[rule]
+		if !ok {
+			t.Errorf("no %s finding", rule)
+			continue
+		}
+		if f.File != w.file || f.SecretAccessKey != w.token || f.Confidence != confidenceHigh || f.Status != statusSkipped {
+			t.Errorf("%s: got %+v", rule, f)
+		}
+	}
+}
+
+func TestGitHubValidator(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path != "/user":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Header.Get("Authorization") == "token "+testGitHubToken:
+			w.Write([]byte(`{"login":"octocat"}`))
+		case r.Header.Get("Authorization") == "token ghp_ratelimited":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer api.Close()
+	validator := githubValidator{baseURL: api.URL, client: api.Client()}
+
+	if valid, err := validator.Validate(context.Background(), "", testGitHubToken); !valid || err != nil {
+		t.Errorf("live token: valid %v err %v", valid, err)
+	}
+	if valid, err := validator.Validate(context.Background(), "", "ghp_revoked"); valid || err != nil {
+		t.Errorf("revoked token: valid %v err %v, want invalid", valid, err)
+	}
+	if _, err := validator.Validate(context.Background(), "", "ghp_ratelimited"); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("forbidden call: got %v, want an error", err)
+	}
+}
+
+func TestGitHubSearchRepos(t *testing.T) {
+	// Two local repositories stand in for the search results, one of them holding a key
+	leaky, clean := newFixtureRepo(t), newFixtureRepo(t)
+	leaky.commit("add key", map[string]string{"config.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+	clean.commit("readme", map[string]string{"README.md": "nothing here\n"})
+
+	var requests []string
+	limited := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/search/repositories" || r.Header.Get("Authorization") != "token "+testGitHubToken {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		// The first request is rate limited, and retried once it has waited
+		if !limited {
+			limited = true
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		requests = append(requests, r.URL.RawQuery)
+
+		var items []string
+		switch r.URL.Query().Get("page") {
+		case "1":
+			// A full page of matches in the leaky repository, which is scanned once
+			for i := 0; i < githubSearchPageSize; i++ {
+				items = append(items, fmt.Sprintf(`{"full_name": "org/leaky", "clone_url": %q}`, leaky.dir))
+			}
+		case "2":
+			items = append(items, fmt.Sprintf(`{"full_name": "org/clean", "clone_url": %q}`, clean.dir))
+		}
+		fmt.Fprintf(w, `{"items": [%s]}`, strings.Join(items, ","))
+	}))
+	defer server.Close()
+
+	search := githubSearch{baseURL: server.URL, token: testGitHubToken, client: server.Client()}
+	repos, err := search.repos(context.Background(), "org:org payments", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{leaky.dir, clean.dir}; !reflect.DeepEqual(repos, want) {
+		t.Fatalf("got repos %v, want %v", repos, want)
+	}
+	if len(requests) != 2 || !strings.Contains(requests[0], "q=org%3Aorg+payments") || !strings.Contains(requests[1], "page=2") {
+		t.Errorf("got requests %v, want both pages of the query", requests)
+	}
+
+	var scanned []string
+	result, err := ScanRepos(context.Background(), repos, ScanOptions{NoValidate: true, OnProgress: func(e ProgressEvent) {
+		if e.Stage == progressCloned {
+			scanned = append(scanned, e.Repo)
+		}
+	}}, func(repoURL string, err error) {
+		t.Errorf("scanning %s: %v", repoURL, err)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Findings) != 1 || result.Findings[0].Repo != leaky.dir {
+		t.Errorf("got findings %+v, want the key of %s", result.Findings, leaky.dir)
+	}
+	if !reflect.DeepEqual(scanned, repos) {
+		t.Errorf("scanned %v, want %v", scanned, repos)
+	}
+}
+
+func TestGitHubSearchLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var items []string
+		for i := 0; i < githubSearchPageSize; i++ {
+			items = append(items, fmt.Sprintf(`{"repository": {"full_name": "org/repo%d"}}`, i))
+		}
+		fmt.Fprintf(w, `{"items": [%s]}`, strings.Join(items, ","))
+	}))
+	defer server.Close()
+
+	search := githubSearch{baseURL: server.URL, client: server.Client(), code: true}
+	repos, err := search.repos(context.Background(), "AKIA", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"https://github.com/org/repo0.git", "https://github.com/org/repo1.git", "https://github.com/org/repo2.git"}; !reflect.DeepEqual(repos, want) {
+		t.Errorf("got repos %v, want %v", repos, want)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// githubActionsCommand returns the workflow command annotating a finding in GitHub Actions: error for
+// live keys, warning for keys that could not be validated and notice for skipped keys and findings
+// under allowed paths.
+func githubActionsCommand(f Finding) string {
+	switch {
+	case f.Allowed || f.Status == statusSkipped:
+		return "notice"
+	case f.Status == statusValid:
+		return "error"
+	default:
+		return "warning"
+	}
+}
+
+// githubActionsLine formats the finding as a workflow command, e.g.
+// "::error file=.env,line=3,title=Live AWS access key::...", which Actions renders as an annotation on
+// the file and line. Secrets are redacted from the message.
+func githubActionsLine(f Finding) string {
+	title := "Unverified AWS access key"
+	switch {
+	case f.AccessKeyID == "" && f.Status == statusValid:
+		title = "Live secret"
+	case f.AccessKeyID == "":
+		title = "Possible secret"
+	case f.Status == statusValid:
+		title = "Live AWS access key"
+	case f.Status == statusSkipped:
+		title = "AWS access key not validated"
+	}
+
+	var message string
+	if f.AccessKeyID == "" {
+		message = fmt.Sprintf("Secret matching rule %s: %s", f.Rule, redact(f.SecretAccessKey))
+	} else {
+		message = fmt.Sprintf("%s %s (%s) matched by rule %s", title, f.AccessKeyID, f.KeyType, f.Rule)
+	}
+	if f.Commit != "" {
+		message += " in commit " + f.Commit
+	}
+	if f.Allowed {
+		message += " under an allowed path"
+	}
+	if f.Permalink != "" {
+		message += " (" + f.Permalink + ")"
+	}
+	if f.Exposure == exposurePublic {
+		title += " in a public repository"
+	}
+	if f.Synthetic {
+		title = "Synthetic test finding: " + title
+	}
+
+	properties := []string{"file=" + escapeGitHubProperty(f.File)}
+	if f.Line > 0 {
+		properties = append(properties, fmt.Sprintf("line=%d", f.Line))
+	}
+	properties = append(properties, "title="+escapeGitHubProperty(title))
+
+	return fmt.Sprintf("::%s %s::%s", githubActionsCommand(f), strings.Join(properties, ","), escapeGitHubData(message))
+}
+
+// escapeGitHubData escapes the message of a workflow command.
+func escapeGitHubData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeGitHubProperty escapes a property value of a workflow command, which also cannot hold the
+// separators of the properties.
+func escapeGitHubProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+// writeGitHubActionsReport writes one workflow command per finding, leaving out invalid keys like the
+// text output.
+func writeGitHubActionsReport(w io.Writer, result *ScanResult) error {
+	for _, f := range result.Findings {
+		if f.Status == statusInvalid {
+			continue
+		}
+		if _, err := fmt.Fprintln(w, githubActionsLine(f)); err != nil {
+			return fmt.Errorf("failed to write GitHub Actions report: %v", err)
+		}
+	}
+
+	return nil
+}
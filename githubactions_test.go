@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestGitHubActionsLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		finding Finding
+		want    string
+	}{
+		{
+			"live key",
+			Finding{File: "config/prod.env", Line: 3, Rule: ruleAWSLabelled, AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey, KeyType: classifyKeyType(testAccessKeyID), Status: statusValid, Commit: "0123456789abcdef"},
+			"::error file=config/prod.env,line=3,title=Live AWS access key::Live AWS access key " + testAccessKeyID + " (long-term IAM user access key) matched by rule " + ruleAWSLabelled + " in commit 0123456789abcdef",
+		},
+		{
+			"unverified key",
+			Finding{File: "a.env", Line: 1, Rule: ruleAWSLabelled, AccessKeyID: testAccessKeyID, KeyType: classifyKeyType(testAccessKeyID), Status: statusUnverified},
+			"::warning file=a.env,line=1,title=Unverified AWS access key::Unverified AWS access key " + testAccessKeyID + " (long-term IAM user access key) matched by rule " + ruleAWSLabelled,
+		},
+		{
+			"custom secret",
+			Finding{File: "app.yml", Line: 7, Rule: "acme-token", SecretAccessKey: "acme_9f8e7d6c5b4a39281706", Status: statusUnverified},
+			"::warning file=app.yml,line=7,title=Possible secret::Secret matching rule acme-token: " + redact("acme_9f8e7d6c5b4a39281706"),
+		},
+		{
+			"allowed path",
+			Finding{File: "test/fixtures,keys:1.env", Line: 2, Rule: ruleAWSLabelled, AccessKeyID: testAccessKeyID, KeyType: classifyKeyType(testAccessKeyID), Status: statusValid, Allowed: true},
+			"::notice file=test/fixtures%2Ckeys%3A1.env,line=2,title=Live AWS access key::Live AWS access key " + testAccessKeyID + " (long-term IAM user access key) matched by rule " + ruleAWSLabelled + " under an allowed path",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := githubActionsLine(tt.finding); got != tt.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.name, got, tt.want)
+		}
+		if tt.finding.SecretAccessKey != "" && strings.Contains(githubActionsLine(tt.finding), tt.finding.SecretAccessKey) {
+			t.Errorf("%s: got the secret in the annotation, want it redacted", tt.name)
+		}
+	}
+}
+
+func TestEscapeGitHubData(t *testing.T) {
+	if got := escapeGitHubData("100% done\r\nnext"); got != "100%25 done%0D%0Anext" {
+		t.Errorf("got %q, want percent, carriage return and newline escaped", got)
+	}
+}
+
+func TestWriteGitHubActionsReportSkipsInvalidKeys(t *testing.T) {
+	var out bytes.Buffer
+	err := writeGitHubActionsReport(&out, &ScanResult{Findings: []Finding{
+		{File: "dead.env", Line: 1, Rule: ruleAWSLabelled, AccessKeyID: testAccessKeyID2, Status: statusInvalid},
+		{File: "live.env", Line: 1, Rule: ruleAWSLabelled, AccessKeyID: testAccessKeyID, Status: statusValid},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n"); len(lines) != 1 || !strings.HasPrefix(lines[0], "::error file=live.env,line=1,") {
+		t.Errorf("got %q, want only the live key annotated", out.String())
+	}
+}
+
+func TestCLIGitHubActionsFormat(t *testing.T) {
+	repo := newFixtureRepo(t)
+	commit := repo.commit("add key", map[string]string{"config.env": "# deploy\n" + keyFile(testAccessKeyID, testSecretAccessKey)})
+
+	got := runScanner(t, "-repo", repo.dir, "-no-validate", "-format", "github-actions")
+	want := "::warning file=config.env,line=2,title=Unverified AWS access key::Unverified AWS access key " + testAccessKeyID +
+		" (long-term IAM user access key) matched by rule " + ruleAWSLabelled + " in commit " + commit + "\n"
+	if got.stdout != want || got.code != exitKeysFound {
+		t.Errorf("got exit code %d and stdout:\n%s\nwant %d and:\n%s", got.code, got.stdout, exitKeysFound, want)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// globPattern matches slash separated paths against a glob where ** spans directories.
+type globPattern struct {
+	raw string
+	re  *regexp.Regexp
+	// base reports whether the pattern has no slash and is matched against the file name only.
+	base bool
+}
+
+// compileGlob compiles a glob such as "testdata/**" or "*.pem". A "**" matches any number of
+// directories, "*" and "?" match within a single path element.
+func compileGlob(pattern string) (globPattern, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return globPattern{}, err
+	}
+
+	return globPattern{raw: pattern, re: re, base: !strings.Contains(pattern, "/")}, nil
+}
+
+// compileGlobs compiles every pattern in the list.
+func compileGlobs(patterns []string) ([]globPattern, error) {
+	var globs []globPattern
+	for _, pattern := range patterns {
+		glob, err := compileGlob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		globs = append(globs, glob)
+	}
+
+	return globs, nil
+}
+
+// match reports whether the slash separated relative path matches the glob.
+func (g globPattern) match(relPath string) bool {
+	if g.base {
+		return g.re.MatchString(path.Base(relPath))
+	}
+
+	return g.re.MatchString(relPath)
+}
+
+// matchAnyGlob reports whether the path matches any of the globs.
+func matchAnyGlob(globs []globPattern, relPath string) bool {
+	for _, glob := range globs {
+		if glob.match(relPath) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -2,6 +2,20 @@ module chiragbhatia8/go-access-key-scanner
 
 go 1.19
 
-require github.com/aws/aws-sdk-go v1.44.234
+require (
+	github.com/aws/aws-sdk-go v1.44.234
+	github.com/prometheus/client_golang v1.16.0
+)
 
-require github.com/jmespath/go-jmespath v0.4.0 // indirect
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/jmespath/go-jmespath v0.4.0 // indirect
+	github.com/matttproud/golang_protobuf_extensions v1.0.4 // indirect
+	github.com/prometheus/client_model v0.3.0 // indirect
+	github.com/prometheus/common v0.42.0 // indirect
+	github.com/prometheus/procfs v0.10.1 // indirect
+	golang.org/x/sys v0.8.0 // indirect
+	google.golang.org/protobuf v1.30.0 // indirect
+)
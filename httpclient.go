@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+)
+
+// httpClientOptions configures the HTTP client every outbound call of the scanner is made with: AWS
+// validation and enrichment calls and GitHub API requests. Cloning is left to git and its own config.
+type httpClientOptions struct {
+	// DialTimeout bounds how long a connection takes to establish, TLS handshake included, when positive.
+	DialTimeout time.Duration
+	// Timeout bounds a whole request, reading the response included, when positive.
+	Timeout time.Duration
+	// CACert is a PEM file of certificate authorities trusted on top of the system ones, e.g. those
+	// of an internal endpoint or TLS intercepting proxy.
+	CACert string
+	// MaxIdleConnsPerHost is how many idle connections are kept open to each host for reuse, e.g. one
+	// per key validated at the same time.
+	MaxIdleConnsPerHost int
+}
+
+// newHTTPClient returns a client configured by o. Its transport is a copy of the default transport, so
+// proxies are still taken from the environment, and the client is meant to be shared by every call so
+// its connections are reused.
+func newHTTPClient(o httpClientOptions) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if o.DialTimeout > 0 {
+		transport.DialContext = (&net.Dialer{Timeout: o.DialTimeout, KeepAlive: 30 * time.Second}).DialContext
+		transport.TLSHandshakeTimeout = o.DialTimeout
+	}
+	if o.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = o.MaxIdleConnsPerHost
+	}
+
+	if o.CACert != "" {
+		pem, err := ioutil.ReadFile(o.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %v", err)
+		}
+
+		// The system roots stay trusted, so public endpoints such as AWS still verify
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("failed to read CA certificate %s: no PEM certificates found", o.CACert)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	return &http.Client{Transport: transport, Timeout: o.Timeout}, nil
+}
+
+// awsHTTPClient returns a copy of the client for an AWS session. The SDK sets the CA bundle of
+// AWS_CA_BUNDLE or the shared config on the transport of the client it is given, so the transport is
+// copied as well to keep that from changing the client of every other call.
+func awsHTTPClient(client *http.Client) *http.Client {
+	copied := *client
+	if transport, ok := client.Transport.(*http.Transport); ok {
+		copied.Transport = transport.Clone()
+	}
+
+	return &copied
+}
+
+// httpClientFlags registers the flags configuring the HTTP client on fs, for the scan and serve commands.
+func httpClientFlags(fs *flag.FlagSet) *httpClientOptions {
+	o := &httpClientOptions{}
+	fs.DurationVar(&o.DialTimeout, "dial-timeout", 0, "Maximum time to connect to AWS or GitHub, TLS handshake included (0 for no limit)")
+	fs.DurationVar(&o.Timeout, "http-timeout", 0, "Maximum time for a single HTTP request to AWS or GitHub, response included (0 for no limit)")
+	fs.StringVar(&o.CACert, "ca-cert", "", "PEM file of certificate authorities to trust on top of the system ones for calls to AWS and GitHub, e.g. of an internal endpoint or proxy")
+
+	return o
+}
+
+// httpClient returns the client outbound calls of the scan are made with: HTTPClient when set, and the
+// default client otherwise.
+func (opts ScanOptions) httpClient() *http.Client {
+	if opts.HTTPClient != nil {
+		return opts.HTTPClient
+	}
+
+	return http.DefaultClient
+}
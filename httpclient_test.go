@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingTransport is a RoundTripper counting the requests it makes with the default transport.
+type countingTransport struct {
+	requests int32
+}
+
+// RoundTrip counts the request and makes it.
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&c.requests, 1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	client, err := newHTTPClient(httpClientOptions{DialTimeout: 3 * time.Second, Timeout: 7 * time.Second, MaxIdleConnsPerHost: 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Timeout != 7*time.Second {
+		t.Errorf("got timeout %v, want 7s", client.Timeout)
+	}
+	transport := client.Transport.(*http.Transport)
+	if transport.TLSHandshakeTimeout != 3*time.Second || transport.MaxIdleConnsPerHost != 12 || transport.Proxy == nil {
+		t.Errorf("got TLS handshake timeout %v, %d idle connections per host and proxy %v, want 3s, 12 and the environment's",
+			transport.TLSHandshakeTimeout, transport.MaxIdleConnsPerHost, transport.Proxy != nil)
+	}
+	if transport == http.DefaultTransport {
+		t.Error("got the default transport changed, want a copy")
+	}
+}
+
+func TestNewHTTPClientCACert(t *testing.T) {
+	endpoint := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	// The handshake the untrusting client fails is expected
+	endpoint.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	endpoint.StartTLS()
+	defer endpoint.Close()
+	dir := t.TempDir()
+	caCert := filepath.Join(dir, "ca.pem")
+	ioutil.WriteFile(caCert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: endpoint.Certificate().Raw}), 0o600)
+
+	client, err := newHTTPClient(httpClientOptions{CACert: caCert})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(endpoint.URL)
+	if err != nil {
+		t.Fatalf("got error %v calling the endpoint signed by the CA", err)
+	}
+	resp.Body.Close()
+
+	// Without the CA the endpoint is not trusted
+	client, _ = newHTTPClient(httpClientOptions{})
+	if _, err := client.Get(endpoint.URL); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("got error %v without the CA, want the certificate rejected", err)
+	}
+
+	notPEM := filepath.Join(dir, "ca.txt")
+	ioutil.WriteFile(notPEM, []byte("not a certificate"), 0o600)
+	for _, path := range []string{notPEM, filepath.Join(dir, "missing.pem")} {
+		if _, err := newHTTPClient(httpClientOptions{CACert: path}); err == nil {
+			t.Errorf("%s: got no error", filepath.Base(path))
+		}
+	}
+}
+
+func TestAWSSessionUsesHTTPClient(t *testing.T) {
+	withoutAWSCredentials(t)
+	// The SDK sets the CA bundle of AWS_CA_BUNDLE on the transport, so it must be an *http.Transport,
+	// whose dials are counted
+	var dials int32
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	}
+	client := &http.Client{Transport: transport, Timeout: 9 * time.Second}
+	opts := ScanOptions{AWSEndpoint: newSTSStub(t, testAccessKeyID).URL, ValidationMethod: validationMethodSTS, HTTPClient: client}
+
+	sess, err := opts.awsSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sess.Config.HTTPClient; got == client || got.Timeout != 9*time.Second {
+		t.Errorf("got session client %+v, want a copy of the configured client with its timeout", got)
+	}
+
+	valid, err := opts.stsValidator().Validate(context.Background(), testAccessKeyID, testSecretAccessKey)
+	if err != nil || !valid {
+		t.Fatalf("got %v, %v, want the key valid", valid, err)
+	}
+	if n := atomic.LoadInt32(&dials); n != 1 {
+		t.Errorf("got %d connections made by the configured client, want 1", n)
+	}
+}
+
+func TestAWSHTTPClientCopiesTransport(t *testing.T) {
+	client, _ := newHTTPClient(httpClientOptions{Timeout: time.Second})
+
+	copied := awsHTTPClient(client)
+	if copied == client || copied.Transport == client.Transport || copied.Timeout != time.Second {
+		t.Errorf("got client %+v, want a copy with its own transport and the same timeout", copied)
+	}
+}
+
+func TestGitHubValidatorUsesHTTPClient(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"login":"octocat"}`))
+	}))
+	defer api.Close()
+	transport := &countingTransport{}
+
+	valid, err := githubValidator{baseURL: api.URL, client: &http.Client{Transport: transport}}.Validate(context.Background(), "", "ghp_token")
+	if err != nil || !valid {
+		t.Fatalf("got %v, %v, want the token valid", valid, err)
+	}
+	if n := atomic.LoadInt32(&transport.requests); n != 1 {
+		t.Errorf("got %d requests through the configured client, want 1", n)
+	}
+}
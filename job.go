@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// jobSpec is the layout of a -job file: the scan options shared by every repository, and the
+// repositories to scan, each an object like the body of POST /scan whose options override the defaults.
+type jobSpec struct {
+	Defaults json.RawMessage   `json:"defaults"`
+	Repos    []json.RawMessage `json:"repos"`
+}
+
+// loadJob reads a job spec, returning the default options and the options of every repository.
+func loadJob(path string) (ScanOptions, []ScanOptions, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ScanOptions{}, nil, fmt.Errorf("failed to read job: %v", err)
+	}
+
+	var spec jobSpec
+	if err := decodeStrict(data, &spec); err != nil {
+		return ScanOptions{}, nil, fmt.Errorf("failed to parse job %s: %v", path, err)
+	}
+
+	var defaults ScanOptions
+	if len(spec.Defaults) > 0 {
+		if err := decodeStrict(spec.Defaults, &defaults); err != nil {
+			return ScanOptions{}, nil, fmt.Errorf("failed to parse defaults of job %s: %v", path, err)
+		}
+	}
+	if len(spec.Repos) == 0 {
+		return ScanOptions{}, nil, fmt.Errorf("job %s has no repos", path)
+	}
+
+	// Every repository starts from the defaults, so only the options it sets are overridden. They are
+	// decoded again for each one rather than copied, since a copy would share the slices of the
+	// defaults, which decoding an override writes into.
+	jobs := make([]ScanOptions, len(spec.Repos))
+	for i, raw := range spec.Repos {
+		if len(spec.Defaults) > 0 {
+			if err := decodeStrict(spec.Defaults, &jobs[i]); err != nil {
+				return ScanOptions{}, nil, fmt.Errorf("failed to parse defaults of job %s: %v", path, err)
+			}
+		}
+		if err := decodeStrict(raw, &jobs[i]); err != nil {
+			return ScanOptions{}, nil, fmt.Errorf("failed to parse repo %d of job %s: %v", i+1, path, err)
+		}
+		if jobs[i].RepoURL == "" {
+			return ScanOptions{}, nil, fmt.Errorf("repo %d of job %s has no repo URL", i+1, path)
+		}
+	}
+
+	return defaults, jobs, nil
+}
+
+// decodeStrict decodes JSON into v, rejecting unknown fields so a misspelt option is not ignored.
+func decodeStrict(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// ScanJob scans every repository of the job spec at path with its own options and combines their
+// results like ScanRepos. The baseline and findings cap of the defaults apply to the whole run.
+func ScanJob(ctx context.Context, path string, onError func(repoURL string, err error)) (*ScanResult, error) {
+	defaults, jobs, err := loadJob(path)
+	if err != nil {
+		return nil, err
+	}
+	scrubJobTokens(defaults, jobs)
+
+	return scanEach(ctx, jobs, defaults, onError)
+}
+
+// PlanJob returns the plan of the scan of every repository of the job spec at path, like PlanScan.
+func PlanJob(ctx context.Context, path string) ([]repoPlan, error) {
+	defaults, jobs, err := loadJob(path)
+	if err != nil {
+		return nil, err
+	}
+	scrubJobTokens(defaults, jobs)
+
+	return PlanScan(ctx, jobs)
+}
+
+// scrubJobTokens scrubs the tokens of the job from logs, since they must never be logged.
+func scrubJobTokens(defaults ScanOptions, jobs []ScanOptions) {
+	logScrubber.add(defaults.Token)
+	for _, job := range jobs {
+		logScrubber.add(job.Token)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeJob writes a job spec and returns its path.
+func writeJob(t *testing.T, spec string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "job.json")
+	if err := ioutil.WriteFile(path, []byte(spec), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestScanJobPerRepositoryOptions(t *testing.T) {
+	app := newFixtureRepo(t)
+	app.commit("add keys", map[string]string{
+		"config.env":        keyFile(testAccessKeyID, testSecretAccessKey),
+		"vendor/legacy.env": keyFile(testAccessKeyID2, testSecretAccessKey2),
+	})
+	infra := newFixtureRepo(t)
+	infra.commit("add key", map[string]string{"deploy.env": keyFile(testAccessKeyID2, testSecretAccessKey2)})
+	infra.commit("readme", map[string]string{"README.md": "hello\n"})
+
+	// app excludes its vendored files, and infra only scans its latest commit, which still holds the key
+	path := writeJob(t, `{
+  "defaults": {"no_validate": true, "max_commits": 10},
+  "repos": [
+    {"repo": "`+app.dir+`", "exclude": ["vendor/**"]},
+    {"repo": "`+infra.dir+`", "tip_only": true}
+  ]
+}`)
+
+	result, err := ScanJob(context.Background(), path, func(repoURL string, err error) {
+		t.Errorf("scanning %s: %v", repoURL, err)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found []string
+	for _, f := range result.Findings {
+		found = append(found, f.Repo+" "+f.File)
+	}
+	sort.Strings(found)
+	want := []string{app.dir + " config.env", infra.dir + " deploy.env"}
+	sort.Strings(want)
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("got findings %v, want %v", found, want)
+	}
+	// Only the latest commit of infra and the single commit of app are scanned
+	if result.Commits != 2 {
+		t.Errorf("got %d commits, want 2", result.Commits)
+	}
+}
+
+func TestScanJobPerRepositoryBranch(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("readme", map[string]string{"README.md": "hello\n"})
+	repo.git("checkout", "-q", "-b", "release")
+	repo.commit("add key", map[string]string{"config.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+	repo.git("checkout", "-q", "main")
+
+	// Only the repository scanning the release branch sees the key
+	path := writeJob(t, `{
+  "defaults": {"no_validate": true},
+  "repos": [{"repo": "`+repo.dir+`"}, {"repo": "`+repo.dir+`", "branch": "release"}]
+}`)
+
+	_, jobs, err := loadJob(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []int{0, 1} {
+		result, err := Scan(context.Background(), jobs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Findings) != want {
+			t.Errorf("branch %q: got %d findings, want %d", jobs[i].Branch, len(result.Findings), want)
+		}
+	}
+}
+
+func TestLoadJobDefaults(t *testing.T) {
+	path := writeJob(t, `{"defaults": {"region": "eu-west-1", "max_commits": 5}, "repos": [{"repo": "a"}, {"repo": "b", "max_commits": 1}]}`)
+
+	defaults, jobs, err := loadJob(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if defaults.Region != "eu-west-1" || len(jobs) != 2 {
+		t.Fatalf("got defaults %+v and %d jobs", defaults, len(jobs))
+	}
+	if jobs[0].Region != "eu-west-1" || jobs[0].MaxCommits != 5 || jobs[1].MaxCommits != 1 || jobs[1].RepoURL != "b" {
+		t.Errorf("got jobs %+v and %+v, want the defaults overridden per repository", jobs[0], jobs[1])
+	}
+}
+
+func TestLoadJobDefaultsAreNotShared(t *testing.T) {
+	path := writeJob(t, `{"defaults": {"exclude": ["x", "y"]}, "repos": [{"repo": "a", "exclude": ["a"]}, {"repo": "b", "exclude": ["b"]}, {"repo": "c"}]}`)
+
+	defaults, jobs, err := loadJob(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range [][]string{{"a"}, {"b"}, {"x", "y"}} {
+		if !reflect.DeepEqual(jobs[i].Exclude, want) {
+			t.Errorf("repo %s excludes %v, want %v", jobs[i].RepoURL, jobs[i].Exclude, want)
+		}
+	}
+	if !reflect.DeepEqual(defaults.Exclude, []string{"x", "y"}) {
+		t.Errorf("defaults exclude %v after the overrides, want [x y]", defaults.Exclude)
+	}
+}
+
+func TestLoadJobInvalid(t *testing.T) {
+	tests := []struct {
+		spec, err string
+	}{
+		{`not json`, "failed to parse job"},
+		{`{"repos": []}`, "has no repos"},
+		{`{"repos": [{"max_commits": 1}]}`, "repo 1 of job"},
+		{`{"repos": [{"repo": "a", "max_comits": 1}]}`, `unknown field "max_comits"`},
+		{`{"defaults": {"regoin": "x"}, "repos": [{"repo": "a"}]}`, "failed to parse defaults"},
+	}
+
+	for _, tt := range tests {
+		if _, _, err := loadJob(writeJob(t, tt.spec)); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.spec, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import "strings"
+
+// keyType describes the kind of AWS identifier encoded in an access key ID prefix.
+type keyType struct {
+	Prefix      string
+	Name        string
+	Description string
+}
+
+// Strategies used to decide how a discovered access key is validated.
+const (
+	// validateIAM validates the key with AWS, using the configured validation method.
+	validateIAM = iota
+	// skipTemporary marks STS credentials, which cannot be used without the session token.
+	skipTemporary
+	// skipNotCredential marks unique IDs that are not usable as credentials at all.
+	skipNotCredential
+)
+
+// knownKeyTypes lists the AWS unique identifier prefixes documented by IAM.
+var knownKeyTypes = []keyType{
+	{"AKIA", "access-key", "long-term IAM user access key"},
+	{"ASIA", "temporary-access-key", "temporary STS access key"},
+	{"ABIA", "sts-bearer-token", "STS service bearer token"},
+	{"ACCA", "context-credential", "context-specific credential"},
+	{"AGPA", "group-id", "IAM group ID"},
+	{"AIDA", "user-id", "IAM user ID"},
+	{"AIPA", "instance-profile-id", "EC2 instance profile ID"},
+	{"ANPA", "managed-policy-id", "managed policy ID"},
+	{"ANVA", "managed-policy-version-id", "version in a managed policy"},
+	{"APKA", "public-key-id", "public key ID"},
+	{"AROA", "role-id", "IAM role ID"},
+	{"ASCA", "certificate-id", "certificate ID"},
+}
+
+// unknownKeyType is returned for access key IDs without a recognised prefix.
+var unknownKeyType = keyType{Prefix: "", Name: "unknown", Description: "unrecognised key type"}
+
+// classifyKeyType returns the key type identified by the prefix of the given access key ID.
+func classifyKeyType(accessKeyID string) keyType {
+	for _, kt := range knownKeyTypes {
+		if strings.HasPrefix(accessKeyID, kt.Prefix) {
+			return kt
+		}
+	}
+
+	return unknownKeyType
+}
+
+// validationStrategy returns how a key of this type should be validated.
+func (kt keyType) validationStrategy() int {
+	switch kt.Prefix {
+	case "AKIA":
+		return validateIAM
+	case "ASIA":
+		return skipTemporary
+	default:
+		return skipNotCredential
+	}
+}
+
+// String returns a human readable representation of the key type.
+func (kt keyType) String() string {
+	return kt.Description
+}
+
+// MarshalText encodes the key type as its short name.
+func (kt keyType) MarshalText() ([]byte, error) {
+	return []byte(kt.Name), nil
+}
+
+// UnmarshalText decodes a key type from its short name.
+func (kt *keyType) UnmarshalText(text []byte) error {
+	for _, known := range knownKeyTypes {
+		if known.Name == string(text) {
+			*kt = known
+			return nil
+		}
+	}
+
+	*kt = unknownKeyType
+	return nil
+}
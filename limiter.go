@@ -0,0 +1,91 @@
+package main
+
+import (
+	"log"
+	"sync"
+)
+
+// concurrencyLimiter bounds the validation calls in flight. When adaptive, it halves the limit when
+// a call is throttled and raises it by one after a limit's worth of calls succeed, up to max, like
+// TCP congestion control, so a throttling API is backed off from rather than retried at full speed.
+type concurrencyLimiter struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	limit    int
+	max      int
+	inFlight int
+	adaptive bool
+	verbose  bool
+	// successes counts the calls that succeeded since the limit last changed.
+	successes int
+	// stale counts the calls still in flight from before the last decrease, whose throttling is
+	// already accounted for.
+	stale int
+}
+
+// newConcurrencyLimiter returns a limiter allowing max calls in flight, adapting the limit under
+// throttling when adaptive is set and logging its changes when verbose is set.
+func newConcurrencyLimiter(max int, adaptive, verbose bool) *concurrencyLimiter {
+	l := &concurrencyLimiter{limit: max, max: max, adaptive: adaptive, verbose: verbose}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// acquire waits until another call may start.
+func (l *concurrencyLimiter) acquire() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for l.inFlight >= l.limit {
+		l.cond.Wait()
+	}
+	l.inFlight++
+}
+
+// release ends a call, adapting the limit to whether it was throttled.
+func (l *concurrencyLimiter) release(throttled bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	defer l.cond.Broadcast()
+
+	l.inFlight--
+	if !l.adaptive {
+		return
+	}
+
+	// Calls started before the last decrease were sent at the old rate
+	if l.stale > 0 {
+		l.stale--
+		return
+	}
+
+	switch {
+	case throttled:
+		l.limit /= 2
+		if l.limit < 1 {
+			l.limit = 1
+		}
+		l.successes = 0
+		l.stale = l.inFlight
+		if l.verbose {
+			log.Printf("Validation throttled, reducing concurrency to %d", l.limit)
+		}
+	case l.limit < l.max:
+		l.successes++
+		if l.successes >= l.limit {
+			l.limit++
+			l.successes = 0
+			if l.verbose {
+				log.Printf("Validation no longer throttled, raising concurrency to %d", l.limit)
+			}
+		}
+	}
+}
+
+// current returns the current limit.
+func (l *concurrencyLimiter) current() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.limit
+}
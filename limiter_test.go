@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestConcurrencyLimiterAIMD(t *testing.T) {
+	l := newConcurrencyLimiter(8, true, false)
+	for i := 0; i < 8; i++ {
+		l.acquire()
+	}
+
+	// The first throttled call halves the limit, and the calls already in flight do not halve it again
+	l.release(true)
+	if got := l.current(); got != 4 {
+		t.Fatalf("got limit %d after throttling, want 4", got)
+	}
+	for i := 0; i < 7; i++ {
+		l.release(true)
+	}
+	if got := l.current(); got != 4 {
+		t.Fatalf("got limit %d after the stale calls, want 4", got)
+	}
+
+	// A limit's worth of successful calls raises it by one
+	for i := 0; i < 4; i++ {
+		l.acquire()
+		l.release(false)
+	}
+	if got := l.current(); got != 5 {
+		t.Errorf("got limit %d after 4 successes, want 5", got)
+	}
+
+	l.acquire()
+	l.release(true)
+	l.acquire()
+	l.release(true)
+	l.acquire()
+	l.release(true)
+	if got := l.current(); got != 1 {
+		t.Errorf("got limit %d, want it never below 1", got)
+	}
+}
+
+func TestConcurrencyLimiterNotAdaptive(t *testing.T) {
+	l := newConcurrencyLimiter(3, false, false)
+	l.acquire()
+	l.release(true)
+	if got := l.current(); got != 3 {
+		t.Errorf("got limit %d, want 3 without adapting", got)
+	}
+}
+
+// throttlingValidator throttles every call until it has throttled the given number, then reports
+// every key valid, recording the most calls it saw in flight at once.
+type throttlingValidator struct {
+	mu          sync.Mutex
+	throttles   int
+	inFlight    int
+	maxInFlight int
+}
+
+// Validate implements keyValidator.
+func (v *throttlingValidator) Validate(ctx context.Context, accessKeyID, secretAccessKey string) (bool, error) {
+	v.mu.Lock()
+	v.inFlight++
+	if v.inFlight > v.maxInFlight {
+		v.maxInFlight = v.inFlight
+	}
+	throttled := v.throttles > 0
+	if throttled {
+		v.throttles--
+	}
+	v.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	v.mu.Lock()
+	v.inFlight--
+	v.mu.Unlock()
+	if throttled {
+		return false, awserr.New("Throttling", "Rate exceeded", nil)
+	}
+	return true, nil
+}
+
+// throttledFindings returns n findings of distinct long-term keys.
+func throttledFindings(n int) []Finding {
+	var findings []Finding
+	for i := 0; i < n; i++ {
+		findings = append(findings, newFinding("", "a.env", keyMatch{AccessKeyID: fmt.Sprintf("AKIATEST%012d", i), SecretAccessKey: testSecretAccessKey}))
+	}
+	return findings
+}
+
+func TestAdaptivePoolReducesConcurrencyUnderThrottling(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	validator := &throttlingValidator{throttles: 8}
+	pool := validationPool{validator: validator, byRule: map[string]keyValidator{}, concurrency: 8, timeout: time.Second, adaptive: true, verbose: true}
+	findings := throttledFindings(16)
+
+	pool.run(context.Background(), findings)
+
+	if !strings.Contains(logs.String(), "Validation throttled, reducing concurrency to 4") {
+		t.Errorf("got logs %q, want the concurrency halved", logs.String())
+	}
+	if !strings.Contains(logs.String(), "ending at a concurrency of") {
+		t.Errorf("got logs %q, want the final concurrency", logs.String())
+	}
+	for _, f := range findings {
+		if f.Status != statusValid {
+			t.Errorf("got finding %s %s %q, want throttled calls retried until valid", f.AccessKeyID, f.Status, f.Error)
+		}
+	}
+	if validator.maxInFlight > 8 {
+		t.Errorf("got %d calls in flight, want at most 8", validator.maxInFlight)
+	}
+}
+
+func TestPoolWithoutAdaptingLeavesThrottledKeysUnverified(t *testing.T) {
+	validator := &throttlingValidator{throttles: 1}
+	pool := validationPool{validator: validator, byRule: map[string]keyValidator{}, concurrency: 1, timeout: time.Second}
+	findings := throttledFindings(2)
+
+	pool.run(context.Background(), findings)
+
+	// The throttled call is not retried, whichever of the two keys it was
+	statuses := make(map[string]int)
+	for _, f := range findings {
+		statuses[f.Status]++
+		if f.Status == statusUnverified && !strings.HasPrefix(f.Error, "validation throttled") {
+			t.Errorf("got error %q, want the key unverified because it was throttled", f.Error)
+		}
+	}
+	if statuses[statusUnverified] != 1 || statuses[statusValid] != 1 {
+		t.Errorf("got statuses %v, want one key throttled and one valid", statuses)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// lintFinding is a finding in the minimal, linter-style shape editor integrations consume.
+type lintFinding struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Col     int    `json:"col"`
+	RuleID  string `json:"ruleId"`
+	Message string `json:"message"`
+}
+
+// lintFindings converts the findings of a scan of the working tree at root into lint findings,
+// locating the column of every key in its file.
+func lintFindings(root string, findings []Finding) []lintFinding {
+	lines := make(map[string][]string)
+	lints := []lintFinding{}
+	for _, f := range findings {
+		if _, ok := lines[f.File]; !ok {
+			lines[f.File] = readLines(filepath.Join(root, f.File))
+		}
+
+		lints = append(lints, lintFinding{
+			File:    f.File,
+			Line:    f.Line,
+			Col:     keyColumn(lines[f.File], f),
+			RuleID:  f.Rule,
+			Message: lintMessage(f),
+		})
+	}
+
+	return lints
+}
+
+// readLines returns the lines of the file, or nil when it cannot be read.
+func readLines(path string) []string {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	return lines
+}
+
+// keyColumn returns the 1-based column, in characters, where the finding's access key ID, or its
+// secret, starts on its line. It is 1 when the key is not on the line as written, e.g. when it was
+// joined from several string literals or is in a notebook cell.
+func keyColumn(lines []string, f Finding) int {
+	if f.Cell > 0 || f.Line < 1 || f.Line > len(lines) {
+		return 1
+	}
+	line := lines[f.Line-1]
+
+	for _, key := range []string{f.AccessKeyID, f.SecretAccessKey} {
+		if key == "" {
+			continue
+		}
+		if i := strings.Index(line, key); i >= 0 {
+			return utf8.RuneCountInString(line[:i]) + 1
+		}
+	}
+
+	return 1
+}
+
+// lintMessage describes the finding without revealing its secret.
+func lintMessage(f Finding) string {
+	if f.AccessKeyID == "" {
+		return fmt.Sprintf("Possible secret matching rule %s: %s", f.Rule, redact(f.SecretAccessKey))
+	}
+	if f.SecretAccessKey == "" {
+		return fmt.Sprintf("Possible %s %s", f.KeyType, f.AccessKeyID)
+	}
+
+	return fmt.Sprintf("Possible %s %s with its secret", f.KeyType, f.AccessKeyID)
+}
+
+// writeLintJSON writes the findings of a scan of the working tree at root as a JSON array of lint findings.
+func writeLintJSON(w io.Writer, root string, result *ScanResult) error {
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(lintFindings(root, result.Findings)); err != nil {
+		return fmt.Errorf("failed to write findings: %v", err)
+	}
+
+	return nil
+}
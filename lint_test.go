@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// writeWorkspace writes a workspace fixture with a key pair in an indented Python file, one with an
+// accented comment before it, and a clean file.
+func writeWorkspace(t *testing.T) *fixtureRepo {
+	repo := newFixtureRepo(t)
+	repo.commit("add settings", map[string]string{
+		"src/settings.py": "class Settings:\n    aws_access_key_id = \"" + testAccessKeyID + "\"\n    aws_secret_access_key = \"" + testSecretAccessKey + "\"\n",
+		"README.md":       "hello\n",
+	})
+	repo.write(map[string]string{"deploy/prod.env": "# clé: AWS_ACCESS_KEY_ID=" + testAccessKeyID2 + "\nAWS_SECRET_ACCESS_KEY=" + testSecretAccessKey2 + "\n"})
+
+	return repo
+}
+
+func TestLintJSON(t *testing.T) {
+	repo := writeWorkspace(t)
+	result, err := ScanPath(context.Background(), repo.dir, ScanOptions{NoValidate: true, Untracked: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := writeLintJSON(&out, repo.dir, result); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every finding has exactly the minimal fields
+	var raw []map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &raw); err != nil {
+		t.Fatalf("invalid JSON %s: %v", out.String(), err)
+	}
+	for _, finding := range raw {
+		keys := make(map[string]bool)
+		for key := range finding {
+			keys[key] = true
+		}
+		if want := map[string]bool{"file": true, "line": true, "col": true, "ruleId": true, "message": true}; !reflect.DeepEqual(keys, want) {
+			t.Errorf("got fields %v, want file, line, col, ruleId and message", keys)
+		}
+	}
+
+	var lints []lintFinding
+	if err := json.Unmarshal(out.Bytes(), &lints); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]lintFinding{
+		"deploy/prod.env": {File: "deploy/prod.env", Line: 1, Col: 26, RuleID: ruleAWSLabelled, Message: "Possible long-term IAM user access key " + testAccessKeyID2 + " with its secret"},
+		"src/settings.py": {File: "src/settings.py", Line: 2, Col: 26, RuleID: ruleAWSLabelled, Message: "Possible long-term IAM user access key " + testAccessKeyID + " with its secret"},
+	}
+	if len(lints) != len(want) {
+		t.Fatalf("got lint findings %+v, want %d", lints, len(want))
+	}
+	for _, lint := range lints {
+		if lint != want[lint.File] {
+			t.Errorf("got %+v, want %+v", lint, want[lint.File])
+		}
+	}
+}
+
+func TestLintJSONNoFindings(t *testing.T) {
+	var out bytes.Buffer
+	if err := writeLintJSON(&out, t.TempDir(), &ScanResult{}); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "[]\n" {
+		t.Errorf("got %q, want an empty array", out.String())
+	}
+}
+
+func TestCLIListFindingsJSON(t *testing.T) {
+	repo := writeWorkspace(t)
+
+	got := runScanner(t, "-path", repo.dir, "-untracked", "-list-findings-json")
+	var lints []lintFinding
+	if err := json.Unmarshal([]byte(got.stdout), &lints); err != nil {
+		t.Fatalf("stdout is not a JSON array of findings: %v\n%s", err, got.stdout)
+	}
+	if len(lints) != 2 {
+		t.Errorf("got %d findings, want 2:\n%s", len(lints), got.stdout)
+	}
+	if got.code != exitKeysFound {
+		t.Errorf("got exit code %d, want %d; stderr:\n%s", got.code, exitKeysFound, got.stderr)
+	}
+
+	// Only a path is linted
+	if got := runScanner(t, "-repo", repo.dir, "-list-findings-json"); got.code == 0 || got.stdout != "" {
+		t.Errorf("got stdout %q and exit code %d, want -list-findings-json without -path rejected", got.stdout, got.code)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// stringLiteral matches a single or double quoted string literal on one line.
+const stringLiteral = `(?:"(?:[^"\\\n]|\\.)*"|'(?:[^'\\\n]|\\.)*')`
+
+var (
+	// plusConcatenation matches literals joined with +, as in Go and JavaScript.
+	plusConcatenation = regexp.MustCompile(stringLiteral + `(?:\s*\+\s*` + stringLiteral + `)+`)
+	// adjacentConcatenation also matches Python's implicit concatenation of adjacent literals.
+	adjacentConcatenation = regexp.MustCompile(stringLiteral + `(?:\s*(?:\+\s*)?` + stringLiteral + `)+`)
+	literalPattern        = regexp.MustCompile(stringLiteral)
+)
+
+// concatenationPatterns maps the source file extensions whose string concatenations are joined
+// to the pattern matching them.
+var concatenationPatterns = map[string]*regexp.Regexp{
+	".go":  plusConcatenation,
+	".js":  plusConcatenation,
+	".jsx": plusConcatenation,
+	".mjs": plusConcatenation,
+	".cjs": plusConcatenation,
+	".ts":  plusConcatenation,
+	".tsx": plusConcatenation,
+	".py":  adjacentConcatenation,
+}
+
+// joinLiterals joins concatenated string literals in Go, Python and JavaScript source, so a key split
+// as "AKIA" + "..." is matched as one literal. Other files are returned unchanged. The newlines inside a
+// concatenation are moved after the joined literal so line numbers stay the same.
+func joinLiterals(path string, content []byte) []byte {
+	pattern, ok := concatenationPatterns[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return content
+	}
+
+	return pattern.ReplaceAllFunc(content, func(concatenation []byte) []byte {
+		literals := literalPattern.FindAll(concatenation, -1)
+		quote := literals[0][0]
+
+		joined := []byte{quote}
+		for _, literal := range literals {
+			joined = append(joined, literal[1:len(literal)-1]...)
+		}
+		joined = append(joined, quote)
+
+		return append(joined, bytes.Repeat([]byte("\n"), bytes.Count(concatenation, []byte("\n")))...)
+	})
+}
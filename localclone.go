@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+)
+
+// updateLocalClone fetches the new commits of the existing clone at dir from its origin remote and
+// fast-forwards its checked out branch to them, so a recurring scan does not clone the repository
+// again. It returns the URL of the origin. The clone is rejected when it does not track repoURL, when
+// set, has uncommitted changes or no branch checked out, or has diverged from its upstream, e.g.
+// after local commits or a force push, since its history would no longer be the repository's.
+func updateLocalClone(dir, repoURL, token string) (string, error) {
+	origin, err := gitIn(dir, nil, "remote", "get-url", "origin")
+	if err != nil {
+		return "", fmt.Errorf("%s is not a clone with an origin remote: %w", dir, err)
+	}
+	if repoURL != "" && strings.TrimSuffix(origin, "/") != strings.TrimSuffix(repoURL, "/") {
+		return "", fmt.Errorf("local clone %s is a clone of %s, not %s", dir, origin, repoURL)
+	}
+
+	status, err := gitIn(dir, nil, "status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		return "", err
+	}
+	if status != "" {
+		return "", fmt.Errorf("local clone %s has uncommitted changes", dir)
+	}
+
+	branch, err := gitIn(dir, nil, "symbolic-ref", "-q", "--short", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("local clone %s has no branch checked out", dir)
+	}
+	before, err := headCommit(dir)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := gitIn(dir, tokenEnv(token), "fetch", "-q", "--prune", "origin"); err != nil {
+		return "", fmt.Errorf("failed to fetch into local clone %s: %w", dir, err)
+	}
+	upstream, err := gitIn(dir, nil, "rev-parse", "--verify", "-q", branch+"@{upstream}")
+	if err != nil {
+		return "", fmt.Errorf("branch %s of local clone %s has no upstream branch", branch, dir)
+	}
+	if !isAncestorOf(dir, before, upstream) {
+		return "", fmt.Errorf("branch %s of local clone %s has diverged from its upstream; clone the repository again", branch, dir)
+	}
+
+	if _, err := gitIn(dir, nil, "merge", "-q", "--ff-only", upstream); err != nil {
+		return "", fmt.Errorf("failed to update local clone %s: %w", dir, err)
+	}
+	fetched, err := gitIn(dir, nil, "rev-list", "--count", before+".."+upstream)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("Fetched %s new commits into local clone %s", fetched, dir)
+
+	return origin, nil
+}
+
+// isAncestorOf reports whether the commit is an ancestor of, or the same as, descendant.
+func isAncestorOf(repoPath, commit, descendant string) bool {
+	cmd := exec.Command("git", "merge-base", "--is-ancestor", commit, descendant)
+	cmd.Dir = repoPath
+	return cmd.Run() == nil
+}
+
+// gitIn runs git with the given arguments in dir, with env as its environment when not nil, and
+// returns its trimmed output.
+func gitIn(dir string, env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = env
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %w. Output: %s", args[0], commandError(err), strings.TrimSpace(string(output)))
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
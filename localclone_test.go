@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// localClone clones the repository into a new directory, as a user would keep it for recurring scans.
+func localClone(t *testing.T, repo *fixtureRepo) *fixtureRepo {
+	t.Helper()
+
+	dir := filepath.Join(t.TempDir(), "clone")
+	if output, err := exec.Command("git", "clone", "-q", repo.dir, dir).CombinedOutput(); err != nil {
+		t.Fatalf("git clone: %v: %s", err, output)
+	}
+	clone := &fixtureRepo{t: t, dir: dir}
+	clone.git("config", "user.name", "Test")
+	clone.git("config", "user.email", "test@example.com")
+
+	return clone
+}
+
+func TestScanLocalCloneFetchesNewCommits(t *testing.T) {
+	upstream := newFixtureRepo(t)
+	upstream.commit("add old key", map[string]string{"old.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+	clone := localClone(t, upstream)
+	opts := ScanOptions{LocalClone: clone.dir, NoValidate: true, Diff: true, DB: filepath.Join(t.TempDir(), "scans.json"), SinceLastScan: true}
+
+	result, err := Scan(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Commits != 1 || len(result.Findings) != 1 || result.Repo != upstream.dir {
+		t.Fatalf("first scan: got %d commits and findings %+v of %s, want the old key of %s", result.Commits, result.Findings, result.Repo, upstream.dir)
+	}
+
+	added := upstream.commit("add new key", map[string]string{"new.env": keyFile(testAccessKeyID2, testSecretAccessKey2)})
+	result, err = Scan(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if head := clone.git("rev-parse", "HEAD"); head != added {
+		t.Errorf("got local clone at %s, want it fast-forwarded to the fetched %s", head, added)
+	}
+	if result.Commits != 1 || len(result.Findings) != 1 || result.Findings[0].Commit != added || result.Findings[0].File != "new.env" {
+		t.Errorf("second scan: got %d commits and findings %+v, want only the fetched commit scanned", result.Commits, result.Findings)
+	}
+}
+
+func TestUpdateLocalCloneRejectsStaleClones(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(upstream, clone *fixtureRepo)
+		repoURL string
+		err     string
+	}{
+		{"diverged", func(upstream, clone *fixtureRepo) {
+			clone.commit("local change", map[string]string{"local.txt": "local\n"})
+			upstream.commit("upstream change", map[string]string{"upstream.txt": "upstream\n"})
+		}, "", "has diverged from its upstream"},
+		{"force pushed", func(upstream, clone *fixtureRepo) {
+			upstream.git("commit", "-q", "--amend", "-m", "rewritten")
+		}, "", "has diverged from its upstream"},
+		{"uncommitted changes", func(upstream, clone *fixtureRepo) {
+			clone.write(map[string]string{"README.md": "edited\n"})
+		}, "", "has uncommitted changes"},
+		{"detached", func(upstream, clone *fixtureRepo) {
+			clone.git("checkout", "-q", "--detach")
+		}, "", "has no branch checked out"},
+		{"other repository", func(upstream, clone *fixtureRepo) {}, "https://github.com/acme/other", "not https://github.com/acme/other"},
+	}
+
+	for _, tt := range tests {
+		upstream := newFixtureRepo(t)
+		upstream.commit("readme", map[string]string{"README.md": "hello\n"})
+		clone := localClone(t, upstream)
+		tt.prepare(upstream, clone)
+
+		if _, err := updateLocalClone(clone.dir, tt.repoURL, ""); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestUpdateLocalCloneNotAClone(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("readme", map[string]string{"README.md": "hello\n"})
+
+	if _, err := updateLocalClone(repo.dir, "", ""); err == nil || !strings.Contains(err.Error(), "is not a clone with an origin remote") {
+		t.Errorf("got error %v, want a repository without origin rejected", err)
+	}
+}
@@ -0,0 +1,33 @@
+//go:build !unix
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// lockFile takes an exclusive lock by creating the file at path, which must not exist, waiting until
+// no other scan holds it or ctx is cancelled, since file locks are not supported on this platform. It
+// returns a function releasing the lock by removing the file. A lock file left by a process that died
+// holding it must be removed by hand.
+func lockFile(ctx context.Context, path string) (func(), error) {
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0o600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to lock %s: %v", path, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
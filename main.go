@@ -1,15 +1,23 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -18,240 +26,1348 @@ import (
 	"github.com/aws/aws-sdk-go/service/iam"
 )
 
-// cloneRepo clones the repository from the given URL and returns the local path to the cloned repository.
-func cloneRepo(url string) (string, error) {
+// cloneRepo clones the repository from the given URL into a new directory under tmpDir, the system
+// temporary directory when empty, and returns the local path to the cloned repository. The branch is
+// checked out instead of the default one when it is not empty, and only the latest depth commits are
+// cloned when depth is positive. The progress git reports is passed to
+// onProgress when it is not nil, and cancelling ctx stops the clone.
+// A non-empty token is sent as HTTP basic auth through git's environment so it never appears in the command line or output.
+func cloneRepo(ctx context.Context, url, branch, token, tmpDir string, depth int, onProgress func(ProgressEvent)) (string, error) {
 	// Create a temporary directory to store the cloned repository
-	tempDir, err := ioutil.TempDir("", "repo-clone-")
+	tempDir, err := ioutil.TempDir(tmpDir, "repo-clone-")
 	if err != nil {
 		return "", fmt.Errorf("failed to create temporary directory: %v", err)
 	}
 
-	// Run the git clone command
-	cmd := exec.Command("git", "clone", url, tempDir)
-	output, err := cmd.CombinedOutput()
+	// Run the git clone command, ending its options with "--" so the URL is never taken for one
+	args, source := []string{"clone"}, url
+	if depth > 0 {
+		args, source = append(args, "--depth", strconv.Itoa(depth)), localCloneURL(url)
+	}
+	if branch != "" {
+		args = append(args, "--branch", branch)
+	}
+	args = append(args, "--", source, tempDir)
+	if onProgress != nil {
+		args = append(args[:1], append([]string{"--progress"}, args[1:]...)...)
+	}
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = tokenEnv(token)
+	var output string
+	if onProgress != nil {
+		progress := &cloneProgressWriter{onProgress: onProgress}
+		cmd.Stdout, cmd.Stderr = progress, progress
+		err = cmd.Run()
+		output = progress.String()
+	} else {
+		var combined []byte
+		combined, err = cmd.CombinedOutput()
+		output = string(combined)
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to clone repository: %v. Output: %s", err, string(output))
+		os.RemoveAll(tempDir)
+		return "", &CloneError{URL: url, Output: output, Err: commandError(err)}
 	}
 
 	return tempDir, nil
 }
 
+// localCloneURL returns the file:// URL of a local repository, since git ignores the depth and filter
+// of local clones given as a path, or url itself when it is not a local directory.
+func localCloneURL(url string) string {
+	if info, err := os.Stat(url); err == nil && info.IsDir() {
+		if abs, err := filepath.Abs(url); err == nil {
+			return "file://" + filepath.ToSlash(abs)
+		}
+	}
+
+	return url
+}
+
+// tokenEnv returns the environment of git commands sending a non-empty token as HTTP basic auth, or
+// nil to inherit the environment when there is no token.
+func tokenEnv(token string) []string {
+	if token == "" {
+		return nil
+	}
+
+	auth := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + token))
+	return append(os.Environ(),
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http.extraHeader",
+		"GIT_CONFIG_VALUE_0=Authorization: Basic "+auth,
+	)
+}
+
+// checkTempDir returns the directory clones are created in, tmpDir or the system temporary directory
+// when empty, or an error when it does not exist or is not writable.
+func checkTempDir(tmpDir string) (string, error) {
+	if tmpDir == "" {
+		tmpDir = os.TempDir()
+	}
+
+	dir, err := ioutil.TempDir(tmpDir, "repo-clone-")
+	if err != nil {
+		return "", fmt.Errorf("temporary directory %s is not writable: %v", tmpDir, err)
+	}
+	os.RemoveAll(dir)
+
+	return tmpDir, nil
+}
+
+// historyOptions controls which commits getCommitHashes returns.
+type historyOptions struct {
+	// SkipMerges excludes merge commits from the history.
+	SkipMerges bool
+	// SkipAuthor excludes commits whose "name <email>" author matches the pattern.
+	SkipAuthor *regexp.Regexp
+	// MaxCommits limits the history to the latest commits when positive.
+	MaxCommits int
+	// Since excludes this commit and its ancestors from the history when set.
+	Since string
+	// Until is the commit the history starts from, HEAD when empty.
+	Until string
+	// Subpath limits the history to commits touching this repository relative path when set.
+	Subpath string
+	// LogArgs are extra git log arguments, such as --first-parent. Arguments after "--" are paths
+	// the history is limited to, along with Subpath.
+	LogArgs []string
+	// CredentialFiles limits the history to commits changing a file whose name suggests credentials.
+	CredentialFiles bool
+}
+
+// credentialFileGlobs match the names of files that commonly hold credentials, matched case-insensitively
+// by CredentialFiles. Patterns without a slash match the file name in any directory.
+var credentialFileGlobs = mustCompileGlobs(
+	".env", ".env.*", "*.env", "credentials", "credentials.*", "*credentials*.json", "config", "config.*",
+	"*.pem", "*.key", "*.p12", "*.pfx", "id_rsa*", "*secret*", ".npmrc", ".netrc", ".pgpass", ".boto",
+	"*.tfstate", "*.tfstate.backup", "*.tfvars", "docker-compose*.yml", "docker-compose*.yaml",
+)
+
+// mustCompileGlobs compiles built-in globs, which are known to be valid.
+func mustCompileGlobs(patterns ...string) []globPattern {
+	globs, err := compileGlobs(patterns)
+	if err != nil {
+		panic(err)
+	}
+
+	return globs
+}
+
+// commitHashPattern matches a full SHA-1 or SHA-256 commit hash.
+var commitHashPattern = regexp.MustCompile(`^[0-9a-f]{40}(?:[0-9a-f]{24})?$`)
+
 // getCommitHashes retrieves the commit hashes from the given repository path and returns them as a slice of strings.
-func getCommitHashes(repoPath string) ([]string, error) {
-	// Change working directory to the repository path
-	err := os.Chdir(repoPath)
+// It also reports whether the history was truncated by the MaxCommits limit.
+func getCommitHashes(repoPath string, opts historyOptions) ([]string, bool, error) {
+	// Run the git log command to get commit hashes along with their authors
+	args := []string{"log", "--pretty=format:%H%x00%an <%ae>"}
+	if opts.SkipMerges {
+		args = append(args, "--no-merges")
+	}
+	logArgs, paths := opts.LogArgs, []string(nil)
+	for i, arg := range opts.LogArgs {
+		if arg == "--" {
+			logArgs, paths = opts.LogArgs[:i], opts.LogArgs[i+1:]
+			break
+		}
+	}
+	args = append(args, logArgs...)
+	if opts.Until != "" {
+		args = append(args, opts.Until)
+	} else if opts.Since != "" {
+		args = append(args, "HEAD")
+	}
+	if opts.Since != "" {
+		args = append(args, "^"+opts.Since)
+	}
+
+	// Ask for one extra commit to tell whether the limit cut the history short. The author and
+	// credential file filters run after git log, so then the limit is applied once filtering is done.
+	if opts.MaxCommits > 0 && opts.SkipAuthor == nil && !opts.CredentialFiles {
+		args = append(args, "-n", strconv.Itoa(opts.MaxCommits+1))
+	}
+
+	// The files every commit changed follow its line, so commits can be kept by the names of the files
+	if opts.CredentialFiles {
+		args = append(args, "--name-only")
+	}
+
+	if opts.Subpath != "" {
+		paths = append([]string{opts.Subpath}, paths...)
+	}
+	if len(paths) > 0 {
+		args = append(append(args, "--"), paths...)
+	}
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = repoPath
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
 	if err != nil {
-		return nil, fmt.Errorf("failed to change working directory: %v", err)
+		return nil, false, fmt.Errorf("failed to get commit hashes: %w. Output: %s", commandError(err), stderr.String())
 	}
 
-	// Run the git log command to get commit hashes
-	cmd := exec.Command("git", "log", "--pretty=format:%H")
+	// Split the output by newline and keep the hashes of commits that pass the author and credential file filters
+	var commitHashes []string
+	var pending string
+	for _, line := range strings.Split(string(output), "\n") {
+		if line == "" {
+			continue
+		}
+
+		// File names have no NUL, so they are told apart from the line of the commit changing them
+		if opts.CredentialFiles && !strings.Contains(line, "\x00") {
+			if pending != "" && matchAnyGlob(credentialFileGlobs, strings.ToLower(line)) {
+				commitHashes = append(commitHashes, pending)
+				pending = ""
+			}
+			continue
+		}
+		pending = ""
+
+		// Extra arguments could still change the output, e.g. --graph
+		fields := strings.SplitN(line, "\x00", 2)
+		if len(fields) != 2 || !commitHashPattern.MatchString(fields[0]) {
+			return nil, false, fmt.Errorf("failed to get commit hashes: unexpected git log output %q", line)
+		}
+		if opts.SkipAuthor != nil && len(fields) == 2 && opts.SkipAuthor.MatchString(fields[1]) {
+			continue
+		}
+
+		if opts.CredentialFiles {
+			pending = fields[0]
+			continue
+		}
+		commitHashes = append(commitHashes, fields[0])
+	}
+
+	if opts.MaxCommits > 0 && len(commitHashes) > opts.MaxCommits {
+		return commitHashes[:opts.MaxCommits], true, nil
+	}
+
+	return commitHashes, false, nil
+}
+
+// countCommits returns the number of commits reachable from HEAD, regardless of any history filters.
+func countCommits(repoPath string) (int, error) {
+	cmd := exec.Command("git", "rev-list", "--count", "HEAD")
+	cmd.Dir = repoPath
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get commit hashes: %v. Output: %s", err, string(output))
+		return 0, fmt.Errorf("failed to count commits: %w. Output: %s", commandError(err), string(output))
 	}
 
-	// Split the output by newline and return the commit hashes as a slice
-	commitHashes := strings.Split(string(output), "\n")
-
-	return commitHashes, nil
+	return strconv.Atoi(strings.TrimSpace(string(output)))
 }
 
 // checkoutCommit checks out the specified commit in the repository at the given path.
 func checkoutCommit(repoPath, commitHash string) error {
-	// Change working directory to the repository path
-	err := os.Chdir(repoPath)
+	// Run the git checkout command to switch to the specified commit
+	cmd := exec.Command("git", "checkout", commitHash)
+	cmd.Dir = repoPath
+	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("failed to change working directory: %v", err)
+		return fmt.Errorf("failed to checkout commit: %w. Output: %s", commandError(err), string(output))
 	}
 
-	// Run the git checkout command to switch to the specified commit
-	cmd := exec.Command("git", "checkout", commitHash)
+	return nil
+}
+
+// commitExists reports whether the commit is present in the repository at the given path.
+func commitExists(repoPath, commitHash string) bool {
+	cmd := exec.Command("git", "cat-file", "-e", commitHash+"^{commit}")
+	cmd.Dir = repoPath
+	return cmd.Run() == nil
+}
+
+// currentCheckout returns what HEAD points to in the repository at the given path: the branch name,
+// or the commit hash when HEAD is detached.
+func currentCheckout(repoPath string) (string, error) {
+	cmd := exec.Command("git", "symbolic-ref", "-q", "--short", "HEAD")
+	cmd.Dir = repoPath
+	if output, err := cmd.Output(); err == nil {
+		return strings.TrimSpace(string(output)), nil
+	}
+
+	return headCommit(repoPath)
+}
+
+// restoreCheckout checks out the branch or commit returned by currentCheckout again.
+func restoreCheckout(repoPath, checkout string) error {
+	cmd := exec.Command("git", "checkout", "-q", checkout)
+	cmd.Dir = repoPath
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("failed to checkout commit: %v. Output: %s", err, string(output))
+		return fmt.Errorf("failed to restore checkout of %s: %w. Output: %s", checkout, commandError(err), string(output))
 	}
 
 	return nil
 }
 
-// searchIAMKeysInFile searches for AWS IAM keys in the specified file and returns a map with access keys as keys and secret access keys as values.
-func searchIAMKeysInFile(filePath string) (map[string]string, error) {
+// keyMatch is an access key pair found in a piece of content.
+type keyMatch struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// Rule names the detector that produced the match.
+	Rule string
+	// Line is the 1-based line of the access key ID in the original content.
+	Line int
+	// Confidence overrides the confidence derived from the shape of the keys when set.
+	Confidence string
+	// Cell is the 1-based cell of a notebook match, whose Line is then within the cell.
+	Cell int
+	// Resource and Attribute locate a match in Terraform state, e.g. aws_iam_access_key.ci and secret.
+	Resource, Attribute string
+	// SecretFile is the repository relative path of the file the secret was found in, when it was
+	// paired from another file than the access key ID.
+	SecretFile string
+	// Encoding is the encoding of the token the match was decoded from, e.g. base64, and Encoded the token.
+	Encoding, Encoded string
+}
+
+// labelSeparator matches what separates a label from its value in .env files, shell exports, YAML
+// and JSON: an optional closing quote, "=", ":" or ":=" padded with spaces or tabs, an optional YAML
+// block scalar indicator with the value on the next line, and an optional opening quote. Padding
+// never spans lines, so an empty value cannot capture the next line's label.
+const labelSeparator = `["']?[ \t]*(?::=|[=:])[ \t]*(?:[|>][-+]?[ \t]*\r?\n[ \t]*)?["']?`
+
+// Regular expressions to match labelled Access Key IDs and Secret Access Keys. The aws-labelled-key
+// rule decides whether they are compiled case-insensitively. Values only span printable ASCII, so
+// non-UTF-8 bytes next to a key, such as latin-1 text, never end up in the capture.
+const (
+	accessKeyIDLabelPattern     = `(AWS_ACCESS_KEY_ID|aws_access_key_id)` + labelSeparator + `([\w\/\+]+)["']?`
+	secretAccessKeyLabelPattern = `(AWS_SECRET_ACCESS_KEY|aws_secret_access_key)` + labelSeparator + `([!-~]+)["']?`
+)
+
+// searchIAMKeysInFile searches for AWS IAM keys in the specified file and returns the matched key pairs.
+func searchIAMKeysInFile(filePath string, rules *ruleSet) ([]keyMatch, error) {
 	// Read the file content
 	content, err := ioutil.ReadFile(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read file: %v", err)
 	}
 
-	// Regular expressions to match Access Key ID and Secret Access Key
-	accessKeyIDPattern := regexp.MustCompile(`(?i)(AWS_ACCESS_KEY_ID|aws_access_key_id)[=:]["']?([\w\/\+]+)["']?`)
-	secretAccessKeyPattern := regexp.MustCompile(`(?i)(AWS_SECRET_ACCESS_KEY|aws_secret_access_key)[=:]["']?([^ \t\r\n\v\f]+)["']?`)
+	return rules.searchFile(filePath, content), nil
+}
 
-	// Find matches in the file content
-	accessKeyIDs := accessKeyIDPattern.FindAllStringSubmatch(string(content), -1)
-	secretAccessKeys := secretAccessKeyPattern.FindAllStringSubmatch(string(content), -1)
+// mmapThreshold is the size from which files are memory-mapped rather than read when mmap is enabled.
+const mmapThreshold = 1 << 20
 
-	// Combine the matched keys
-	iamKeys := make(map[string]string)
-	for _, match := range accessKeyIDs {
-		accessKeyID := match[1]
-		for _, secretMatch := range secretAccessKeys {
-			if secretMatch[0] != "" {
-				secretAccessKey := secretMatch[1]
-				iamKeys[accessKeyID] = secretAccessKey
+// searchIAMKeysInMappedFile searches for AWS IAM keys in the specified file by memory-mapping it,
+// avoiding a heap copy of large files. Matches are copied out before the file is unmapped.
+func searchIAMKeysInMappedFile(filePath string, rules *ruleSet) ([]keyMatch, error) {
+	content, unmap, err := mapFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer unmap()
+
+	return rules.searchFile(filePath, content), nil
+}
+
+// readAndSearchFile searches the file with searchIAMKeysInMappedFile when mmap is enabled and the
+// file is large enough to benefit, and with searchIAMKeysInFile otherwise.
+func readAndSearchFile(filePath string, size int64, rules *ruleSet, mmap bool) ([]keyMatch, error) {
+	if mmap && mmapSupported && size >= mmapThreshold {
+		return searchIAMKeysInMappedFile(filePath, rules)
+	}
+
+	return searchIAMKeysInFile(filePath, rules)
+}
+
+// searchIAMKeys runs every rule over the content and returns the matched key pairs.
+func searchIAMKeys(content []byte, rules *ruleSet) []keyMatch {
+	return rules.search(content)
+}
+
+// searchLabelledKeys matches keys assigned to the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY labels,
+// passing over secrets that are variable references. Every access key ID is paired with one secret:
+// the nearest one whose label has the same prefix, e.g. PROD_ in PROD_AWS_ACCESS_KEY_ID, else the
+// nearest one, each secret going to a single ID while there are secrets left, so a file of several
+// labelled pairs keeps each ID with its own secret.
+func searchLabelledKeys(content []byte, accessKeyIDPattern, secretAccessKeyPattern *regexp.Regexp) []keyMatch {
+	type label struct {
+		value string
+		// start is the offset of the label and at that of its value.
+		start, at int
+		prefix    string
+	}
+	find := func(pattern *regexp.Regexp) []label {
+		var labels []label
+		for _, loc := range pattern.FindAllSubmatchIndex(content, -1) {
+			labels = append(labels, label{string(content[loc[4]:loc[5]]), loc[0], loc[4], labelPrefix(content, loc[0])})
+		}
+		return labels
+	}
+
+	// Find matches in the file content, an ID only once
+	var ids []label
+	seen := make(map[string]bool)
+	for _, id := range find(accessKeyIDPattern) {
+		if !seen[id.value] {
+			seen[id.value] = true
+			ids = append(ids, id)
+		}
+	}
+	var secrets []label
+	for _, secret := range find(secretAccessKeyPattern) {
+		// A secret referring to a CI secret or environment variable is not committed in plaintext
+		if secret.value != "" && !isVariableReference(normalizeKey(secret.value)) {
+			secrets = append(secrets, secret)
+		}
+	}
+	if len(ids) == 0 || len(secrets) == 0 {
+		return nil
+	}
+
+	// Rank every candidate pair, same prefix first, then nearest
+	type candidate struct{ id, secret, mismatch, distance int }
+	var candidates []candidate
+	for i, id := range ids {
+		for j, secret := range secrets {
+			c := candidate{id: i, secret: j, distance: id.start - secret.start}
+			if c.distance < 0 {
+				c.distance = -c.distance
 			}
+			if !strings.EqualFold(id.prefix, secret.prefix) {
+				c.mismatch = 1
+			}
+			candidates = append(candidates, c)
+		}
+	}
+	sort.SliceStable(candidates, func(a, b int) bool {
+		if candidates[a].mismatch != candidates[b].mismatch {
+			return candidates[a].mismatch < candidates[b].mismatch
+		}
+		return candidates[a].distance < candidates[b].distance
+	})
+
+	// Pair greedily with unused secrets, then the IDs left over with their best secret
+	paired := make([]int, len(ids))
+	for i := range paired {
+		paired[i] = -1
+	}
+	used := make([]bool, len(secrets))
+	for _, c := range candidates {
+		if paired[c.id] < 0 && !used[c.secret] {
+			paired[c.id], used[c.secret] = c.secret, true
+		}
+	}
+	for _, c := range candidates {
+		if paired[c.id] < 0 {
+			paired[c.id] = c.secret
+		}
+	}
+
+	// Combine the matched keys
+	matches := make([]keyMatch, 0, len(ids))
+	for i, id := range ids {
+		matches = append(matches, keyMatch{
+			AccessKeyID:     id.value,
+			SecretAccessKey: secrets[paired[i]].value,
+			Rule:            ruleAWSLabelled,
+			Line:            lineNumber(content, id.at),
+		})
+	}
+
+	return matches
+}
+
+// labelPrefix returns the identifier characters right before the label starting at offset, e.g.
+// PROD_ for PROD_AWS_ACCESS_KEY_ID, or "" when the label starts the identifier.
+func labelPrefix(content []byte, offset int) string {
+	start := offset
+	for start > 0 {
+		c := content[start-1]
+		if c != '_' && c != '-' && c != '.' && !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z') && !('0' <= c && c <= '9') {
+			break
 		}
+		start--
 	}
 
-	return iamKeys, nil
+	return string(content[start:offset])
+}
+
+// lineNumber returns the 1-based line containing the given byte offset.
+func lineNumber(content []byte, offset int) int {
+	return bytes.Count(content[:offset], []byte("\n")) + 1
+}
+
+// walkOptions controls which files searchIAMKeysInRepo examines.
+type walkOptions struct {
+	// MaxFileSize skips files larger than this many bytes when positive.
+	MaxFileSize int64
+	// Exclude skips files whose repository relative path matches any of the globs.
+	Exclude []globPattern
+	// AllowPath counts files whose findings are informational; they are still scanned.
+	AllowPath []globPattern
+	// Rules are the detectors run over every file.
+	Rules *ruleSet
+	// Untracked also searches files git does not track, except ignored ones.
+	Untracked bool
+	// Ignored also searches files git ignores.
+	Ignored bool
+	// Subpath limits the search to files under this repository relative path when set.
+	Subpath string
+	// Mmap memory-maps large files instead of reading them, where the platform supports it.
+	Mmap bool
+	// ScanGenerated also searches files that look generated or minified.
+	ScanGenerated bool
+	// FollowRenames detects renamed files in commit diffs, so moving a file does not add its content again.
+	FollowRenames bool
+	// PairAcrossFiles pairs access key IDs without a secret with the secret of a sibling file.
+	PairAcrossFiles bool
+	// FollowSymlinks searches the files symlinks inside the repository point to instead of skipping them.
+	FollowSymlinks bool
+	// Strict fails the search on a file that cannot be read instead of skipping it.
+	Strict bool
+}
+
+// unreadable handles an error reading a file or directory of the repository: it is returned in strict
+// mode, and otherwise logged and counted in stats, so the rest of the repository is still searched.
+func (opts walkOptions) unreadable(err error, stats *ScanStats) error {
+	if opts.Strict {
+		return err
+	}
+
+	log.Printf("Warning: %v; skipping it", err)
+	stats.SkippedUnreadable++
+	return nil
 }
 
 // searchIAMKeysInRepo searches for AWS IAM keys in the repository at the given path and returns a map of file paths to matched keys.
-func searchIAMKeysInRepo(repoPath string) (map[string]map[string]string, error) {
-	foundIAMKeys := make(map[string]map[string]string)
+// Only tracked files are searched, plus untracked or ignored files when opts asks for them; excluded, oversize and binary files
+// are skipped, as are generated and minified files unless opts asks for them, and every file seen is counted in stats.
+func searchIAMKeysInRepo(repoPath string, opts walkOptions, stats *ScanStats) (map[string][]keyMatch, error) {
+	foundIAMKeys := make(map[string][]keyMatch)
+	var scanned []string
 
-	err := filepath.Walk(repoPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	relPaths, err := listFiles(repoPath, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := walkFiles(repoPath, relPaths, opts, stats)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		path, relPath, info := file.path, file.relPath, file.info
+		stats.FilesSeen++
+
+		// Skip files that are excluded, too large or binary
+		if matchAnyGlob(opts.Exclude, relPath) {
+			stats.SkippedExcluded++
+			continue
 		}
 
-		// Skip directories
-		if info.IsDir() {
-			return nil
+		if opts.MaxFileSize > 0 && info.Size() > opts.MaxFileSize {
+			stats.SkippedOversize++
+			continue
+		}
+
+		head, err := readFileHead(path)
+		if err != nil {
+			if err := opts.unreadable(fmt.Errorf("failed to read file %s: %v", relPath, err), stats); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if looksBinary(head) && !(opts.Rules.decodePlists && bytes.HasPrefix(head, binaryPlistMagic)) &&
+			!(opts.Rules.decodeDocuments && isDocument(relPath, head)) {
+			stats.SkippedBinary++
+			continue
+		}
+		if !opts.ScanGenerated && looksGenerated(relPath, head) {
+			stats.SkippedGenerated++
+			continue
 		}
 
 		// Search for IAM keys in the file
-		iamKeys, err := searchIAMKeysInFile(path)
+		iamKeys, err := readAndSearchFile(path, info.Size(), opts.Rules, opts.Mmap)
 		if err != nil {
-			return fmt.Errorf("failed to search IAM keys in file: %v", err)
+			if err := opts.unreadable(fmt.Errorf("failed to search IAM keys in file %s: %v", relPath, err), stats); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		stats.FilesScanned++
+		scanned = append(scanned, path)
+		if matchAnyGlob(opts.AllowPath, relPath) {
+			stats.FilesAllowed++
 		}
 
 		// Add the matched keys to the map
 		if len(iamKeys) > 0 {
 			foundIAMKeys[path] = iamKeys
 		}
+	}
 
-		return nil
-	})
+	if opts.PairAcrossFiles {
+		if err := pairAcrossFiles(repoPath, foundIAMKeys, scanned, opts.Rules); err != nil {
+			return nil, err
+		}
+	}
 
+	return foundIAMKeys, nil
+}
+
+// listFiles returns the slash-separated paths, relative to repoPath, of the files git tracks in the
+// working tree, followed by the untracked and ignored files when opts asks for them, limited to
+// opts.Subpath when set. Files inside .git are never listed.
+func listFiles(repoPath string, opts walkOptions) ([]string, error) {
+	var pathspec []string
+	if opts.Subpath != "" {
+		pathspec = []string{"--", opts.Subpath}
+	}
+
+	files, err := gitLsFiles(repoPath, append([]string{"--cached"}, pathspec...)...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to search IAM keys in repository: %v", err)
+		return nil, err
 	}
 
-	return foundIAMKeys, nil
+	var others []string
+	switch {
+	case opts.Untracked && opts.Ignored:
+		others, err = gitLsFiles(repoPath, append([]string{"--others"}, pathspec...)...)
+	case opts.Untracked:
+		others, err = gitLsFiles(repoPath, append([]string{"--others", "--exclude-standard"}, pathspec...)...)
+	case opts.Ignored:
+		others, err = gitLsFiles(repoPath, append([]string{"--others", "--ignored", "--exclude-standard"}, pathspec...)...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return append(files, others...), nil
 }
 
-func validateIAMKey(accessKeyID string, secretAccessKey string) bool {
+// gitLsFiles runs git ls-files with the given arguments and returns the listed paths.
+func gitLsFiles(repoPath string, args ...string) ([]string, error) {
+	cmd := exec.Command("git", append([]string{"ls-files", "-z"}, args...)...)
+	cmd.Dir = repoPath
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w. Output: %s", commandError(err), stderr.String())
+	}
 
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String("us-west-2")},
-	)
+	var files []string
+	for _, file := range strings.Split(string(output), "\x00") {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
 
+	return files, nil
+}
+
+// readFileHead returns the leading bytes of the file at the given path that are sniffed to tell
+// binary and generated files apart.
+func readFileHead(path string) ([]byte, error) {
+	file, err := os.Open(path)
 	if err != nil {
-		return false
+		return nil, err
+	}
+	defer file.Close()
+
+	buf := make([]byte, binarySniffLen)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
 	}
 
+	return buf[:n], nil
+}
+
+// binarySniffLen is how many leading bytes are checked for NUL bytes, as git does.
+const binarySniffLen = 8000
+
+// looksBinary reports whether the leading bytes of the content contain a NUL byte.
+func looksBinary(content []byte) bool {
+	if len(content) > binarySniffLen {
+		content = content[:binarySniffLen]
+	}
+
+	return bytes.IndexByte(content, 0) != -1
+}
+
+// validateIAMKey reports whether the access key belongs to an IAM user. A ValidationError is returned
+// when AWS could not be asked, in which case the key's validity is unknown.
+func validateIAMKey(ctx context.Context, sess *session.Session, accessKeyID, secretAccessKey string) (bool, error) {
+
 	svc := iam.New(sess)
 
-	result, err := svc.GetAccessKeyLastUsed(&iam.GetAccessKeyLastUsedInput{
+	result, err := svc.GetAccessKeyLastUsedWithContext(ctx, &iam.GetAccessKeyLastUsedInput{
 		AccessKeyId: aws.String(accessKeyID),
 	})
 	if err != nil {
 		if awsErr, ok := err.(awserr.Error); ok {
 			switch awsErr.Code() {
 			case iam.ErrCodeNoSuchEntityException:
-				return false
+				return false, nil
 			default:
-				return false
+				return false, &ValidationError{AccessKeyID: accessKeyID, Err: err}
 			}
 		} else {
-			return false
+			return false, &ValidationError{AccessKeyID: accessKeyID, Err: err}
 		}
 	}
 
 	if result != nil && result.UserName != nil {
-		return true
+		return true, nil
 	} else {
-		return false
+		return false, nil
+	}
+}
+
+// printResult reports the findings of a scan to the console.
+func printResult(result *ScanResult) {
+	if result.Truncated {
+		fmt.Printf("Note: history truncated to the latest %d commits.\n", result.Commits)
+	}
+	if result.Capped {
+		fmt.Printf("Note: scan stopped early after collecting the maximum of %d findings.\n", len(result.Findings))
+	}
+	if result.EmptyHistory {
+		fmt.Println("Note: the repository has no commits, so its working tree was scanned instead.")
+	}
+	if result.Synthetic {
+		fmt.Printf("Note: TEST MODE, the %d findings are synthetic findings of -inject-findings; nothing was scanned and no key is real.\n", len(result.Findings))
+	}
+	if result.Since != "" {
+		fmt.Printf("Note: only scanned the %d commits added since the last scan of %s.\n", result.Commits, result.Since)
+	}
+
+	exposed := 0
+	for _, f := range result.Findings {
+		if f.Exposure == exposurePublic {
+			exposed++
+		}
+	}
+	if exposed > 0 {
+		fmt.Printf("\n!!! CRITICAL: %d live keys are exposed in a public repository (%s). Rotate them now. !!!\n\n", exposed, exposurePublic)
+	}
+
+	validKeysFound := false
+	for _, f := range result.Findings {
+		// Findings under allowed paths are informational only, and live keys in public repositories stand out
+		prefix := exposureNote(f)
+		if f.Allowed {
+			prefix = "Info (allowed path): "
+		}
+
+		// Custom rules match a secret without an access key ID
+		if f.AccessKeyID == "" {
+			switch f.Status {
+			case statusValid:
+				if !f.Allowed {
+					validKeysFound = true
+				}
+				fmt.Printf("%sValid secret matching rule %s found %s: %s%s\n", prefix, f.Rule, f.where(), redact(f.SecretAccessKey), headNote(f))
+			case statusInvalid:
+				continue
+			default:
+				fmt.Printf("%sSecret matching rule %s found %s: %s%s\n", prefix, f.Rule, f.where(), redact(f.SecretAccessKey), headNote(f))
+			}
+			printRemediation(f)
+			printContext(f)
+			continue
+		}
+
+		switch f.Status {
+		case statusValid:
+			if !f.Allowed {
+				validKeysFound = true
+			}
+			fmt.Printf("%sValid IAM key found %s: %s (%s)%s%s%s%s\n", prefix, f.where(), f.AccessKeyID, f.KeyType, encodingNote(f), signatureNote(f), headNote(f), ownerNote(f))
+		case statusUnverified:
+			fmt.Printf("%sUnverified IAM key found %s: %s (%s)%s%s%s%s\n", prefix, f.where(), f.AccessKeyID, f.KeyType, encodingNote(f), signatureNote(f), headNote(f), ownerNote(f))
+		case statusSkipped:
+			reason := "is not a usable credential"
+			if f.KeyType.validationStrategy() == skipTemporary {
+				reason = "requires a session token"
+			}
+			fmt.Printf("Skipping validation of %s %s: %s %s\n", f.AccessKeyID, f.where(), f.KeyType, reason)
+		default:
+			continue
+		}
+		printRemediation(f)
+		printContext(f)
+	}
+
+	if !validKeysFound {
+		fmt.Println("\nNo valid IAM keys found.")
+	}
+
+	stats := result.Stats
+	if stats.HiddenUnvalidated > 0 {
+		fmt.Printf("\nShowing %d of %d findings; %d not validated as live are hidden by -only-validated.\n",
+			len(result.Findings), len(result.Findings)+stats.HiddenUnvalidated, stats.HiddenUnvalidated)
+	}
+	fmt.Printf("\nSuppressed %d findings by allowlist, %d by confidence, %d by severity and %d by baseline; %d findings under allowed paths; skipped %d binary, %d oversize, %d generated and %d unreadable files, and %d symlinks.\n",
+		stats.SuppressedByAllowlist, stats.SuppressedByConfidence, stats.SuppressedBySeverity, stats.SuppressedByBaseline, stats.SuppressedByAllowPath, stats.SkippedBinary, stats.SkippedOversize, stats.SkippedGenerated, stats.SkippedUnreadable, stats.SkippedSymlinks)
+}
+
+// signatureNote describes the signature of the finding's commit for console output, when it was verified.
+func signatureNote(f Finding) string {
+	if f.Signature == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(" [commit signature: %s]", f.Signature)
+}
+
+// printCoverage reports which files and commits the scan examined.
+func printCoverage(result *ScanResult) {
+	stats := result.Stats
+	skipped := stats.SkippedBinary + stats.SkippedOversize + stats.SkippedExcluded + stats.SkippedGenerated + stats.SkippedSymlinks + stats.SkippedUnreadable
+
+	fmt.Println("\nCoverage:")
+	if result.Repo != "" {
+		fmt.Printf("  Commits scanned: %d of %d\n", result.Commits, result.TotalCommits)
+		if stats.SkippedMissingCommits > 0 {
+			fmt.Printf("  Commits missing: %d (not in the clone)\n", stats.SkippedMissingCommits)
+		}
+	}
+	fmt.Printf("  Files seen:      %d\n", stats.FilesSeen)
+	fmt.Printf("  Files scanned:   %d\n", stats.FilesScanned)
+	fmt.Printf("  Files skipped:   %d (binary %d, oversize %d, excluded %d, generated %d, symlinks %d, unreadable %d)\n",
+		skipped, stats.SkippedBinary, stats.SkippedOversize, stats.SkippedExcluded, stats.SkippedGenerated, stats.SkippedSymlinks, stats.SkippedUnreadable)
+	fmt.Printf("  Files allowed:   %d (scanned, findings informational)\n", stats.FilesAllowed)
+	if result.Commits > 1 {
+		fmt.Println("  Files are counted once in every commit they are searched in.")
 	}
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "serve":
+			runServe(os.Args[2:])
+			return
+		case "doctor":
+			runDoctorCommand(os.Args[2:])
+			return
+		case "diff":
+			runReportDiff(os.Args[2:])
+			return
+		case "schema":
+			runSchemaCommand(os.Args[2:])
+			return
+		case "version":
+			fmt.Println(versionString())
+			return
+		}
+	}
+
 	// Parse command line arguments
 	repoURL := flag.String("repo", "", "GitHub repository URL")
+	branch := flag.String("branch", "", "Clone and scan this branch of the repository instead of its default branch")
+	bundle := flag.String("bundle", "", "Scan the repository in a git bundle file, e.g. one created with git bundle create repo.bundle --all")
+	job := flag.String("job", "", "Scan the repositories of this JSON job spec, each with its own options, into one report")
+	checkKeys := flag.String("check-keys", "", "Only validate the access-key-id,secret-access-key pairs in this CSV file (- reads standard input)")
+	revalidate := flag.String("revalidate", "", "Only validate the findings saved by -save-findings to this file, without scanning again")
+	githubQuery := flag.String("github-search", "", "Scan the repositories found by this GitHub search query, e.g. 'org:example'")
+	githubSearchCode := flag.Bool("github-search-code", false, "Make -github-search search code and scan the repositories containing matches")
+	githubSearchLimit := flag.Int("github-search-limit", 100, "Maximum number of repositories -github-search scans")
+	path := flag.String("path", "", "Scan the working tree of a local git repository instead of cloning a repository")
+	untracked := flag.Bool("untracked", false, "With -path, also scan untracked files")
+	ignored := flag.Bool("ignored", false, "With -path, also scan files ignored by git")
+	file := flag.String("file", "", "Scan a single file instead of a repository (- reads standard input)")
+	localClone := flag.String("local-clone", "", "Fetch the new commits into this existing clone of the repository and scan it instead of cloning")
+	cloneCache := flag.String("clone-cache", "", "Directory of mirrors of the repositories scanned, cloned once and fetched into on later scans, to clone from instead of the remote")
+	tmpDir := flag.String("tmp-dir", "", "Directory repositories are cloned into (default $TMPDIR or the system temporary directory)")
+	maxFindings := flag.Int("max-findings", 0, "Stop scanning once this many findings are collected (0 means no limit)")
+	noValidate := flag.Bool("no-validate", false, "Report matches as unverified without validating them against AWS")
+	validateGitHub := flag.Bool("validate-github", false, "Validate GitHub tokens with an authenticated call to the GitHub API")
+	skipMerges := flag.Bool("skip-merges", false, "Do not scan merge commits")
+	skipAuthor := flag.String("skip-author", "", "Do not scan commits whose author name or email matches this regular expression")
+	region := flag.String("region", "", "AWS region used for validation calls (default us-west-2, or the default region of -partition)")
+	partition := flag.String("partition", "", "AWS partition keys are validated in: aws, aws-us-gov or aws-cn (default the partition of -region)")
+	concurrency := flag.Int("concurrency", defaultConcurrency, "Maximum number of keys validated at the same time")
+	adaptiveConcurrency := flag.Bool("adaptive-concurrency", false, "Halve the validation concurrency whenever AWS throttles a call, retrying it, and raise it back as calls succeed")
+	verbose := flag.Bool("verbose", false, "Log more detail about the scan, such as changes of the adaptive validation concurrency")
+	var allow stringList
+	flag.Var(&allow, "allow", "Access key ID to ignore; may be repeated or comma separated")
+	minConfidence := flag.String("min-confidence", confidenceLow, "Ignore findings below this confidence (low, medium or high)")
+	minSeverity := flag.String("min-severity", "", "Ignore validated findings below this severity (info, low, medium, high or critical)")
+	var exclude stringList
+	var allowPath stringList
+	flag.Var(&allowPath, "allow-path", "Glob of repository paths whose findings are informational and never fail the scan; may be repeated or comma separated")
+	flag.Var(&exclude, "exclude", "Glob of repository paths not to scan, e.g. 'vendor/**'; may be repeated or comma separated")
+	coverage := flag.Bool("coverage", false, "Print which files and commits were examined")
+	dangling := flag.Bool("dangling", false, "Also scan blobs that are no longer referenced by any commit")
+	scanGenerated := flag.Bool("scan-generated", false, "Also scan files that look generated or minified, such as lockfiles, *.min.js and files marked DO NOT EDIT")
+	tipOnly := flag.Bool("tip-only", false, "Only clone and scan the latest commit of the default branch, skipping the history")
+	diffRange := flag.String("diff-range", "", "Only scan the lines added by the commits in this base..head range, e.g. those of a pull request")
+	diff := flag.Bool("diff", false, "Only scan the lines each commit added instead of every commit's full tree; whitespace-only changes are ignored")
+	pairAcrossFiles := flag.Bool("pair-across-files", false, "Pair an access key ID found without a secret with the secret of a sibling file in the same directory")
+	followSymlinks := flag.Bool("follow-symlinks", false, "Search the files symlinks inside the repository point to, under the path of the link, instead of skipping symlinks")
+	strict := flag.Bool("strict", false, "Fail the scan on any file that cannot be read or commit missing from the clone instead of skipping it")
+	followRenames := flag.Bool("follow-renames", false, "With -diff or -diff-range, detect renamed files so a key moved to another file is not reported again")
+	reflog := flag.Bool("reflog", false, "Also scan commits only reachable from the reflog, such as amended or rebased commits")
+	remotes := flag.Bool("remotes", false, "Also scan commits only reachable from the refs the repository tracks of its own remotes, e.g. in a mirror")
+	notes := flag.Bool("notes", false, "Also scan the content of git notes")
+	db := flag.String("db", "", "JSON file recording the last scanned commit of every repository")
+	sinceLastScan := flag.Bool("since-last-scan", false, "Only scan commits added since the last scan recorded in -db; falls back to a full scan without a record")
+	joinLiterals := flag.Bool("join-literals", false, "Join concatenated string literals in Go, Python and JavaScript files before matching")
+	decodePlists := flag.Bool("decode-plists", false, "Decode binary and XML property lists and search their string values")
+	decodeEncoded := flag.Bool("decode-encoded", false, "Also decode high-entropy base64 and hex tokens and search them for AWS keys")
+	documents := flag.Bool("documents", false, "Extract the text of PDF and DOCX documents and search it instead of skipping them as binary")
+	rulesFile := flag.String("rules", "", "JSON file with custom rules and overrides for the built-in rules")
+	var logArgs argList
+	flag.Var(&logArgs, "log-args", "Extra git log arguments selecting the commits to scan, e.g. --first-parent, separated by spaces; may be repeated")
+	var onlyRules, enableRules, disableRules stringList
+	flag.Var(&onlyRules, "only-rule", "Only run this rule; may be repeated or comma separated")
+	flag.Var(&enableRules, "enable-rule", "Run this rule even if the rules file disables it; may be repeated or comma separated")
+	flag.Var(&disableRules, "disable-rule", "Do not run this rule; may be repeated or comma separated")
+	mmap := flag.Bool("mmap", false, "Memory-map large files instead of reading them into memory, where supported")
+	maxFileSize := flag.Int64("max-file-size", defaultMaxFileSize, "Skip files larger than this many bytes (0 for no limit)")
+	maxCommits := flag.Int("max-commits", 0, "Only scan the latest N commits (0 for the full history)")
+	validationMethod := flag.String("validation-method", validationMethodSTS, "How AWS keys are validated: sts signs a GetCallerIdentity call with the key itself, iam looks it up with the scanner's own credentials")
+	awsProfile := flag.String("aws-profile", "", "Shared config profile whose credentials are used to make IAM validation calls")
+	awsAssumeRoleARN := flag.String("aws-assume-role-arn", "", "Role to assume for making IAM validation calls, e.g. in another account")
+	var enrichmentProfiles stringList
+	flag.Var(&enrichmentProfiles, "enrichment-profiles", "Shared config profiles in whose accounts the IAM user and last use of every AWS key found are looked up, in order; may be repeated or comma separated")
+	awsEndpoint := flag.String("aws-endpoint", "", "Custom AWS endpoint URL for validation calls, e.g. http://localhost:4566 for LocalStack")
+	timeout := flag.Duration("timeout", 0, "Abort the whole scan after this long (0 for no limit)")
+	validateTimeout := flag.Duration("validate-timeout", defaultValidateTimeout, "Maximum time for a single validation call; keys that time out are reported as unverified")
+	httpOptions := httpClientFlags(flag.CommandLine)
+	public := flag.Bool("public", false, "Treat the repository as public, escalating live keys to critical-public-exposure; the visibility of github.com repositories is otherwise asked from GitHub")
+	token := flag.String("token", "", "Token used to clone private repositories over HTTPS (prefer the "+envName("token")+" environment variable)")
+	format := flag.String("format", formatText, "Format written to standard output: text, json, sarif, compact or github-actions")
+	baselinePath := flag.String("baseline", "", "Baseline file of known findings to suppress, so only new findings fail the scan")
+	writeBaselinePath := flag.String("write-baseline", "", "Write a baseline file suppressing every finding of this scan, and those of -baseline")
+	outputJSON := flag.String("output-json", "", "Also write the report as JSON to this file")
+	dryRunPlan := flag.Bool("dry-run-plan", false, "Print the repositories, commits, files and validators a scan would cover, without scanning")
+	saveFindings := flag.String("save-findings", "", "Save the findings, with their secrets, to this file before validating them, for -revalidate")
+	verifySignatures := flag.Bool("verify-signatures", false, "Report whether the commit of every finding is signed and its signature verifies (slow)")
+	checkHead := flag.Bool("check-head", false, "Report whether the key of every finding is still present at HEAD, lowering the severity of keys only in the history")
+	subpath := flag.String("subpath", "", "Only scan files under this repository relative path, and only the commits touching it")
+	credentialFilesOnly := flag.Bool("credential-files-only", false, "Only scan the commits changing files named like credentials, such as .env, credentials, *.pem or config.*, trading completeness for speed")
+	outputSARIF := flag.String("output-sarif", "", "Also write the report as SARIF to this file")
+	sinkTarget := flag.String("sink", "", "Also publish every finding as a JSON message to a NATS subject as it is found: nats://host:port/subject")
+	syslogTarget := flag.String("syslog", "", "Also send every finding to syslog: local, or udp://host:port or tcp://host:port")
+	unique := flag.Bool("unique", false, "Print one entry per unique secret, with every location it was found at, instead of every finding; with -format json, as a JSON list of secrets")
+	onlyValidated := flag.Bool("only-validated", false, "Only print findings validated as live; JSON and SARIF reports still include every finding")
+	contextSize := flag.Int("context", 0, "Include this many lines before and after every finding, with secrets redacted, in text and JSON output")
+	listFindingsJSON := flag.Bool("list-findings-json", false, "With -path, only print the findings as a JSON array of {file, line, col, ruleId, message}, without validation, for editors")
+	count := flag.Bool("count", false, "Only print the number of live findings, for shell scripts")
+	countAll := flag.Bool("count-all", false, "With -count, print the number of every finding instead of only the live ones")
+	templateText := flag.String("template", "", "Go text template rendered for every finding instead of the default output, e.g. '{{.File}}:{{.Line}} {{.RuleName}}'")
+	redactInLogs := flag.Bool("redact-in-logs", true, "Scrub the token and every secret found from log lines and error messages")
+	redactFormat := flag.String("redact-format", redactPartial, "How secrets are masked in every output and in logs: partial, hash or full")
+	showVersion := flag.Bool("version", false, "Print the version and exit")
+	injectFindings := flag.Int("inject-findings", 0, "Test only: report this many synthetic findings instead of scanning, to test integrations")
+	injectStatus := flag.String("inject-status", statusValid, "Test only: status of the synthetic findings of -inject-findings: valid, invalid, unverified or mixed")
+	flag.Usage = usage
 	flag.Parse()
 
-	if *repoURL == "" {
-		log.Fatal("Please provide a GitHub repository URL using the -repo flag.")
+	if *showVersion {
+		fmt.Println(versionString())
+		return
 	}
 
-	// Start the timer
-	startTime := time.Now()
+	// Scrub secrets from everything logged from here on
+	log.SetOutput(scrubWriter{os.Stderr})
 
-	// Clone the repository
-	repoPath, err := cloneRepo(*repoURL)
-	if err != nil {
-		log.Fatalf("Error cloning repository: %v", err)
+	if isFlagSet(flag.CommandLine, "token") {
+		log.Printf("Warning: -token is visible to other processes; set %s instead.", envName("token"))
+	}
+
+	if err := applyEnv(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+	logScrubber.setEnabled(*redactInLogs)
+	if err := setRedactFormat(*redactFormat); err != nil {
+		log.Fatal(err)
+	}
+	logScrubber.add(*token)
+
+	if *injectFindings > 0 && (*repoURL != "" || *bundle != "" || *githubQuery != "" || *path != "" || *file != "" || *checkKeys != "" || *revalidate != "" || *job != "" || *localClone != "" || *dryRunPlan || *saveFindings != "") {
+		log.Fatal("The -inject-findings flag reports synthetic findings instead of scanning, so it cannot be used with a scan target, -dry-run-plan or -save-findings.")
+	}
+	if *injectFindings == 0 && *repoURL == "" && *bundle == "" && *githubQuery == "" && *path == "" && *file == "" && *checkKeys == "" && *revalidate == "" && *job == "" && *localClone == "" {
+		log.Fatal("Please provide a GitHub repository URL using the -repo flag, a git bundle using the -bundle flag, a GitHub search using the -github-search flag, a local repository using the -path flag, a file using the -file flag, a key list using the -check-keys flag, saved findings using the -revalidate flag, a job spec using the -job flag or an existing clone using the -local-clone flag.")
+	}
+
+	// A bundle is cloned like any other repository once it is known to be valid
+	if *bundle != "" {
+		if *repoURL != "" {
+			log.Fatal("The -repo and -bundle flags cannot be used together.")
+		}
+		var err error
+		if *repoURL, err = checkBundle(*bundle); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *localClone != "" && (*bundle != "" || *githubQuery != "" || *job != "" || *path != "" || *file != "" || *checkKeys != "" || *revalidate != "" || *dryRunPlan) {
+		log.Fatal("The -local-clone flag can only be combined with -repo.")
+	}
+	if *cloneCache != "" && *localClone != "" {
+		log.Fatal("The -clone-cache and -local-clone flags cannot be combined.")
+	}
+	if *dryRunPlan && (*path != "" || *file != "" || *checkKeys != "" || *revalidate != "") {
+		log.Fatal("The -dry-run-plan flag only plans scans of -repo, -bundle, -github-search or -job.")
+	}
+
+	if _, ok := reportWriters[*format]; !ok && *format != formatText {
+		log.Fatalf("Invalid format %q: must be text, json, sarif, compact or github-actions.", *format)
+	}
+	if *validationMethod != validationMethodSTS && *validationMethod != validationMethodIAM {
+		log.Fatalf("Invalid validation method %q: must be sts or iam.", *validationMethod)
 	}
 
-	// Get commit hashes
-	commitHashes, err := getCommitHashes(repoPath)
+	// The count is all that is printed, so it cannot be combined with another output format
+	if *count && (*templateText != "" || *format != formatText) {
+		log.Fatal("The -count flag cannot be used with -template or -format.")
+	}
+	if *unique && (*count || *listFindingsJSON || *templateText != "" || (*format != formatText && *format != formatJSON)) {
+		log.Fatal("The -unique flag only applies to the text and json formats and cannot be used with -count, -list-findings-json or -template.")
+	}
+	if *countAll && !*count {
+		log.Fatal("The -count-all flag requires -count.")
+	}
+	if *contextSize < 0 {
+		log.Fatal("The -context flag must not be negative.")
+	}
+	if *listFindingsJSON && (*path == "" || *count || *templateText != "" || *format != formatText) {
+		log.Fatal("The -list-findings-json flag requires -path and cannot be used with -count, -template or -format.")
+	}
+	if *saveFindings != "" && (*checkKeys != "" || *revalidate != "" || *job != "") {
+		log.Fatal("The -save-findings flag cannot be used with -check-keys, -revalidate or -job.")
+	}
+
+	// Parse the template up front so a mistake is reported before a long scan
+	var findingTemplate *template.Template
+	if *templateText != "" {
+		var err error
+		if findingTemplate, err = parseFindingTemplate(*templateText); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	opts := ScanOptions{
+		RepoURL:             *repoURL,
+		Branch:              *branch,
+		SkipMerges:          *skipMerges,
+		SkipAuthor:          *skipAuthor,
+		LogArgs:             logArgs,
+		MaxCommits:          *maxCommits,
+		Region:              *region,
+		Partition:           *partition,
+		AWSEndpoint:         *awsEndpoint,
+		ValidationMethod:    *validationMethod,
+		AWSProfile:          *awsProfile,
+		AWSAssumeRoleARN:    *awsAssumeRoleARN,
+		EnrichmentProfiles:  enrichmentProfiles,
+		ValidateTimeout:     Duration(*validateTimeout),
+		Concurrency:         *concurrency,
+		AdaptiveConcurrency: *adaptiveConcurrency,
+		Verbose:             *verbose,
+		Public:              *public,
+		Token:               *token,
+		Allow:               allow,
+		MinConfidence:       *minConfidence,
+		MinSeverity:         *minSeverity,
+		MaxFileSize:         *maxFileSize,
+		Mmap:                *mmap,
+		Exclude:             exclude,
+		AllowPath:           allowPath,
+		Dangling:            *dangling,
+		RulesFile:           *rulesFile,
+		JoinLiterals:        *joinLiterals,
+		DecodePlists:        *decodePlists,
+		DecodeEncoded:       *decodeEncoded,
+		Documents:           *documents,
+		OnlyRules:           onlyRules,
+		EnableRules:         enableRules,
+		DisableRules:        disableRules,
+		TipOnly:             *tipOnly,
+		ScanGenerated:       *scanGenerated,
+		Diff:                *diff,
+		DiffRange:           *diffRange,
+		FollowRenames:       *followRenames,
+		PairAcrossFiles:     *pairAcrossFiles,
+		FollowSymlinks:      *followSymlinks,
+		Strict:              *strict,
+		Subpath:             *subpath,
+		CredentialFilesOnly: *credentialFilesOnly,
+		VerifySignatures:    *verifySignatures,
+		CheckHead:           *checkHead,
+		Untracked:           *untracked,
+		Ignored:             *ignored,
+		DB:                  *db,
+		SinceLastScan:       *sinceLastScan,
+		Reflog:              *reflog,
+		Remotes:             *remotes,
+		Notes:               *notes,
+		ValidateGitHub:      *validateGitHub,
+		MaxFindings:         *maxFindings,
+		TmpDir:              *tmpDir,
+		LocalClone:          *localClone,
+		CloneCache:          *cloneCache,
+		NoValidate:          *noValidate || *listFindingsJSON,
+		Context:             *contextSize,
+		Baseline:            *baselinePath,
+	}
+
+	if _, err := opts.awsRegion(); err != nil {
+		log.Fatal(err)
+	}
+
+	// One client is shared by every call of the run, keeping a connection open per key validated at once
+	httpOptions.MaxIdleConnsPerHost = opts.Concurrency
+	httpClient, err := newHTTPClient(*httpOptions)
 	if err != nil {
-		log.Fatalf("Error getting commit hashes: %v", err)
+		log.Fatal(err)
+	}
+	opts.HTTPClient = httpClient
+	if *tmpDir != "" {
+		if _, err := checkTempDir(*tmpDir); err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	validKeysFound := false
+	// Start the timer
+	startTime := time.Now()
 
-	// Create a channel to communicate errors from goroutines
-	errChan := make(chan error, 1)
-
-	// Iterate over commit hashes and spawn a goroutine to search for IAM keys in each commit
-	for _, commitHash := range commitHashes {
-		go func(commitHash string) {
-			// Checkout the commit
-			err := checkoutCommit(repoPath, commitHash)
-			if err != nil {
-				errChan <- fmt.Errorf("error checking out commit %s: %v", commitHash, err)
-				return
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	// A plan only clones the commits and trees of the repositories, and neither scans nor validates
+	if *dryRunPlan {
+		var plans []repoPlan
+		var err error
+		switch {
+		case *githubQuery != "":
+			var repos []string
+			if repos, err = newGitHubSearch(opts.httpClient(), *token, *githubSearchCode).repos(ctx, *githubQuery, *githubSearchLimit); err != nil {
+				log.Printf("Error searching GitHub: %v", err)
+				os.Exit(exitCode(err))
+			}
+			jobs := make([]ScanOptions, len(repos))
+			for i, repo := range repos {
+				jobs[i] = opts
+				jobs[i].RepoURL = repo
 			}
+			plans, err = PlanScan(ctx, jobs)
+		case *job != "":
+			plans, err = PlanJob(ctx, *job)
+		default:
+			plans, err = PlanScan(ctx, []ScanOptions{opts})
+		}
+		if err != nil {
+			log.Printf("Error planning scan: %v", err)
+			os.Exit(exitCode(err))
+		}
+		printPlan(os.Stdout, plans)
+		return
+	}
+
+	// Saved findings are validated once they are written, so the scan itself does not validate them
+	scanOpts := opts
+	if *saveFindings != "" {
+		scanOpts.NoValidate = true
+		scanOpts.MinSeverity = ""
+	}
+
+	// Repository, path and file scans publish their findings to the sink as they are validated, and
+	// the other modes once they are done
+	var sink *natsSink
+	if *sinkTarget != "" {
+		if sink, err = newSink(*sinkTarget); err != nil {
+			log.Fatal(err)
+		}
+		if *saveFindings == "" && *injectFindings == 0 && *job == "" && *checkKeys == "" && *revalidate == "" {
+			scanOpts.OnFinding = sink.publish
+		}
+	}
+
+	var result *ScanResult
+	scanFailed := false
+	if *injectFindings > 0 {
+		if result, err = InjectFindings(*injectFindings, *injectStatus, opts); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Warning: test mode, reporting %d synthetic findings instead of scanning", *injectFindings)
+	} else if *githubQuery != "" {
+		repos, err := newGitHubSearch(opts.httpClient(), *token, *githubSearchCode).repos(ctx, *githubQuery, *githubSearchLimit)
+		if err != nil {
+			log.Printf("Error searching GitHub: %v", err)
+			os.Exit(exitCode(err))
+		}
+		log.Printf("Found %d repositories matching %q", len(repos), *githubQuery)
 
-			// Search for IAM keys in the repository
-			foundIAMKeys, err := searchIAMKeysInRepo(repoPath)
-			if err != nil {
-				errChan <- fmt.Errorf("error searching for IAM keys in commit %s: %v", commitHash, err)
-				return
+		result, err = ScanRepos(ctx, repos, scanOpts, func(repoURL string, err error) {
+			log.Printf("Error scanning repository %s: %v", repoURL, err)
+			scanFailed = true
+		})
+		if err != nil {
+			log.Printf("Error scanning repositories: %v", err)
+			os.Exit(exitCode(err))
+		}
+	} else if *job != "" {
+		result, err = ScanJob(ctx, *job, func(repoURL string, err error) {
+			log.Printf("Error scanning repository %s: %v", repoURL, err)
+			scanFailed = true
+		})
+		if err != nil {
+			log.Printf("Error scanning job: %v", err)
+			os.Exit(exitCode(err))
+		}
+	} else if *checkKeys != "" {
+		result, err = CheckKeys(ctx, *checkKeys, opts)
+		if err != nil {
+			log.Printf("Error checking keys: %v", err)
+			os.Exit(exitCode(err))
+		}
+	} else if *revalidate != "" {
+		result, err = Revalidate(ctx, *revalidate, opts)
+		if err != nil {
+			log.Printf("Error revalidating findings: %v", err)
+			os.Exit(exitCode(err))
+		}
+	} else if *path != "" {
+		result, err = ScanPath(ctx, *path, scanOpts)
+		if err != nil {
+			log.Printf("Error scanning path: %v", err)
+			os.Exit(exitCode(err))
+		}
+	} else if *file != "" {
+		result, err = ScanFile(ctx, *file, scanOpts)
+		if err != nil {
+			log.Printf("Error scanning file: %v", err)
+			os.Exit(exitCode(err))
+		}
+	} else {
+		result, err = Scan(ctx, scanOpts)
+		if err != nil {
+			var gitNotFound *GitNotFoundError
+			if errors.As(err, &gitNotFound) {
+				log.Printf("Error scanning repository: git is not installed or not on the PATH")
+			} else {
+				log.Printf("Error scanning repository: %v", err)
 			}
+			os.Exit(exitCode(err))
+		}
+	}
 
-			// Spawn a goroutine for each IAM key found in the repository to validate the key concurrently
-			for _, iamKeys := range foundIAMKeys {
-				for accessKeyID, secretAccessKey := range iamKeys {
-					fmt.Println(validateIAMKey(accessKeyID, secretAccessKey))
-					go func(accessKeyID, secretAccessKey string) {
-						if valid := validateIAMKey(accessKeyID, secretAccessKey); valid {
-							validKeysFound = true
-							fmt.Printf("Valid IAM key found in commit %s: %s\n", commitHash, accessKeyID)
-						}
-					}(accessKeyID, secretAccessKey)
-				}
+	// The findings are saved before validation so an interrupted validation can be resumed with -revalidate
+	if *saveFindings != "" {
+		if err := writeFindingsFile(*saveFindings, result); err != nil {
+			log.Fatal(err)
+		}
+		if err := validateResult(ctx, result, opts); err != nil {
+			log.Printf("Error validating findings: %v", err)
+			os.Exit(exitCode(err))
+		}
+	}
+	if sink != nil {
+		if scanOpts.OnFinding == nil {
+			for _, f := range result.Findings {
+				sink.publish(f)
 			}
-		}(commitHash)
+		}
+		sink.close()
 	}
 
-	// Wait for all goroutines to finish
-	for i := 0; i < len(commitHashes); i++ {
-		select {
-		case err := <-errChan:
-			log.Fatalf("%v", err)
-		default:
-			// No errors, continue
+	// The console output can be limited to live keys; reports and the exit code still cover every finding
+	shown := result
+	if *onlyValidated {
+		shown = validatedOnly(result)
+	}
+
+	if *count {
+		fmt.Println(countFindings(result, *countAll))
+	} else if *listFindingsJSON {
+		if err := writeLintJSON(os.Stdout, *path, result); err != nil {
+			log.Fatal(err)
+		}
+	} else if findingTemplate != nil {
+		// Templated output only contains the rendered findings so it can be consumed by other tools
+		if err := printTemplate(os.Stdout, findingTemplate, shown); err != nil {
+			log.Fatal(err)
+		}
+		if *coverage {
+			printCoverage(result)
+		}
+	} else if *unique && *format == formatJSON {
+		if err := writeUniqueJSON(os.Stdout, shown); err != nil {
+			log.Fatal(err)
 		}
+	} else if *unique {
+		printUnique(shown)
+		if *coverage {
+			printCoverage(result)
+		}
+	} else if *format == formatCompact || *format == formatGitHubActions {
+		// Compact output and annotations are for the console, so they are limited like the text output
+		if err := reportWriters[*format](os.Stdout, shown); err != nil {
+			log.Fatal(err)
+		}
+	} else if *format != formatText {
+		if err := reportWriters[*format](os.Stdout, result); err != nil {
+			log.Fatal(err)
+		}
+	} else if *checkKeys != "" {
+		printCheckResult(result)
+	} else {
+		printResult(shown)
+		if *coverage {
+			printCoverage(result)
+		}
+
+		duration := time.Since(startTime).Round(time.Second / 100).String()
+
+		fmt.Printf("\nTotal time taken: %v\n", duration)
 	}
 
-	if !validKeysFound {
-		fmt.Println("\nNo valid IAM keys found in the repository.")
+	// The baseline covers the findings of this scan and the ones already suppressed
+	if *writeBaselinePath != "" {
+		previous, err := loadBaseline(*baselinePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := writeBaseline(*writeBaselinePath, result.Findings, previous); err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	duration := time.Since(startTime).Round(time.Second / 100).String()
+	// The same result is written to every requested report file
+	outputs := []struct{ path, format string }{
+		{*outputJSON, formatJSON},
+		{*outputSARIF, formatSARIF},
+	}
+	for _, output := range outputs {
+		if output.path == "" {
+			continue
+		}
+		if err := writeReportFile(output.path, output.format, result); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *syslogTarget != "" {
+		if err := writeSyslog(*syslogTarget, result); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	fmt.Printf("\nTotal time taken: %v\n", duration)
+	for _, f := range result.Findings {
+		if f.failsBuild() {
+			os.Exit(exitKeysFound)
+		}
+	}
+	if scanFailed {
+		os.Exit(exitError)
+	}
 }
@@ -0,0 +1,547 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestGetCommitHashesSkipsMergesAndAuthors(t *testing.T) {
+	repo := newFixtureRepo(t)
+	first := repo.commit("first", map[string]string{"a.txt": "a"})
+	repo.git("checkout", "-q", "-b", "feature")
+	feature := repo.commit("feature", map[string]string{"b.txt": "b"})
+	repo.git("checkout", "-q", "main")
+	bot := repo.commitAs("dependabot[bot] <bot@example.com>", "bump", map[string]string{"c.txt": "c"})
+	repo.git("merge", "-q", "--no-ff", "-m", "merge", "feature")
+	merge := repo.git("rev-parse", "HEAD")
+
+	all, _, err := getCommitHashes(repo.dir, historyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 4 {
+		t.Fatalf("got %d commits, want 4", len(all))
+	}
+
+	hashes, _, err := getCommitHashes(repo.dir, historyOptions{SkipMerges: true, SkipAuthor: regexp.MustCompile(`\[bot\]`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]bool)
+	for _, hash := range hashes {
+		got[hash] = true
+	}
+	if got[merge] || got[bot] {
+		t.Errorf("merge or bot commit not excluded: %v", hashes)
+	}
+	if !got[first] || !got[feature] || len(hashes) != 2 {
+		t.Errorf("got %v, want %s and %s", hashes, first, feature)
+	}
+}
+
+func TestGetCommitHashesMaxCommitsAfterAuthorFilter(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("first", nil)
+	second := repo.commit("second", nil)
+	repo.commitAs("ci-bot <bot@example.com>", "bot", nil)
+
+	hashes, truncated, err := getCommitHashes(repo.dir, historyOptions{SkipAuthor: regexp.MustCompile(`^ci-bot `), MaxCommits: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 1 || hashes[0] != second || !truncated {
+		t.Errorf("got %v truncated %v, want [%s] truncated", hashes, truncated, second)
+	}
+}
+
+func TestGetCommitHashesMaxCommits(t *testing.T) {
+	repo := newFixtureRepo(t)
+	var commits []string
+	for i := 0; i < 5; i++ {
+		commits = append(commits, repo.commit("commit", nil))
+	}
+
+	hashes, truncated, err := getCommitHashes(repo.dir, historyOptions{MaxCommits: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 3 || !truncated {
+		t.Fatalf("got %d hashes truncated %v, want 3 truncated", len(hashes), truncated)
+	}
+	for i, hash := range hashes {
+		if want := commits[len(commits)-1-i]; hash != want {
+			t.Errorf("hash %d = %s, want the latest commits %s", i, hash, want)
+		}
+	}
+
+	if _, truncated, _ := getCommitHashes(repo.dir, historyOptions{MaxCommits: 5}); truncated {
+		t.Error("history of exactly MaxCommits commits reported truncated")
+	}
+}
+
+func TestScanReportsTruncatedHistory(t *testing.T) {
+	repo := newFixtureRepo(t)
+	for i := 0; i < 4; i++ {
+		repo.commit("commit", nil)
+	}
+
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true, MaxCommits: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Commits != 2 || result.TotalCommits != 4 || !result.Truncated {
+		t.Errorf("got %d of %d commits truncated %v, want 2 of 4 truncated", result.Commits, result.TotalCommits, result.Truncated)
+	}
+}
+
+func TestSearchLabelledKeysPairsEachID(t *testing.T) {
+	rules, err := newRuleSet(nil, ruleSelection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := "PROD_AWS_ACCESS_KEY_ID=" + testAccessKeyID + "\n" +
+		"DEV_AWS_ACCESS_KEY_ID=" + testAccessKeyID2 + "\n" +
+		"DEV_AWS_SECRET_ACCESS_KEY=" + testSecretAccessKey2 + "\n" +
+		"PROD_AWS_SECRET_ACCESS_KEY=" + testSecretAccessKey + "\n"
+
+	secrets := make(map[string]string)
+	for _, m := range rules.search([]byte(content)) {
+		if m.Rule == ruleAWSLabelled {
+			secrets[m.AccessKeyID] = m.SecretAccessKey
+		}
+	}
+	if secrets[testAccessKeyID] != testSecretAccessKey || secrets[testAccessKeyID2] != testSecretAccessKey2 {
+		t.Errorf("got pairs %v, want each ID with its own secret", secrets)
+	}
+}
+
+func TestCoverageReconciles(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("files", map[string]string{
+		"README.md":    "hello\n",
+		"config.env":   keyFile(testAccessKeyID, testSecretAccessKey),
+		"logo.png":     "\x89PNG\r\n\x1a\n\x00\x00",
+		"vendor/a.txt": "vendored\n",
+	})
+	repo.commit("more", map[string]string{"README.md": "hello again\n"})
+
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true, Exclude: []string{"vendor/**"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := result.Stats
+	skipped := stats.SkippedBinary + stats.SkippedOversize + stats.SkippedExcluded + stats.SkippedGenerated + stats.SkippedSymlinks + stats.SkippedUnreadable
+	if stats.FilesScanned+skipped != stats.FilesSeen {
+		t.Errorf("scanned %d + skipped %d != seen %d", stats.FilesScanned, skipped, stats.FilesSeen)
+	}
+	if stats.SkippedBinary == 0 || stats.SkippedExcluded == 0 {
+		t.Errorf("got stats %+v, want the binary and excluded files skipped", stats)
+	}
+	if result.Commits != 2 || result.TotalCommits != 2 {
+		t.Errorf("scanned %d of %d commits, want 2 of 2", result.Commits, result.TotalCommits)
+	}
+}
+
+func TestSearchLatin1File(t *testing.T) {
+	// Latin-1 accents are single bytes that are not valid UTF-8
+	content := "# Caf\xe9 cr\xe8me br\xfbl\xe9e\n" +
+		"cl\xe9 aws_access_key_id = " + testAccessKeyID + "\xe9 # r\xe9vis\xe9e\n" +
+		"aws_secret_access_key = " + testSecretAccessKey + "\xe0\n" +
+		"r\xe9f\xe9rence: \xe9" + testAccessKeyID2 + "\xe8 \xe0 v\xe9rifier\n"
+	path := filepath.Join(t.TempDir(), "legacy.cfg")
+	if err := ioutil.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := newRuleSet(nil, ruleSelection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matches, err := searchIAMKeysInFile(path, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("got %d matches %+v, want 2", len(matches), matches)
+	}
+	for _, m := range matches {
+		switch m.AccessKeyID {
+		case testAccessKeyID:
+			if m.SecretAccessKey != testSecretAccessKey || m.Line != 2 {
+				t.Errorf("labelled pair captured as %q at line %d, want the clean secret at line 2", m.SecretAccessKey, m.Line)
+			}
+		case testAccessKeyID2:
+			if m.Line != 4 {
+				t.Errorf("bare ID at line %d, want 4", m.Line)
+			}
+		default:
+			t.Errorf("unexpected capture %q", m.AccessKeyID)
+		}
+	}
+}
+
+func TestSubpath(t *testing.T) {
+	repo := newFixtureRepo(t)
+	infra := repo.commit("infra", map[string]string{"infra/prod.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+	app := repo.commit("app", map[string]string{"app/dev.env": keyFile(testAccessKeyID2, testSecretAccessKey2)})
+
+	hashes, _, err := getCommitHashes(repo.dir, historyOptions{Subpath: "infra/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 1 || hashes[0] != infra {
+		t.Errorf("got commits %v, want only %s touching infra/, not %s", hashes, infra, app)
+	}
+
+	for _, diff := range []bool{false, true} {
+		result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true, Subpath: "infra/", Diff: diff})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Commits != 1 || len(result.Findings) != 1 || result.Findings[0].File != "infra/prod.env" {
+			t.Errorf("diff %v: got %d commits and findings %+v, want only infra/prod.env", diff, result.Commits, result.Findings)
+		}
+		if result.Stats.FilesSeen != 1 {
+			t.Errorf("diff %v: saw %d files, want only the one under infra/", diff, result.Stats.FilesSeen)
+		}
+	}
+}
+
+func TestScanStopsAtMaxFindings(t *testing.T) {
+	repo := newFixtureRepo(t)
+	const commits = 30
+	for i := 0; i < commits; i++ {
+		id, secret := fmt.Sprintf("AKIATEST%012d", i), fmt.Sprintf("wJalrXUtnFEMI/K7MDENG/bPxRfiCY%010d", i)
+		repo.commit("add key", map[string]string{fmt.Sprintf("keys/%02d.env", i): keyFile(id, secret)})
+	}
+
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true, Diff: true, MaxFindings: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Findings) != 5 || !result.Capped {
+		t.Errorf("got %d findings capped %v, want 5 capped", len(result.Findings), result.Capped)
+	}
+	if result.Commits >= commits {
+		t.Errorf("scanned %d of %d commits, want the scan stopped at the cap", result.Commits, commits)
+	}
+
+	result, err = Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true, Diff: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Findings) != commits || result.Capped {
+		t.Errorf("uncapped scan: got %d findings capped %v, want %d", len(result.Findings), result.Capped, commits)
+	}
+}
+
+func TestScanClonesUnderTmpDir(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("add key", map[string]string{"config.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+	tmpDir := t.TempDir()
+
+	var clones []string
+	_, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true, TmpDir: tmpDir, OnProgress: func(e ProgressEvent) {
+		if e.Stage == progressCloned {
+			clones, _ = filepath.Glob(filepath.Join(tmpDir, "repo-clone-*"))
+		}
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clones) != 1 {
+		t.Errorf("got clones %v under %s while scanning, want one", clones, tmpDir)
+	}
+	if left, _ := filepath.Glob(filepath.Join(tmpDir, "*")); len(left) != 0 {
+		t.Errorf("got %v left under %s after the scan, want the clone removed", left, tmpDir)
+	}
+}
+
+func TestCloneRepoHonorsTMPDIR(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("readme", map[string]string{"README.md": "hello\n"})
+	tmpDir := t.TempDir()
+	t.Setenv("TMPDIR", tmpDir)
+
+	path, err := cloneRepo(context.Background(), repo.dir, "", "", "", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+	if filepath.Dir(path) != tmpDir {
+		t.Errorf("cloned into %s, want a directory under %s", path, tmpDir)
+	}
+
+	if dir, err := checkTempDir(""); err != nil || dir != tmpDir {
+		t.Errorf("checkTempDir() = %q, %v, want %q", dir, err, tmpDir)
+	}
+}
+
+func TestCloneNeverTakesTheURLForAnOption(t *testing.T) {
+	ctx := context.Background()
+	marker := filepath.Join(t.TempDir(), "pwned")
+	url := "--upload-pack=touch " + marker
+
+	for name, clone := range map[string]func() error{
+		"clone": func() error {
+			_, err := cloneRepo(ctx, url, "", "", "", 0, nil)
+			return err
+		},
+		"shallow clone": func() error {
+			_, err := cloneRepo(ctx, url, "", "", "", 1, nil)
+			return err
+		},
+		"clone cache": func() error {
+			return updateMirror(ctx, filepath.Join(t.TempDir(), "mirror.git"), url, "")
+		},
+		"plan": func() error {
+			_, err := cloneMetadata(url, "", "", "", 0)
+			return err
+		},
+	} {
+		var cloneErr *CloneError
+		if err := clone(); !errors.As(err, &cloneErr) || !strings.Contains(cloneErr.Output, "repository '"+url+"'") {
+			t.Errorf("%s: got %v, want the URL cloned as a repository", name, err)
+		}
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("the URL ran as an option of git clone")
+	}
+}
+
+func TestCheckTempDirInvalid(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := ioutil.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range []string{filepath.Join(t.TempDir(), "missing"), file} {
+		if _, err := checkTempDir(dir); err == nil || !strings.Contains(err.Error(), "is not writable") {
+			t.Errorf("checkTempDir(%s): got error %v, want it rejected", dir, err)
+		}
+	}
+}
+
+func TestLabelledKeyForms(t *testing.T) {
+	rules, err := newRuleSet(nil, ruleSelection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, id, secret string
+	}{
+		{"export", "export AWS_ACCESS_KEY_ID=" + testAccessKeyID, "export AWS_SECRET_ACCESS_KEY=" + testSecretAccessKey},
+		{"colon", "AWS_ACCESS_KEY_ID: " + testAccessKeyID, "AWS_SECRET_ACCESS_KEY: " + testSecretAccessKey},
+		{"colon without space", "AWS_ACCESS_KEY_ID:" + testAccessKeyID, "AWS_SECRET_ACCESS_KEY:" + testSecretAccessKey},
+		{"indented", "  AWS_ACCESS_KEY_ID=" + testAccessKeyID, "\tAWS_SECRET_ACCESS_KEY=" + testSecretAccessKey},
+		{"padded", "AWS_ACCESS_KEY_ID = " + testAccessKeyID, "AWS_SECRET_ACCESS_KEY\t=\t" + testSecretAccessKey},
+		{"double quoted", `export AWS_ACCESS_KEY_ID="` + testAccessKeyID + `"`, `export AWS_SECRET_ACCESS_KEY="` + testSecretAccessKey + `"`},
+		{"single quoted", "  AWS_ACCESS_KEY_ID: '" + testAccessKeyID + "'", "  AWS_SECRET_ACCESS_KEY: '" + testSecretAccessKey + "'"},
+		{"JSON", `"AWS_ACCESS_KEY_ID": "` + testAccessKeyID + `",`, `"AWS_SECRET_ACCESS_KEY": "` + testSecretAccessKey + `"`},
+		{"Go", "AWS_ACCESS_KEY_ID := \"" + testAccessKeyID + "\"", "AWS_SECRET_ACCESS_KEY := \"" + testSecretAccessKey + "\""},
+		{"lower case", "aws_access_key_id = " + testAccessKeyID, "aws_secret_access_key = " + testSecretAccessKey},
+	}
+
+	for _, tt := range tests {
+		content := tt.id + "\n" + tt.secret + "\n"
+		var labelled []keyMatch
+		for _, m := range rules.search([]byte(content)) {
+			if m.Rule == ruleAWSLabelled {
+				labelled = append(labelled, m)
+			}
+		}
+		if len(labelled) != 1 || labelled[0].AccessKeyID != testAccessKeyID || labelled[0].SecretAccessKey != testSecretAccessKey {
+			t.Errorf("%s: got labelled matches %+v, want %s with its secret", tt.name, labelled, testAccessKeyID)
+		}
+	}
+}
+
+func TestLabelledKeyEmptyValue(t *testing.T) {
+	rules, err := newRuleSet(nil, ruleSelection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An empty value does not capture the label on the next line
+	content := "export AWS_ACCESS_KEY_ID=\nexport AWS_SECRET_ACCESS_KEY=\nAWS_REGION=us-east-1\n"
+	for _, m := range rules.search([]byte(content)) {
+		t.Errorf("matched %s:%s, want no match", m.AccessKeyID, m.SecretAccessKey)
+	}
+}
+
+func TestGetCommitHashesLogArgs(t *testing.T) {
+	repo := newFixtureRepo(t)
+	first := repo.commit("first", map[string]string{"a.txt": "a"})
+	repo.git("checkout", "-q", "-b", "feature")
+	feature := repo.commit("fix: feature", map[string]string{"docs/b.txt": "b"})
+	repo.git("checkout", "-q", "main")
+	second := repo.commit("fix: second", map[string]string{"c.txt": "c"})
+	repo.git("merge", "-q", "--no-ff", "-m", "merge", "feature")
+	merge := repo.git("rev-parse", "HEAD")
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"first parent", []string{"--first-parent"}, []string{merge, second, first}},
+		{"grep", []string{"--grep=^fix:"}, []string{second, feature}},
+		{"paths", []string{"--", "docs"}, []string{feature}},
+		{"first parent with paths", []string{"--first-parent", "--", "docs"}, []string{merge}},
+	}
+
+	for _, tt := range tests {
+		history, err := ScanOptions{LogArgs: tt.args}.historyOptions()
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes, _, err := getCommitHashes(repo.dir, history)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if strings.Join(hashes, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("%s: got %v, want %v", tt.name, hashes, tt.want)
+		}
+	}
+}
+
+func TestCheckLogArgs(t *testing.T) {
+	for _, args := range [][]string{{"--first-parent", "--since=2020-01-01"}, {"--", "not-an-option"}, nil} {
+		if err := checkLogArgs(args); err != nil {
+			t.Errorf("%v: got error %v, want the arguments accepted", args, err)
+		}
+	}
+	for _, args := range [][]string{{"--pretty=oneline"}, {"--format=%s"}, {"--output=/tmp/x"}, {"main"}} {
+		if err := checkLogArgs(args); err == nil {
+			t.Errorf("%v: got no error, want the arguments rejected", args)
+		}
+	}
+}
+
+func TestGetCommitHashesRejectsChangedOutput(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("first", map[string]string{"a.txt": "a\n"})
+
+	// An argument slipping past the check still cannot turn the output into something other than hashes
+	for _, arg := range []string{"--graph", "-p", "--stat"} {
+		if _, _, err := getCommitHashes(repo.dir, historyOptions{LogArgs: []string{arg}}); err == nil || !strings.Contains(err.Error(), "unexpected git log output") {
+			t.Errorf("%s: got error %v, want the output rejected", arg, err)
+		}
+	}
+}
+
+// unreadableFixture commits a key file and an unreadable.env, which it then replaces in the working
+// tree with a socket, a file that cannot be opened even with the permissions of root.
+func unreadableFixture(t *testing.T) *fixtureRepo {
+	t.Helper()
+
+	repo := newFixtureRepo(t)
+	repo.commit("add keys", map[string]string{
+		"config.env":     keyFile(testAccessKeyID, testSecretAccessKey),
+		"unreadable.env": keyFile(testAccessKeyID2, testSecretAccessKey2),
+	})
+	path := filepath.Join(repo.dir, "unreadable.env")
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("cannot create a socket: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	return repo
+}
+
+func TestScanPathSkipsUnreadableFiles(t *testing.T) {
+	repo := unreadableFixture(t)
+	logs := captureLog(t)
+
+	result, err := ScanPath(context.Background(), repo.dir, ScanOptions{NoValidate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Findings) != 1 || result.Findings[0].File != "config.env" {
+		t.Errorf("got findings %+v, want the key of config.env", result.Findings)
+	}
+	if result.Stats.SkippedUnreadable != 1 || result.Stats.FilesScanned != 1 {
+		t.Errorf("got %d files skipped as unreadable and %d scanned, want 1 and 1", result.Stats.SkippedUnreadable, result.Stats.FilesScanned)
+	}
+	if !strings.Contains(logs.String(), "failed to read file unreadable.env") {
+		t.Errorf("got log %q, want the unreadable file reported", logs.String())
+	}
+}
+
+func TestScanPathStrict(t *testing.T) {
+	repo := unreadableFixture(t)
+
+	_, err := ScanPath(context.Background(), repo.dir, ScanOptions{NoValidate: true, Strict: true})
+	if err == nil || !strings.Contains(err.Error(), "failed to read file unreadable.env") {
+		t.Errorf("got error %v, want the unreadable file to fail the scan", err)
+	}
+}
+
+func TestGetCommitHashesCredentialFiles(t *testing.T) {
+	repo := newFixtureRepo(t)
+	env := repo.commit("add env", map[string]string{".env": "DEBUG=1\n"})
+	repo.commit("docs", map[string]string{"README.md": "# app\n"})
+	nested := repo.commit("add settings", map[string]string{"deploy/config.yml": "region: eu-west-1\n", "deploy/notes.txt": "n\n"})
+	repo.commit("more docs", map[string]string{"docs/guide.md": "guide\n", "README.md": "# app v2\n"})
+	upper := repo.commit("add prod env", map[string]string{"services/api/Prod.ENV": "LOG=1\n"})
+	repo.git("rm", "-q", ".env")
+	removed := repo.commit("remove env", nil)
+
+	hashes, _, err := getCommitHashes(repo.dir, historyOptions{CredentialFiles: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{removed, upper, nested, env}; strings.Join(hashes, " ") != strings.Join(want, " ") {
+		t.Errorf("got %v, want %v", hashes, want)
+	}
+
+	// The commit limit counts the commits kept
+	hashes, truncated, err := getCommitHashes(repo.dir, historyOptions{CredentialFiles: true, MaxCommits: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{removed, upper}; strings.Join(hashes, " ") != strings.Join(want, " ") || !truncated {
+		t.Errorf("with a limit: got %v truncated %v, want %v truncated", hashes, truncated, want)
+	}
+}
+
+func TestScanCredentialFilesOnly(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("add readme", map[string]string{"README.md": "key " + testAccessKeyID2 + "\n"})
+	env := repo.commit("add env", map[string]string{".env": keyFile(testAccessKeyID, testSecretAccessKey)})
+	repo.commit("update readme", map[string]string{"README.md": "docs\n"})
+
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true, CredentialFilesOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Commits != 1 {
+		t.Errorf("scanned %d commits, want only the one changing .env", result.Commits)
+	}
+	// The commit is still scanned in full, README.md included
+	if len(result.Findings) != 2 {
+		t.Fatalf("got findings %+v, want the keys of the commit changing .env", result.Findings)
+	}
+	for _, f := range result.Findings {
+		if f.Commit != env {
+			t.Errorf("got finding in commit %s, want %s", f.Commit, env)
+		}
+	}
+
+	if _, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true, CredentialFilesOnly: true, TipOnly: true}); err == nil {
+		t.Error("got no error combining tip-only and credential-files-only")
+	}
+}
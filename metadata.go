@@ -0,0 +1,71 @@
+package main
+
+import "time"
+
+// ReportMetadata describes how a scan result was produced, so archived reports can be audited and
+// reproduced without outside context.
+type ReportMetadata struct {
+	ScannerVersion string    `json:"scanner_version"`
+	ScannerCommit  string    `json:"scanner_commit"`
+	StartedAt      time.Time `json:"started_at"`
+	FinishedAt     time.Time `json:"finished_at"`
+	// Repo and Commit are the scanned repository and its HEAD commit, when a single repository was scanned.
+	Repo   string `json:"repo,omitempty"`
+	Commit string `json:"commit,omitempty"`
+	// Options are the scan options, with the token redacted.
+	Options ScanOptions  `json:"options"`
+	Counts  reportCounts `json:"counts"`
+}
+
+// reportCounts summarizes the findings of a scan result by status.
+type reportCounts struct {
+	Commits      int `json:"commits"`
+	FilesScanned int `json:"files_scanned"`
+	Findings     int `json:"findings"`
+	Valid        int `json:"valid"`
+	Unverified   int `json:"unverified"`
+	Invalid      int `json:"invalid"`
+	Skipped      int `json:"skipped"`
+	Allowed      int `json:"allowed"`
+}
+
+// setMetadata records the metadata of a finished scan that ran with opts from started, and scanned
+// commit when it is a single repository.
+func (result *ScanResult) setMetadata(opts ScanOptions, started time.Time, commit string) {
+	if opts.Token != "" {
+		opts.Token = redact(opts.Token)
+	}
+
+	result.Metadata = &ReportMetadata{
+		ScannerVersion: scannerVersion(),
+		ScannerCommit:  scannerCommit(),
+		StartedAt:      started.UTC(),
+		FinishedAt:     time.Now().UTC(),
+		Repo:           result.Repo,
+		Commit:         commit,
+		Options:        opts,
+		Counts:         result.counts(),
+	}
+}
+
+// counts summarizes the findings of the result by status.
+func (result *ScanResult) counts() reportCounts {
+	counts := reportCounts{Commits: result.Commits, FilesScanned: result.Stats.FilesScanned, Findings: len(result.Findings)}
+	for _, f := range result.Findings {
+		switch f.Status {
+		case statusValid:
+			counts.Valid++
+		case statusUnverified:
+			counts.Unverified++
+		case statusInvalid:
+			counts.Invalid++
+		case statusSkipped:
+			counts.Skipped++
+		}
+		if f.Allowed {
+			counts.Allowed++
+		}
+	}
+
+	return counts
+}
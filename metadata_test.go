@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReportMetadata(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("add key", map[string]string{"config.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+	head := repo.commit("add dead key", map[string]string{"dead.env": keyFile(testAccessKeyID2, testSecretAccessKey2), "README.md": "hello\n"})
+	stub := newSTSStub(t, testAccessKeyID)
+	setBuildVars(t, "1.2.3", "abc1234")
+
+	started := time.Now().UTC()
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, AWSEndpoint: stub.URL, Token: testGitHubToken, Diff: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := writeJSONReport(&out, result); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), testGitHubToken) {
+		t.Errorf("JSON report holds the token:\n%s", out.String())
+	}
+
+	var report struct {
+		Metadata ReportMetadata `json:"metadata"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("invalid JSON report: %v", err)
+	}
+	m := report.Metadata
+	if m.ScannerVersion != "1.2.3" || m.ScannerCommit != "abc1234" {
+		t.Errorf("got scanner %s %s, want 1.2.3 abc1234", m.ScannerVersion, m.ScannerCommit)
+	}
+	if m.Repo != repo.dir || m.Commit != head {
+		t.Errorf("got repository %s at %s, want %s at %s", m.Repo, m.Commit, repo.dir, head)
+	}
+	if m.StartedAt.Before(started.Add(-time.Second)) || m.FinishedAt.Before(m.StartedAt) || m.FinishedAt.After(time.Now()) {
+		t.Errorf("got scan from %v to %v, want it started after %v", m.StartedAt, m.FinishedAt, started)
+	}
+	if m.Options.RepoURL != repo.dir || !m.Options.Diff || m.Options.AWSEndpoint != stub.URL || m.Options.Token != redact(testGitHubToken) {
+		t.Errorf("got options %+v, want those of the scan with the token redacted", m.Options)
+	}
+	want := reportCounts{Commits: 2, FilesScanned: result.Stats.FilesScanned, Findings: 2, Valid: 1, Invalid: 1}
+	if m.Counts != want {
+		t.Errorf("got counts %+v, want %+v", m.Counts, want)
+	}
+	if m.Counts.FilesScanned == 0 {
+		t.Error("got no files scanned")
+	}
+}
+
+func TestSARIFMetadata(t *testing.T) {
+	repo := newFixtureRepo(t)
+	head := repo.commit("add key", map[string]string{"config.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := writeSARIFReport(&out, result); err != nil {
+		t.Fatal(err)
+	}
+	var sarif struct {
+		Runs []struct {
+			Invocations []struct {
+				StartTimeUTC string `json:"startTimeUtc"`
+			} `json:"invocations"`
+			VersionControlProvenance []struct {
+				RepositoryURI string `json:"repositoryUri"`
+				RevisionID    string `json:"revisionId"`
+			} `json:"versionControlProvenance"`
+			Properties struct {
+				Metadata ReportMetadata `json:"metadata"`
+			} `json:"properties"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &sarif); err != nil {
+		t.Fatalf("invalid SARIF: %v", err)
+	}
+
+	run := sarif.Runs[0]
+	if len(run.Invocations) != 1 || run.Invocations[0].StartTimeUTC == "" {
+		t.Errorf("got invocations %+v, want the scan's", run.Invocations)
+	}
+	if len(run.VersionControlProvenance) != 1 || run.VersionControlProvenance[0].RepositoryURI != repo.dir || run.VersionControlProvenance[0].RevisionID != head {
+		t.Errorf("got provenance %+v, want %s at %s", run.VersionControlProvenance, repo.dir, head)
+	}
+	if run.Properties.Metadata.Counts.Findings != 1 {
+		t.Errorf("got metadata counts %+v, want 1 finding", run.Properties.Metadata.Counts)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Metrics exported by the serve mode on /metrics.
+var (
+	scansStarted = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "scanner_scans_started_total",
+		Help: "Number of scans started.",
+	})
+	scansCompleted = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "scanner_scans_completed_total",
+		Help: "Number of scans that completed successfully.",
+	})
+	scansFailed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "scanner_scans_failed_total",
+		Help: "Number of scans that failed.",
+	})
+	scansCancelled = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "scanner_scans_cancelled_total",
+		Help: "Number of scans cancelled before they finished.",
+	})
+	scanDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "scanner_scan_duration_seconds",
+		Help:    "Duration of completed and failed scans.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	})
+	findingsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scanner_findings_total",
+		Help: "Number of findings reported by completed scans, by validation status and severity.",
+	}, []string{"status", "severity"})
+	validationCalls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scanner_validation_calls_total",
+		Help: "Number of key validation calls, by resulting status.",
+	}, []string{"status"})
+)
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// scrapeMetric returns the value of the metric series, such as `scanner_findings_total{severity="high",status="valid"}`,
+// as served on /metrics, or 0 when it is not exported yet.
+func scrapeMetric(t *testing.T, s *server, series string) float64 {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if strings.HasPrefix(line, series+" ") {
+			value, err := strconv.ParseFloat(strings.TrimPrefix(line, series+" "), 64)
+			if err != nil {
+				t.Fatalf("invalid metric line %q", line)
+			}
+			return value
+		}
+	}
+
+	return 0
+}
+
+func TestMetricsCountScans(t *testing.T) {
+	s := newServer(func(ctx context.Context, opts ScanOptions) (*ScanResult, error) {
+		return &ScanResult{Findings: []Finding{
+			{AccessKeyID: testAccessKeyID, Status: statusValid, Severity: severityCritical},
+			{AccessKeyID: testAccessKeyID2, Status: statusInvalid, Severity: severityLow},
+		}}, nil
+	}, 1, "")
+
+	completed := `scanner_scans_completed_total`
+	critical := `scanner_findings_total{severity="critical",status="valid"}`
+	low := `scanner_findings_total{severity="low",status="invalid"}`
+	before := []float64{scrapeMetric(t, s, completed), scrapeMetric(t, s, critical), scrapeMetric(t, s, low)}
+
+	if code := postScan(t, s, `{"repo":"https://github.com/o/a"}`, nil); code != http.StatusOK {
+		t.Fatalf("scan: status %d", code)
+	}
+
+	after := []float64{scrapeMetric(t, s, completed), scrapeMetric(t, s, critical), scrapeMetric(t, s, low)}
+	for i, series := range []string{completed, critical, low} {
+		if after[i] != before[i]+1 {
+			t.Errorf("%s went from %v to %v, want an increment of 1", series, before[i], after[i])
+		}
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !unix
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+)
+
+// mmapSupported reports whether files can be memory-mapped on this platform.
+const mmapSupported = false
+
+// mapFile reads the whole file since memory-mapping is not supported on this platform.
+func mapFile(path string) ([]byte, func(), error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read file: %v", err)
+	}
+
+	return content, func() {}, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeLargeFixture writes a file of about size bytes of configuration lines with key pairs at its
+// start, middle and end, and returns its path.
+func writeLargeFixture(tb testing.TB, size int) string {
+	tb.Helper()
+
+	var content bytes.Buffer
+	pairs := []string{keyFile(testAccessKeyID, testSecretAccessKey), keyFile(testAccessKeyID2, testSecretAccessKey2)}
+	content.WriteString(pairs[0])
+	for i := 0; content.Len() < size; i++ {
+		if i == size/2/64 {
+			content.WriteString(pairs[1])
+		}
+		content.WriteString("setting_value = some ordinary configuration text of a large file\n")
+	}
+	content.WriteString(pairs[0])
+
+	path := filepath.Join(tb.TempDir(), "large.env")
+	if err := ioutil.WriteFile(path, content.Bytes(), 0o600); err != nil {
+		tb.Fatal(err)
+	}
+
+	return path
+}
+
+func TestMappedFileMatchesReadFile(t *testing.T) {
+	rules, err := newRuleSet(nil, ruleSelection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.env")
+	if err := ioutil.WriteFile(empty, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{writeLargeFixture(t, mmapThreshold), empty} {
+		read, err := searchIAMKeysInFile(path, rules)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mapped, err := searchIAMKeysInMappedFile(path, rules)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(mapped, read) {
+			t.Errorf("%s: mapped file matches %+v, want %+v", filepath.Base(path), mapped, read)
+		}
+	}
+}
+
+func TestScanFileMmap(t *testing.T) {
+	path := writeLargeFixture(t, mmapThreshold)
+
+	var results [2]*ScanResult
+	for i, mmap := range []bool{false, true} {
+		result, err := ScanFile(context.Background(), path, ScanOptions{NoValidate: true, Mmap: mmap, MaxFileSize: 8 * mmapThreshold})
+		if err != nil {
+			t.Fatal(err)
+		}
+		results[i] = result
+	}
+
+	// The pair at the start and end of the file is reported once
+	if len(results[0].Findings) != 2 {
+		t.Errorf("got %d findings, want 2", len(results[0].Findings))
+	}
+	if !reflect.DeepEqual(results[1].Findings, results[0].Findings) {
+		t.Errorf("got findings %+v with mmap, want %+v", results[1].Findings, results[0].Findings)
+	}
+}
+
+func BenchmarkSearchLargeFile(b *testing.B) {
+	path := writeLargeFixture(b, 16*mmapThreshold)
+	rules, err := newRuleSet(nil, ruleSelection{})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, bm := range []struct {
+		name   string
+		search func(string, *ruleSet) ([]keyMatch, error)
+	}{
+		{"ReadFile", searchIAMKeysInFile},
+		{"mmap", searchIAMKeysInMappedFile},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			b.SetBytes(16 * mmapThreshold)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := bm.search(path, rules); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// mmapSupported reports whether files can be memory-mapped on this platform.
+const mmapSupported = true
+
+// mapFile memory-maps the file read-only and returns its content with a function unmapping it.
+// The content must not be used once it is unmapped.
+func mapFile(path string) ([]byte, func(), error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open file: %v", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to stat file: %v", err)
+	}
+	if info.Size() == 0 {
+		return nil, func() {}, nil
+	}
+
+	content, err := syscall.Mmap(int(f.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to map file: %v", err)
+	}
+
+	return content, func() { syscall.Munmap(content) }, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+)
+
+// notebook is the part of a Jupyter notebook (.ipynb) that holds code and text.
+type notebook struct {
+	Cells []notebookCell `json:"cells"`
+}
+
+// notebookCell is a cell of a notebook, with the outputs of code cells.
+type notebookCell struct {
+	Source  notebookText     `json:"source"`
+	Outputs []notebookOutput `json:"outputs"`
+}
+
+// notebookOutput is an output of a code cell: stream text, or data keyed by MIME type for results.
+type notebookOutput struct {
+	Text notebookText               `json:"text"`
+	Data map[string]json.RawMessage `json:"data"`
+}
+
+// notebookText is multiline text, which notebooks store as a string or as a list of lines.
+type notebookText string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *notebookText) UnmarshalJSON(data []byte) error {
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err == nil {
+		*t = notebookText(strings.Join(lines, ""))
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	*t = notebookText(text)
+
+	return nil
+}
+
+// isNotebook reports whether the path is a Jupyter notebook.
+func isNotebook(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".ipynb")
+}
+
+// texts returns the source of the cell followed by its textual outputs.
+func (c notebookCell) texts() []string {
+	texts := []string{string(c.Source)}
+	for _, output := range c.Outputs {
+		if output.Text != "" {
+			texts = append(texts, string(output.Text))
+		}
+		for mimeType, raw := range output.Data {
+			var text notebookText
+			if strings.HasPrefix(mimeType, "text/") && json.Unmarshal(raw, &text) == nil && text != "" {
+				texts = append(texts, string(text))
+			}
+		}
+	}
+
+	return texts
+}
+
+// searchNotebook runs every rule over the source and outputs of each cell of a notebook, decoded
+// from their JSON strings, and reports the 1-based cell of every match with its line in the cell's
+// source or output. It returns false when the content is not a notebook, so it can be searched as is.
+func (rs *ruleSet) searchNotebook(content []byte) ([]keyMatch, bool) {
+	var nb notebook
+	if err := json.Unmarshal(content, &nb); err != nil || nb.Cells == nil {
+		return nil, false
+	}
+
+	var matches []keyMatch
+	for i, cell := range nb.Cells {
+		for _, text := range cell.texts() {
+			cellContent := []byte(text)
+			if rs.joinLiterals {
+				cellContent = joinLiterals("cell.py", cellContent)
+			}
+			for _, match := range rs.search(cellContent) {
+				match.Cell = i + 1
+				matches = append(matches, match)
+			}
+		}
+	}
+
+	return matches, true
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+// notebookFixture returns a notebook with a markdown cell, a code cell assigning a key pair and a
+// code cell whose output prints another one.
+func notebookFixture(t *testing.T) string {
+	nb := map[string]interface{}{
+		"nbformat": 4,
+		"cells": []interface{}{
+			map[string]interface{}{"cell_type": "markdown", "source": "# Load the data\n"},
+			map[string]interface{}{
+				"cell_type": "code",
+				"source": []string{
+					"import boto3\n",
+					"\n",
+					"AWS_ACCESS_KEY_ID = \"" + testAccessKeyID + "\"\n",
+					"AWS_SECRET_ACCESS_KEY = \"" + testSecretAccessKey + "\"\n",
+				},
+				"outputs": []interface{}{},
+			},
+			map[string]interface{}{
+				"cell_type": "code",
+				"source":    "!cat ~/.aws/credentials",
+				"outputs": []interface{}{
+					map[string]interface{}{"output_type": "stream", "name": "stdout", "text": []string{"[default]\n", "aws_access_key_id = " + testAccessKeyID2 + "\n", "aws_secret_access_key = " + testSecretAccessKey2 + "\n"}},
+				},
+			},
+		},
+	}
+	data, err := json.MarshalIndent(nb, "", " ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
+
+func TestScanNotebook(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("add notebook", map[string]string{"analysis.ipynb": notebookFixture(t)})
+
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Lines count from the start of the cell's source or output, and secrets are decoded from their JSON strings
+	type location struct {
+		cell, line int
+		secret     string
+	}
+	want := map[string]location{testAccessKeyID: {2, 3, testSecretAccessKey}, testAccessKeyID2: {3, 2, testSecretAccessKey2}}
+	if len(result.Findings) != len(want) {
+		t.Fatalf("got findings %+v, want one in each code cell", result.Findings)
+	}
+	for _, f := range result.Findings {
+		if got := (location{f.Cell, f.Line, f.SecretAccessKey}); got != want[f.AccessKeyID] {
+			t.Errorf("%s: got %+v, want %+v", f.AccessKeyID, got, want[f.AccessKeyID])
+		}
+		if f.File != "analysis.ipynb" {
+			t.Errorf("got file %s, want analysis.ipynb", f.File)
+		}
+	}
+}
+
+func TestSearchNotebookNotJSON(t *testing.T) {
+	rules, err := newRuleSet(nil, ruleSelection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A file named like a notebook that is not one is searched as is
+	for _, content := range []string{"AWS_ACCESS_KEY_ID=" + testAccessKeyID, `{"metadata": {}}`} {
+		if _, ok := rules.searchNotebook([]byte(content)); ok {
+			t.Errorf("searchNotebook(%q) searched it as a notebook", content)
+		}
+	}
+	if !isNotebook("Analysis.IPYNB") || isNotebook("notes.json") {
+		t.Error("notebook extension not recognised case-insensitively")
+	}
+}
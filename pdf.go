@@ -0,0 +1,439 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxPDFDepth bounds how deeply the page tree of a PDF is followed, since its nodes can reference
+// each other in cycles.
+const maxPDFDepth = 32
+
+var (
+	pdfObjectRe   = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+	pdfLengthRe   = regexp.MustCompile(`/Length\s+(\d+)(\s+\d+\s+R)?`)
+	pdfRefRe      = regexp.MustCompile(`(\d+)\s+\d+\s+R`)
+	pdfKidsRe     = regexp.MustCompile(`/Kids\s*\[([^\]]*)\]`)
+	pdfContentsRe = regexp.MustCompile(`/Contents\s*(\[[^\]]*\]|\d+\s+\d+\s+R)`)
+	pdfFilterRe   = regexp.MustCompile(`/Filter\s*(\[[^\]]*\]|/\w+)`)
+	pdfFirstRe    = regexp.MustCompile(`/First\s+(\d+)`)
+	pdfPageRe     = regexp.MustCompile(`/Type\s*/Page\b`)
+	pdfPagesRe    = regexp.MustCompile(`/Type\s*/Pages\b`)
+	pdfObjStmRe   = regexp.MustCompile(`/Type\s*/ObjStm\b`)
+)
+
+// pdfObject is an indirect object of a PDF: its dictionary, or other value, and its stream, still
+// encoded, when it has one.
+type pdfObject struct {
+	dict   []byte
+	stream []byte
+}
+
+// pdfDocument is a PDF being decoded.
+type pdfDocument struct {
+	objects map[int]pdfObject
+	// budget is how many more bytes may be decompressed from its streams.
+	budget int
+}
+
+// pdfPages returns the text of every page of a PDF in page order, as drawn by the text operators of
+// their content streams. Only text in fonts with a single byte encoding can be read; streams compressed
+// with filters other than FlateDecode are passed over.
+func pdfPages(content []byte) ([]string, bool) {
+	doc := &pdfDocument{objects: parsePDFObjects(content), budget: maxDocumentText}
+	doc.expandObjectStreams()
+
+	var pages []string
+	for _, ref := range doc.pageRefs() {
+		contents := pdfContentsRe.FindSubmatch(doc.objects[ref].dict)
+		if contents == nil {
+			pages = append(pages, "")
+			continue
+		}
+
+		var text []string
+		for _, m := range pdfRefRe.FindAllSubmatch(contents[1], -1) {
+			n, _ := strconv.Atoi(string(m[1]))
+			if stream, ok := doc.decodeStream(doc.objects[n]); ok {
+				text = append(text, pdfText(stream))
+			}
+		}
+		pages = append(pages, strings.Join(text, "\n"))
+	}
+	if len(pages) == 0 {
+		return nil, false
+	}
+
+	return pages, true
+}
+
+// parsePDFObjects returns the indirect objects of a PDF by number. Objects appended by incremental
+// updates replace the earlier ones with the same number.
+func parsePDFObjects(content []byte) map[int]pdfObject {
+	objects := make(map[int]pdfObject)
+	for pos := 0; pos < len(content); {
+		m := pdfObjectRe.FindSubmatchIndex(content[pos:])
+		if m == nil {
+			break
+		}
+		n, _ := strconv.Atoi(string(content[pos+m[2] : pos+m[3]]))
+		body := pos + m[1]
+
+		end := bytes.Index(content[body:], []byte("endobj"))
+		if end < 0 {
+			end = len(content) - body
+		}
+		streamAt := bytes.Index(content[body:body+end], []byte("stream"))
+		if streamAt < 0 {
+			objects[n] = pdfObject{dict: content[body : body+end]}
+			pos = body + end
+			continue
+		}
+
+		// The stream follows its dictionary and an end of line, and is Length bytes long unless the
+		// length is an indirect reference or wrong, in which case it ends at endstream
+		dict := content[body : body+streamAt]
+		start := body + streamAt + len("stream")
+		if bytes.HasPrefix(content[start:], []byte("\r\n")) {
+			start += 2
+		} else if bytes.HasPrefix(content[start:], []byte("\n")) {
+			start++
+		}
+		stop := -1
+		if length := pdfLengthRe.FindSubmatch(dict); length != nil && length[2] == nil {
+			if l, err := strconv.Atoi(string(length[1])); err == nil && l <= len(content)-start &&
+				bytes.HasPrefix(bytes.TrimLeft(content[start+l:], "\r\n "), []byte("endstream")) {
+				stop = start + l
+			}
+		}
+		if stop < 0 {
+			i := bytes.Index(content[start:], []byte("endstream"))
+			if i < 0 {
+				break
+			}
+			stop = start + i
+		}
+
+		objects[n] = pdfObject{dict: dict, stream: content[start:stop]}
+		pos = stop + len("endstream")
+	}
+
+	return objects
+}
+
+// expandObjectStreams adds the objects compressed into object streams, where PDF 1.5 and later keep
+// most dictionaries, including the page tree.
+func (doc *pdfDocument) expandObjectStreams() {
+	var streams []int
+	for n, obj := range doc.objects {
+		if obj.stream != nil && pdfObjStmRe.Match(obj.dict) {
+			streams = append(streams, n)
+		}
+	}
+	sort.Ints(streams)
+
+	for _, n := range streams {
+		first := pdfFirstRe.FindSubmatch(doc.objects[n].dict)
+		data, ok := doc.decodeStream(doc.objects[n])
+		if first == nil || !ok {
+			continue
+		}
+		offset, _ := strconv.Atoi(string(first[1]))
+		if offset > len(data) {
+			continue
+		}
+
+		// The stream starts with pairs of object numbers and offsets relative to First
+		header := strings.Fields(string(data[:offset]))
+		for i := 0; i+1 < len(header); i += 2 {
+			num, err1 := strconv.Atoi(header[i])
+			start, err2 := strconv.Atoi(header[i+1])
+			if err1 != nil || err2 != nil || offset+start > len(data) {
+				continue
+			}
+			stop := len(data)
+			if i+3 < len(header) {
+				if next, err := strconv.Atoi(header[i+3]); err == nil && next >= start && offset+next <= len(data) {
+					stop = offset + next
+				}
+			}
+			if _, ok := doc.objects[num]; !ok {
+				doc.objects[num] = pdfObject{dict: data[offset+start : stop]}
+			}
+		}
+	}
+}
+
+// pageRefs returns the object numbers of the pages in the order of the page tree, or in object order
+// when the tree cannot be found.
+func (doc *pdfDocument) pageRefs() []int {
+	var nums []int
+	for n := range doc.objects {
+		nums = append(nums, n)
+	}
+	sort.Ints(nums)
+
+	var pages []int
+	visited := make(map[int]bool)
+	var walk func(n, depth int)
+	walk = func(n, depth int) {
+		obj, ok := doc.objects[n]
+		if !ok || visited[n] || depth > maxPDFDepth {
+			return
+		}
+		visited[n] = true
+		if pdfPagesRe.Match(obj.dict) {
+			if kids := pdfKidsRe.FindSubmatch(obj.dict); kids != nil {
+				for _, m := range pdfRefRe.FindAllSubmatch(kids[1], -1) {
+					kid, _ := strconv.Atoi(string(m[1]))
+					walk(kid, depth+1)
+				}
+			}
+		} else if pdfPageRe.Match(obj.dict) {
+			pages = append(pages, n)
+		}
+	}
+
+	// The root of the page tree is the only Pages node without a parent
+	for _, n := range nums {
+		if dict := doc.objects[n].dict; pdfPagesRe.Match(dict) && !bytes.Contains(dict, []byte("/Parent")) {
+			walk(n, 0)
+		}
+	}
+	if len(pages) > 0 {
+		return pages
+	}
+
+	for _, n := range nums {
+		if pdfPageRe.Match(doc.objects[n].dict) {
+			pages = append(pages, n)
+		}
+	}
+
+	return pages
+}
+
+// decodeStream returns the decoded stream of the object, which must be uncompressed or compressed
+// with FlateDecode alone, within the decompression budget of the document.
+func (doc *pdfDocument) decodeStream(obj pdfObject) ([]byte, bool) {
+	if obj.stream == nil {
+		return nil, false
+	}
+
+	var data []byte
+	filter := pdfFilterRe.FindSubmatch(obj.dict)
+	switch {
+	case filter == nil:
+		data = obj.stream
+	case strings.Trim(string(filter[1]), "[] \r\n\t") == "/FlateDecode":
+		r, err := zlib.NewReader(bytes.NewReader(obj.stream))
+		if err != nil {
+			return nil, false
+		}
+		// A stream cut short still holds the text before the damage
+		data, _ = ioutil.ReadAll(io.LimitReader(r, int64(doc.budget)+1))
+	default:
+		return nil, false
+	}
+	if len(data) > doc.budget {
+		doc.budget = 0
+		return nil, false
+	}
+	doc.budget -= len(data)
+
+	return data, true
+}
+
+// pdfText returns the text shown by the operators of a content stream, starting a line at every
+// text object and move to another line.
+func pdfText(stream []byte) string {
+	var text strings.Builder
+	newline := func() {
+		if s := text.String(); s != "" && !strings.HasSuffix(s, "\n") {
+			text.WriteString("\n")
+		}
+	}
+
+	// Strings and numbers are the operands of the next operator
+	var shown []string
+	var numbers []float64
+	for i := 0; i < len(stream); {
+		c := stream[i]
+		switch {
+		case c == '%':
+			for i < len(stream) && stream[i] != '\n' && stream[i] != '\r' {
+				i++
+			}
+		case c == '(':
+			s, next := pdfLiteralString(stream, i)
+			shown = append(shown, s)
+			i = next
+		case c == '<' && i+1 < len(stream) && stream[i+1] == '<', c == '>' && i+1 < len(stream) && stream[i+1] == '>':
+			i += 2
+		case c == '<':
+			end := bytes.IndexByte(stream[i:], '>')
+			if end < 0 {
+				end = len(stream) - i
+			}
+			shown = append(shown, pdfHexString(stream[i+1:i+end]))
+			i += end + 1
+		case c == '/':
+			i++
+			for i < len(stream) && !pdfDelimiter(stream[i]) {
+				i++
+			}
+		case c == '[', c == ']', c == '>', c == '{', c == '}', c == ')', pdfSpace(c):
+			i++
+		default:
+			start := i
+			for i < len(stream) && !pdfDelimiter(stream[i]) {
+				i++
+			}
+			if i == start {
+				i++
+				continue
+			}
+			word := string(stream[start:i])
+			if n, err := strconv.ParseFloat(word, 64); err == nil {
+				// Wide gaps between the strings of a TJ array separate words
+				if len(shown) > 0 && n < -200 {
+					shown = append(shown, " ")
+				}
+				numbers = append(numbers, n)
+				continue
+			}
+
+			switch word {
+			case "BT", "T*", "Tm":
+				newline()
+			case "Td", "TD":
+				if len(numbers) >= 2 && numbers[len(numbers)-1] != 0 {
+					newline()
+				} else if s := text.String(); s != "" && !strings.HasSuffix(s, "\n") && !strings.HasSuffix(s, " ") {
+					text.WriteString(" ")
+				}
+			case "'", "\"":
+				newline()
+				text.WriteString(strings.Join(shown, ""))
+			case "Tj", "TJ":
+				text.WriteString(strings.Join(shown, ""))
+			case "ID":
+				// The binary data of an inline image runs up to EI
+				end := bytes.Index(stream[i:], []byte("EI"))
+				if end < 0 {
+					end = len(stream) - i
+				}
+				i += end
+			}
+			shown, numbers = nil, nil
+		}
+	}
+
+	return text.String()
+}
+
+// pdfLiteralString decodes the literal string starting at the parenthesis at start, returning it and
+// the offset after it.
+func pdfLiteralString(stream []byte, start int) (string, int) {
+	var s strings.Builder
+	depth := 0
+	i := start
+	for ; i < len(stream); i++ {
+		c := stream[i]
+		switch c {
+		case '(':
+			depth++
+			if depth == 1 {
+				continue
+			}
+		case ')':
+			depth--
+			if depth == 0 {
+				return s.String(), i + 1
+			}
+		case '\\':
+			i++
+			if i >= len(stream) {
+				break
+			}
+			switch e := stream[i]; e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				// A backslash at the end of a line continues the string on the next one
+				if e == '\r' && i+1 < len(stream) && stream[i+1] == '\n' {
+					i++
+				}
+				continue
+			default:
+				if e < '0' || e > '7' {
+					c = e
+					break
+				}
+				octal := 0
+				for j := 0; j < 3 && i < len(stream) && stream[i] >= '0' && stream[i] <= '7'; j++ {
+					octal = octal*8 + int(stream[i]-'0')
+					i++
+				}
+				i--
+				c = byte(octal)
+			}
+		}
+		s.WriteString(pdfChar(c))
+	}
+
+	return s.String(), i
+}
+
+// pdfHexString decodes the digits of a hexadecimal string, where a missing final digit is 0.
+func pdfHexString(digits []byte) string {
+	var clean []byte
+	for _, c := range digits {
+		if !pdfSpace(c) {
+			clean = append(clean, c)
+		}
+	}
+	if len(clean)%2 == 1 {
+		clean = append(clean, '0')
+	}
+
+	var s strings.Builder
+	for i := 0; i+1 < len(clean); i += 2 {
+		b, err := strconv.ParseUint(string(clean[i:i+2]), 16, 8)
+		if err != nil {
+			return ""
+		}
+		s.WriteString(pdfChar(byte(b)))
+	}
+
+	return s.String()
+}
+
+// pdfChar returns the character of a byte of a single byte font encoding, as Latin-1 outside ASCII.
+func pdfChar(b byte) string {
+	return string(rune(b))
+}
+
+// pdfSpace reports whether the byte is PDF white-space.
+func pdfSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
+
+// pdfDelimiter reports whether the byte ends a name, number or operator.
+func pdfDelimiter(c byte) bool {
+	return pdfSpace(c) || strings.IndexByte("()<>[]{}/%", c) >= 0
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// githubWebURL returns the web URL of a github.com repository, e.g. "https://github.com/org/repo", from
+// its HTTPS, SSH or scp-like clone URL, or "" when the repository is not on github.com. Credentials in
+// the clone URL are left out.
+func githubWebURL(cloneURL string) string {
+	var path string
+	switch {
+	case strings.HasPrefix(cloneURL, "git@github.com:"):
+		path = strings.TrimPrefix(cloneURL, "git@github.com:")
+	default:
+		u, err := url.Parse(cloneURL)
+		if err != nil || !strings.EqualFold(u.Hostname(), "github.com") {
+			return ""
+		}
+		if u.Scheme != "https" && u.Scheme != "http" && u.Scheme != "ssh" {
+			return ""
+		}
+		path = u.Path
+	}
+
+	parts := strings.Split(strings.TrimSuffix(strings.Trim(path, "/"), ".git"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return ""
+	}
+
+	return "https://github.com/" + parts[0] + "/" + parts[1]
+}
+
+// permalink returns the URL of the line of the finding in the commit it was found in, under the web URL
+// of its repository. Findings without a commit, and those in dangling blobs or notes, which are not
+// files of a commit, have none.
+func permalink(webURL string, f Finding) string {
+	if webURL == "" || f.Commit == "" || f.File == "" || f.Source == sourceDangling || f.Source == sourceNotes {
+		return ""
+	}
+
+	segments := strings.Split(f.File, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	link := fmt.Sprintf("%s/blob/%s/%s", webURL, f.Commit, strings.Join(segments, "/"))
+	// Lines of notebook cells are not lines of the file
+	if f.Line > 0 && f.Cell == 0 {
+		link += fmt.Sprintf("#L%d", f.Line)
+	}
+
+	return link
+}
+
+// addPermalinks sets the permalink of every finding of the repository cloned from repoURL, when it is
+// on github.com.
+func addPermalinks(repoURL string, findings []Finding) {
+	webURL := githubWebURL(repoURL)
+	if webURL == "" {
+		return
+	}
+
+	for i := range findings {
+		findings[i].Permalink = permalink(webURL, findings[i])
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// validationQueueSize is how many findings can wait for the validation stream before the scan waits
+// for it in turn.
+const validationQueueSize = 1024
+
+// validationStream validates the key pairs of findings while the scan is still producing them, so
+// validating the keys of early commits overlaps with searching the later ones. Its results are kept
+// for the validation of the complete findings, which then only calls out for the keys the stream did
+// not validate, so every key is still validated once.
+type validationStream struct {
+	pool   validationPool
+	scrubs *scrubScope
+	queue  chan Finding
+	done   chan struct{}
+	once   sync.Once
+
+	mu      sync.Mutex
+	results map[string]validationResult
+}
+
+// streamValidation starts validating the findings added to the returned stream with the validation
+// pool of opts, or returns nil when keys are not validated.
+func (opts ScanOptions) streamValidation(ctx context.Context, rules *ruleSet) *validationStream {
+	if opts.NoValidate {
+		return nil
+	}
+
+	s := &validationStream{
+		pool:    opts.validationPool(rules),
+		scrubs:  opts.scrubs,
+		queue:   make(chan Finding, validationQueueSize),
+		done:    make(chan struct{}),
+		results: make(map[string]validationResult),
+	}
+	go s.run(ctx)
+
+	return s
+}
+
+// add queues the finding for validation. A nil stream validates nothing.
+func (s *validationStream) add(f Finding) {
+	if s == nil {
+		return
+	}
+
+	// Secrets may be echoed back in validation errors, so make sure they never reach a log
+	s.scrubs.add(f.SecretAccessKey)
+	s.queue <- f
+}
+
+// wait stops accepting findings and waits for the validations under way. It may be called more than once.
+func (s *validationStream) wait() {
+	if s == nil {
+		return
+	}
+
+	s.once.Do(func() { close(s.queue) })
+	<-s.done
+}
+
+// result returns the result of the key pair with the given fingerprint, when the stream validated it.
+func (s *validationStream) result(fingerprint string) (validationResult, bool) {
+	if s == nil {
+		return validationResult{}, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, ok := s.results[fingerprint]
+	return result, ok
+}
+
+// run validates every new key pair of the queued findings concurrently, within the concurrency of the
+// pool, until the queue is closed.
+func (s *validationStream) run(ctx context.Context) {
+	defer close(s.done)
+
+	p := s.pool
+	limiter := newConcurrencyLimiter(p.concurrency, p.adaptive, p.verbose)
+	var wg sync.WaitGroup
+	seen := make(map[string]bool)
+	var awsChecked bool
+	var awsUnavailable error
+	for f := range s.queue {
+		validator := p.validatorFor(f)
+		if validator == nil || ctx.Err() != nil {
+			continue
+		}
+		fingerprint := credentialFingerprint(p.validatedRule(f), f.AccessKeyID, f.SecretAccessKey)
+		if seen[fingerprint] {
+			continue
+		}
+		seen[fingerprint] = true
+		if _, ok := p.cache.get(fingerprint); ok {
+			continue
+		}
+
+		// AWS keys are left to the final validation when AWS cannot be called, which reports why
+		if validator == p.validator {
+			if !awsChecked {
+				awsUnavailable, awsChecked = p.unavailable(ctx, []keyValidator{validator}), true
+			}
+			if awsUnavailable != nil {
+				continue
+			}
+		}
+
+		wg.Add(1)
+		go func(f Finding) {
+			defer wg.Done()
+
+			status, message := p.validateWithRetries(ctx, limiter, validator, f.AccessKeyID, f.SecretAccessKey)
+			result := validationResult{status: status, message: logScrubber.scrub(message)}
+			validationCalls.WithLabelValues(status).Inc()
+			p.cache.put(fingerprint, result)
+
+			s.mu.Lock()
+			s.results[fingerprint] = result
+			s.mu.Unlock()
+		}(f)
+	}
+
+	wg.Wait()
+}
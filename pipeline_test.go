@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// hookValidator is a fakeValidator that reports every call on a channel, so a test knows when a
+// validation began.
+type hookValidator struct {
+	fakeValidator
+	started chan string
+}
+
+// Validate reports the call on started, then validates like fakeValidator.
+func (v *hookValidator) Validate(ctx context.Context, accessKeyID, secretAccessKey string) (bool, error) {
+	v.started <- accessKeyID
+	return v.fakeValidator.Validate(ctx, accessKeyID, secretAccessKey)
+}
+
+func TestValidationStreamOverlapsScanning(t *testing.T) {
+	validator := &hookValidator{fakeValidator: fakeValidator{valid: map[string]bool{testAccessKeyID: true}}, started: make(chan string, 4)}
+	pool := validationPool{validator: validator, concurrency: 2, timeout: time.Second}
+	stream := &validationStream{pool: pool, queue: make(chan Finding, validationQueueSize), done: make(chan struct{}), results: make(map[string]validationResult)}
+	go stream.run(context.Background())
+
+	first := newFinding("c1", "a.env", keyMatch{AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey})
+	stream.add(first)
+
+	// The first key is validated while the scan is still to produce the others
+	select {
+	case id := <-validator.started:
+		if id != testAccessKeyID {
+			t.Errorf("got %s validated first, want %s", id, testAccessKeyID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("got no validation before the scan completed")
+	}
+
+	stream.add(newFinding("c2", "b.env", keyMatch{AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey}))
+	stream.add(newFinding("c2", "c.env", keyMatch{AccessKeyID: testAccessKeyID2, SecretAccessKey: testSecretAccessKey2}))
+	stream.wait()
+	stream.wait()
+
+	got := validator.called()
+	sort.Strings(got)
+	if want := []string{testAccessKeyID2, testAccessKeyID}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got calls %v, want each key validated once", got)
+	}
+	result, ok := stream.result(credentialFingerprint("", testAccessKeyID, testSecretAccessKey))
+	if !ok || result.status != statusValid {
+		t.Errorf("got result %+v %v, want the first key valid", result, ok)
+	}
+}
+
+func TestValidationPoolReusesStreamedResults(t *testing.T) {
+	validator := &hookValidator{fakeValidator: fakeValidator{valid: map[string]bool{testAccessKeyID: true}}, started: make(chan string, 4)}
+	pool := validationPool{validator: validator, concurrency: 2, timeout: time.Second}
+	stream := &validationStream{pool: pool, queue: make(chan Finding, validationQueueSize), done: make(chan struct{}), results: make(map[string]validationResult)}
+	go stream.run(context.Background())
+	stream.add(newFinding("c1", "a.env", keyMatch{AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey}))
+	stream.wait()
+
+	// Only the key the stream has not seen is validated again
+	pool.streamed = stream
+	findings := []Finding{
+		newFinding("c1", "a.env", keyMatch{AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey}),
+		newFinding("c1", "b.env", keyMatch{AccessKeyID: testAccessKeyID2, SecretAccessKey: testSecretAccessKey2}),
+	}
+	pool.run(context.Background(), findings)
+
+	if got, want := validator.called(), []string{testAccessKeyID, testAccessKeyID2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got calls %v, want %v", got, want)
+	}
+	if findings[0].Status != statusValid || findings[1].Status != statusInvalid {
+		t.Errorf("got statuses %q and %q, want valid and invalid", findings[0].Status, findings[1].Status)
+	}
+}
+
+func TestScanValidatesEachKeyOnce(t *testing.T) {
+	withoutAWSCredentials(t)
+	sts := newSTSStub(t, testAccessKeyID)
+	var calls int32
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		sts.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer stub.Close()
+	repo := newFixtureRepo(t)
+	for _, file := range []string{"a.env", "b.env", "c.env"} {
+		repo.commit("add "+file, map[string]string{file: keyFile(testAccessKeyID, testSecretAccessKey)})
+	}
+
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, Diff: true, AWSEndpoint: stub.URL, ValidationMethod: validationMethodSTS})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Findings) != 3 {
+		t.Fatalf("got %d findings, want 3", len(result.Findings))
+	}
+	for _, f := range result.Findings {
+		if f.Status != statusValid {
+			t.Errorf("got %s %s, want valid", f.File, f.Status)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("got %d validation calls, want 1", n)
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// repoPlan is what a scan of one repository would cover, as estimated by -dry-run-plan.
+type repoPlan struct {
+	Repo string
+	// Mode describes what is searched in each commit, e.g. "full tree of every commit".
+	Mode string
+	// Filters lists the history filters that apply, e.g. "no merges".
+	Filters []string
+	// Commits is the number of commits the filters leave to scan, out of TotalCommits.
+	Commits      int
+	TotalCommits int
+	Truncated    bool
+	// Files is the number of files at HEAD that would be searched, after the subpath and exclude
+	// patterns, and Excluded the number left out by the exclude patterns.
+	Files    int
+	Excluded int
+	// Validators names the validators findings would be checked with.
+	Validators []string
+	Err        error
+}
+
+// PlanScan estimates what scanning the repository of every job would cover, without scanning it.
+// Only the commits and trees of each repository are cloned, without file contents, so the history
+// filters can be applied and the files at HEAD counted; a repository whose plan fails records the
+// error and the others are still planned.
+func PlanScan(ctx context.Context, jobs []ScanOptions) ([]repoPlan, error) {
+	var plans []repoPlan
+	for _, job := range jobs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		plan, err := planRepo(job)
+		if err != nil {
+			plan = repoPlan{Repo: job.RepoURL, Err: err}
+		}
+		plans = append(plans, plan)
+	}
+
+	return plans, nil
+}
+
+// planRepo returns the plan of the scan of opts.RepoURL.
+func planRepo(opts ScanOptions) (repoPlan, error) {
+	history, err := opts.historyOptions()
+	if err != nil {
+		return repoPlan{}, err
+	}
+	walk, err := opts.walkOptions()
+	if err != nil {
+		return repoPlan{}, err
+	}
+	validators, err := opts.validatorNames()
+	if err != nil {
+		return repoPlan{}, err
+	}
+
+	depth := 0
+	if opts.TipOnly {
+		depth = 1
+	}
+	repoPath, err := cloneMetadata(opts.RepoURL, opts.Branch, opts.Token, opts.TmpDir, depth)
+	if err != nil {
+		return repoPlan{}, fmt.Errorf("error cloning repository: %w", err)
+	}
+	defer os.RemoveAll(repoPath)
+
+	if opts.DiffRange != "" {
+		for _, rev := range []*string{&history.Since, &history.Until} {
+			if *rev, err = resolveCommit(repoPath, *rev); err != nil {
+				return repoPlan{}, fmt.Errorf("error resolving diff range: %w", err)
+			}
+		}
+	}
+
+	if opts.SinceLastScan {
+		if opts.DB == "" {
+			return repoPlan{}, fmt.Errorf("since-last-scan requires a scan database")
+		}
+		db, err := loadScanDB(opts.DB)
+		if err != nil {
+			return repoPlan{}, err
+		}
+		if record, ok := db.Repos[opts.RepoURL]; ok && isAncestor(repoPath, record.LastCommit) {
+			history.Since = record.LastCommit
+		}
+	}
+
+	plan := repoPlan{Repo: opts.RepoURL, Mode: opts.planMode(), Filters: opts.planFilters(history), Commits: 1, TotalCommits: 1, Validators: validators}
+	if !opts.TipOnly {
+		commitHashes, truncated, err := getCommitHashes(repoPath, history)
+		if err != nil {
+			return repoPlan{}, fmt.Errorf("error getting commit hashes: %w", err)
+		}
+		if plan.TotalCommits, err = countCommits(repoPath); err != nil {
+			return repoPlan{}, fmt.Errorf("error counting commits: %w", err)
+		}
+		plan.Commits, plan.Truncated = len(commitHashes), truncated
+	}
+
+	files, err := treeFiles(repoPath, "HEAD", opts.Subpath)
+	if err != nil {
+		return repoPlan{}, err
+	}
+	for _, file := range files {
+		if matchAnyGlob(walk.Exclude, file) {
+			plan.Excluded++
+		} else {
+			plan.Files++
+		}
+	}
+
+	return plan, nil
+}
+
+// cloneMetadata clones the commits and trees of the repository at url into a new bare repository
+// under tmpDir, without the contents of any file, and returns its path. Its HEAD is the branch when it
+// is not empty, and only the latest depth commits are cloned when depth is positive.
+func cloneMetadata(url, branch, token, tmpDir string, depth int) (string, error) {
+	tempDir, err := ioutil.TempDir(tmpDir, "repo-plan-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+
+	args := []string{"clone", "-q", "--bare", "--filter=blob:none"}
+	if depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(depth))
+	}
+	if branch != "" {
+		args = append(args, "--branch", branch)
+	}
+	cmd := exec.Command("git", append(args, "--", localCloneURL(url), tempDir)...)
+	cmd.Env = tokenEnv(token)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return "", &CloneError{URL: url, Output: string(output), Err: commandError(err)}
+	}
+
+	return tempDir, nil
+}
+
+// treeFiles returns the paths of the files in the tree of the commit, limited to subpath when set.
+func treeFiles(repoPath, commit, subpath string) ([]string, error) {
+	args := []string{"ls-tree", "-r", "-z", "--name-only", commit}
+	if subpath != "" {
+		args = append(args, "--", subpath)
+	}
+	cmd := exec.Command("git", args...)
+	cmd.Dir = repoPath
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the files of %s: %w", commit, commandError(err))
+	}
+
+	var files []string
+	for _, file := range strings.Split(string(output), "\x00") {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+
+	return files, nil
+}
+
+// planMode describes what the scan searches in each commit, and the extra sources it searches.
+func (opts ScanOptions) planMode() string {
+	mode := "full tree of every commit"
+	switch {
+	case opts.TipOnly:
+		mode = "tree of the latest commit"
+	case opts.DiffRange != "":
+		mode = "lines added by " + opts.DiffRange
+	case opts.Diff:
+		mode = "lines added by every commit"
+	}
+
+	for _, extra := range []struct {
+		enabled bool
+		name    string
+	}{
+		{opts.Reflog, "reflog"},
+		{opts.Remotes, "remotes"},
+		{opts.Notes, "notes"},
+		{opts.Dangling, "dangling objects"},
+	} {
+		if extra.enabled {
+			mode += ", " + extra.name
+		}
+	}
+
+	return mode
+}
+
+// planFilters describes the history filters of the scan.
+func (opts ScanOptions) planFilters(history historyOptions) []string {
+	var filters []string
+	if history.SkipMerges {
+		filters = append(filters, "no merges")
+	}
+	if history.SkipAuthor != nil {
+		filters = append(filters, fmt.Sprintf("authors not matching %q", history.SkipAuthor.String()))
+	}
+	if history.MaxCommits > 0 {
+		filters = append(filters, fmt.Sprintf("latest %d commits", history.MaxCommits))
+	}
+	if opts.SinceLastScan && opts.DiffRange == "" {
+		if history.Since != "" {
+			filters = append(filters, "since last scan at "+history.Since)
+		} else {
+			filters = append(filters, "since last scan (none recorded, full history)")
+		}
+	}
+	if history.Subpath != "" {
+		filters = append(filters, "touching "+history.Subpath)
+	}
+	if len(history.LogArgs) > 0 {
+		filters = append(filters, "git log "+strings.Join(history.LogArgs, " "))
+	}
+	if history.CredentialFiles {
+		filters = append(filters, "changing credential files")
+	}
+
+	return filters
+}
+
+// validatorNames names the validators findings of the scan would be checked with, in the order
+// they are listed by -dry-run-plan.
+func (opts ScanOptions) validatorNames() ([]string, error) {
+	if opts.NoValidate {
+		return nil, nil
+	}
+
+	rules, err := opts.ruleSet()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	switch opts.ValidationMethod {
+	case "", validationMethodSTS:
+		names = append(names, "AWS STS GetCallerIdentity")
+	case validationMethodIAM:
+		names = append(names, "AWS IAM (caller credentials)")
+	default:
+		return nil, fmt.Errorf("unknown validation method %q: must be sts or iam", opts.ValidationMethod)
+	}
+	if opts.ValidateGitHub {
+		names = append(names, "GitHub API")
+	}
+
+	var custom []string
+	for rule := range rules.validators() {
+		custom = append(custom, "rule "+rule+" (command)")
+	}
+	sort.Strings(custom)
+
+	return append(names, custom...), nil
+}
+
+// printPlan writes the plans of the repositories and their totals.
+func printPlan(w io.Writer, plans []repoPlan) {
+	commits, files, failed := 0, 0, 0
+	fmt.Fprintln(w, "Scan plan:")
+	for _, plan := range plans {
+		fmt.Fprintf(w, "\n  %s\n", plan.Repo)
+		if plan.Err != nil {
+			fmt.Fprintf(w, "    Error:      %s\n", strings.TrimSpace(plan.Err.Error()))
+			failed++
+			continue
+		}
+
+		filters := "none"
+		if len(plan.Filters) > 0 {
+			filters = strings.Join(plan.Filters, ", ")
+		}
+		validators := "none (-no-validate)"
+		if len(plan.Validators) > 0 {
+			validators = strings.Join(plan.Validators, ", ")
+		}
+		truncated := ""
+		if plan.Truncated {
+			truncated = " (history cut short by the commit limit)"
+		}
+
+		fmt.Fprintf(w, "    Mode:       %s\n", plan.Mode)
+		fmt.Fprintf(w, "    Filters:    %s\n", filters)
+		fmt.Fprintf(w, "    Commits:    %d of %d%s\n", plan.Commits, plan.TotalCommits, truncated)
+		fmt.Fprintf(w, "    Files:      %d at HEAD (%d excluded)\n", plan.Files, plan.Excluded)
+		fmt.Fprintf(w, "    Validators: %s\n", validators)
+		commits += plan.Commits
+		files += plan.Files
+	}
+
+	fmt.Fprintf(w, "\nRepositories: %d, commits: %d, files at HEAD: %d", len(plans)-failed, commits, files)
+	if failed > 0 {
+		fmt.Fprintf(w, ", failed to plan: %d", failed)
+	}
+	fmt.Fprintln(w)
+}
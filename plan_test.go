@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// planFixture commits 4 commits, one of them by a bot, holding 3 files of which one is vendored.
+func planFixture(t *testing.T) *fixtureRepo {
+	t.Helper()
+
+	repo := newFixtureRepo(t)
+	repo.commit("readme", map[string]string{"README.md": "hello\n"})
+	repo.commitAs("Deploy Bot <bot@example.com>", "vendor", map[string]string{"vendor/lib.go": "package lib\n"})
+	repo.commit("config", map[string]string{"config.env": "REGION=us-east-1\n"})
+	repo.commit("edit config", map[string]string{"config.env": "REGION=eu-west-1\n"})
+
+	return repo
+}
+
+func TestPlanScan(t *testing.T) {
+	app := planFixture(t)
+	tools := newFixtureRepo(t)
+	tools.commit("readme", map[string]string{"README.md": "tools\n"})
+	missing := filepath.Join(t.TempDir(), "missing")
+
+	plans, err := PlanScan(context.Background(), []ScanOptions{
+		{RepoURL: app.dir, SkipAuthor: "bot@", MaxCommits: 2, Exclude: []string{"vendor/**"}},
+		{RepoURL: tools.dir, NoValidate: true, TipOnly: true},
+		{RepoURL: missing},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plans) != 3 {
+		t.Fatalf("got %d plans, want 3", len(plans))
+	}
+
+	want := repoPlan{
+		Repo:         app.dir,
+		Mode:         "full tree of every commit",
+		Filters:      []string{`authors not matching "bot@"`, "latest 2 commits"},
+		Commits:      2,
+		TotalCommits: 4,
+		Truncated:    true,
+		Files:        2,
+		Excluded:     1,
+		Validators:   []string{"AWS STS GetCallerIdentity"},
+	}
+	if !reflect.DeepEqual(plans[0], want) {
+		t.Errorf("got plan %+v, want %+v", plans[0], want)
+	}
+	if p := plans[1]; p.Mode != "tree of the latest commit" || p.Commits != 1 || p.Files != 1 || p.Validators != nil {
+		t.Errorf("got plan %+v, want the latest commit without validation", p)
+	}
+	if p := plans[2]; p.Repo != missing || p.Err == nil {
+		t.Errorf("got plan %+v, want the missing repository to fail", p)
+	}
+
+	// Filtering by author alone leaves the 3 commits of people
+	plans, err = PlanScan(context.Background(), []ScanOptions{{RepoURL: app.dir, SkipAuthor: "bot@"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := plans[0]; p.Commits != 3 || p.Truncated {
+		t.Errorf("got %d commits, truncated %v, want 3 commits", p.Commits, p.Truncated)
+	}
+}
+
+func TestPrintPlan(t *testing.T) {
+	var out bytes.Buffer
+	printPlan(&out, []repoPlan{
+		{Repo: "https://github.com/acme/app", Mode: "lines added by every commit", Filters: []string{"no merges"}, Commits: 3, TotalCommits: 10, Truncated: true, Files: 7, Excluded: 2, Validators: []string{"AWS STS GetCallerIdentity", "GitHub API"}},
+		{Repo: "https://github.com/acme/gone", Err: errors.New("error cloning repository: not found\n")},
+	})
+
+	want := `Scan plan:
+
+  https://github.com/acme/app
+    Mode:       lines added by every commit
+    Filters:    no merges
+    Commits:    3 of 10 (history cut short by the commit limit)
+    Files:      7 at HEAD (2 excluded)
+    Validators: AWS STS GetCallerIdentity, GitHub API
+
+  https://github.com/acme/gone
+    Error:      error cloning repository: not found
+
+Repositories: 1, commits: 3, files at HEAD: 7, failed to plan: 1
+`
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestCLIDryRunPlan(t *testing.T) {
+	repo := planFixture(t)
+	repo.commit("add key", map[string]string{"creds.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+
+	got := runScanner(t, "-repo", repo.dir, "-dry-run-plan", "-skip-author", "bot@", "-exclude", "vendor/**", "-no-validate")
+	if got.code != 0 {
+		t.Errorf("got exit code %d, want 0; stderr:\n%s", got.code, got.stderr)
+	}
+	for _, want := range []string{"  " + repo.dir + "\n", `Filters:    authors not matching "bot@"`, "Commits:    4 of 5\n", "Files:      3 at HEAD (1 excluded)", "Validators: none (-no-validate)"} {
+		if !strings.Contains(got.stdout, want) {
+			t.Errorf("got stdout %q, want it to hold %q", got.stdout, want)
+		}
+	}
+	// Nothing is scanned, so the key is not reported
+	if strings.Contains(got.stdout, testAccessKeyID) {
+		t.Errorf("got stdout %q, want no findings", got.stdout)
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+)
+
+// binaryPlistMagic starts every binary property list.
+var binaryPlistMagic = []byte("bplist00")
+
+// maxPlistDepth bounds how deeply containers of a binary plist are followed, since objects can
+// reference each other in cycles.
+const maxPlistDepth = 64
+
+// maxPlistVisits bounds the number of objects walked in a binary plist.
+const maxPlistVisits = 1 << 20
+
+// plistValue is a string value of a property list, with the dictionary key it is stored under and
+// its 1-based line in the file, or 0 when the plist is binary.
+type plistValue struct {
+	key, value string
+	line       int
+}
+
+// isPlist reports whether the content is a binary property list, or the file is an XML one.
+func isPlist(path string, content []byte) bool {
+	if bytes.HasPrefix(content, binaryPlistMagic) {
+		return true
+	}
+
+	return strings.EqualFold(filepath.Ext(path), ".plist") && bytes.Contains(content[:minInt(len(content), 512)], []byte("<plist"))
+}
+
+// minInt returns the smaller of a and b.
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+// searchPlist runs every rule over the string and data values of a binary or XML property list,
+// rendered one per line as "key = value" under the dictionary key holding them, so labelled keys
+// pair like in a credentials file. Matches in XML plists keep the line of their value in the file;
+// those in binary plists have the line of the value in the rendering. It returns false when the
+// content cannot be decoded, so it can be searched as is.
+func (rs *ruleSet) searchPlist(content []byte) ([]keyMatch, bool) {
+	var values []plistValue
+	var ok bool
+	if bytes.HasPrefix(content, binaryPlistMagic) {
+		values, ok = decodeBinaryPlist(content)
+	} else {
+		values, ok = decodeXMLPlist(content)
+	}
+	if !ok {
+		return nil, false
+	}
+
+	var text strings.Builder
+	var lines []int
+	for _, v := range values {
+		// Every value is on a line of its own, where multiline values start
+		if v.key != "" {
+			text.WriteString(v.key + " = ")
+		}
+		text.WriteString(v.value + "\n")
+		for range strings.Split(v.value, "\n") {
+			lines = append(lines, v.line)
+		}
+	}
+
+	matches := rs.search([]byte(text.String()))
+	for i := range matches {
+		if line := matches[i].Line; line > 0 && line <= len(lines) && lines[line-1] > 0 {
+			matches[i].Line = lines[line-1]
+		}
+	}
+
+	return matches, true
+}
+
+// decodeXMLPlist returns the string and data values of an XML property list.
+func decodeXMLPlist(content []byte) ([]plistValue, bool) {
+	type container struct {
+		dict bool
+		key  string
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	decoder.Strict = false
+	stack := []container{{}}
+	var values []plistValue
+	line, counted := 1, 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, false
+		}
+
+		top := &stack[len(stack)-1]
+		switch t := token.(type) {
+		case xml.StartElement:
+			offset := int(decoder.InputOffset())
+			line += bytes.Count(content[counted:offset], []byte("\n"))
+			counted = offset
+			switch t.Name.Local {
+			case "plist":
+			case "dict", "array":
+				stack = append(stack, container{dict: t.Name.Local == "dict"})
+			case "key", "string", "data":
+				var text string
+				if err := decoder.DecodeElement(&text, &t); err != nil {
+					return nil, false
+				}
+				if t.Name.Local == "key" {
+					top.key = text
+					continue
+				}
+				if t.Name.Local == "data" {
+					decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+					if err != nil || looksBinary(decoded) {
+						top.key = ""
+						continue
+					}
+					text = string(decoded)
+				}
+				values = append(values, plistValue{key: top.key, value: text, line: line})
+				top.key = ""
+			default:
+				if err := decoder.Skip(); err != nil {
+					return nil, false
+				}
+				top.key = ""
+			}
+		case xml.EndElement:
+			if (t.Name.Local == "dict" || t.Name.Local == "array") && len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+				stack[len(stack)-1].key = ""
+			}
+		}
+	}
+
+	return values, true
+}
+
+// binaryPlist is a binary property list being decoded.
+type binaryPlist struct {
+	content []byte
+	offsets []uint64
+	refSize int
+	values  []plistValue
+	// visits counts the objects walked, bounded since objects can be shared by many containers.
+	visits int
+}
+
+// decodeBinaryPlist returns the string and data values of a binary property list, walking its
+// objects from the top one.
+func decodeBinaryPlist(content []byte) ([]plistValue, bool) {
+	if len(content) < len(binaryPlistMagic)+32 {
+		return nil, false
+	}
+
+	// The trailer holds the sizes of offsets and object references, the number of objects, the top
+	// object and where the offset table starts
+	trailer := content[len(content)-32:]
+	offsetSize, refSize := int(trailer[6]), int(trailer[7])
+	count, top, table := binary.BigEndian.Uint64(trailer[8:]), binary.BigEndian.Uint64(trailer[16:]), binary.BigEndian.Uint64(trailer[24:])
+	if offsetSize < 1 || offsetSize > 8 || refSize < 1 || refSize > 8 || top >= count ||
+		table > uint64(len(content)) || count > (uint64(len(content))-table)/uint64(offsetSize) {
+		return nil, false
+	}
+
+	p := &binaryPlist{content: content, refSize: refSize, offsets: make([]uint64, count)}
+	for i := range p.offsets {
+		start := table + uint64(i*offsetSize)
+		p.offsets[i] = readUint(content[start : start+uint64(offsetSize)])
+	}
+
+	if !p.walk(top, "", 0) {
+		return nil, false
+	}
+
+	return p.values, true
+}
+
+// walk collects the values of the object and the objects it contains, under the given dictionary key.
+func (p *binaryPlist) walk(ref uint64, key string, depth int) bool {
+	p.visits++
+	if ref >= uint64(len(p.offsets)) || depth > maxPlistDepth || p.visits > maxPlistVisits {
+		return false
+	}
+	offset := p.offsets[ref]
+	if offset >= uint64(len(p.content)) {
+		return false
+	}
+
+	marker := p.content[offset]
+	switch marker >> 4 {
+	case 0x4, 0x5, 0x6:
+		value, ok := p.text(offset, marker)
+		if !ok {
+			return false
+		}
+		if marker>>4 != 0x4 || !looksBinary([]byte(value)) {
+			p.values = append(p.values, plistValue{key: key, value: value})
+		}
+	case 0xA, 0xC:
+		length, start, ok := p.length(offset, marker)
+		if !ok {
+			return false
+		}
+		refs, ok := p.refs(start, length)
+		if !ok {
+			return false
+		}
+		for _, child := range refs {
+			if !p.walk(child, key, depth+1) {
+				return false
+			}
+		}
+	case 0xD:
+		length, start, ok := p.length(offset, marker)
+		if !ok {
+			return false
+		}
+		refs, ok := p.refs(start, 2*length)
+		if !ok {
+			return false
+		}
+		for i := uint64(0); i < length; i++ {
+			if !p.walk(refs[length+i], p.key(refs[i]), depth+1) {
+				return false
+			}
+		}
+	}
+
+	// Numbers, booleans, dates and UIDs hold no text
+	return true
+}
+
+// text returns the content of the data, ASCII string or UTF-16 string object at offset.
+func (p *binaryPlist) text(offset uint64, marker byte) (string, bool) {
+	length, start, ok := p.length(offset, marker)
+	if !ok {
+		return "", false
+	}
+
+	if marker>>4 != 0x6 {
+		if start+length > uint64(len(p.content)) {
+			return "", false
+		}
+		return string(p.content[start : start+length]), true
+	}
+
+	if start+2*length > uint64(len(p.content)) {
+		return "", false
+	}
+	units := make([]uint16, length)
+	for i := range units {
+		units[i] = binary.BigEndian.Uint16(p.content[start+uint64(2*i):])
+	}
+
+	return string(utf16.Decode(units)), true
+}
+
+// key returns the string object ref used as a dictionary key, or "" when it is not a string.
+func (p *binaryPlist) key(ref uint64) string {
+	if ref >= uint64(len(p.offsets)) || p.offsets[ref] >= uint64(len(p.content)) {
+		return ""
+	}
+
+	offset := p.offsets[ref]
+	marker := p.content[offset]
+	if marker>>4 != 0x5 && marker>>4 != 0x6 {
+		return ""
+	}
+	key, _ := p.text(offset, marker)
+
+	return key
+}
+
+// length returns the length and the offset of the content of the object at offset with the given
+// marker, whose length follows as an integer object when its low nibble is 0xF.
+func (p *binaryPlist) length(offset uint64, marker byte) (uint64, uint64, bool) {
+	length, start := uint64(marker&0xF), offset+1
+	if length == 0xF {
+		if start >= uint64(len(p.content)) || p.content[start]>>4 != 0x1 {
+			return 0, 0, false
+		}
+		size := uint64(1) << (p.content[start] & 0xF)
+		if size > 8 || start+1+size > uint64(len(p.content)) {
+			return 0, 0, false
+		}
+		length = readUint(p.content[start+1 : start+1+size])
+		start += 1 + size
+	}
+	if length > uint64(len(p.content)) {
+		return 0, 0, false
+	}
+
+	return length, start, true
+}
+
+// refs reads n object references starting at offset.
+func (p *binaryPlist) refs(offset, n uint64) ([]uint64, bool) {
+	size := uint64(p.refSize)
+	if n > uint64(len(p.content)) || offset+n*size > uint64(len(p.content)) {
+		return nil, false
+	}
+
+	refs := make([]uint64, n)
+	for i := range refs {
+		start := offset + uint64(i)*size
+		refs[i] = readUint(p.content[start : start+size])
+	}
+
+	return refs, true
+}
+
+// readUint reads a big-endian unsigned integer of up to 8 bytes.
+func readUint(b []byte) uint64 {
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+
+	return n
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// binaryPlistFixture is a binary plist, written by Python's plistlib, of an Accounts array holding a
+// dictionary with an aws_access_key_id, an aws_secret_access_key and a Name, and a Version integer.
+const binaryPlistFixture = "62706c6973743030d20102030b584163636f756e74735756657273696f6ea104d305060708090a544e616d655f101161" +
+	"77735f6163636573735f6b65795f69645f10156177735f7365637265745f6163636573735f6b6579566465706c6f795f" +
+	"1014414b4941494f53464f444e4e374558414d504c455f1028774a616c725855746e46454d492f4b374d44454e472f62" +
+	"507852666943594558414d504c454b45591003080d161e20272c40585f76a10000000000000101000000000000000c00" +
+	"0000000000000000000000000000a3"
+
+// binaryPlistRepo commits the binary plist fixture to a new repository.
+func binaryPlistRepo(t *testing.T) *fixtureRepo {
+	t.Helper()
+
+	content, err := hex.DecodeString(binaryPlistFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := newFixtureRepo(t)
+	repo.commit("add preferences", map[string]string{"Library/Preferences/com.example.deploy.plist": string(content)})
+
+	return repo
+}
+
+func TestDecodeBinaryPlist(t *testing.T) {
+	content, _ := hex.DecodeString(binaryPlistFixture)
+
+	values, ok := decodeBinaryPlist(content)
+	if !ok {
+		t.Fatal("got the fixture undecodable")
+	}
+	got := make(map[string]string)
+	for _, v := range values {
+		got[v.key] = v.value
+	}
+	want := map[string]string{"aws_access_key_id": testAccessKeyID, "aws_secret_access_key": testSecretAccessKey, "Name": "deploy"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got values %v, want %v", got, want)
+	}
+
+	// A truncated plist is searched as is rather than decoded
+	if _, ok := decodeBinaryPlist(content[:len(content)-10]); ok {
+		t.Error("got a truncated plist decoded")
+	}
+}
+
+func TestScanBinaryPlist(t *testing.T) {
+	repo := binaryPlistRepo(t)
+
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Findings) != 0 || result.Stats.SkippedBinary != 1 {
+		t.Errorf("by default: got findings %+v and %d binary files skipped, want the plist skipped as binary", result.Findings, result.Stats.SkippedBinary)
+	}
+
+	result, err = Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true, DecodePlists: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Findings) != 1 {
+		t.Fatalf("with plists decoded: got %d findings, want 1", len(result.Findings))
+	}
+	if f := result.Findings[0]; f.AccessKeyID != testAccessKeyID || f.SecretAccessKey != testSecretAccessKey || f.File != "Library/Preferences/com.example.deploy.plist" {
+		t.Errorf("got finding %+v, want the key pair of the plist", f)
+	}
+	if result.Stats.SkippedBinary != 0 {
+		t.Errorf("with plists decoded: got %d binary files skipped, want 0", result.Stats.SkippedBinary)
+	}
+}
+
+func TestScanFileXMLPlist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.plist")
+	ioutil.WriteFile(path, []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0">
+<dict>
+	<key>aws_access_key_id</key>
+	<string>`+testAccessKeyID+`</string>
+	<key>aws_secret_access_key</key>
+	<string>`+testSecretAccessKey+`</string>
+</dict>
+</plist>
+`), 0o600)
+
+	result, err := ScanFile(context.Background(), path, ScanOptions{NoValidate: true, DecodePlists: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Findings) != 1 || result.Findings[0].Line != 5 || result.Findings[0].SecretAccessKey != testSecretAccessKey {
+		t.Errorf("got findings %+v, want the pair at line 5", result.Findings)
+	}
+}
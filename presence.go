@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Values of Finding.AtHead, recorded with CheckHead.
+const (
+	headPresent = "present"
+	headRemoved = "removed"
+)
+
+// annotateHeadPresence records whether the key of every finding is still in the tree of the head
+// commit, searching it for the access key IDs and secrets of the findings with git grep. A key counts
+// as present when its ID or its secret is found anywhere in the tree, in any file.
+func annotateHeadPresence(repoPath, head string, findings []Finding) error {
+	var patterns []string
+	seen := make(map[string]bool)
+	for _, f := range findings {
+		for _, key := range []string{f.AccessKeyID, f.SecretAccessKey} {
+			if key != "" && !seen[key] {
+				seen[key] = true
+				patterns = append(patterns, key)
+			}
+		}
+	}
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	// git grep exits with 1 when nothing matches
+	cmd := exec.Command("git", "grep", "--no-color", "-a", "-F", "-o", "-h", "-f", "-", head)
+	cmd.Dir = repoPath
+	cmd.Stdin = strings.NewReader(strings.Join(patterns, "\n") + "\n")
+	output, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+		return fmt.Errorf("failed to search the tree of %s: %w", head, commandError(err))
+	}
+
+	present := make(map[string]bool)
+	for _, line := range strings.Split(string(output), "\n") {
+		if line != "" {
+			present[line] = true
+		}
+	}
+
+	for i := range findings {
+		f := &findings[i]
+		if f.Commit == head || present[f.AccessKeyID] || present[f.SecretAccessKey] {
+			f.AtHead = headPresent
+		} else {
+			f.AtHead = headRemoved
+		}
+	}
+
+	return nil
+}
+
+// headNote describes whether the finding's key is still at HEAD for console output, when it was checked.
+func headNote(f Finding) string {
+	if f.AtHead != headRemoved {
+		return ""
+	}
+
+	return " [not present at HEAD]"
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// removedKeyFixture commits a key that is later deleted, a key that stays, and a key that is moved
+// to another file.
+func removedKeyFixture(t *testing.T) *fixtureRepo {
+	t.Helper()
+
+	repo := newFixtureRepo(t)
+	repo.commit("add keys", map[string]string{
+		"old.env":  keyFile(testAccessKeyID, testSecretAccessKey),
+		"live.env": keyFile(testAccessKeyID2, testSecretAccessKey2),
+	})
+	repo.git("rm", "-q", "old.env")
+	repo.commit("remove key", nil)
+
+	return repo
+}
+
+func TestScanCheckHead(t *testing.T) {
+	repo := removedKeyFixture(t)
+	repo.commit("add moved key", map[string]string{"moved.ini": "[ci]\nkey = AKIAJ7UQ3GWCEXAMPLE0\n"})
+	repo.git("mv", "moved.ini", "ci.ini")
+	repo.commit("move key", nil)
+
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true, Diff: true, CheckHead: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	atHead := make(map[string]string)
+	severities := make(map[string]string)
+	for _, f := range result.Findings {
+		atHead[f.File] = f.AtHead
+		severities[f.File] = f.Severity
+	}
+	want := map[string]string{"old.env": headRemoved, "live.env": headPresent, "moved.ini": headPresent, "ci.ini": headPresent}
+	for file, status := range want {
+		if atHead[file] != status {
+			t.Errorf("%s: got at HEAD %q, want %q", file, atHead[file], status)
+		}
+	}
+	if severities["old.env"] != lowerSeverity(severities["live.env"]) || severities["old.env"] == severities["live.env"] {
+		t.Errorf("got severities %v, want the removed key one level below the present one", severities)
+	}
+}
+
+func TestScanWithoutCheckHead(t *testing.T) {
+	repo := removedKeyFixture(t)
+
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true, Diff: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range result.Findings {
+		if f.AtHead != "" {
+			t.Errorf("got finding in %s at HEAD %q, want it unchecked", f.File, f.AtHead)
+		}
+	}
+}
+
+func TestLowerSeverity(t *testing.T) {
+	tests := map[string]string{
+		severityCritical: severityHigh,
+		severityHigh:     severityMedium,
+		severityMedium:   severityLow,
+		severityLow:      severityLow,
+		severityInfo:     severityInfo,
+	}
+	for severity, want := range tests {
+		if got := lowerSeverity(severity); got != want {
+			t.Errorf("lowerSeverity(%q): got %q, want %q", severity, got, want)
+		}
+	}
+}
+
+func TestCLICheckHead(t *testing.T) {
+	repo := removedKeyFixture(t)
+
+	got := runScanner(t, "-repo", repo.dir, "-no-validate", "-diff", "-check-head")
+	for _, line := range strings.Split(got.stdout, "\n") {
+		switch {
+		case strings.Contains(line, "old.env:1"):
+			if !strings.HasSuffix(line, "[not present at HEAD]") {
+				t.Errorf("got line %q, want the removed key marked", line)
+			}
+		case strings.Contains(line, "live.env:1"):
+			if strings.Contains(line, "not present at HEAD") {
+				t.Errorf("got line %q, want the present key unmarked", line)
+			}
+		}
+	}
+	if !strings.Contains(got.stdout, "old.env:1") || !strings.Contains(got.stdout, "live.env:1") {
+		t.Errorf("got stdout %q, want both keys reported", got.stdout)
+	}
+}
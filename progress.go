@@ -0,0 +1,93 @@
+package main
+
+// ProgressEvent reports how far a scan has got to the OnProgress callback of ScanOptions.
+type ProgressEvent struct {
+	// Stage is "cloning", "cloned", "commits", "validating" or "done".
+	Stage string
+	// Phase is the step git reports in the "cloning" stage, such as "Receiving objects".
+	Phase string
+	// Repo is the repository or path being scanned.
+	Repo string
+	// Done and Total count the objects of the phase in the "cloning" stage, the commits scanned so
+	// far and to scan in the "commits" stage, and the findings to validate in the "validating" stage.
+	Done, Total int
+}
+
+// Stages of a scan reported in progress events.
+const (
+	progressCloning    = "cloning"
+	progressCloned     = "cloned"
+	progressCommits    = "commits"
+	progressValidating = "validating"
+	progressDone       = "done"
+)
+
+// notifierQueueSize is the number of callbacks that can be pending before progress events are dropped.
+const notifierQueueSize = 256
+
+// notifier delivers the callbacks of ScanOptions from a goroutine of its own, one at a time, so
+// callbacks need not be safe for concurrent use and a slow callback never blocks a scan holding a
+// lock. Progress events are dropped rather than queued when the callbacks fall behind, since the
+// next one supersedes them; findings are always delivered. A nil notifier does nothing.
+type notifier struct {
+	onProgress func(ProgressEvent)
+	onFinding  func(Finding)
+	queue      chan func()
+	done       chan struct{}
+}
+
+// newNotifier starts delivering the callbacks of opts, or returns nil when it has none.
+func newNotifier(opts ScanOptions) *notifier {
+	if opts.OnProgress == nil && opts.OnFinding == nil {
+		return nil
+	}
+
+	n := &notifier{
+		onProgress: opts.OnProgress,
+		onFinding:  opts.OnFinding,
+		queue:      make(chan func(), notifierQueueSize),
+		done:       make(chan struct{}),
+	}
+	go func() {
+		defer close(n.done)
+		for call := range n.queue {
+			call()
+		}
+	}()
+
+	return n
+}
+
+// progress queues a progress event, dropping it when the queue is full.
+func (n *notifier) progress(event ProgressEvent) {
+	if n == nil || n.onProgress == nil {
+		return
+	}
+
+	select {
+	case n.queue <- func() { n.onProgress(event) }:
+	default:
+	}
+}
+
+// findings queues every finding.
+func (n *notifier) findings(findings []Finding) {
+	if n == nil || n.onFinding == nil {
+		return
+	}
+
+	for _, f := range findings {
+		f := f
+		n.queue <- func() { n.onFinding(f) }
+	}
+}
+
+// close waits for every queued callback to return. The notifier must not be used afterwards.
+func (n *notifier) close() {
+	if n == nil {
+		return
+	}
+
+	close(n.queue)
+	<-n.done
+}
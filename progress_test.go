@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestScanCallbacks(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("add live key", map[string]string{"live.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+	repo.commit("readme", map[string]string{"README.md": "hello\n"})
+	repo.commit("add dead key", map[string]string{"dead.env": keyFile(testAccessKeyID2, testSecretAccessKey2)})
+	stub := newSTSStub(t, testAccessKeyID)
+
+	// The callbacks are called one at a time and have returned once Scan does, so they need no lock
+	var events []ProgressEvent
+	var found []Finding
+	result, err := Scan(context.Background(), ScanOptions{
+		RepoURL:     repo.dir,
+		AWSEndpoint: stub.URL,
+		Diff:        true,
+		OnProgress:  func(e ProgressEvent) { events = append(events, e) },
+		OnFinding:   func(f Finding) { found = append(found, f) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stages []string
+	lastDone := 0
+	for _, e := range events {
+		if len(stages) == 0 || stages[len(stages)-1] != e.Stage {
+			stages = append(stages, e.Stage)
+		}
+		if e.Repo != repo.dir {
+			t.Errorf("got %s event for repository %q, want %q", e.Stage, e.Repo, repo.dir)
+		}
+		if e.Stage == progressCommits {
+			if e.Total != 3 || e.Done < lastDone || e.Done > e.Total {
+				t.Errorf("got commit progress %d of %d after %d, want up to 3 of 3", e.Done, e.Total, lastDone)
+			}
+			lastDone = e.Done
+		}
+	}
+	want := []string{progressCloned, progressCommits, progressValidating, progressDone}
+	if len(stages) > 0 && stages[0] == progressCloning {
+		stages = stages[1:]
+	}
+	if fmt.Sprint(stages) != fmt.Sprint(want) {
+		t.Errorf("got stages %v, want %v", stages, want)
+	}
+	if lastDone != 3 {
+		t.Errorf("got %d commits done in the last progress event, want 3", lastDone)
+	}
+
+	if len(found) != len(result.Findings) || len(found) != 2 {
+		t.Fatalf("got %d findings from OnFinding and %d in the result, want 2", len(found), len(result.Findings))
+	}
+	statuses := make([]string, len(found))
+	for i, f := range found {
+		statuses[i] = f.AccessKeyID + " " + f.Status
+	}
+	sort.Strings(statuses)
+	if want := []string{testAccessKeyID2 + " " + statusInvalid, testAccessKeyID + " " + statusValid}; fmt.Sprint(statuses) != fmt.Sprint(want) {
+		t.Errorf("got validated findings %v, want %v", statuses, want)
+	}
+}
+
+func TestScanSlowCallbacks(t *testing.T) {
+	repo := newFixtureRepo(t)
+	const commits = 10
+	for i := 0; i < commits; i++ {
+		id, secret := fmt.Sprintf("AKIATEST%012d", i), fmt.Sprintf("wJalrXUtnFEMI/K7MDENG/bPxRfiCY%010d", i)
+		repo.commit("add key", map[string]string{fmt.Sprintf("keys/%02d.env", i): keyFile(id, secret)})
+	}
+
+	// Slow callbacks delay the scan but never block it, and every finding is still delivered
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	found := 0
+	result, err := Scan(ctx, ScanOptions{
+		RepoURL:    repo.dir,
+		NoValidate: true,
+		Diff:       true,
+		OnProgress: func(ProgressEvent) { time.Sleep(5 * time.Millisecond) },
+		OnFinding:  func(Finding) { time.Sleep(5 * time.Millisecond); found++ },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != commits || len(result.Findings) != commits {
+		t.Errorf("got %d findings from OnFinding and %d in the result, want %d", found, len(result.Findings), commits)
+	}
+}
+
+func TestNotifierDropsProgressWhenBehind(t *testing.T) {
+	release := make(chan struct{})
+	delivered := 0
+	n := newNotifier(ScanOptions{OnProgress: func(ProgressEvent) { <-release; delivered++ }})
+	for i := 0; i < 2*notifierQueueSize; i++ {
+		n.progress(ProgressEvent{Stage: progressCommits, Done: i})
+	}
+	close(release)
+	n.close()
+
+	if delivered == 0 || delivered > notifierQueueSize+1 {
+		t.Errorf("delivered %d progress events, want at most the %d queued and the one being delivered", delivered, notifierQueueSize)
+	}
+
+	// Without callbacks there is no notifier, and a nil notifier does nothing
+	if n := newNotifier(ScanOptions{}); n != nil {
+		t.Error("got a notifier without callbacks")
+	}
+	var none *notifier
+	none.progress(ProgressEvent{})
+	none.findings([]Finding{{}})
+	none.close()
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Sources of findings discovered outside the regular commit history.
+const (
+	sourceReflog = "reflog"
+	sourceNotes  = "notes"
+)
+
+// getReflogCommits returns the commits recorded in the reflogs of the repository at reflogPath that
+// exist in the clone at repoPath but are not part of the already scanned history.
+func getReflogCommits(reflogPath, repoPath string, scanned []string) ([]string, error) {
+	// Walk the reflogs of HEAD, branches and tags; the notes ref has a reflog too but its commits are not source trees
+	cmd := exec.Command("git", "log", "--walk-reflogs", "--format=%H", "HEAD", "--branches", "--tags")
+	cmd.Dir = reflogPath
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reflog: %w. Output: %s", commandError(err), string(output))
+	}
+
+	seen := make(map[string]bool)
+	for _, hash := range scanned {
+		seen[hash] = true
+	}
+
+	var commits []string
+	for _, hash := range strings.Fields(string(output)) {
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+
+		// Commits that were never copied into the clone cannot be checked out
+		check := exec.Command("git", "cat-file", "-e", hash+"^{commit}")
+		check.Dir = repoPath
+		if check.Run() != nil {
+			continue
+		}
+
+		commits = append(commits, hash)
+	}
+
+	return commits, nil
+}
+
+// reflogSource returns where reflogs should be read from: the original repository when scanning a
+// local path, whose reflogs a clone does not copy, or the clone itself otherwise.
+func reflogSource(repoURL, repoPath string) string {
+	if info, err := os.Stat(repoURL); err == nil && info.IsDir() {
+		return repoURL
+	}
+
+	return repoPath
+}
+
+// searchNotes fetches the git notes of the origin into the clone and searches their content for AWS IAM keys.
+func searchNotes(repoPath string, opts walkOptions, stats *ScanStats) ([]Finding, error) {
+	// Notes are not fetched by a regular clone; a remote without notes is not an error
+	fetch := exec.Command("git", "fetch", "origin", "refs/notes/*:refs/notes/*")
+	fetch.Dir = repoPath
+	fetch.CombinedOutput()
+
+	cmd := exec.Command("git", "notes", "list")
+	cmd.Dir = repoPath
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notes: %w. Output: %s", commandError(err), string(output))
+	}
+
+	// Each line is "<note blob> <annotated commit>"
+	var notes [][]string
+	for _, line := range strings.Split(string(output), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 {
+			notes = append(notes, fields)
+		}
+	}
+	if len(notes) == 0 {
+		return nil, nil
+	}
+
+	reader, err := newCatFile(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var findings []Finding
+	for _, note := range notes {
+		blob, err := reader.read(note[0], opts.MaxFileSize)
+		if err != nil {
+			return nil, err
+		}
+
+		stats.FilesSeen++
+		if opts.MaxFileSize > 0 && blob.Size > opts.MaxFileSize {
+			stats.SkippedOversize++
+			continue
+		}
+		stats.FilesScanned++
+		for _, match := range searchIAMKeys(blob.Content, opts.Rules) {
+			finding := newFinding(note[1], "", match)
+			finding.Source = sourceNotes
+			findings = append(findings, finding)
+		}
+	}
+
+	return findings, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+// findingsBySource returns the findings of the result keyed by their source.
+func findingsBySource(result *ScanResult) map[string][]Finding {
+	bySource := make(map[string][]Finding)
+	for _, f := range result.Findings {
+		bySource[f.Source] = append(bySource[f.Source], f)
+	}
+
+	return bySource
+}
+
+func TestScanReflog(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("first", map[string]string{"README.md": "hello\n"})
+	amended := repo.commit("add config", map[string]string{"config.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+	repo.write(map[string]string{"config.env": "AWS_ACCESS_KEY_ID=\n"})
+	repo.git("commit", "-q", "-a", "--amend", "-m", "add config")
+
+	for _, reflog := range []bool{false, true} {
+		result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true, Reflog: reflog})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		found := findingsBySource(result)[sourceReflog]
+		if !reflog {
+			if len(result.Findings) != 0 {
+				t.Errorf("without reflog: got %+v, want no findings", result.Findings)
+			}
+			continue
+		}
+		if len(found) != 1 || found[0].Commit != amended || found[0].AccessKeyID != testAccessKeyID {
+			t.Errorf("with reflog: got %+v, want the key of amended commit %s", result.Findings, amended)
+		}
+	}
+}
+
+func TestScanNotes(t *testing.T) {
+	repo := newFixtureRepo(t)
+	commit := repo.commit("first", map[string]string{"README.md": "hello\n"})
+	repo.git("notes", "add", "-m", "deployed with\n"+keyFile(testAccessKeyID, testSecretAccessKey), commit)
+
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true, Notes: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := findingsBySource(result)[sourceNotes]
+	if len(found) != 1 || found[0].Commit != commit || found[0].AccessKeyID != testAccessKeyID {
+		t.Errorf("got %+v, want the key in the note on %s", result.Findings, commit)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import "fmt"
+
+// purgeAdvice is how every remediation ends: a secret stays in the history, and in every clone and
+// fork of it, until the history is rewritten.
+const purgeAdvice = "then purge it from the history with git filter-repo, force push and ask collaborators to re-clone"
+
+// vendorSecrets names the secret of the built-in token rules and where it is revoked.
+var vendorSecrets = map[string]struct{ name, revoke string }{
+	ruleGitHubToken: {"GitHub token", "under Settings > Developer settings of its owner, or through the credential revocation API"},
+	ruleGitLabToken: {"GitLab personal access token", "under Preferences > Access Tokens of its owner"},
+	ruleNPMToken:    {"npm token", "with npm token revoke or under Access Tokens on npmjs.com"},
+}
+
+// assignRemediations sets the remediation advice of every validated finding. The remediation of a
+// rule, when set, replaces the built-in advice for its findings that are not invalid, like its severity.
+// The advice for publicly exposed keys starts by saying so.
+func assignRemediations(findings []Finding, rules *ruleSet) {
+	overrides := rules.remediations()
+	for i := range findings {
+		f := &findings[i]
+		if f.Status != statusInvalid && overrides[f.Rule] != "" {
+			f.Remediation = overrides[f.Rule]
+		} else {
+			f.Remediation = defaultRemediation(*f)
+		}
+		if f.Exposure == exposurePublic {
+			f.Remediation = "The repository is public, so anyone may already have this key and it must be treated as used by an attacker: act now. " + f.Remediation
+		}
+	}
+}
+
+// defaultRemediation returns the built-in advice for a validated finding, from its rule, key type and
+// status. Findings without an AWS access key ID are tokens or the secrets of custom rules.
+func defaultRemediation(f Finding) string {
+	if f.KeyType == unknownKeyType {
+		return secretRemediation(f)
+	}
+
+	advice := awsKeyRemediation(f)
+	if f.Rule == ruleTerraformState {
+		advice += " Keep Terraform state in a remote backend instead of the repository, since it holds every secret of its resources."
+	}
+
+	return advice
+}
+
+// awsKeyRemediation returns the advice for an AWS access key ID and its secret.
+func awsKeyRemediation(f Finding) string {
+	switch {
+	case f.KeyType.validationStrategy() == skipTemporary:
+		return fmt.Sprintf("%s is a %s, which expires with its session; if its session token leaked too, revoke the active sessions of the role that issued it in IAM, %s.", f.AccessKeyID, f.KeyType, purgeAdvice)
+	case f.KeyType.validationStrategy() == skipNotCredential:
+		return fmt.Sprintf("%s (%s) is not a credential, so it cannot be used to call AWS; remove it if it was not meant to be public, as it identifies a resource of its account.", f.AccessKeyID, f.KeyType)
+	case f.Status == statusValid:
+		return fmt.Sprintf("%s is a live %s: rotate it immediately via IAM by creating a new access key for its user, moving everything using it to the new key and deactivating and deleting %s, review CloudTrail for its use, %s.", f.AccessKeyID, f.KeyType, f.AccessKeyID, purgeAdvice)
+	case f.Status == statusInvalid:
+		return fmt.Sprintf("%s is not live, so it needs no rotation; remove it from the code so it is not mistaken for a live key, and purge it from the history if it once was.", f.AccessKeyID)
+	default:
+		return fmt.Sprintf("Whether %s is live is unknown: look it up in IAM, and if it is active, rotate it by creating a new access key for its user and deactivating and deleting %s, %s.", f.AccessKeyID, f.AccessKeyID, purgeAdvice)
+	}
+}
+
+// secretRemediation returns the advice for a token or the secret of a custom rule.
+func secretRemediation(f Finding) string {
+	name, revoke := "secret", "where it was issued"
+	if vendor, ok := vendorSecrets[f.Rule]; ok {
+		name, revoke = vendor.name, vendor.revoke
+	}
+
+	switch f.Status {
+	case statusValid:
+		return fmt.Sprintf("This %s is live: revoke it immediately %s, replace it where it is used, %s.", name, revoke, purgeAdvice)
+	case statusInvalid:
+		return fmt.Sprintf("This %s is not live, so it needs no revocation; remove it from the code so it is not mistaken for a live one.", name)
+	default:
+		return fmt.Sprintf("This %s was not validated: unless it is known to be inactive, revoke it %s, replace it where it is used, %s.", name, revoke, purgeAdvice)
+	}
+}
+
+// printRemediation prints the remediation advice of the finding under it.
+func printRemediation(f Finding) {
+	if f.Remediation != "" {
+		fmt.Printf("  Remediation: %s\n", f.Remediation)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// sourceRemote tags findings in commits only reachable from the remote-tracking refs of the scanned repository.
+const sourceRemote = "remote"
+
+// remoteRefsPrefix is where the remote-tracking refs of the scanned repository are fetched into the clone.
+const remoteRefsPrefix = "refs/scanned-remotes/"
+
+// getRemoteCommits fetches the remote-tracking refs of every remote configured in the scanned
+// repository, such as a local mirror with several remotes, into the clone. It returns the commits
+// only reachable from those refs that are not part of the already scanned history, and the
+// remote ref, e.g. "upstream/main", each was first found on.
+func getRemoteCommits(repoPath string, scanned []string) ([]string, map[string]string, error) {
+	// A regular clone only copies the branches of the origin, not the refs it tracks of its own remotes
+	fetch := exec.Command("git", "fetch", "--quiet", "origin", "+refs/remotes/*:"+remoteRefsPrefix+"*")
+	fetch.Dir = repoPath
+	if output, err := fetch.CombinedOutput(); err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch remote refs: %w. Output: %s", commandError(err), string(output))
+	}
+
+	list := exec.Command("git", "for-each-ref", "--format=%(refname)", remoteRefsPrefix)
+	list.Dir = repoPath
+	output, err := list.CombinedOutput()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list remote refs: %w. Output: %s", commandError(err), string(output))
+	}
+
+	seen := make(map[string]bool)
+	for _, hash := range scanned {
+		seen[hash] = true
+	}
+
+	var commits []string
+	refOf := make(map[string]string)
+	for _, ref := range strings.Fields(string(output)) {
+		// The HEAD of a remote only points at one of its branches
+		if strings.HasSuffix(ref, "/HEAD") {
+			continue
+		}
+
+		revList := exec.Command("git", "rev-list", ref, "--not", "HEAD")
+		revList.Dir = repoPath
+		revOutput, err := revList.CombinedOutput()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list commits of %s: %w. Output: %s", ref, commandError(err), string(revOutput))
+		}
+
+		for _, hash := range strings.Fields(string(revOutput)) {
+			if seen[hash] {
+				continue
+			}
+			seen[hash] = true
+			commits = append(commits, hash)
+			refOf[hash] = strings.TrimPrefix(ref, remoteRefsPrefix)
+		}
+	}
+
+	return commits, refOf, nil
+}
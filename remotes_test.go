@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestScanRemotes(t *testing.T) {
+	// The mirror tracks its origin and a fork, which has a branch holding a key
+	origin := newFixtureRepo(t)
+	origin.commit("readme", map[string]string{"README.md": "hello\n"})
+	fork := newFixtureRepo(t)
+	fork.git("pull", "-q", origin.dir, "main")
+	fork.git("checkout", "-q", "-b", "feature")
+	leak := fork.commit("add key", map[string]string{"config.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+
+	mirror := newFixtureRepo(t)
+	mirror.git("remote", "add", "origin", origin.dir)
+	mirror.git("remote", "add", "fork", fork.dir)
+	mirror.git("fetch", "-q", "--all")
+	mirror.git("checkout", "-q", "-B", "main", "origin/main")
+
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: mirror.dir, NoValidate: true, Diff: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Findings) != 0 {
+		t.Errorf("got findings %+v without scanning remotes, want none", result.Findings)
+	}
+
+	result, err = Scan(context.Background(), ScanOptions{RepoURL: mirror.dir, NoValidate: true, Diff: true, Remotes: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Findings) != 1 {
+		t.Fatalf("got %d findings scanning remotes, want 1", len(result.Findings))
+	}
+	if f := result.Findings[0]; f.Commit != leak || f.Source != sourceRemote || f.Ref != "fork/feature" {
+		t.Errorf("got finding in %s from %s ref %s, want %s from %s ref fork/feature", f.Commit, f.Source, f.Ref, leak, sourceRemote)
+	}
+}
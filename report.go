@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Report formats written to standard output with -format or to a file with the -output-* flags.
+const (
+	formatText    = "text"
+	formatJSON    = "json"
+	formatSARIF   = "sarif"
+	formatCompact = "compact"
+	// formatGitHubActions writes workflow commands that GitHub Actions renders as annotations.
+	formatGitHubActions = "github-actions"
+)
+
+// reportWriters maps the formats other than text to their writers.
+var reportWriters = map[string]func(io.Writer, *ScanResult) error{
+	formatJSON:          writeJSONReport,
+	formatSARIF:         writeSARIFReport,
+	formatCompact:       writeCompactReport,
+	formatGitHubActions: writeGitHubActionsReport,
+}
+
+// writeJSONReport writes the scan result as indented JSON. Secrets are never included.
+func writeJSONReport(w io.Writer, result *ScanResult) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		return fmt.Errorf("failed to write JSON report: %v", err)
+	}
+
+	return nil
+}
+
+// writeReportFile writes the scan result in the given format to the file at path.
+func writeReportFile(path, format string, result *ScanResult) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s report: %v", format, err)
+	}
+
+	if err := reportWriters[format](f, result); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write %s report: %v", format, err)
+	}
+
+	return nil
+}
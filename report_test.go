@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReportsFanOutFromOneScan(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("add key", map[string]string{"config.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	sarifPath, jsonPath := filepath.Join(dir, "report.sarif"), filepath.Join(dir, "report.json")
+	text := captureStdout(t, func() { printResult(result) })
+	if err := writeReportFile(sarifPath, formatSARIF, result); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeReportFile(jsonPath, formatJSON, result); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(text, testAccessKeyID) || !strings.Contains(text, "config.env:1") {
+		t.Errorf("text output does not report the finding:\n%s", text)
+	}
+
+	var sarif struct {
+		Runs []struct {
+			Results []struct {
+				RuleID string `json:"ruleId"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	data, err := ioutil.ReadFile(sarifPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &sarif); err != nil {
+		t.Fatalf("invalid SARIF: %v", err)
+	}
+	if len(sarif.Runs) != 1 || len(sarif.Runs[0].Results) != 1 || sarif.Runs[0].Results[0].RuleID != ruleAWSLabelled {
+		t.Errorf("SARIF report does not hold the finding:\n%s", data)
+	}
+
+	var report ScanResult
+	data, _ = ioutil.ReadFile(jsonPath)
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("invalid JSON report: %v", err)
+	}
+	if len(report.Findings) != 1 || report.Findings[0].AccessKeyID != testAccessKeyID {
+		t.Errorf("JSON report does not hold the finding: %s", data)
+	}
+	for _, output := range []string{text, string(data)} {
+		if strings.Contains(output, testSecretAccessKey) {
+			t.Errorf("report leaks the secret:\n%s", output)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+// report is the part of a JSON scan report read by the diff subcommand.
+type report struct {
+	Findings []reportFinding `json:"findings"`
+}
+
+// loadReport reads a JSON report written with -format json or -output-json.
+func loadReport(path string) (*report, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report: %v", err)
+	}
+
+	var r report
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("failed to parse report %s: %v", path, err)
+	}
+
+	// Reports without fingerprints are fingerprinted from the fields they have
+	for i := range r.Findings {
+		if r.Findings[i].Fingerprint == "" {
+			r.Findings[i].Fingerprint = r.Findings[i].fingerprint()
+		}
+	}
+
+	return &r, nil
+}
+
+// reportDiff classifies the findings of two reports by identity.
+type reportDiff struct {
+	New        []reportFinding
+	Resolved   []reportFinding
+	Persisting []reportFinding
+}
+
+// identity identifies a finding of a report across runs: its repository, file, rule and access key
+// ID, like a baseline entry, but not its commit, so a key still in the history is the same finding
+// whichever commits the runs scanned. Reports hold no secrets, so the findings of a rule without an
+// access key ID are told apart by file only.
+func (f reportFinding) identity() string {
+	return f.Finding.baselineFingerprint()
+}
+
+// diffReports returns the findings only in the new report, only in the old report and in both, each
+// identity once, under the first finding reporting it.
+func diffReports(old, new *report) reportDiff {
+	oldPrints := make(map[string]bool)
+	for _, f := range old.Findings {
+		oldPrints[f.identity()] = true
+	}
+	newPrints := make(map[string]bool)
+	for _, f := range new.Findings {
+		newPrints[f.identity()] = true
+	}
+
+	var diff reportDiff
+	listed := make(map[string]bool)
+	for _, f := range new.Findings {
+		id := f.identity()
+		if listed[id] {
+			continue
+		}
+		listed[id] = true
+		if oldPrints[id] {
+			diff.Persisting = append(diff.Persisting, f)
+		} else {
+			diff.New = append(diff.New, f)
+		}
+	}
+	for _, f := range old.Findings {
+		id := f.identity()
+		if !newPrints[id] && !listed[id] {
+			listed[id] = true
+			diff.Resolved = append(diff.Resolved, f)
+		}
+	}
+
+	return diff
+}
+
+// printReportDiff writes the new, resolved and persisting findings.
+func printReportDiff(w io.Writer, diff reportDiff) {
+	sections := []struct {
+		title    string
+		findings []reportFinding
+	}{
+		{"New", diff.New},
+		{"Resolved", diff.Resolved},
+		{"Persisting", diff.Persisting},
+	}
+
+	for i, section := range sections {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s findings: %d\n", section.title, len(section.findings))
+		for _, f := range section.findings {
+			key := f.AccessKeyID
+			if key == "" {
+				key = "secret matching rule " + f.Rule
+			}
+			fmt.Fprintf(w, "  %s %s %s (%s)\n", f.identity(), key, f.where(), f.Status)
+		}
+	}
+}
+
+// runReportDiff parses the diff subcommand arguments and compares two JSON reports. The exit code
+// is exitKeysFound when the new report has findings the old one did not.
+func runReportDiff(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: aws-iam-keys-finder diff old.json new.json")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(exitError)
+	}
+
+	old, err := loadReport(fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	new, err := loadReport(fs.Arg(1))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	diff := diffReports(old, new)
+	printReportDiff(os.Stdout, diff)
+	if len(diff.New) > 0 {
+		os.Exit(exitKeysFound)
+	}
+}
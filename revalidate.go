@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// findingsFile is the layout of the file written by -save-findings and read by -revalidate: the scan
+// result before validation, and the secrets of its findings in the same order, since reports never
+// include secrets.
+type findingsFile struct {
+	Result  *ScanResult `json:"result"`
+	Secrets []string    `json:"secrets"`
+}
+
+// writeFindingsFile writes the result and its secrets to path, readable only by the owner.
+func writeFindingsFile(path string, result *ScanResult) error {
+	file := findingsFile{Result: result, Secrets: make([]string, len(result.Findings))}
+	for i, f := range result.Findings {
+		file.Secrets[i] = f.SecretAccessKey
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode findings: %v", err)
+	}
+	if err := ioutil.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write findings: %v", err)
+	}
+
+	return nil
+}
+
+// loadFindingsFile reads a file written by writeFindingsFile, restoring the secrets of its findings.
+func loadFindingsFile(path string) (*ScanResult, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read findings: %v", err)
+	}
+
+	var file findingsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse findings %s: %v", path, err)
+	}
+	if file.Result == nil || len(file.Secrets) != len(file.Result.Findings) {
+		return nil, fmt.Errorf("failed to parse findings %s: not written by -save-findings", path)
+	}
+
+	for i := range file.Result.Findings {
+		file.Result.Findings[i].SecretAccessKey = file.Secrets[i]
+	}
+
+	return file.Result, nil
+}
+
+// Revalidate validates the findings of the file at path, written by -save-findings, without scanning
+// again, e.g. after validation was interrupted. Findings are validated and filtered by severity with
+// opts, whose rules must include the custom rules that found them for their validators to run.
+func Revalidate(ctx context.Context, path string, opts ScanOptions) (*ScanResult, error) {
+	result, err := loadFindingsFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateResult(ctx, result, opts); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// validateResult validates the findings of a result scanned without validation, then drops those
+// below the minimum severity of opts, updating the metadata to match.
+func validateResult(ctx context.Context, result *ScanResult, opts ScanOptions) error {
+	rules, err := opts.ruleSet()
+	if err != nil {
+		return err
+	}
+	severities, err := opts.severityFilter()
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	validateFindings(ctx, result.Findings, opts, rules)
+	result.Findings = severities.apply(result.Findings, &result.Stats)
+
+	if result.Metadata != nil {
+		result.Metadata.FinishedAt = time.Now().UTC()
+		result.Metadata.Options.NoValidate = opts.NoValidate
+		result.Metadata.Options.MinSeverity = opts.MinSeverity
+		result.Metadata.Counts = result.counts()
+	}
+
+	return nil
+}
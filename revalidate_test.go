@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// savedFindings scans a repository holding a live and a dead key without validating them, writes
+// the findings to a file and removes the repository, so only the file is left to validate.
+func savedFindings(t *testing.T) string {
+	t.Helper()
+
+	repo := newFixtureRepo(t)
+	repo.commit("add keys", map[string]string{
+		"live.env": keyFile(testAccessKeyID, testSecretAccessKey),
+		"dead.env": keyFile(testAccessKeyID2, testSecretAccessKey2),
+	})
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "findings.json")
+	if err := writeFindingsFile(path, result); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(repo.dir); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestRevalidate(t *testing.T) {
+	path := savedFindings(t)
+	stub := newSTSStub(t, testAccessKeyID)
+
+	result, err := Revalidate(context.Background(), path, ScanOptions{AWSEndpoint: stub.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := make(map[string]string)
+	for _, f := range result.Findings {
+		statuses[f.File] = f.Status
+		if f.SecretAccessKey == "" {
+			t.Errorf("got finding %+v without its secret", f)
+		}
+	}
+	if statuses["live.env"] != statusValid || statuses["dead.env"] != statusInvalid {
+		t.Errorf("got statuses %v, want live.env valid and dead.env invalid", statuses)
+	}
+	if m := result.Metadata; m == nil || m.Options.NoValidate || m.Counts.Valid != 1 || m.Counts.Invalid != 1 || m.Counts.Commits != 1 {
+		t.Errorf("got metadata %+v, want the counts of the validated findings", m)
+	}
+}
+
+func TestWriteFindingsFileIsPrivate(t *testing.T) {
+	path := savedFindings(t)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Errorf("got mode %o, want 600 since the file holds secrets", mode)
+	}
+}
+
+func TestLoadFindingsFileInvalid(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		content, err string
+	}{
+		{"not json", "failed to parse findings"},
+		{`{"findings": []}`, "not written by -save-findings"},
+		{`{"result": {"findings": [{"file": "a.env"}]}, "secrets": []}`, "not written by -save-findings"},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(dir, "findings.json")
+		ioutil.WriteFile(path, []byte(tt.content), 0o600)
+		if _, err := loadFindingsFile(path); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.content, err, tt.err)
+		}
+	}
+}
+
+func TestCLISaveFindingsAndRevalidate(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("add key", map[string]string{"live.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+	path := filepath.Join(t.TempDir(), "findings.json")
+
+	// Validation fails against an unreachable endpoint, leaving the key unverified
+	got := runScanner(t, "-repo", repo.dir, "-save-findings", path, "-aws-endpoint", "http://127.0.0.1:1")
+	if got.code != exitKeysFound || !strings.Contains(got.stdout, "Unverified IAM key found") {
+		t.Fatalf("got exit code %d and stdout %q, want the key unverified", got.code, got.stdout)
+	}
+
+	stub := newSTSStub(t, testAccessKeyID)
+	got = runScanner(t, "-revalidate", path, "-aws-endpoint", stub.URL)
+	if got.code != exitKeysFound || !strings.Contains(got.stdout, "Valid IAM key found") || !strings.Contains(got.stdout, "live.env:1: "+testAccessKeyID) {
+		t.Errorf("got exit code %d and stdout %q, want the saved key valid", got.code, got.stdout)
+	}
+}
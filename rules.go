@@ -0,0 +1,564 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// Names of the built-in rules.
+const (
+	ruleAWSLabelled    = "aws-labelled-key"
+	ruleAWSURL         = "aws-url-credentials"
+	ruleAWSAccessKeyID = "aws-access-key-id"
+	ruleGitHubToken    = "github-token"
+	ruleGitLabToken    = "gitlab-token"
+	ruleNPMToken       = "npm-token"
+)
+
+// Rule is a detector run over every scanned file. Custom rules match a single secret with Pattern;
+// a rule with the name of a built-in rule overrides the built-in's case sensitivity, Disabled, Severity and
+// Remediation settings instead, those it sets and no others.
+type Rule struct {
+	Name string `json:"name"`
+	// Pattern is the regular expression of a custom rule. The first capture group is the secret,
+	// or the whole match when the pattern has no groups.
+	Pattern string `json:"pattern,omitempty"`
+	// CaseSensitive disables the case-insensitive matching applied by default when true. It is a
+	// pointer so an override leaving it out keeps the built-in's setting.
+	CaseSensitive *bool `json:"case_sensitive,omitempty"`
+	// Confidence of the findings of a custom rule, defaulting to medium.
+	Confidence string `json:"confidence,omitempty"`
+	// Severity replaces the default severity of the rule's findings that are not invalid, e.g. high for
+	// private keys that cannot be validated. A rule with the name of a built-in rule can set it too.
+	Severity string `json:"severity,omitempty"`
+	// Pair is the regular expression of the value a custom rule's secret comes with, such as the
+	// client ID of a client secret. Its first capture group, or the whole match, is reported as the
+	// ID of the nearest secret at most PairWithin lines away.
+	Pair string `json:"pair,omitempty"`
+	// PairWithin is how many lines apart a secret and its pair may be, defaulting to 5.
+	PairWithin int `json:"pair_within,omitempty"`
+	// Remediation replaces the built-in advice on fixing the rule's findings that are not invalid, e.g.
+	// with the runbook of the team owning the secret. A rule with the name of a built-in rule can set it too.
+	Remediation string `json:"remediation,omitempty"`
+	// Disabled turns the rule off when true; a rule with the name of a built-in rule can turn the
+	// built-in off, or on again with false.
+	Disabled *bool `json:"disabled,omitempty"`
+	// Validator is the command and arguments run to check whether a secret found by a custom rule
+	// is live. The secret is written to its standard input; exit code 0 means live.
+	Validator []string `json:"validator,omitempty"`
+}
+
+// rulesFile is the layout of the JSON file given to -rules.
+type rulesFile struct {
+	Rules []Rule `json:"rules"`
+}
+
+// builtinRules are the rules run when no rules file is given. Labels are matched case-insensitively,
+// while raw key values are case-sensitive since real access key IDs are always upper case. Tokens
+// with a vendor prefix are high confidence since the prefix rarely appears by chance.
+var builtinRules = []Rule{
+	{Name: ruleAWSLabelled, CaseSensitive: aws.Bool(false)},
+	{Name: ruleAWSURL, CaseSensitive: aws.Bool(true)},
+	{Name: ruleTerraformState, CaseSensitive: aws.Bool(true)},
+	{Name: ruleAWSAccessKeyID, Pattern: `\b((?:A3T[A-Z0-9]|AKIA|ASIA|ABIA|ACCA|AGPA|AIDA|AIPA|ANPA|ANVA|APKA|AROA|ASCA)[A-Z0-9]{16})\b`, CaseSensitive: aws.Bool(true)},
+	{Name: ruleGitHubToken, Pattern: `\b((?:ghp|gho|ghs|ghu|ghr)_[A-Za-z0-9]{36})\b`, CaseSensitive: aws.Bool(true), Confidence: confidenceHigh},
+	{Name: ruleGitLabToken, Pattern: `\b(glpat-[A-Za-z0-9_\-]{20})(?:[^A-Za-z0-9_\-]|$)`, CaseSensitive: aws.Bool(true), Confidence: confidenceHigh},
+	{Name: ruleNPMToken, Pattern: `\b(npm_[A-Za-z0-9]{36})\b`, CaseSensitive: aws.Bool(true), Confidence: confidenceHigh},
+}
+
+// defaultPairWithin is how many lines apart a secret and its pair may be when the rule does not say.
+const defaultPairWithin = 5
+
+// compiledRule is a rule with its regular expressions compiled.
+type compiledRule struct {
+	Rule
+	re *regexp.Regexp
+	// pairRe is the compiled Pair pattern of a custom rule, or nil.
+	pairRe *regexp.Regexp
+	// secretRe is the secret label pattern of the aws-labelled-key rule.
+	secretRe *regexp.Regexp
+}
+
+// ruleSet holds the compiled rules of a scan.
+type ruleSet struct {
+	rules []compiledRule
+	// joinLiterals joins concatenated string literals in source files before matching.
+	joinLiterals bool
+	// decodePlists searches the values of binary and XML property lists instead of their raw content.
+	decodePlists bool
+	// decodeDocuments searches the text of PDF and DOCX documents instead of their raw content.
+	decodeDocuments bool
+	// decodeEncoded also searches base64 and hex tokens for AWS keys once decoded.
+	decodeEncoded bool
+}
+
+// loadRules reads the rules from a JSON rules file.
+func loadRules(path string) ([]Rule, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules file: %v", err)
+	}
+
+	var file rulesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse rules file %s: %v", path, err)
+	}
+
+	return file.Rules, nil
+}
+
+// ruleSet returns the built-in rules combined with the rules file and inline rules of the options.
+func (opts ScanOptions) ruleSet() (*ruleSet, error) {
+	rules := opts.Rules
+	if opts.RulesFile != "" {
+		fileRules, err := loadRules(opts.RulesFile)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(fileRules, rules...)
+	}
+
+	set, err := newRuleSet(rules, ruleSelection{Only: opts.OnlyRules, Enable: opts.EnableRules, Disable: opts.DisableRules})
+	if err != nil {
+		return nil, err
+	}
+	set.joinLiterals = opts.JoinLiterals
+	set.decodePlists = opts.DecodePlists
+	set.decodeDocuments = opts.Documents
+	set.decodeEncoded = opts.DecodeEncoded
+
+	return set, nil
+}
+
+// ruleSelection picks which rules run, on top of the Disabled setting of each rule.
+type ruleSelection struct {
+	// Only disables every rule not listed when non-empty.
+	Only []string
+	// Enable turns the listed rules on, including rules disabled by the rules file.
+	Enable []string
+	// Disable turns the listed rules off.
+	Disable []string
+}
+
+// apply sets the Disabled setting of the rules according to the selection. Every name must be a known rule.
+func (sel ruleSelection) apply(rules []Rule) error {
+	index := make(map[string]int)
+	for i, rule := range rules {
+		index[rule.Name] = i
+	}
+	for _, names := range [][]string{sel.Only, sel.Enable, sel.Disable} {
+		for _, name := range names {
+			if _, ok := index[name]; !ok {
+				return fmt.Errorf("unknown rule %q", name)
+			}
+		}
+	}
+
+	if len(sel.Only) > 0 {
+		for i := range rules {
+			rules[i].Disabled = aws.Bool(true)
+		}
+		for _, name := range sel.Only {
+			rules[index[name]].Disabled = aws.Bool(false)
+		}
+	}
+	for _, name := range sel.Enable {
+		rules[index[name]].Disabled = aws.Bool(false)
+	}
+	for _, name := range sel.Disable {
+		rules[index[name]].Disabled = aws.Bool(true)
+	}
+
+	return nil
+}
+
+// newRuleSet compiles the built-in rules with the given overrides and custom rules appended, leaving
+// out the rules that are disabled once the selection is applied.
+func newRuleSet(custom []Rule, sel ruleSelection) (*ruleSet, error) {
+	rules := append([]Rule(nil), builtinRules...)
+	for _, rule := range custom {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("rule with pattern %q has no name", rule.Pattern)
+		}
+
+		if rule.Severity != "" {
+			if err := checkSeverity(rule.Severity); err != nil {
+				return nil, fmt.Errorf("rule %s has %v", rule.Name, err)
+			}
+		}
+
+		overridden := false
+		for i := range rules {
+			if rules[i].Name == rule.Name {
+				if rule.CaseSensitive != nil {
+					rules[i].CaseSensitive = rule.CaseSensitive
+				}
+				if rule.Disabled != nil {
+					rules[i].Disabled = rule.Disabled
+				}
+				if rule.Severity != "" {
+					rules[i].Severity = rule.Severity
+				}
+				if rule.Remediation != "" {
+					rules[i].Remediation = rule.Remediation
+				}
+				overridden = true
+			}
+		}
+		if overridden {
+			continue
+		}
+
+		if rule.Pattern == "" {
+			return nil, fmt.Errorf("rule %s has no pattern", rule.Name)
+		}
+		if rule.Confidence == "" {
+			rule.Confidence = confidenceMedium
+		}
+		if _, ok := confidenceRank[rule.Confidence]; !ok {
+			return nil, fmt.Errorf("rule %s has invalid confidence %q", rule.Name, rule.Confidence)
+		}
+		if len(rule.Validator) > 0 && rule.Validator[0] == "" {
+			return nil, fmt.Errorf("rule %s has an empty validator command", rule.Name)
+		}
+		if rule.PairWithin < 0 {
+			return nil, fmt.Errorf("rule %s has a negative pair_within", rule.Name)
+		}
+		if rule.Pair != "" && rule.PairWithin == 0 {
+			rule.PairWithin = defaultPairWithin
+		}
+		rules = append(rules, rule)
+	}
+
+	if err := sel.apply(rules); err != nil {
+		return nil, err
+	}
+
+	set := &ruleSet{}
+	for _, rule := range rules {
+		if aws.BoolValue(rule.Disabled) {
+			continue
+		}
+		compiled := compiledRule{Rule: rule}
+
+		var err error
+		switch rule.Name {
+		case ruleAWSLabelled:
+			if compiled.re, err = rule.compile(accessKeyIDLabelPattern); err == nil {
+				compiled.secretRe, err = rule.compile(secretAccessKeyLabelPattern)
+			}
+		case ruleAWSURL, ruleTerraformState:
+			// URLs and Terraform state are parsed rather than matched, so there is nothing to compile
+		default:
+			if compiled.re, err = rule.compile(rule.Pattern); err == nil && rule.Pair != "" {
+				compiled.pairRe, err = rule.compile(rule.Pair)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern for rule %s: %v", rule.Name, err)
+		}
+
+		set.rules = append(set.rules, compiled)
+	}
+
+	return set, nil
+}
+
+// compile compiles the pattern, case-insensitively unless the rule is case-sensitive.
+func (r Rule) compile(pattern string) (*regexp.Regexp, error) {
+	if !aws.BoolValue(r.CaseSensitive) {
+		pattern = "(?i)" + pattern
+	}
+
+	return regexp.Compile(pattern)
+}
+
+// searchFile runs every rule over the content of the file at the given path, searching the cells of
+// notebooks one by one, reading the resources of Terraform state, pairing keys by section in AWS
+// credentials files, extracting the text of documents and decoding property lists or joining concatenated string literals first when
+// the rule set asks for it.
+func (rs *ruleSet) searchFile(path string, content []byte) []keyMatch {
+	if rs.decodeDocuments && isDocument(path, content) {
+		if matches, ok := rs.searchDocument(content); ok {
+			return matches
+		}
+	}
+	if rs.decodePlists && isPlist(path, content) {
+		if matches, ok := rs.searchPlist(content); ok {
+			return matches
+		}
+	}
+	if isNotebook(path) {
+		if matches, ok := rs.searchNotebook(content); ok {
+			return matches
+		}
+	}
+	if rs.enabled(ruleTerraformState) && isTerraformState(path, content) {
+		if matches, ok := searchTerraformState(content); ok {
+			return mergeMatches(matches, rs.search(content))
+		}
+	}
+	if rs.enabled(ruleAWSLabelled) {
+		if matches, ok := searchCredentialsINI(content); ok {
+			return mergeMatches(matches, rs.search(content))
+		}
+	}
+	if rs.joinLiterals {
+		content = joinLiterals(path, content)
+	}
+
+	return rs.search(content)
+}
+
+// enabled reports whether the named rule runs.
+func (rs *ruleSet) enabled(name string) bool {
+	for _, rule := range rs.rules {
+		if rule.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// labelledSecretPattern returns the secret label pattern of the aws-labelled-key rule, or nil when it does not run.
+func (rs *ruleSet) labelledSecretPattern() *regexp.Regexp {
+	for _, rule := range rs.rules {
+		if rule.Name == ruleAWSLabelled {
+			return rule.secretRe
+		}
+	}
+
+	return nil
+}
+
+// mergeMatches returns the primary matches followed by the other matches whose keys they do not
+// already report.
+func mergeMatches(primary, others []keyMatch) []keyMatch {
+	seen := make(map[string]bool)
+	for _, match := range primary {
+		seen[match.AccessKeyID] = true
+		seen[match.SecretAccessKey] = true
+	}
+
+	merged := primary
+	for _, match := range others {
+		if (match.AccessKeyID != "" && seen[match.AccessKeyID]) || (match.SecretAccessKey != "" && seen[match.SecretAccessKey]) {
+			continue
+		}
+		merged = append(merged, match)
+	}
+
+	return merged
+}
+
+// search runs every rule over the content. Access key IDs found by the raw value rule are dropped
+// when another rule already matched them, so a labelled key is only reported once, and keys found in
+// encoded tokens when the rule set decodes them are dropped when they are also in plain text.
+func (rs *ruleSet) search(content []byte) []keyMatch {
+	var found, values []keyMatch
+	for _, rule := range rs.rules {
+		switch rule.Name {
+		case ruleAWSLabelled:
+			found = append(found, searchLabelledKeys(content, rule.re, rule.secretRe)...)
+		case ruleAWSURL:
+			found = append(found, searchURLKeys(content)...)
+		case ruleTerraformState:
+			// Terraform state is searched by searchFile, which knows the file name
+		case ruleAWSAccessKeyID:
+			values = append(values, rule.searchPattern(content)...)
+		default:
+			found = append(found, rule.searchPattern(content)...)
+		}
+	}
+
+	// Normalize the keys so the same key quoted differently is reported and validated once
+	matches := normalizeMatches(found)
+	values = normalizeMatches(values)
+
+	seen := make(map[string]bool)
+	for _, match := range matches {
+		seen[match.AccessKeyID] = true
+	}
+	for _, match := range values {
+		if !seen[match.AccessKeyID] {
+			seen[match.AccessKeyID] = true
+			matches = append(matches, match)
+		}
+	}
+
+	if rs.decodeEncoded {
+		matches = mergeMatches(matches, normalizeMatches(rs.searchEncoded(content)))
+	}
+
+	return matches
+}
+
+// keyDelimiters are the quotes, brackets and punctuation that commonly surround a key in source and
+// config files, e.g. the closing brace after the last value of a JSON object.
+const keyDelimiters = "\"'`,;()[]{}"
+
+// normalizeKey strips surrounding whitespace, quotes, brackets and trailing punctuation from a captured key,
+// so "AKIA...", 'AKIA...' and AKIA..., are the same key. Bytes outside printable ASCII, such as
+// latin-1 accents or UTF-8 noise adjacent to the key, are stripped as well.
+func normalizeKey(key string) string {
+	return strings.TrimFunc(key, func(r rune) bool {
+		return r <= ' ' || r > '~' || strings.ContainsRune(keyDelimiters, r)
+	})
+}
+
+// variableReference matches values that refer to a variable rather than hold a secret, as CI configs
+// and shell scripts do: ${{ secrets.X }} in GitHub Actions, ${VAR} and $VAR in GitLab CI, CircleCI and
+// shells, and $(VAR) in Azure Pipelines. Values only span printable ASCII without spaces, so a
+// reference with spaces is matched from its start, which is a lone $ once the brackets of ${{ or ${
+// are stripped. Values masked by CI logs, such as ***, are matched too.
+var variableReference = regexp.MustCompile(`^(?:\$(?:\{|\(|[A-Za-z_][A-Za-z0-9_]*$|$)|\*+$)`)
+
+// isVariableReference reports whether the normalized value refers to a variable or is masked, so
+// there is no secret to report.
+func isVariableReference(value string) bool {
+	return variableReference.MatchString(value)
+}
+
+// normalizeMatches normalizes the keys of every match and drops matches repeated once normalized.
+func normalizeMatches(matches []keyMatch) []keyMatch {
+	var normalized []keyMatch
+	seen := make(map[keyMatch]bool)
+	for _, match := range matches {
+		match.AccessKeyID = normalizeKey(match.AccessKeyID)
+		match.SecretAccessKey = normalizeKey(match.SecretAccessKey)
+		if !seen[match] {
+			seen[match] = true
+			normalized = append(normalized, match)
+		}
+	}
+
+	return normalized
+}
+
+// searchPattern returns a match for every occurrence of the rule's pattern. The aws-access-key-id rule
+// produces access key IDs; custom rules produce secrets, paired with an ID when the rule has a Pair pattern.
+func (r compiledRule) searchPattern(content []byte) []keyMatch {
+	var matches []keyMatch
+	for _, value := range findValues(r.re, content) {
+		if isVariableReference(normalizeKey(value.text)) {
+			continue
+		}
+		match := keyMatch{Rule: r.Name, Line: value.line}
+		if r.Name == ruleAWSAccessKeyID {
+			match.AccessKeyID = value.text
+		} else {
+			match.SecretAccessKey = value.text
+			match.Confidence = r.Confidence
+		}
+		matches = append(matches, match)
+	}
+
+	if r.pairRe != nil {
+		pairMatches(matches, findValues(r.pairRe, content), r.PairWithin)
+	}
+
+	return matches
+}
+
+// foundValue is the first capture group, or the whole match, of a pattern with its line.
+type foundValue struct {
+	text string
+	line int
+}
+
+// findValues returns every value the pattern matches in the content.
+func findValues(re *regexp.Regexp, content []byte) []foundValue {
+	var values []foundValue
+	for _, loc := range re.FindAllSubmatchIndex(content, -1) {
+		start, end := loc[0], loc[1]
+		if len(loc) >= 4 && loc[2] >= 0 {
+			start, end = loc[2], loc[3]
+		}
+		values = append(values, foundValue{text: string(content[start:end]), line: lineNumber(content, start)})
+	}
+
+	return values
+}
+
+// pairMatches sets the ID of every secret to the nearest pair value at most within lines away,
+// preferring the value before the secret on a tie, like a client_id above its client_secret.
+func pairMatches(matches []keyMatch, pairs []foundValue, within int) {
+	for i := range matches {
+		best := -1
+		for j, pair := range pairs {
+			distance := lineDistance(pair.line, matches[i].Line)
+			if distance > within {
+				continue
+			}
+			if best < 0 || distance < lineDistance(pairs[best].line, matches[i].Line) {
+				best = j
+			}
+		}
+		if best >= 0 {
+			matches[i].AccessKeyID = pairs[best].text
+		}
+	}
+}
+
+// lineDistance returns how many lines apart a and b are.
+func lineDistance(a, b int) int {
+	if a > b {
+		return a - b
+	}
+
+	return b - a
+}
+
+// validators returns a command validator for every rule that has one, keyed by rule name.
+func (rs *ruleSet) validators() map[string]keyValidator {
+	validators := make(map[string]keyValidator)
+	if rs == nil {
+		return validators
+	}
+
+	for _, rule := range rs.rules {
+		if len(rule.Validator) > 0 {
+			validators[rule.Name] = commandValidator{rule: rule.Name, argv: rule.Validator}
+		}
+	}
+
+	return validators
+}
+
+// severities returns the severity of every rule that sets one, keyed by rule name.
+func (rs *ruleSet) severities() map[string]string {
+	severities := make(map[string]string)
+	if rs == nil {
+		return severities
+	}
+
+	for _, rule := range rs.rules {
+		if rule.Severity != "" {
+			severities[rule.Name] = rule.Severity
+		}
+	}
+
+	return severities
+}
+
+// remediations returns the remediation advice of every rule that sets one, keyed by rule name.
+func (rs *ruleSet) remediations() map[string]string {
+	remediations := make(map[string]string)
+	if rs == nil {
+		return remediations
+	}
+
+	for _, rule := range rs.rules {
+		if rule.Remediation != "" {
+			remediations[rule.Name] = rule.Remediation
+		}
+	}
+
+	return remediations
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// searchRules compiles the built-in rules with the custom rules and searches the content with them.
+func searchRules(t *testing.T, custom []Rule, content string) []keyMatch {
+	t.Helper()
+
+	rules, err := newRuleSet(custom, ruleSelection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rules.search([]byte(content))
+}
+
+// matchesOf returns the matches of the named rule.
+func matchesOf(matches []keyMatch, rule string) []keyMatch {
+	var found []keyMatch
+	for _, m := range matches {
+		if m.Rule == rule {
+			found = append(found, m)
+		}
+	}
+
+	return found
+}
+
+func TestLabelledRuleIsCaseInsensitive(t *testing.T) {
+	for _, labels := range [][2]string{
+		{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY"},
+		{"aws_access_key_id", "aws_secret_access_key"},
+		{"Aws_Access_Key_Id", "Aws_Secret_Access_Key"},
+	} {
+		content := labels[0] + " = " + testAccessKeyID + "\n" + labels[1] + " = " + testSecretAccessKey + "\n"
+		matches := matchesOf(searchRules(t, nil, content), ruleAWSLabelled)
+		if len(matches) != 1 || matches[0].SecretAccessKey != testSecretAccessKey {
+			t.Errorf("%s: got %+v, want the mixed-case secret matched as written", labels[0], matches)
+		}
+	}
+}
+
+func TestValueRuleIsCaseSensitive(t *testing.T) {
+	if matches := matchesOf(searchRules(t, nil, "id: akiaiosfodnn7example\n"), ruleAWSAccessKeyID); len(matches) != 0 {
+		t.Errorf("lower-case ID matched: %+v", matches)
+	}
+	if matches := matchesOf(searchRules(t, nil, "id: "+testAccessKeyID+"\n"), ruleAWSAccessKeyID); len(matches) != 1 {
+		t.Errorf("got %+v, want the ID matched", matches)
+	}
+}
+
+func TestCustomRuleCaseSensitivity(t *testing.T) {
+	content := "token: tok_AbCdEfGh\n"
+	tests := []struct {
+		caseSensitive *bool
+		want          int
+	}{
+		{nil, 1},
+		{aws.Bool(false), 1},
+		{aws.Bool(true), 0},
+	}
+
+	for _, tt := range tests {
+		rule := Rule{Name: "custom-token", Pattern: `\b(tok_[a-z]{8})\b`, CaseSensitive: tt.caseSensitive}
+		matches := matchesOf(searchRules(t, []Rule{rule}, content), "custom-token")
+		if len(matches) != tt.want {
+			t.Errorf("case_sensitive %v: got %d matches, want %d", aws.BoolValue(tt.caseSensitive), len(matches), tt.want)
+			continue
+		}
+		if tt.want == 1 && matches[0].SecretAccessKey != "tok_AbCdEfGh" {
+			t.Errorf("got secret %q, want it as written", matches[0].SecretAccessKey)
+		}
+	}
+}
+
+func TestNormalizeKey(t *testing.T) {
+	for _, raw := range []string{
+		testAccessKeyID,
+		`"` + testAccessKeyID + `"`,
+		`'` + testAccessKeyID + `'`,
+		"`" + testAccessKeyID + "`,",
+		" " + testAccessKeyID + ";\t",
+		"(" + testAccessKeyID + ")",
+		"\xe9" + testAccessKeyID,
+	} {
+		if got := normalizeKey(raw); got != testAccessKeyID {
+			t.Errorf("normalizeKey(%q) = %q, want %q", raw, got, testAccessKeyID)
+		}
+	}
+}
+
+func TestQuotingStylesCollapseToOneCredential(t *testing.T) {
+	styles := []string{
+		"aws_access_key_id = \"" + testAccessKeyID + "\"\naws_secret_access_key = \"" + testSecretAccessKey + "\"\n",
+		"aws_access_key_id = '" + testAccessKeyID + "'\naws_secret_access_key = '" + testSecretAccessKey + "'\n",
+		"aws_access_key_id = " + testAccessKeyID + ",\naws_secret_access_key = " + testSecretAccessKey + ";\n",
+	}
+
+	var findings []Finding
+	for i, content := range append(styles, styles[0]+styles[1]) {
+		matches := searchRules(t, nil, content)
+		if len(matches) != 1 {
+			t.Fatalf("style %d: got %d matches %+v, want a single one", i, len(matches), matches)
+		}
+		findings = append(findings, newFinding("", "config", matches[0]))
+	}
+
+	for _, f := range findings {
+		if f.AccessKeyID != testAccessKeyID || f.SecretAccessKey != testSecretAccessKey || f.fingerprint() != findings[0].fingerprint() {
+			t.Errorf("finding %+v is not the normalized credential of the others", f)
+		}
+	}
+
+	validator := &fakeValidator{}
+	pool := validationPool{validator: validator, byRule: map[string]keyValidator{}, concurrency: 4, timeout: time.Second}
+	pool.run(context.Background(), findings)
+	if calls := validator.called(); len(calls) != 1 {
+		t.Errorf("validated the credential %d times, want once", len(calls))
+	}
+}
+
+func TestRuleSelection(t *testing.T) {
+	content := "AWS_ACCESS_KEY_ID=" + testAccessKeyID + "\nAWS_SECRET_ACCESS_KEY=" + testSecretAccessKey + "\nGITHUB_TOKEN=" + testGitHubToken + "\n"
+	rulesOf := func(sel ruleSelection, custom []Rule) map[string]bool {
+		t.Helper()
+		rules, err := newRuleSet(custom, sel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := make(map[string]bool)
+		for _, m := range rules.search([]byte(content)) {
+			found[m.Rule] = true
+		}
+		return found
+	}
+
+	if found := rulesOf(ruleSelection{Only: []string{ruleGitHubToken}}, nil); len(found) != 1 || !found[ruleGitHubToken] {
+		t.Errorf("only github-token: got rules %v", found)
+	}
+	if found := rulesOf(ruleSelection{Disable: []string{ruleAWSLabelled, ruleAWSAccessKeyID, ruleAWSURL}}, nil); found[ruleAWSLabelled] || found[ruleAWSAccessKeyID] || !found[ruleGitHubToken] {
+		t.Errorf("AWS rules disabled: got rules %v", found)
+	}
+
+	// Enabling a rule turns it on when the rules file disables it
+	disabled := []Rule{{Name: ruleGitHubToken, Disabled: aws.Bool(true)}}
+	if found := rulesOf(ruleSelection{}, disabled); found[ruleGitHubToken] {
+		t.Errorf("rules file disabling github-token: got rules %v", found)
+	}
+	if found := rulesOf(ruleSelection{Enable: []string{ruleGitHubToken}}, disabled); !found[ruleGitHubToken] {
+		t.Errorf("github-token enabled over the rules file: got rules %v", found)
+	}
+
+	if _, err := newRuleSet(nil, ruleSelection{Only: []string{"no-such-rule"}}); err == nil {
+		t.Error("unknown rule accepted")
+	}
+}
+
+func TestScanOnlyGitHubRule(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("secrets", map[string]string{
+		"aws.env":    keyFile(testAccessKeyID, testSecretAccessKey),
+		"github.env": "GITHUB_TOKEN=" + testGitHubToken + "\n",
+	})
+
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true, OnlyRules: []string{ruleGitHubToken}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Findings) != 1 || result.Findings[0].Rule != ruleGitHubToken {
+		t.Errorf("got %+v, want only the GitHub token", result.Findings)
+	}
+}
+
+// pairedRule is a custom rule pairing a client secret with the client ID near it.
+var pairedRule = Rule{
+	Name:    "acme-client",
+	Pattern: `client_secret\s*=\s*"([a-z0-9]{24})"`,
+	Pair:    `client_id\s*=\s*"(acme-[a-z0-9]{8})"`,
+}
+
+func TestPairedRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		content string
+		want    map[string]string
+	}{
+		{
+			name:    "pair above",
+			rule:    pairedRule,
+			content: "client_id = \"acme-0a1b2c3d\"\nclient_secret = \"s3cr3ts3cr3ts3cr3ts3cr3t\"\n",
+			want:    map[string]string{"s3cr3ts3cr3ts3cr3ts3cr3t": "acme-0a1b2c3d"},
+		},
+		{
+			name: "nearest pair, the one above on a tie",
+			rule: pairedRule,
+			content: "client_id = \"acme-aaaaaaaa\"\nclient_secret = \"aaaaaaaaaaaaaaaaaaaaaaaa\"\nclient_id = \"acme-bbbbbbbb\"\n" +
+				"\n\n\nclient_secret = \"bbbbbbbbbbbbbbbbbbbbbbbb\"\n",
+			want: map[string]string{"aaaaaaaaaaaaaaaaaaaaaaaa": "acme-aaaaaaaa", "bbbbbbbbbbbbbbbbbbbbbbbb": "acme-bbbbbbbb"},
+		},
+		{
+			name:    "pair too far away",
+			rule:    pairedRule,
+			content: "client_id = \"acme-0a1b2c3d\"\n\n\n\n\n\nclient_secret = \"s3cr3ts3cr3ts3cr3ts3cr3t\"\n",
+			want:    map[string]string{"s3cr3ts3cr3ts3cr3ts3cr3t": ""},
+		},
+		{
+			name:    "wider window",
+			rule:    Rule{Name: pairedRule.Name, Pattern: pairedRule.Pattern, Pair: pairedRule.Pair, PairWithin: 10},
+			content: "client_id = \"acme-0a1b2c3d\"\n\n\n\n\n\nclient_secret = \"s3cr3ts3cr3ts3cr3ts3cr3t\"\n",
+			want:    map[string]string{"s3cr3ts3cr3ts3cr3ts3cr3t": "acme-0a1b2c3d"},
+		},
+	}
+
+	for _, tt := range tests {
+		rules, err := newRuleSet([]Rule{tt.rule}, ruleSelection{Only: []string{tt.rule.Name}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]string)
+		for _, m := range rules.search([]byte(tt.content)) {
+			got[m.SecretAccessKey] = m.AccessKeyID
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got secrets paired with %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := newRuleSet([]Rule{{Name: "bad", Pattern: `x`, Pair: `(`}}, ruleSelection{}); err == nil {
+		t.Error("invalid pair pattern accepted")
+	}
+}
+
+func TestScanPairedRule(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("add client", map[string]string{"acme.conf": "client_id = \"acme-0a1b2c3d\"\nclient_secret = \"s3cr3ts3cr3ts3cr3ts3cr3t\"\n"})
+
+	// The validator receives both halves of the credential
+	rule := pairedRule
+	rule.Validator = []string{"sh", "-c", `read secret; [ "$SCANNER_ID:$secret" = acme-0a1b2c3d:s3cr3ts3cr3ts3cr3ts3cr3t ]`}
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, Rules: []Rule{rule}, OnlyRules: []string{rule.Name}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Findings) != 1 {
+		t.Fatalf("got %d findings, want one combined finding", len(result.Findings))
+	}
+	if f := result.Findings[0]; f.AccessKeyID != "acme-0a1b2c3d" || f.SecretAccessKey != "s3cr3ts3cr3ts3cr3ts3cr3t" || f.Status != statusValid {
+		t.Errorf("got finding %s:%s %s, want the paired client validated as live", f.AccessKeyID, f.SecretAccessKey, f.Status)
+	}
+}
+
+func TestIsVariableReference(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"$AWS_SECRET", true},
+		{"${AWS_SECRET", true},
+		{"$(AWS_SECRET", true},
+		{"$", true},
+		{"***", true},
+		{testSecretAccessKey, false},
+		{"$AWS_SECRET/suffix", false},
+		{"abc$DEF", false},
+		{"**secret**", false},
+	}
+
+	for _, tt := range tests {
+		if got := isVariableReference(tt.value); got != tt.want {
+			t.Errorf("isVariableReference(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestSearchSkipsCIVariableReferences(t *testing.T) {
+	references := map[string]string{
+		"github actions": "env:\n  AWS_ACCESS_KEY_ID: " + testAccessKeyID + "\n  AWS_SECRET_ACCESS_KEY: ${{ secrets.AWS_SECRET }}\n",
+		"gitlab ci":      "variables:\n  AWS_ACCESS_KEY_ID: " + testAccessKeyID + "\n  AWS_SECRET_ACCESS_KEY: $AWS_SECRET\n",
+		"circleci":       "environment:\n  AWS_ACCESS_KEY_ID: " + testAccessKeyID + "\n  AWS_SECRET_ACCESS_KEY: ${AWS_SECRET}\n",
+		"azure":          "variables:\n  AWS_ACCESS_KEY_ID: " + testAccessKeyID + "\n  AWS_SECRET_ACCESS_KEY: $(AWS_SECRET)\n",
+		"masked":         "AWS_ACCESS_KEY_ID=" + testAccessKeyID + "\nAWS_SECRET_ACCESS_KEY=***\n",
+	}
+
+	for name, content := range references {
+		t.Run(name, func(t *testing.T) {
+			// The access key ID is still committed in plaintext, so it is reported without a secret
+			matches := searchRules(t, nil, content)
+			if len(matches) != 1 || matches[0].AccessKeyID != testAccessKeyID || matches[0].SecretAccessKey != "" {
+				t.Errorf("got matches %+v, want the access key ID alone", matches)
+			}
+		})
+	}
+
+	literal := "variables:\n  AWS_ACCESS_KEY_ID: " + testAccessKeyID + "\n  AWS_SECRET_ACCESS_KEY: " + testSecretAccessKey + "\n"
+	if matches := searchRules(t, nil, literal); len(matches) != 1 || matches[0].SecretAccessKey != testSecretAccessKey {
+		t.Errorf("got matches %+v for a literal secret, want the pair", matches)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// SARIF 2.1.0 document, reduced to the properties the scanner fills in.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool                     sarifTool                    `json:"tool"`
+	Invocations              []sarifInvocation            `json:"invocations,omitempty"`
+	VersionControlProvenance []sarifVersionControlDetails `json:"versionControlProvenance,omitempty"`
+	Results                  []sarifResult                `json:"results"`
+	Properties               map[string]interface{}       `json:"properties,omitempty"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful bool   `json:"executionSuccessful"`
+	StartTimeUTC        string `json:"startTimeUtc"`
+	EndTimeUTC          string `json:"endTimeUtc"`
+}
+
+type sarifVersionControlDetails struct {
+	RepositoryURI string `json:"repositoryUri"`
+	RevisionID    string `json:"revisionId,omitempty"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID     string                 `json:"ruleId"`
+	Level      string                 `json:"level"`
+	Message    sarifMessage           `json:"message"`
+	Locations  []sarifLocation        `json:"locations"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// writeSARIFReport writes the scan result as a SARIF log for code scanning tools. Invalid keys are
+// left out like in the text output; critical and high severity findings are errors, medium ones
+// warnings and the rest notes.
+func writeSARIFReport(w io.Writer, result *ScanResult) error {
+	rules := make(map[string]bool)
+	results := []sarifResult{}
+	for _, f := range result.Findings {
+		if f.Status == statusInvalid {
+			continue
+		}
+		rules[f.Rule] = true
+
+		properties := map[string]interface{}{
+			"status":     f.Status,
+			"confidence": f.Confidence,
+			"severity":   f.Severity,
+		}
+		if f.AccessKeyID != "" {
+			properties["keyType"] = f.KeyType.Name
+		}
+		if f.Commit != "" {
+			properties["commit"] = f.Commit
+		}
+		if f.Source != "" {
+			properties["source"] = f.Source
+		}
+		if f.Ref != "" {
+			properties["ref"] = f.Ref
+		}
+		if f.Cell > 0 {
+			properties["cell"] = f.Cell
+		}
+		if f.Resource != "" {
+			properties["resource"] = f.Resource
+			properties["attribute"] = f.Attribute
+		}
+		if f.SecretFile != "" {
+			properties["secretFile"] = f.SecretFile
+		}
+		if f.Encoding != "" {
+			properties["encoding"] = f.Encoding
+		}
+		if f.Signature != "" {
+			properties["signature"] = f.Signature
+		}
+		if f.AtHead != "" {
+			properties["atHead"] = f.AtHead
+		}
+		if f.Permalink != "" {
+			properties["permalink"] = f.Permalink
+		}
+		if f.Owner != nil {
+			properties["owner"] = f.Owner
+		}
+		if f.Exposure != "" {
+			properties["exposure"] = f.Exposure
+		}
+		if f.Remediation != "" {
+			properties["remediation"] = f.Remediation
+		}
+		if f.Synthetic {
+			properties["synthetic"] = true
+		}
+
+		results = append(results, sarifResult{
+			RuleID:  f.Rule,
+			Level:   sarifLevel(f),
+			Message: sarifMessage{Text: sarifText(f)},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: f.File},
+				Region:           sarifRegion{StartLine: f.Line},
+			}}},
+			Properties: properties,
+		})
+	}
+
+	var ruleIDs []string
+	for id := range rules {
+		ruleIDs = append(ruleIDs, id)
+	}
+	sort.Strings(ruleIDs)
+
+	driver := sarifDriver{
+		Name:           "aws-iam-keys-finder",
+		Version:        scannerVersion(),
+		InformationURI: "https://github.com/chiragbhatia8/go-access-key-scanner",
+		Rules:          []sarifRule{},
+	}
+	for _, id := range ruleIDs {
+		driver.Rules = append(driver.Rules, sarifRule{ID: id, ShortDescription: sarifMessage{Text: "Secret matched by rule " + id}})
+	}
+
+	// The report metadata maps to the run's invocation and provenance, and is kept whole in its properties
+	run := sarifRun{Tool: sarifTool{Driver: driver}, Results: results}
+	if m := result.Metadata; m != nil {
+		run.Invocations = []sarifInvocation{{
+			ExecutionSuccessful: true,
+			StartTimeUTC:        m.StartedAt.Format(time.RFC3339Nano),
+			EndTimeUTC:          m.FinishedAt.Format(time.RFC3339Nano),
+		}}
+		if m.Repo != "" {
+			run.VersionControlProvenance = []sarifVersionControlDetails{{RepositoryURI: m.Repo, RevisionID: m.Commit}}
+		}
+		run.Properties = map[string]interface{}{"metadata": m}
+	}
+
+	log := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(log); err != nil {
+		return fmt.Errorf("failed to write SARIF report: %v", err)
+	}
+
+	return nil
+}
+
+// sarifLevel returns the SARIF level of a finding from its severity.
+func sarifLevel(f Finding) string {
+	switch f.Severity {
+	case severityCritical, severityHigh:
+		return "error"
+	case severityMedium:
+		return "warning"
+	default:
+		return "note"
+	}
+}
+
+// sarifText returns the SARIF message of a finding. Only the redacted secret is included.
+func sarifText(f Finding) string {
+	if f.AccessKeyID == "" {
+		return fmt.Sprintf("%s secret matching rule %s: %s", f.Status, f.Rule, redact(f.SecretAccessKey))
+	}
+
+	return fmt.Sprintf("%s %s %s", f.Status, f.KeyType, f.AccessKeyID)
+}
@@ -0,0 +1,1208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// Validation statuses recorded on a Finding.
+const (
+	statusValid      = "valid"
+	statusInvalid    = "invalid"
+	statusSkipped    = "skipped"
+	statusUnverified = "unverified"
+)
+
+// ScanOptions configures a single repository scan.
+type ScanOptions struct {
+	// RepoURL is the URL of the repository to clone and scan.
+	RepoURL string `json:"repo"`
+	// Branch is the branch cloned and scanned instead of the default branch when it is not empty.
+	Branch string `json:"branch,omitempty"`
+	// SkipMerges excludes merge commits from the scanned history.
+	SkipMerges bool `json:"skip_merges,omitempty"`
+	// SkipAuthor excludes commits whose author matches this regular expression.
+	SkipAuthor string `json:"skip_author,omitempty"`
+	// MaxCommits limits the scan to the latest commits when positive.
+	MaxCommits int `json:"max_commits,omitempty"`
+	// Region is the AWS region used for validation calls.
+	Region string `json:"region,omitempty"`
+	// Partition is the AWS partition keys are validated in, e.g. aws-us-gov or aws-cn. When it is empty
+	// the partition is the one Region belongs to.
+	Partition string `json:"partition,omitempty"`
+	// AWSEndpoint overrides the endpoint used for validation calls, e.g. to target LocalStack.
+	AWSEndpoint string `json:"aws_endpoint,omitempty"`
+	// ValidationMethod is how AWS keys are validated: sts, the default, signs a GetCallerIdentity call
+	// with the key itself, and iam looks it up with the scanner's own credentials.
+	ValidationMethod string `json:"validation_method,omitempty"`
+	// AWSProfile is the shared config profile whose credentials IAM validation calls are made with.
+	AWSProfile string `json:"aws_profile,omitempty"`
+	// AWSAssumeRoleARN is a role assumed to make validation calls, e.g. from a tooling account.
+	AWSAssumeRoleARN string `json:"aws_assume_role_arn,omitempty"`
+	// EnrichmentProfiles are shared config profiles, e.g. one per account of an organization, in whose
+	// accounts the IAM user and last use of every AWS key found are looked up.
+	EnrichmentProfiles []string `json:"enrichment_profiles,omitempty"`
+	// ValidateTimeout bounds each validation call; a call that runs out of time leaves the key unverified.
+	ValidateTimeout Duration `json:"validate_timeout,omitempty"`
+	// Concurrency is the maximum number of keys validated at the same time.
+	Concurrency int `json:"concurrency,omitempty"`
+	// AdaptiveConcurrency halves the number of keys validated at the same time whenever AWS throttles
+	// a call, retrying it, and raises it back towards Concurrency as calls succeed again.
+	AdaptiveConcurrency bool `json:"adaptive_concurrency,omitempty"`
+	// Verbose logs how the scan proceeds, such as changes of the adaptive concurrency.
+	Verbose bool `json:"verbose,omitempty"`
+	// Public marks the repository as public, escalating its live keys to critical-public-exposure. The
+	// visibility of github.com repositories is otherwise asked from the GitHub API.
+	Public bool `json:"public,omitempty"`
+	// Token authenticates HTTPS clones of private repositories.
+	Token string `json:"token,omitempty"`
+	// Allow lists access key IDs that are never reported.
+	Allow []string `json:"allow,omitempty"`
+	// MinConfidence drops findings below this confidence level.
+	MinConfidence string `json:"min_confidence,omitempty"`
+	// MinSeverity drops findings below this severity once they are validated.
+	MinSeverity string `json:"min_severity,omitempty"`
+	// Exclude lists globs of repository paths that are not scanned.
+	Exclude []string `json:"exclude,omitempty"`
+	// AllowPath lists globs of repository paths that are scanned but whose findings are only informational.
+	AllowPath []string `json:"allow_path,omitempty"`
+	// RulesFile is a JSON file with custom rules and overrides for the built-in rules.
+	RulesFile string `json:"rules_file,omitempty"`
+	// Rules are custom rules and built-in overrides, applied on top of RulesFile.
+	Rules []Rule `json:"rules,omitempty"`
+	// JoinLiterals joins concatenated string literals in Go, Python and JavaScript files before matching.
+	JoinLiterals bool `json:"join_literals,omitempty"`
+	// DecodeEncoded also decodes base64 and hex tokens of high entropy, such as a key stored encoded to
+	// keep it from the eye, and searches them for AWS keys. Only the tokens are decoded, not whole files.
+	DecodeEncoded bool `json:"decode_encoded,omitempty"`
+	// DecodePlists decodes binary and XML property lists, such as macOS preferences, and searches their
+	// string and data values. Binary plists are otherwise skipped like any binary file.
+	DecodePlists bool `json:"decode_plists,omitempty"`
+	// Documents extracts the text of PDF and DOCX documents, such as committed runbooks, and searches it
+	// instead of skipping them as binary files.
+	Documents bool `json:"documents,omitempty"`
+	// OnlyRules runs only the named rules when non-empty.
+	OnlyRules []string `json:"only_rules,omitempty"`
+	// EnableRules turns on named rules, including ones the rules file disables.
+	EnableRules []string `json:"enable_rules,omitempty"`
+	// DisableRules turns off named rules.
+	DisableRules []string `json:"disable_rules,omitempty"`
+	// Dangling also scans blobs that are not reachable from any ref.
+	Dangling bool `json:"dangling,omitempty"`
+	// TipOnly clones only the latest commit of the default branch and scans its tree, skipping the history.
+	TipOnly bool `json:"tip_only,omitempty"`
+	// Diff only searches the lines each commit added, ignoring whitespace-only changes, instead of every commit's full tree.
+	Diff bool `json:"diff,omitempty"`
+	// DiffRange only searches the lines added by the commits in a base..head range, such as those of a
+	// pull request, as if Diff was set.
+	DiffRange string `json:"diff_range,omitempty"`
+	// FollowRenames detects renamed files in commit diffs, so a key in a file that is moved, and
+	// possibly edited, is only reported in the commit that added it.
+	FollowRenames bool `json:"follow_renames,omitempty"`
+	// PairAcrossFiles pairs an access key ID found without a secret with the secret of a sibling file in
+	// the same directory, such as separate id and secret files, when the pair is unambiguous.
+	PairAcrossFiles bool `json:"pair_across_files,omitempty"`
+	// FollowSymlinks searches the files and directories symlinks point to, under the path of the link.
+	// Symlinks are skipped otherwise, as git stores the link and its target is scanned at its own path.
+	// Symlinks leading outside the repository or back into a directory already walked are always skipped.
+	FollowSymlinks bool `json:"follow_symlinks,omitempty"`
+	// Strict fails the scan on any file that cannot be read, or commit missing from the clone, instead
+	// of logging and skipping it.
+	Strict bool `json:"strict,omitempty"`
+	// Reflog also scans commits that are only reachable from the reflog, such as amended or rebased commits.
+	Reflog bool `json:"reflog,omitempty"`
+	// Remotes also scans commits only reachable from the refs the repository tracks of its own remotes, e.g. in a mirror.
+	Remotes bool `json:"remotes,omitempty"`
+	// Notes also scans the content of git notes.
+	Notes bool `json:"notes,omitempty"`
+	// ValidateGitHub validates GitHub tokens with an authenticated call to the GitHub API.
+	ValidateGitHub bool `json:"validate_github,omitempty"`
+	// MaxFindings stops the scan once this many findings are collected when positive.
+	MaxFindings int `json:"max_findings,omitempty"`
+	// NoValidate reports findings as unverified without calling AWS.
+	NoValidate bool `json:"no_validate,omitempty"`
+	// MaxFileSize skips files larger than this many bytes when positive.
+	MaxFileSize int64 `json:"max_file_size,omitempty"`
+	// ScanGenerated also scans files that look generated or minified, which are skipped by default.
+	ScanGenerated bool `json:"scan_generated,omitempty"`
+	// Mmap memory-maps large files instead of reading them, where the platform supports it.
+	Mmap bool `json:"mmap,omitempty"`
+	// VerifySignatures records whether the commit of every finding is signed and the signature verifies.
+	VerifySignatures bool `json:"verify_signatures,omitempty"`
+	// CheckHead records whether the key of every finding of a history scan is still in the tree of the
+	// HEAD commit, and lowers the severity of keys already removed from it by one level.
+	CheckHead bool `json:"check_head,omitempty"`
+	// LogArgs are extra git log arguments selecting the commits to scan, e.g. --first-parent or
+	// --grep=fix, added to the other history filters. Arguments after "--" are paths the history is
+	// limited to. Options changing the output format or writing files are rejected.
+	LogArgs []string `json:"log_args,omitempty"`
+	// Subpath limits the scan to files under this repository relative path and the commits touching it.
+	Subpath string `json:"subpath,omitempty"`
+	// CredentialFilesOnly only scans the commits that changed a file whose name suggests credentials,
+	// such as .env, credentials, *.pem or config.*, each still in full. It trades completeness for speed
+	// on huge histories: a key committed to any other file is missed.
+	CredentialFilesOnly bool `json:"credential_files_only,omitempty"`
+	// Untracked also scans untracked files in local mode.
+	Untracked bool `json:"untracked,omitempty"`
+	// Ignored also scans files git ignores in local mode.
+	Ignored bool `json:"ignored,omitempty"`
+
+	// The following options name local paths, so they are only settable from the command line.
+
+	// DB is the scan database recording the last scanned commit of every repository.
+	DB string `json:"-"`
+	// TmpDir is the directory repositories are cloned into, the system temporary directory when empty.
+	TmpDir string `json:"-"`
+	// LocalClone is an existing clone of the repository to fetch the new commits into and scan,
+	// instead of cloning it again. RepoURL defaults to the URL of its origin.
+	LocalClone string `json:"-"`
+	// CloneCache is a directory of mirrors of the repositories scanned, cloned once and fetched into on
+	// later scans, that scans clone from instead of the remote.
+	CloneCache string `json:"-"`
+
+	// SinceLastScan only scans the commits added since the last scan recorded in DB.
+	SinceLastScan bool `json:"since_last_scan,omitempty"`
+	// HTTPClient is the client AWS and GitHub API calls are made with, e.g. one with custom timeouts,
+	// CA certificates or connection pooling, for library consumers. The default client is used when nil.
+	HTTPClient *http.Client `json:"-"`
+	// OnProgress is called as the scan moves through its stages and commits, for library consumers.
+	OnProgress func(ProgressEvent) `json:"-"`
+	// OnFinding is called with every reported finding once it is validated, before the scan returns.
+	OnFinding func(Finding) `json:"-"`
+
+	// Baseline is a baseline file of known findings to suppress, written with -write-baseline.
+	Baseline string `json:"baseline,omitempty"`
+	// Context is the number of lines before and after every finding included in its report.
+	Context int `json:"context,omitempty"`
+
+	// validations caches validation results across the scans of a multi-repository run.
+	validations *validationCache
+	// streamed holds the results of the keys validated while the history was being searched.
+	streamed *validationStream
+	// scrubs holds the secrets of the scan scrubbed from logs, which are forgotten once it is done,
+	// when set by a long-running caller such as the server.
+	scrubs *scrubScope
+}
+
+// Defaults applied to ScanOptions fields left empty.
+const (
+	defaultRegion      = "us-west-2"
+	defaultConcurrency = 8
+	defaultMaxFileSize = 10 << 20
+
+	defaultValidateTimeout = 5 * time.Second
+)
+
+// Finding describes an AWS access key discovered in a repository.
+type Finding struct {
+	// Repo is the repository of the finding when several repositories are scanned together.
+	Repo   string `json:"repo,omitempty"`
+	Commit string `json:"commit"`
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	// Cell is the 1-based cell of a finding in a Jupyter notebook, whose Line is then the line in the
+	// source or output of the cell.
+	Cell int `json:"cell,omitempty"`
+	// Resource and Attribute are the resource address and attribute path of a finding in Terraform
+	// state, e.g. "module.ci.aws_iam_access_key.deploy" and "secret".
+	Resource  string `json:"resource,omitempty"`
+	Attribute string `json:"attribute,omitempty"`
+	// SecretFile is the file the secret was paired from, when it is not the file of the access key ID.
+	SecretFile string `json:"secret_file,omitempty"`
+	Rule       string `json:"rule"`
+	// Source tags findings that were not found in the regular history: "dangling", "reflog", "notes" or "remote".
+	Source string `json:"source,omitempty"`
+	// Ref is the remote ref, e.g. "upstream/main", of findings from the remotes of the scanned repository.
+	Ref             string  `json:"ref,omitempty"`
+	AccessKeyID     string  `json:"access_key_id"`
+	SecretAccessKey string  `json:"-"`
+	KeyType         keyType `json:"key_type"`
+	Confidence      string  `json:"confidence"`
+	Status          string  `json:"status"`
+	// Severity ranks the finding once it is validated: info, low, medium, high or critical.
+	Severity string `json:"severity,omitempty"`
+	// Signature is the signature status of the commit, e.g. "verified" or "unsigned", with VerifySignatures.
+	Signature string `json:"signature,omitempty"`
+	// AtHead is "present" when the key is still in the tree of the HEAD commit and "removed" when it is
+	// only in the history, with CheckHead.
+	AtHead string `json:"at_head,omitempty"`
+	// Exposure is critical-public-exposure for live keys found in a public repository, the most urgent
+	// findings there are, whatever their rule's severity.
+	Exposure string `json:"exposure,omitempty"`
+	// Remediation is advice on fixing the finding, for its rule, key type and status.
+	Remediation string `json:"remediation,omitempty"`
+	// Encoding is the encoding of the token the key was found in once decoded, base64 or hex, with DecodeEncoded.
+	Encoding string `json:"encoding,omitempty"`
+	// Permalink is the URL of the line of the finding in its commit, for repositories on github.com.
+	Permalink string `json:"permalink,omitempty"`
+	// Owner is the IAM user the key belongs to, looked up with EnrichmentProfiles.
+	Owner *KeyOwner `json:"owner,omitempty"`
+	// Allowed marks findings under an allowed path, which are informational and do not fail the build.
+	Allowed bool `json:"allowed,omitempty"`
+	// Synthetic marks test-only findings injected by InjectFindings, whose keys are not real.
+	Synthetic bool `json:"synthetic,omitempty"`
+	// Error holds the ValidationError message when AWS could not be asked about the key.
+	Error string `json:"error,omitempty"`
+	// Context holds the lines around the finding, with secrets redacted, when ScanOptions.Context is set.
+	Context []ContextLine `json:"context,omitempty"`
+	// encoded is the token the key was decoded from, which gives the secret away like the secret itself.
+	encoded string
+}
+
+// ScanStats counts what a scan suppressed or skipped. The file counters of history scans count every
+// file once in each commit whose tree it is searched in, so a file left unchanged by several commits
+// counts once per commit.
+type ScanStats struct {
+	SuppressedByAllowlist  int `json:"suppressed_by_allowlist"`
+	SuppressedByConfidence int `json:"suppressed_by_confidence"`
+	SuppressedByAllowPath  int `json:"suppressed_by_allow_path"`
+	FilesSeen              int `json:"files_seen"`
+	FilesScanned           int `json:"files_scanned"`
+	FilesAllowed           int `json:"files_allowed"`
+	SkippedBinary          int `json:"skipped_binary"`
+	SkippedOversize        int `json:"skipped_oversize"`
+	SkippedExcluded        int `json:"skipped_excluded"`
+	SkippedGenerated       int `json:"skipped_generated"`
+	SkippedSymlinks        int `json:"skipped_symlinks"`
+	// SkippedUnreadable counts the files and directories that could not be read, outside strict mode.
+	SkippedUnreadable    int `json:"skipped_unreadable"`
+	SuppressedBySeverity int `json:"suppressed_by_severity"`
+	SuppressedByBaseline int `json:"suppressed_by_baseline"`
+	// SkippedMissingCommits counts the commits to scan that were not in the clone, e.g. beyond the
+	// boundary of a shallow clone.
+	SkippedMissingCommits int `json:"skipped_missing_commits"`
+	// HiddenUnvalidated counts the findings left out of the console output by -only-validated.
+	HiddenUnvalidated int `json:"hidden_unvalidated,omitempty"`
+}
+
+// add adds the counters of other to s.
+func (s *ScanStats) add(other ScanStats) {
+	s.SuppressedByAllowlist += other.SuppressedByAllowlist
+	s.SuppressedByConfidence += other.SuppressedByConfidence
+	s.SuppressedByAllowPath += other.SuppressedByAllowPath
+	s.FilesSeen += other.FilesSeen
+	s.FilesScanned += other.FilesScanned
+	s.FilesAllowed += other.FilesAllowed
+	s.SkippedBinary += other.SkippedBinary
+	s.SkippedOversize += other.SkippedOversize
+	s.SkippedExcluded += other.SkippedExcluded
+	s.SkippedGenerated += other.SkippedGenerated
+	s.SkippedSymlinks += other.SkippedSymlinks
+	s.SkippedUnreadable += other.SkippedUnreadable
+	s.SuppressedBySeverity += other.SuppressedBySeverity
+	s.SuppressedByBaseline += other.SuppressedByBaseline
+	s.SkippedMissingCommits += other.SkippedMissingCommits
+}
+
+// ScanResult holds the outcome of a repository scan.
+type ScanResult struct {
+	// Metadata describes the scanner, options and timing of the scan.
+	Metadata       *ReportMetadata `json:"metadata,omitempty"`
+	ScannerVersion string          `json:"scanner_version"`
+	Repo           string          `json:"repo"`
+	Commits        int             `json:"commits"`
+	TotalCommits   int             `json:"total_commits"`
+	Truncated      bool            `json:"truncated,omitempty"`
+	// Since is the previously scanned commit the history started after, when SinceLastScan applied.
+	Since string `json:"since,omitempty"`
+	// Capped records that the scan stopped early because MaxFindings findings were collected.
+	Capped bool `json:"capped,omitempty"`
+	// Cancelled records that the scan was cancelled before it finished, so its findings are partial.
+	Cancelled bool `json:"cancelled,omitempty"`
+	// EmptyHistory records that the repository had no commits, so its working tree was scanned instead.
+	EmptyHistory bool `json:"empty_history,omitempty"`
+	// Synthetic records that the findings were injected for testing by InjectFindings, not found by a scan.
+	Synthetic bool      `json:"synthetic,omitempty"`
+	Findings  []Finding `json:"findings"`
+	Stats     ScanStats `json:"stats"`
+}
+
+// where describes the location of the finding for console output.
+func (f Finding) where() string {
+	if f.Repo != "" {
+		return fmt.Sprintf("in repository %s %s", f.Repo, Finding{Commit: f.Commit, File: f.File, Line: f.Line, Cell: f.Cell, Resource: f.Resource, Attribute: f.Attribute, SecretFile: f.SecretFile, Source: f.Source, Ref: f.Ref}.where())
+	}
+	if f.Source == sourceDangling {
+		return fmt.Sprintf("in dangling blob %s at line %d", f.File, f.Line)
+	}
+	if f.Source == sourceNotes {
+		return fmt.Sprintf("in the note on commit %s at line %d", f.Commit, f.Line)
+	}
+	if f.Commit == "" {
+		return "at " + f.position()
+	}
+	if f.Source == sourceReflog {
+		return fmt.Sprintf("in reflog commit %s at %s", f.Commit, f.position())
+	}
+	if f.Source == sourceRemote {
+		return fmt.Sprintf("in commit %s on remote ref %s at %s", f.Commit, f.Ref, f.position())
+	}
+
+	return fmt.Sprintf("in commit %s at %s", f.Commit, f.position())
+}
+
+// position returns the file and line of the finding, e.g. "config.py:3", including the cell in
+// notebooks, the resource attribute in Terraform state and the file of a secret paired from another file.
+func (f Finding) position() string {
+	switch {
+	case f.Cell > 0:
+		return fmt.Sprintf("%s cell %d line %d", f.File, f.Cell, f.Line)
+	case f.Resource != "":
+		return fmt.Sprintf("%s:%d (%s)", f.File, f.Line, joinPath(f.Resource, f.Attribute))
+	case f.SecretFile != "":
+		return fmt.Sprintf("%s:%d (secret in %s)", f.File, f.Line, f.SecretFile)
+	default:
+		return fmt.Sprintf("%s:%d", f.File, f.Line)
+	}
+}
+
+// historyOptions converts the scan options into the filters used by getCommitHashes.
+func (opts ScanOptions) historyOptions() (historyOptions, error) {
+	if opts.TipOnly && (opts.Diff || opts.Reflog || opts.Remotes || opts.Dangling || opts.SinceLastScan || opts.CredentialFilesOnly) {
+		return historyOptions{}, fmt.Errorf("tip-only cannot be combined with diff, reflog, remotes, dangling, since-last-scan or credential-files-only")
+	}
+
+	if opts.DiffRange != "" && (opts.TipOnly || opts.SinceLastScan) {
+		return historyOptions{}, fmt.Errorf("diff-range cannot be combined with tip-only or since-last-scan")
+	}
+	if opts.FollowRenames && !opts.Diff && opts.DiffRange == "" {
+		return historyOptions{}, fmt.Errorf("follow-renames requires diff or diff-range")
+	}
+
+	history := historyOptions{SkipMerges: opts.SkipMerges, MaxCommits: opts.MaxCommits, Subpath: opts.Subpath}
+	if opts.DiffRange != "" {
+		base, head, err := parseDiffRange(opts.DiffRange)
+		if err != nil {
+			return historyOptions{}, err
+		}
+		history.Since, history.Until = base, head
+	}
+	if opts.SkipAuthor != "" {
+		pattern, err := regexp.Compile(opts.SkipAuthor)
+		if err != nil {
+			return historyOptions{}, fmt.Errorf("invalid skip-author pattern: %v", err)
+		}
+		history.SkipAuthor = pattern
+	}
+	if err := checkLogArgs(opts.LogArgs); err != nil {
+		return historyOptions{}, err
+	}
+	history.LogArgs = opts.LogArgs
+	history.CredentialFiles = opts.CredentialFilesOnly
+
+	return history, nil
+}
+
+// logArgsDenied lists the git log options that extra log arguments cannot set, since they change
+// the format getCommitHashes parses or write to files.
+var logArgsDenied = []string{"--pretty", "--format", "--oneline", "--output", "-z", "--null"}
+
+// checkLogArgs returns an error when an extra git log argument, before any "--", is not an option
+// or is one that would break the listing of commit hashes.
+func checkLogArgs(args []string) error {
+	for _, arg := range args {
+		if arg == "--" {
+			return nil
+		}
+		if !strings.HasPrefix(arg, "-") {
+			return fmt.Errorf("invalid log argument %q: revisions cannot be given, and paths must follow --", arg)
+		}
+		for _, denied := range logArgsDenied {
+			if arg == denied || strings.HasPrefix(arg, denied+"=") {
+				return fmt.Errorf("invalid log argument %q: it would change the output the commits are read from", arg)
+			}
+		}
+	}
+
+	return nil
+}
+
+// partitionRegions maps the AWS partitions keys can be validated in to the region used when none is given.
+var partitionRegions = map[string]string{
+	endpoints.AwsPartitionID:      defaultRegion,
+	endpoints.AwsUsGovPartitionID: "us-gov-west-1",
+	endpoints.AwsCnPartitionID:    "cn-north-1",
+}
+
+// awsRegion returns the region validation calls are made in, checking it belongs to the partition when both are set.
+func (opts ScanOptions) awsRegion() (string, error) {
+	if opts.Partition == "" {
+		if opts.Region == "" {
+			return defaultRegion, nil
+		}
+		return opts.Region, nil
+	}
+
+	region, ok := partitionRegions[opts.Partition]
+	if !ok {
+		return "", fmt.Errorf("unknown partition %q", opts.Partition)
+	}
+	if opts.Region == "" {
+		return region, nil
+	}
+
+	if partition, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), opts.Region); !ok || partition.ID() != opts.Partition {
+		return "", fmt.Errorf("region %s is not in partition %s", opts.Region, opts.Partition)
+	}
+
+	return opts.Region, nil
+}
+
+// awsConfig returns the AWS SDK configuration used for validation calls. The SDK resolves the IAM and
+// STS endpoints of the region's partition, e.g. iam.us-gov.amazonaws.com for GovCloud regions.
+func (opts ScanOptions) awsConfig() (*aws.Config, error) {
+	region, err := opts.awsRegion()
+	if err != nil {
+		return nil, err
+	}
+
+	// Regional STS endpoints are used so assumed roles work outside the standard partition
+	config := &aws.Config{Region: aws.String(region), STSRegionalEndpoint: endpoints.RegionalSTSEndpoint}
+	if opts.AWSEndpoint != "" {
+		config.Endpoint = aws.String(opts.AWSEndpoint)
+	}
+	if opts.HTTPClient != nil {
+		config.HTTPClient = awsHTTPClient(opts.HTTPClient)
+	}
+
+	// Throttled calls are retried by the validation pool at a rate it adapts, not at once by the SDK
+	if opts.AdaptiveConcurrency {
+		config.MaxRetries = aws.Int(0)
+	}
+
+	return config, nil
+}
+
+// awsSession returns the session validation calls are made with. These are the scanner's own
+// credentials, from the named profile and assumed role when set, not the keys being validated.
+func (opts ScanOptions) awsSession() (*session.Session, error) {
+	config, err := opts.awsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	options := session.Options{Config: *config}
+	if opts.AWSProfile != "" {
+		options.Profile = opts.AWSProfile
+		options.SharedConfigState = session.SharedConfigEnable
+	}
+
+	sess, err := session.NewSessionWithOptions(options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS session: %v", err)
+	}
+
+	if opts.AWSAssumeRoleARN != "" {
+		sess = sess.Copy(&aws.Config{Credentials: stscreds.NewCredentials(sess, opts.AWSAssumeRoleARN)})
+	}
+
+	return sess, nil
+}
+
+// walkOptions converts the scan options into the options used by searchIAMKeysInRepo.
+func (opts ScanOptions) walkOptions() (walkOptions, error) {
+	exclude, err := compileGlobs(opts.Exclude)
+	if err != nil {
+		return walkOptions{}, fmt.Errorf("invalid exclude pattern: %v", err)
+	}
+
+	allowPath, err := compileGlobs(opts.AllowPath)
+	if err != nil {
+		return walkOptions{}, fmt.Errorf("invalid allow-path pattern: %v", err)
+	}
+
+	rules, err := opts.ruleSet()
+	if err != nil {
+		return walkOptions{}, err
+	}
+
+	return walkOptions{
+		MaxFileSize:     opts.MaxFileSize,
+		Exclude:         exclude,
+		AllowPath:       allowPath,
+		Rules:           rules,
+		Untracked:       opts.Untracked,
+		Ignored:         opts.Ignored,
+		Subpath:         opts.Subpath,
+		Mmap:            opts.Mmap,
+		ScanGenerated:   opts.ScanGenerated,
+		FollowRenames:   opts.FollowRenames,
+		PairAcrossFiles: opts.PairAcrossFiles,
+		FollowSymlinks:  opts.FollowSymlinks,
+		Strict:          opts.Strict,
+	}, nil
+}
+
+// findingFilter converts the scan options into the filter applied to every finding.
+func (opts ScanOptions) findingFilter() (findingFilter, error) {
+	minConfidence := opts.MinConfidence
+	if minConfidence == "" {
+		minConfidence = confidenceLow
+	}
+	if _, ok := confidenceRank[minConfidence]; !ok {
+		return findingFilter{}, fmt.Errorf("invalid minimum confidence %q: must be low, medium or high", minConfidence)
+	}
+
+	allow := make(map[string]bool)
+	for _, accessKeyID := range opts.Allow {
+		allow[accessKeyID] = true
+	}
+
+	allowPath, err := compileGlobs(opts.AllowPath)
+	if err != nil {
+		return findingFilter{}, fmt.Errorf("invalid allow-path pattern: %v", err)
+	}
+
+	return findingFilter{allow: allow, minConfidence: minConfidence, allowPath: allowPath}, nil
+}
+
+// severityFilter returns the filter applied to findings once they are validated.
+func (opts ScanOptions) severityFilter() (severityFilter, error) {
+	if _, ok := severityRank[opts.MinSeverity]; opts.MinSeverity != "" && !ok {
+		return severityFilter{}, fmt.Errorf("invalid minimum severity %q: must be info, low, medium, high or critical", opts.MinSeverity)
+	}
+
+	return severityFilter{minSeverity: opts.MinSeverity}, nil
+}
+
+// Scan clones the repository described by opts, searches every commit for AWS IAM keys and validates them.
+// A scan cancelled through ctx once the history is being searched stops at the next commit and returns
+// the findings collected so far, marked Cancelled and not validated, along with the context's error.
+func Scan(ctx context.Context, opts ScanOptions) (*ScanResult, error) {
+	started := time.Now()
+	history, err := opts.historyOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := opts.findingFilter()
+	if err != nil {
+		return nil, err
+	}
+
+	severities, err := opts.severityFilter()
+	if err != nil {
+		return nil, err
+	}
+
+	known, err := loadBaseline(opts.Baseline)
+	if err != nil {
+		return nil, err
+	}
+
+	walk, err := opts.walkOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := opts.awsRegion(); err != nil {
+		return nil, err
+	}
+
+	var db *scanDB
+	if opts.DB != "" {
+		if db, err = loadScanDB(opts.DB); err != nil {
+			return nil, err
+		}
+	} else if opts.SinceLastScan {
+		return nil, fmt.Errorf("since-last-scan requires a scan database")
+	}
+
+	// An existing clone is updated in place, and identifies the repository when no URL is given
+	repoPath := opts.LocalClone
+	if repoPath != "" {
+		if opts.RepoURL, err = updateLocalClone(repoPath, opts.RepoURL, opts.Token); err != nil {
+			return nil, fmt.Errorf("error updating local clone: %w", err)
+		}
+	}
+
+	notify := newNotifier(opts)
+	defer notify.close()
+
+	// Clone the repository and remove it once the scan is done
+	if repoPath == "" {
+		depth := 0
+		if opts.TipOnly {
+			depth = 1
+		}
+		var onCloneProgress func(ProgressEvent)
+		if opts.OnProgress != nil {
+			onCloneProgress = func(event ProgressEvent) {
+				event.Repo = opts.RepoURL
+				notify.progress(event)
+			}
+		}
+		if opts.CloneCache != "" {
+			repoPath, err = cloneFromCache(ctx, opts.CloneCache, opts.RepoURL, opts.Branch, opts.Token, opts.TmpDir, depth, onCloneProgress)
+		} else {
+			repoPath, err = cloneRepo(ctx, opts.RepoURL, opts.Branch, opts.Token, opts.TmpDir, depth, onCloneProgress)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("error cloning repository: %w", err)
+		}
+		defer os.RemoveAll(repoPath)
+	}
+	notify.progress(ProgressEvent{Stage: progressCloned, Repo: opts.RepoURL})
+
+	head, err := headCommit(repoPath)
+	if err != nil && !hasCommits(repoPath) {
+		return scanEmptyHistory(ctx, repoPath, opts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error resolving HEAD: %w", err)
+	}
+
+	// The commits of a range may not be on any branch of the clone
+	if opts.DiffRange != "" {
+		for _, rev := range []*string{&history.Since, &history.Until} {
+			if *rev, err = resolveCommit(repoPath, *rev); err != nil {
+				return nil, fmt.Errorf("error resolving diff range: %w", err)
+			}
+		}
+		opts.Diff = true
+	}
+
+	// Start after the last scanned commit, unless there is none or it is no longer in the history
+	if opts.SinceLastScan {
+		if record, ok := db.Repos[opts.RepoURL]; ok && isAncestor(repoPath, record.LastCommit) {
+			history.Since = record.LastCommit
+		}
+	}
+
+	// Get commit hashes, or only scan the checked out tip without walking the history
+	commitHashes, truncated, totalCommits := []string{head}, false, 1
+	if !opts.TipOnly {
+		if commitHashes, truncated, err = getCommitHashes(repoPath, history); err != nil {
+			return nil, fmt.Errorf("error getting commit hashes: %w", err)
+		}
+
+		if totalCommits, err = countCommits(repoPath); err != nil {
+			return nil, fmt.Errorf("error counting commits: %w", err)
+		}
+	}
+
+	// Optionally add commits that are only reachable from the reflog
+	reflogCommits := make(map[string]bool)
+	if opts.Reflog {
+		extra, err := getReflogCommits(reflogSource(opts.RepoURL, repoPath), repoPath, commitHashes)
+		if err != nil {
+			return nil, fmt.Errorf("error reading reflog: %w", err)
+		}
+		for _, hash := range extra {
+			reflogCommits[hash] = true
+		}
+		commitHashes = append(commitHashes, extra...)
+	}
+
+	// Optionally add commits that are only reachable from the remotes of the scanned repository
+	var remoteRefs map[string]string
+	if opts.Remotes {
+		var extra []string
+		if extra, remoteRefs, err = getRemoteCommits(repoPath, commitHashes); err != nil {
+			return nil, fmt.Errorf("error reading remote refs: %w", err)
+		}
+		commitHashes = append(commitHashes, extra...)
+	}
+
+	collector := NewResultCollector()
+	collector.SetLimit(opts.MaxFindings)
+
+	// Notes and dangling blobs are read from the object store, so they can be searched while
+	// the commits are checked out
+	var wg sync.WaitGroup
+	var extraErr error
+	var extraStats ScanStats
+	if opts.Notes || opts.Dangling {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			extraErr = searchObjectStore(repoPath, opts, walk, filter, collector, &extraStats)
+		}()
+	}
+
+	// Put the checkout back the way it was cloned once every commit is searched
+	if !opts.Diff {
+		checkout, err := currentCheckout(repoPath)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving the checkout: %w", err)
+		}
+		defer func() {
+			if err := restoreCheckout(repoPath, checkout); err != nil {
+				log.Printf("Warning: %v", err)
+			}
+		}()
+	}
+
+	// New findings are validated while the later commits are searched
+	stream := opts.streamValidation(ctx, walk.Rules)
+	defer stream.wait()
+
+	// Search each commit in turn since checkouts share the same working tree, stopping once the
+	// findings cap is reached
+	var stats ScanStats
+	scanned := 0
+	for _, commitHash := range commitHashes {
+		if collector.Full() || ctx.Err() != nil {
+			break
+		}
+
+		commitFindings, err := searchCommit(repoPath, commitHash, opts.Diff, walk, &stats)
+		var missing *MissingCommitError
+		if errors.As(err, &missing) && !opts.Strict {
+			// Commits beyond the boundary of a shallow clone cannot be searched, but the others can
+			log.Printf("Warning: skipping %v", err)
+			stats.SkippedMissingCommits++
+			continue
+		}
+		if err != nil {
+			wg.Wait()
+			return nil, err
+		}
+
+		if reflogCommits[commitHash] {
+			for i := range commitFindings {
+				commitFindings[i].Source = sourceReflog
+			}
+		}
+		if ref, ok := remoteRefs[commitHash]; ok {
+			for i := range commitFindings {
+				commitFindings[i].Source = sourceRemote
+				commitFindings[i].Ref = ref
+			}
+		}
+		for _, f := range filter.apply(commitFindings, &stats) {
+			if collector.Add(f) && !known.suppresses(f) {
+				stream.add(f)
+			}
+		}
+		scanned++
+		notify.progress(ProgressEvent{Stage: progressCommits, Repo: opts.RepoURL, Done: scanned, Total: len(commitHashes)})
+	}
+
+	wg.Wait()
+	stream.wait()
+	if extraErr != nil {
+		return nil, extraErr
+	}
+	stats.add(extraStats)
+	opts.streamed = stream
+
+	findings := known.apply(collector.Snapshot(), &stats)
+	if opts.VerifySignatures {
+		if err := annotateSignatures(repoPath, findings); err != nil {
+			return nil, fmt.Errorf("error verifying commit signatures: %w", err)
+		}
+	}
+	if opts.CheckHead && !opts.TipOnly {
+		if err := annotateHeadPresence(repoPath, head, findings); err != nil {
+			return nil, fmt.Errorf("error checking findings at HEAD: %w", err)
+		}
+	}
+	addPermalinks(opts.RepoURL, findings)
+
+	// The findings of a cancelled scan are returned as they are, without waiting for validation
+	cancelled := ctx.Err() != nil
+	if cancelled {
+		opts.NoValidate = true
+	}
+	notify.progress(ProgressEvent{Stage: progressValidating, Repo: opts.RepoURL, Total: len(findings)})
+	validateFindings(ctx, findings, opts, walk.Rules)
+	findings = severities.apply(findings, &stats)
+	if err := addContext(findings, opts.Context, gitContentSource(repoPath)); err != nil {
+		return nil, err
+	}
+	notify.findings(findings)
+
+	// A capped or cancelled scan did not reach every commit, so it is not recorded as the last scan
+	capped := collector.Full()
+	cancelled = cancelled || ctx.Err() != nil
+	if db != nil && !capped && !cancelled {
+		db.Repos[opts.RepoURL] = scanRecord{LastCommit: head, ScannedAt: time.Now().UTC(), Findings: len(findings)}
+		if err := db.save(opts.DB); err != nil {
+			return nil, fmt.Errorf("error updating scan database: %w", err)
+		}
+	}
+
+	notify.progress(ProgressEvent{Stage: progressDone, Repo: opts.RepoURL})
+
+	result := &ScanResult{
+		ScannerVersion: scannerVersion(),
+		Repo:           opts.RepoURL,
+		Commits:        scanned,
+		TotalCommits:   totalCommits,
+		Truncated:      truncated,
+		Since:          history.Since,
+		Capped:         capped,
+		Cancelled:      cancelled,
+		Findings:       findings,
+		Stats:          stats,
+	}
+	result.setMetadata(opts, started, head)
+	if cancelled {
+		return result, ctx.Err()
+	}
+
+	return result, nil
+}
+
+// scanEmptyHistory scans the working tree of a repository without any commits, such as a freshly
+// initialized one with staged files, so it is not reported clean without being examined. The working
+// tree of a local repository is the original one, unless it is bare, since a clone of it would be
+// empty; every file in it is searched, untracked or not, as none is committed yet.
+func scanEmptyHistory(ctx context.Context, repoPath string, opts ScanOptions) (*ScanResult, error) {
+	dir := repoPath
+	if info, err := os.Stat(opts.RepoURL); err == nil && info.IsDir() && opts.LocalClone == "" {
+		if bare, err := gitIn(opts.RepoURL, nil, "rev-parse", "--is-bare-repository"); err == nil && bare == "false" {
+			dir = opts.RepoURL
+		}
+	}
+	log.Printf("Warning: %s has no commits; scanning its working tree instead", opts.RepoURL)
+
+	opts.Untracked = true
+	result, err := ScanPath(ctx, dir, opts)
+	if err != nil {
+		return nil, err
+	}
+	result.Repo = opts.RepoURL
+	result.EmptyHistory = true
+
+	return result, nil
+}
+
+// ScanRepos scans every repository in turn and combines their results, tagging each finding with its
+// repository. A repository that fails to scan is reported to onError and left out of the result.
+func ScanRepos(ctx context.Context, repoURLs []string, opts ScanOptions, onError func(repoURL string, err error)) (*ScanResult, error) {
+	jobs := make([]ScanOptions, len(repoURLs))
+	for i, repoURL := range repoURLs {
+		jobs[i] = opts
+		jobs[i].RepoURL = repoURL
+	}
+
+	return scanEach(ctx, jobs, opts, onError)
+}
+
+// scanEach scans the repository of every job in turn with its options and combines their results.
+// The baseline, findings cap, OnFinding callback and metadata of the run are taken from opts.
+func scanEach(ctx context.Context, jobs []ScanOptions, opts ScanOptions, onError func(repoURL string, err error)) (*ScanResult, error) {
+	started := time.Now()
+	combined := &ScanResult{ScannerVersion: scannerVersion()}
+
+	// A key leaked to several repositories is validated once for the whole run
+	if opts.validations == nil {
+		opts.validations = newValidationCache()
+	}
+
+	// The baseline is applied here rather than by every scan since its fingerprints cover the repository
+	known, err := loadBaseline(opts.Baseline)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, job := range jobs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		repoURL := job.RepoURL
+		repoOpts := job
+		repoOpts.validations = opts.validations
+		repoOpts.Baseline = ""
+		repoOpts.OnFinding = nil
+
+		// The findings cap applies across every repository
+		repoOpts.MaxFindings = opts.MaxFindings
+		if opts.MaxFindings > 0 {
+			if combined.Capped {
+				break
+			}
+			repoOpts.MaxFindings = opts.MaxFindings - len(combined.Findings)
+		}
+		if opts.OnFinding != nil {
+			repoOpts.OnFinding = func(f Finding) {
+				f.Repo = repoURL
+				if !known.suppresses(f) {
+					opts.OnFinding(f)
+				}
+			}
+		}
+		result, err := Scan(ctx, repoOpts)
+		if err != nil {
+			onError(repoURL, err)
+			continue
+		}
+
+		for i := range result.Findings {
+			result.Findings[i].Repo = repoURL
+		}
+		combined.Findings = append(combined.Findings, known.apply(result.Findings, &combined.Stats)...)
+		combined.Commits += result.Commits
+		combined.TotalCommits += result.TotalCommits
+		combined.Truncated = combined.Truncated || result.Truncated
+		combined.Capped = combined.Capped || result.Capped
+		combined.Stats.add(result.Stats)
+	}
+	combined.setMetadata(opts, started, "")
+
+	return combined, nil
+}
+
+// searchCommit returns the findings of a single commit: in the lines it added when diff is set, or
+// in its full checked out tree otherwise.
+func searchCommit(repoPath, commitHash string, diff bool, walk walkOptions, stats *ScanStats) ([]Finding, error) {
+	if diff {
+		findings, err := searchCommitDiff(repoPath, commitHash, walk, stats)
+		if err != nil && !commitExists(repoPath, commitHash) {
+			return nil, &MissingCommitError{Commit: commitHash}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error searching the diff of commit %s: %w", commitHash, err)
+		}
+		return findings, nil
+	}
+
+	if err := checkoutCommit(repoPath, commitHash); err != nil {
+		if !commitExists(repoPath, commitHash) {
+			return nil, &MissingCommitError{Commit: commitHash}
+		}
+		return nil, fmt.Errorf("error checking out commit %s: %w", commitHash, err)
+	}
+
+	foundIAMKeys, err := searchIAMKeysInRepo(repoPath, walk, stats)
+	if err != nil {
+		return nil, fmt.Errorf("error searching for IAM keys in commit %s: %w", commitHash, err)
+	}
+
+	return collectFindings(repoPath, commitHash, foundIAMKeys), nil
+}
+
+// searchObjectStore searches the notes and dangling blobs requested by opts and adds their findings to the collector.
+func searchObjectStore(repoPath string, opts ScanOptions, walk walkOptions, filter findingFilter, collector *ResultCollector, stats *ScanStats) error {
+	if opts.Notes {
+		noteFindings, err := searchNotes(repoPath, walk, stats)
+		if err != nil {
+			return fmt.Errorf("error searching notes: %w", err)
+		}
+		collector.AddAll(filter.apply(noteFindings, stats))
+	}
+
+	if opts.Dangling && !collector.Full() {
+		danglingFindings, err := searchDanglingBlobs(repoPath, walk, stats)
+		if err != nil {
+			return fmt.Errorf("error searching dangling blobs: %w", err)
+		}
+		collector.AddAll(filter.apply(danglingFindings, stats))
+	}
+
+	return nil
+}
+
+// ScanPath searches the working tree of a local git repository for AWS IAM keys and validates them,
+// without cloning it or searching its history. Only tracked files are searched unless opts asks for
+// untracked or ignored files too.
+func ScanPath(ctx context.Context, dir string, opts ScanOptions) (*ScanResult, error) {
+	started := time.Now()
+	filter, err := opts.findingFilter()
+	if err != nil {
+		return nil, err
+	}
+
+	severities, err := opts.severityFilter()
+	if err != nil {
+		return nil, err
+	}
+
+	known, err := loadBaseline(opts.Baseline)
+	if err != nil {
+		return nil, err
+	}
+
+	walk, err := opts.walkOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	var stats ScanStats
+	foundIAMKeys, err := searchIAMKeysInRepo(dir, walk, &stats)
+	if err != nil {
+		return nil, fmt.Errorf("error searching for IAM keys in %s: %w", dir, err)
+	}
+	findings := known.apply(filter.apply(collectFindings(dir, "", foundIAMKeys), &stats), &stats)
+	findings, capped := capFindings(findings, opts.MaxFindings)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	notify := newNotifier(opts)
+	defer notify.close()
+	notify.progress(ProgressEvent{Stage: progressValidating, Repo: dir, Total: len(findings)})
+	validateFindings(ctx, findings, opts, walk.Rules)
+	findings = severities.apply(findings, &stats)
+	err = addContext(findings, opts.Context, func(f Finding) ([]byte, error) {
+		return ioutil.ReadFile(filepath.Join(dir, f.File))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read context: %v", err)
+	}
+	notify.findings(findings)
+	notify.progress(ProgressEvent{Stage: progressDone, Repo: dir})
+
+	result := &ScanResult{ScannerVersion: scannerVersion(), Repo: dir, Capped: capped, Findings: findings, Stats: stats}
+	result.setMetadata(opts, started, "")
+
+	return result, nil
+}
+
+// ScanFile searches a single file for AWS IAM keys and validates them, without any git history.
+// A path of "-" reads the content from standard input.
+func ScanFile(ctx context.Context, path string, opts ScanOptions) (*ScanResult, error) {
+	started := time.Now()
+	filter, err := opts.findingFilter()
+	if err != nil {
+		return nil, err
+	}
+
+	severities, err := opts.severityFilter()
+	if err != nil {
+		return nil, err
+	}
+
+	known, err := loadBaseline(opts.Baseline)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := opts.ruleSet()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []keyMatch
+	var stdin []byte
+	if path == "-" {
+		if stdin, err = ioutil.ReadAll(os.Stdin); err != nil {
+			return nil, fmt.Errorf("failed to read standard input: %v", err)
+		}
+		matches = searchIAMKeys(stdin, rules)
+	} else {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %v", err)
+		}
+		matches, err = readAndSearchFile(path, info.Size(), rules, opts.Mmap)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var findings []Finding
+	stats := ScanStats{FilesSeen: 1, FilesScanned: 1}
+	for _, match := range matches {
+		findings = append(findings, newFinding("", path, match))
+	}
+	findings, capped := capFindings(known.apply(filter.apply(findings, &stats), &stats), opts.MaxFindings)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	notify := newNotifier(opts)
+	defer notify.close()
+	notify.progress(ProgressEvent{Stage: progressValidating, Repo: path, Total: len(findings)})
+	validateFindings(ctx, findings, opts, rules)
+	findings = severities.apply(findings, &stats)
+	err = addContext(findings, opts.Context, func(Finding) ([]byte, error) {
+		if path == "-" {
+			return stdin, nil
+		}
+		return ioutil.ReadFile(path)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read context: %v", err)
+	}
+	notify.findings(findings)
+	notify.progress(ProgressEvent{Stage: progressDone, Repo: path})
+
+	result := &ScanResult{ScannerVersion: scannerVersion(), Capped: capped, Findings: findings, Stats: stats}
+	result.setMetadata(opts, started, "")
+
+	return result, nil
+}
+
+// capFindings keeps the first max findings when max is positive and reports whether any were dropped.
+func capFindings(findings []Finding, max int) ([]Finding, bool) {
+	if max <= 0 || len(findings) <= max {
+		return findings, false
+	}
+
+	return findings[:max], true
+}
+
+// collectFindings converts the keys found in a commit into findings sorted by file path.
+func collectFindings(repoPath, commitHash string, foundIAMKeys map[string][]keyMatch) []Finding {
+	var findings []Finding
+	for path, matches := range foundIAMKeys {
+		relPath, err := filepath.Rel(repoPath, path)
+		if err != nil {
+			relPath = path
+		}
+
+		for _, match := range matches {
+			findings = append(findings, newFinding(commitHash, relPath, match))
+		}
+	}
+
+	sort.Slice(findings, func(i, j int) bool {
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+		if findings[i].Line != findings[j].Line {
+			return findings[i].Line < findings[j].Line
+		}
+		return findings[i].AccessKeyID < findings[j].AccessKeyID
+	})
+
+	return findings
+}
+
+// newFinding builds an unvalidated finding for a key pair matched in the given commit and file.
+func newFinding(commitHash, file string, match keyMatch) Finding {
+	confidence := match.Confidence
+	if confidence == "" {
+		confidence = keyConfidence(match.AccessKeyID, match.SecretAccessKey)
+	}
+
+	return Finding{
+		Commit:          commitHash,
+		File:            file,
+		Line:            match.Line,
+		Cell:            match.Cell,
+		Resource:        match.Resource,
+		Attribute:       match.Attribute,
+		SecretFile:      match.SecretFile,
+		Encoding:        match.Encoding,
+		encoded:         match.Encoded,
+		Rule:            match.Rule,
+		AccessKeyID:     match.AccessKeyID,
+		SecretAccessKey: match.SecretAccessKey,
+		KeyType:         classifyKeyType(match.AccessKeyID),
+		Confidence:      confidence,
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// scanDB is the JSON file recording the last successful scan of every repository.
+type scanDB struct {
+	Repos map[string]scanRecord `json:"repos"`
+}
+
+// scanRecord describes the last successful scan of a repository.
+type scanRecord struct {
+	// LastCommit is the HEAD commit the scan covered.
+	LastCommit string    `json:"last_commit"`
+	ScannedAt  time.Time `json:"scanned_at"`
+	Findings   int       `json:"findings"`
+}
+
+// loadScanDB reads the scan database at the given path; a missing file is an empty database.
+func loadScanDB(path string) (*scanDB, error) {
+	db := &scanDB{Repos: make(map[string]scanRecord)}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scan database: %v", err)
+	}
+
+	if err := json.Unmarshal(data, db); err != nil {
+		return nil, fmt.Errorf("failed to parse scan database %s: %v", path, err)
+	}
+	if db.Repos == nil {
+		db.Repos = make(map[string]scanRecord)
+	}
+
+	return db, nil
+}
+
+// save writes the scan database to the given path, replacing the file atomically.
+func (db *scanDB) save(path string) error {
+	data, err := json.MarshalIndent(db, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode scan database: %v", err)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".scan-db-")
+	if err != nil {
+		return fmt.Errorf("failed to write scan database: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write scan database: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write scan database: %v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write scan database: %v", err)
+	}
+
+	return nil
+}
+
+// headCommit returns the hash of the commit checked out at HEAD.
+func headCommit(repoPath string) (string, error) {
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	cmd.Dir = repoPath
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve HEAD: %w. Output: %s", commandError(err), string(output))
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// hasCommits reports whether HEAD of the repository resolves to a commit, which it does not before
+// the first commit is made, or in a clone of an empty repository.
+func hasCommits(repoPath string) bool {
+	cmd := exec.Command("git", "rev-parse", "--verify", "-q", "HEAD^{commit}")
+	cmd.Dir = repoPath
+	return cmd.Run() == nil
+}
+
+// isAncestor reports whether the commit exists in the repository and is an ancestor of HEAD.
+// History rewritten since the commit was recorded makes this false.
+func isAncestor(repoPath, commitHash string) bool {
+	cmd := exec.Command("git", "merge-base", "--is-ancestor", commitHash, "HEAD")
+	cmd.Dir = repoPath
+
+	return cmd.Run() == nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSinceLastScan(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("first", map[string]string{"old.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+	scanned := repo.commit("second", nil)
+	db := filepath.Join(t.TempDir(), "scans.json")
+
+	// Without a prior record the whole history is scanned, and the scan is recorded
+	opts := ScanOptions{RepoURL: repo.dir, NoValidate: true, Diff: true, DB: db, SinceLastScan: true}
+	result, err := Scan(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Commits != 2 || result.Since != "" || len(result.Findings) != 1 {
+		t.Fatalf("first scan: got %d commits since %q and %d findings, want the full history", result.Commits, result.Since, len(result.Findings))
+	}
+
+	newer := repo.commit("third", map[string]string{"new.env": keyFile(testAccessKeyID2, testSecretAccessKey2)})
+	repo.commit("fourth", nil)
+
+	result, err = Scan(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Commits != 2 || result.Since != scanned {
+		t.Errorf("second scan: got %d commits since %q, want 2 since %s", result.Commits, result.Since, scanned)
+	}
+	if len(result.Findings) != 1 || result.Findings[0].Commit != newer {
+		t.Errorf("second scan: got %+v, want only the key of %s", result.Findings, newer)
+	}
+}
+
+func TestSinceLastScanFromRecord(t *testing.T) {
+	repo := newFixtureRepo(t)
+	first := repo.commit("first", nil)
+	repo.commit("second", nil)
+	repo.commit("third", nil)
+
+	path := filepath.Join(t.TempDir(), "scans.json")
+	db := &scanDB{Repos: map[string]scanRecord{repo.dir: {LastCommit: first, ScannedAt: time.Now()}}}
+	if err := db.save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true, DB: path, SinceLastScan: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Commits != 2 || result.Since != first {
+		t.Errorf("got %d commits since %q, want the 2 commits after %s", result.Commits, result.Since, first)
+	}
+
+	saved, err := loadScanDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record := saved.Repos[repo.dir]; record.LastCommit != repo.git("rev-parse", "HEAD") {
+		t.Errorf("recorded last commit %s, want HEAD", record.LastCommit)
+	}
+}
+
+func TestSinceLastScanRequiresDB(t *testing.T) {
+	if _, err := Scan(context.Background(), ScanOptions{RepoURL: "unused", SinceLastScan: true}); err == nil {
+		t.Error("since-last-scan without a database accepted")
+	}
+}
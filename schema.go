@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// jsonSchemaURI is the JSON Schema dialect of the report schema.
+const jsonSchemaURI = "https://json-schema.org/draft/2020-12/schema"
+
+// schemaTypes maps types with a custom JSON encoding to a type with the same layout: findings are
+// encoded with their fingerprint, like a reportFinding.
+var schemaTypes = map[reflect.Type]reflect.Type{
+	reflect.TypeOf(Finding{}): reflect.TypeOf(reportFinding{}),
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// schemaGenerator builds a JSON Schema from Go types the way encoding/json serializes them, so the
+// schema cannot drift from the reports. Named structs are defined once under $defs.
+type schemaGenerator struct {
+	defs map[string]interface{}
+}
+
+// reportSchema returns the JSON Schema of the JSON report written by -format json and -output-json.
+func reportSchema() map[string]interface{} {
+	g := schemaGenerator{defs: make(map[string]interface{})}
+	root := g.schema(reflect.TypeOf(ScanResult{}))
+
+	return map[string]interface{}{
+		"$schema": jsonSchemaURI,
+		"title":   "aws-iam-keys-finder report",
+		"$ref":    root["$ref"],
+		"$defs":   g.defs,
+	}
+}
+
+// schema returns the schema of values of type t.
+func (g schemaGenerator) schema(t reflect.Type) map[string]interface{} {
+	if mapped, ok := schemaTypes[t]; ok {
+		return g.structRef(t.Name(), mapped)
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() != reflect.Struct && (t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType)):
+		return map[string]interface{}{"type": "string"}
+	case t.Kind() == reflect.Struct && t.Implements(textMarshalerType):
+		return map[string]interface{}{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schema(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		// Nil slices are encoded as null
+		return map[string]interface{}{"type": []string{"array", "null"}, "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		return g.structRef(t.Name(), t)
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// structRef defines the struct type t under name in $defs, once, and returns a reference to it.
+func (g schemaGenerator) structRef(name string, t reflect.Type) map[string]interface{} {
+	ref := map[string]interface{}{"$ref": "#/$defs/" + name}
+	if _, ok := g.defs[name]; ok {
+		return ref
+	}
+
+	// Claim the name before generating the fields, in case a field refers back to the struct
+	def := map[string]interface{}{"type": "object"}
+	g.defs[name] = def
+
+	properties := make(map[string]interface{})
+	required := []string{}
+	g.addFields(t, properties, &required)
+	def["properties"] = properties
+	def["required"] = required
+
+	return ref
+}
+
+// addFields adds the encoded fields of the struct type t, including those of embedded structs, to
+// properties, and the ones that are always encoded to required.
+func (g schemaGenerator) addFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			g.addFields(field.Type, properties, required)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = g.schema(field.Type)
+		if !strings.Contains(options, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// runSchemaCommand prints the JSON Schema of the JSON report.
+func runSchemaCommand(args []string) {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: aws-iam-keys-finder schema")
+		os.Exit(exitError)
+	}
+
+	if err := writeSchema(os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitError)
+	}
+}
+
+// writeSchema writes the report schema as indented JSON.
+func writeSchema(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(reportSchema()); err != nil {
+		return fmt.Errorf("failed to write schema: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// validateSchema checks value, decoded from JSON, against the subset of JSON Schema the report
+// schema uses: $ref into $defs, type, properties, required, items and additionalProperties. It also
+// rejects properties of objects the schema does not list, so fields missing from the schema are
+// caught, and returns the path of every violation.
+func validateSchema(root, schema map[string]interface{}, value interface{}, path string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		def, ok := root["$defs"].(map[string]interface{})[strings.TrimPrefix(ref, "#/$defs/")].(map[string]interface{})
+		if !ok {
+			return []string{path + ": unresolved $ref " + ref}
+		}
+		return validateSchema(root, def, value, path)
+	}
+
+	if types, ok := schema["type"]; ok {
+		var allowed []string
+		switch types := types.(type) {
+		case string:
+			allowed = []string{types}
+		case []interface{}:
+			for _, t := range types {
+				allowed = append(allowed, t.(string))
+			}
+		}
+		if !hasJSONType(value, allowed) {
+			return []string{fmt.Sprintf("%s: %v is not of type %v", path, value, allowed)}
+		}
+	}
+
+	var violations []string
+	switch value := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, ok := value[name.(string)]; !ok {
+					violations = append(violations, path+": missing required property "+name.(string))
+				}
+			}
+		}
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			switch {
+			case properties[name] != nil:
+				violations = append(violations, validateSchema(root, properties[name].(map[string]interface{}), value[name], path+"."+name)...)
+			case schema["additionalProperties"] != nil:
+				violations = append(violations, validateSchema(root, schema["additionalProperties"].(map[string]interface{}), value[name], path+"."+name)...)
+			default:
+				violations = append(violations, path+": property "+name+" is not in the schema")
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range value {
+				violations = append(violations, validateSchema(root, items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	}
+
+	return violations
+}
+
+// hasJSONType reports whether the decoded JSON value is of one of the JSON Schema types.
+func hasJSONType(value interface{}, types []string) bool {
+	for _, t := range types {
+		switch v := value.(type) {
+		case nil:
+			if t == "null" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case float64:
+			if t == "number" || (t == "integer" && v == float64(int64(v))) {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case []interface{}:
+			if t == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if t == "object" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// loadSchema returns the schema as written by the schema subcommand.
+func loadSchema(t *testing.T) map[string]interface{} {
+	var out bytes.Buffer
+	if err := writeSchema(&out); err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &schema); err != nil {
+		t.Fatalf("invalid schema: %v", err)
+	}
+	if schema["$schema"] != jsonSchemaURI {
+		t.Errorf("got $schema %v, want %s", schema["$schema"], jsonSchemaURI)
+	}
+
+	return schema
+}
+
+func TestSchemaValidatesReport(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("add keys", map[string]string{
+		"live.env": keyFile(testAccessKeyID, testSecretAccessKey),
+		"dead.env": keyFile(testAccessKeyID2, testSecretAccessKey2),
+	})
+	stub := newSTSStub(t, testAccessKeyID)
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, AWSEndpoint: stub.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := writeJSONReport(&out, result); err != nil {
+		t.Fatal(err)
+	}
+	var report interface{}
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+
+	schema := loadSchema(t)
+	for _, violation := range validateSchema(schema, schema, report, "$") {
+		t.Error(violation)
+	}
+	if findings := report.(map[string]interface{})["findings"].([]interface{}); len(findings) != 2 {
+		t.Errorf("got %d findings in the sample report, want 2", len(findings))
+	}
+}
+
+func TestSchemaRejectsInvalidReports(t *testing.T) {
+	schema := loadSchema(t)
+	for _, report := range []string{
+		`{"findings": [{"file": "config.env", "line": "one"}]}`,
+		`{"findings": "none"}`,
+		`{"unknown": true}`,
+	} {
+		var value interface{}
+		if err := json.Unmarshal([]byte(report), &value); err != nil {
+			t.Fatal(err)
+		}
+		if violations := validateSchema(schema, schema, value, "$"); len(violations) == 0 {
+			t.Errorf("report %s validated", report)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// scanFunc runs a scan; it is a variable on the server so the handler does not depend on git or AWS directly.
+type scanFunc func(ctx context.Context, opts ScanOptions) (*ScanResult, error)
+
+// server exposes the scanner over HTTP.
+type server struct {
+	mux   *http.ServeMux
+	scan  scanFunc
+	slots chan struct{}
+
+	// running holds the scans in flight by ID, so they can be listed and cancelled.
+	mu      sync.Mutex
+	running map[string]*runningScan
+
+	// webhookSecret verifies the signature of the deliveries to POST /webhook, which is disabled without it.
+	webhookSecret string
+}
+
+// runningScan is a scan in flight, which DELETE /scan/{id} cancels.
+type runningScan struct {
+	ID      string    `json:"id"`
+	Repo    string    `json:"repo"`
+	Started time.Time `json:"started_at"`
+	cancel  context.CancelFunc
+}
+
+// newServer returns a server running at most maxScans scans at the same time.
+func newServer(scan scanFunc, maxScans int, webhookSecret string) *server {
+	if maxScans < 1 {
+		maxScans = 1
+	}
+
+	s := &server{
+		mux:     http.NewServeMux(),
+		scan:    scan,
+		slots:   make(chan struct{}, maxScans),
+		running: make(map[string]*runningScan),
+
+		webhookSecret: webhookSecret,
+	}
+	s.mux.HandleFunc("/scan", s.handleScan)
+	s.mux.HandleFunc("/scan/", s.handleCancel)
+	s.mux.HandleFunc("/scans", s.handleScans)
+	s.mux.HandleFunc("/webhook", s.handleWebhook)
+	s.mux.HandleFunc("/healthz", s.handleHealthz)
+	s.mux.Handle("/metrics", promhttp.Handler())
+
+	return s
+}
+
+// ServeHTTP dispatches the request to the registered handlers.
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// handleHealthz reports that the server is up.
+func (s *server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleScan runs the scan described by the JSON request body and responds with its findings. The ID
+// of the scan is sent in the X-Scan-ID header and listed by GET /scans while it runs; a scan cancelled
+// with DELETE /scan/{id} responds with the findings collected until then, marked cancelled.
+func (s *server) handleScan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var opts ScanOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	if opts.RepoURL == "" {
+		writeError(w, http.StatusBadRequest, "repo is required")
+		return
+	}
+	if err := opts.checkRemoteOptions(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.runScan(w, r.Context(), opts)
+}
+
+// runScan runs the scan in a scan slot under a new scan ID and responds with its result. The scan
+// is cancelled with ctx.
+func (s *server) runScan(w http.ResponseWriter, ctx context.Context, opts ScanOptions) {
+	// The token and secrets of the scan are only scrubbed from logs until it has responded, so the
+	// server does not hold on to the secrets of every scan it ran
+	opts.scrubs = &scrubScope{}
+	defer opts.scrubs.release()
+	opts.scrubs.add(opts.Token)
+
+	// Reject the request rather than queue it when all scan slots are busy
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	default:
+		writeError(w, http.StatusServiceUnavailable, "too many concurrent scans")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	running, err := s.register(opts.RepoURL, cancel)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer s.unregister(running.ID)
+	w.Header().Set("X-Scan-ID", running.ID)
+
+	scansStarted.Inc()
+	start := time.Now()
+	result, err := s.scan(ctx, opts)
+	scanDuration.Observe(time.Since(start).Seconds())
+	if err != nil && errors.Is(err, context.Canceled) {
+		scansCancelled.Inc()
+		if result == nil {
+			result = &ScanResult{ScannerVersion: scannerVersion(), Repo: opts.RepoURL, Cancelled: true, Findings: []Finding{}}
+		}
+		writeJSON(w, http.StatusOK, result)
+		return
+	}
+	if err != nil {
+		scansFailed.Inc()
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	scansCompleted.Inc()
+	for _, f := range result.Findings {
+		findingsTotal.WithLabelValues(f.Status, f.Severity).Inc()
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// maxRequestConcurrency caps the number of keys a scan request may validate at the same time.
+const maxRequestConcurrency = 32
+
+// remoteRepoSchemes are the URL schemes repositories of scan requests may be cloned over.
+var remoteRepoSchemes = map[string]bool{"https": true, "http": true, "ssh": true, "git": true}
+
+// scpLikeRepo matches the scp-like syntax of SSH clone URLs, e.g. "git@github.com:org/repo.git".
+var scpLikeRepo = regexp.MustCompile(`^[A-Za-z0-9._-]+@[A-Za-z0-9][A-Za-z0-9.-]*:[^:]`)
+
+// checkRemoteOptions returns an error when options sent to the server would make it read a file or
+// repository of its own, run a command, or use its own AWS credentials and endpoints, which only the
+// command line may: a local repository, a rules or baseline file, the validator command of a custom
+// rule, AWS settings, or git log arguments. It also caps the validation concurrency.
+func (opts ScanOptions) checkRemoteOptions() error {
+	if err := checkRemoteRepo(opts.RepoURL); err != nil {
+		return err
+	}
+	if opts.RulesFile != "" {
+		return fmt.Errorf("rules_file cannot be set in a scan request: send the rules in rules instead")
+	}
+	if opts.Baseline != "" {
+		return fmt.Errorf("baseline cannot be set in a scan request")
+	}
+	for _, rule := range opts.Rules {
+		if len(rule.Validator) > 0 {
+			return fmt.Errorf("rule %s cannot set a validator in a scan request", rule.Name)
+		}
+	}
+	for _, option := range []struct {
+		name string
+		set  bool
+	}{
+		{"aws_endpoint", opts.AWSEndpoint != ""},
+		{"aws_profile", opts.AWSProfile != ""},
+		{"aws_assume_role_arn", opts.AWSAssumeRoleARN != ""},
+		{"enrichment_profiles", len(opts.EnrichmentProfiles) > 0},
+		{"log_args", len(opts.LogArgs) > 0},
+	} {
+		if option.set {
+			return fmt.Errorf("%s cannot be set in a scan request", option.name)
+		}
+	}
+	if opts.Concurrency > maxRequestConcurrency {
+		return fmt.Errorf("concurrency cannot exceed %d in a scan request", maxRequestConcurrency)
+	}
+
+	return nil
+}
+
+// checkRemoteRepo returns an error unless repo is the URL of a remote repository, so a scan request
+// cannot clone a path or file:// URL of the server, or pass git an option.
+func checkRemoteRepo(repo string) error {
+	if strings.HasPrefix(repo, "-") {
+		return fmt.Errorf("repo cannot start with \"-\"")
+	}
+	if scpLikeRepo.MatchString(repo) {
+		return nil
+	}
+	u, err := url.Parse(repo)
+	if err != nil || !remoteRepoSchemes[u.Scheme] || u.Host == "" || strings.HasPrefix(u.Host, "-") {
+		return fmt.Errorf("repo must be an https, http, ssh, git or scp-like remote URL")
+	}
+
+	return nil
+}
+
+// handleCancel cancels the running scan whose ID follows /scan/. The scan stops at the next commit
+// and its own request responds with the findings collected so far.
+func (s *server) handleCancel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", http.MethodDelete)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/scan/")
+	s.mu.Lock()
+	running, ok := s.running[id]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "no running scan with ID "+id)
+		return
+	}
+
+	running.cancel()
+	writeJSON(w, http.StatusAccepted, map[string]string{"id": id, "status": "cancelling"})
+}
+
+// handleScans lists the running scans, oldest first.
+func (s *server) handleScans(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	s.mu.Lock()
+	scans := make([]*runningScan, 0, len(s.running))
+	for _, running := range s.running {
+		scans = append(scans, running)
+	}
+	s.mu.Unlock()
+	sort.Slice(scans, func(i, j int) bool { return scans[i].Started.Before(scans[j].Started) })
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"scans": scans})
+}
+
+// register records a running scan of repo under a new random ID.
+func (s *server) register(repo string, cancel context.CancelFunc) (*runningScan, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate scan ID: %v", err)
+	}
+
+	running := &runningScan{ID: hex.EncodeToString(id), Repo: logScrubber.scrub(repo), Started: time.Now().UTC(), cancel: cancel}
+	s.mu.Lock()
+	s.running[running.ID] = running
+	s.mu.Unlock()
+
+	return running, nil
+}
+
+// unregister removes the scan with the given ID once it is done.
+func (s *server) unregister(id string) {
+	s.mu.Lock()
+	delete(s.running, id)
+	s.mu.Unlock()
+}
+
+// writeJSON writes v as a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
+
+// writeError writes a JSON error response.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": logScrubber.scrub(message)})
+}
+
+// runServe parses the serve subcommand flags and starts the HTTP server.
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "Address to listen on")
+	maxScans := fs.Int("max-concurrent-scans", 2, "Maximum number of scans to run at the same time")
+	redactFormat := fs.String("redact-format", redactPartial, "How secrets are masked in responses and logs: partial, hash or full")
+	webhookSecret := fs.String("webhook-secret", "", "Secret of the GitHub webhook whose push deliveries POST /webhook scans (endpoint disabled when empty)")
+	httpOptions := httpClientFlags(fs)
+	fs.Parse(args)
+
+	log.SetOutput(scrubWriter{os.Stderr})
+	if err := applyEnv(fs); err != nil {
+		log.Fatal(err)
+	}
+	if err := setRedactFormat(*redactFormat); err != nil {
+		log.Fatal(err)
+	}
+	logScrubber.add(*webhookSecret)
+
+	httpOptions.MaxIdleConnsPerHost = defaultConcurrency
+	client, err := newHTTPClient(*httpOptions)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Every scan makes its calls with the client configured by the flags, whatever options it is sent
+	scan := func(ctx context.Context, opts ScanOptions) (*ScanResult, error) {
+		opts.HTTPClient = client
+		return Scan(ctx, opts)
+	}
+
+	log.Printf("Listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, newServer(scan, *maxScans, *webhookSecret)))
+}
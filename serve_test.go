@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// postScan posts the scan request body to the server and decodes its response into v.
+func postScan(t *testing.T, s *server, body string, v interface{}) int {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/scan", strings.NewReader(body)))
+	if v != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("invalid response %q: %v", w.Body.String(), err)
+		}
+	}
+
+	return w.Code
+}
+
+func TestServeScan(t *testing.T) {
+	repo := newFixtureRepo(t)
+	commit := repo.commit("add key", map[string]string{"config.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+
+	// Scan requests only clone remote URLs, so the fixture is served over git's dumb HTTP protocol
+	repo.git("update-server-info")
+	remote := httptest.NewServer(http.FileServer(http.Dir(filepath.Join(repo.dir, ".git"))))
+	defer remote.Close()
+
+	s := newServer(Scan, 1, "")
+	body, _ := json.Marshal(ScanOptions{RepoURL: remote.URL + "/", NoValidate: true})
+	var result ScanResult
+	if code := postScan(t, s, string(body), &result); code != http.StatusOK {
+		t.Fatalf("status %d, want 200", code)
+	}
+
+	if result.Commits != 1 || len(result.Findings) != 1 {
+		t.Fatalf("got %d commits and %d findings, want 1 and 1", result.Commits, len(result.Findings))
+	}
+	f := result.Findings[0]
+	if f.Commit != commit || f.File != "config.env" || f.AccessKeyID != testAccessKeyID || f.Status != statusUnverified {
+		t.Errorf("unexpected finding %+v", f)
+	}
+}
+
+func TestServeRejectsBadRequests(t *testing.T) {
+	s := newServer(func(ctx context.Context, opts ScanOptions) (*ScanResult, error) {
+		t.Error("scan run for a bad request")
+		return &ScanResult{}, nil
+	}, 1, "")
+
+	for _, body := range []string{`{`, `{}`} {
+		var resp map[string]string
+		if code := postScan(t, s, body, &resp); code != http.StatusBadRequest || resp["error"] == "" {
+			t.Errorf("%s: status %d %v, want 400 with an error", body, code, resp)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/scan", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /scan: status %d, want 405", w.Code)
+	}
+}
+
+func TestServeLimitsConcurrentScans(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	s := newServer(func(ctx context.Context, opts ScanOptions) (*ScanResult, error) {
+		close(started)
+		<-release
+		return &ScanResult{Findings: []Finding{}}, nil
+	}, 1, "")
+
+	done := make(chan int)
+	go func() { done <- postScan(t, s, `{"repo":"https://github.com/o/a"}`, nil) }()
+	<-started
+
+	if code := postScan(t, s, `{"repo":"https://github.com/o/b"}`, nil); code != http.StatusServiceUnavailable {
+		t.Errorf("second scan: status %d, want 503", code)
+	}
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("first scan: status %d, want 200", code)
+	}
+}
+
+func TestServeHealthz(t *testing.T) {
+	w := httptest.NewRecorder()
+	newServer(Scan, 1, "").ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"ok"`) {
+		t.Errorf("healthz: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestServeRejectsLocalOptions(t *testing.T) {
+	s := newServer(func(ctx context.Context, opts ScanOptions) (*ScanResult, error) {
+		t.Errorf("scan run with local options %+v", opts)
+		return &ScanResult{}, nil
+	}, 1, "")
+
+	for _, body := range []string{
+		`{"repo":"/srv/repos/private"}`,
+		`{"repo":"../private"}`,
+		`{"repo":"file:///srv/repos/private"}`,
+		`{"repo":"--upload-pack=touch /tmp/pwned"}`,
+		`{"repo":"ext::sh -c id"}`,
+		`{"repo":"ssh://-oProxyCommand=id/o/r"}`,
+		`{"repo":"https://github.com/o/a","rules_file":"/etc/passwd"}`,
+		`{"repo":"https://github.com/o/a","baseline":"/etc/passwd"}`,
+		`{"repo":"https://github.com/o/a","rules":[{"name":"custom","pattern":"x","validator":["sh","-c","id"]}]}`,
+		`{"repo":"https://github.com/o/a","aws_endpoint":"http://169.254.169.254"}`,
+		`{"repo":"https://github.com/o/a","aws_profile":"prod"}`,
+		`{"repo":"https://github.com/o/a","aws_assume_role_arn":"arn:aws:iam::123456789012:role/admin"}`,
+		`{"repo":"https://github.com/o/a","enrichment_profiles":["prod"]}`,
+		`{"repo":"https://github.com/o/a","log_args":["--output=/tmp/log"]}`,
+		`{"repo":"https://github.com/o/a","concurrency":100000}`,
+	} {
+		var resp map[string]string
+		if code := postScan(t, s, body, &resp); code != http.StatusBadRequest {
+			t.Errorf("%s: status %d %v, want 400", body, code, resp)
+		}
+	}
+}
+
+func TestServeAcceptsRemoteRepos(t *testing.T) {
+	s := newServer(func(ctx context.Context, opts ScanOptions) (*ScanResult, error) {
+		return &ScanResult{Findings: []Finding{}}, nil
+	}, 1, "")
+
+	for _, repo := range []string{
+		"https://github.com/o/a.git",
+		"http://git.example.com/o/a",
+		"ssh://git@github.com/o/a.git",
+		"git://git.example.com/o/a",
+		"git@github.com:o/a.git",
+	} {
+		var resp map[string]interface{}
+		if code := postScan(t, s, `{"repo":"`+repo+`","concurrency":32}`, &resp); code != http.StatusOK {
+			t.Errorf("%s: status %d %v, want 200", repo, code, resp)
+		}
+	}
+}
+
+// listScans returns the scans GET /scans lists as running.
+func listScans(t *testing.T, s *server) []runningScan {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/scans", nil))
+	var resp struct{ Scans []runningScan }
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response %q: %v", w.Body.String(), err)
+	}
+
+	return resp.Scans
+}
+
+func TestServeCancelScan(t *testing.T) {
+	started := make(chan struct{})
+	s := newServer(func(ctx context.Context, opts ScanOptions) (*ScanResult, error) {
+		close(started)
+		<-ctx.Done()
+		partial := newFinding("abc123", "config.env", keyMatch{AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey})
+		return &ScanResult{Repo: opts.RepoURL, Cancelled: true, Findings: []Finding{partial}}, ctx.Err()
+	}, 1, "")
+
+	type response struct {
+		code   int
+		result ScanResult
+	}
+	done := make(chan response)
+	go func() {
+		var resp response
+		resp.code = postScan(t, s, `{"repo":"https://github.com/o/r"}`, &resp.result)
+		done <- resp
+	}()
+	<-started
+
+	scans := listScans(t, s)
+	if len(scans) != 1 || scans[0].Repo != "https://github.com/o/r" || scans[0].ID == "" {
+		t.Fatalf("got running scans %+v, want the scan of o/r", scans)
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/scan/"+scans[0].ID, nil))
+	if w.Code != http.StatusAccepted {
+		t.Errorf("DELETE: status %d, want 202", w.Code)
+	}
+
+	resp := <-done
+	if resp.code != http.StatusOK || !resp.result.Cancelled || len(resp.result.Findings) != 1 {
+		t.Errorf("got status %d and result %+v, want the partial findings marked cancelled", resp.code, resp.result)
+	}
+	if scans := listScans(t, s); len(scans) != 0 {
+		t.Errorf("got running scans %+v after the scan ended, want none", scans)
+	}
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/scan/"+scans[0].ID, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("DELETE of an ended scan: status %d, want 404", w.Code)
+	}
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/scan/"+scans[0].ID, nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /scan/{id}: status %d, want 405", w.Code)
+	}
+}
+
+func TestScanCancelledReturnsPartialFindings(t *testing.T) {
+	repo := newFixtureRepo(t)
+	const commits = 20
+	for i := 0; i < commits; i++ {
+		file := fmt.Sprintf("%02d.env", i)
+		repo.commit("add "+file, map[string]string{file: keyFile(testAccessKeyID, testSecretAccessKey)})
+	}
+	stub := newSTSStub(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	onProgress := func(event ProgressEvent) {
+		if event.Stage == progressCommits && event.Done == 1 {
+			cancel()
+		}
+	}
+	result, err := Scan(ctx, ScanOptions{RepoURL: repo.dir, Diff: true, OnProgress: onProgress, AWSEndpoint: stub.URL, ValidationMethod: validationMethodSTS})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want the scan cancelled", err)
+	}
+	if result == nil || !result.Cancelled {
+		t.Fatalf("got result %+v, want it marked cancelled", result)
+	}
+	// The scan notices the cancellation at the commit after the one being searched
+	if len(result.Findings) == 0 || len(result.Findings) == commits {
+		t.Errorf("got %d findings, want those of the commits scanned before the cancellation", len(result.Findings))
+	}
+	for _, f := range result.Findings {
+		if f.Status != statusUnverified {
+			t.Errorf("got finding %s %s, want it left unvalidated", f.File, f.Status)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import "fmt"
+
+// Severity levels assigned to findings once they are validated.
+const (
+	severityInfo     = "info"
+	severityLow      = "low"
+	severityMedium   = "medium"
+	severityHigh     = "high"
+	severityCritical = "critical"
+)
+
+// severityRank orders the severity levels so they can be compared.
+var severityRank = map[string]int{
+	severityInfo:     0,
+	severityLow:      1,
+	severityMedium:   2,
+	severityHigh:     3,
+	severityCritical: 4,
+}
+
+// defaultSeverity returns the severity of a validated finding before rule overrides: live keys are
+// critical, or high for temporary keys, keys that could not be checked are medium and keys that are
+// not live or not credentials at all are low.
+func defaultSeverity(f Finding) string {
+	switch {
+	case f.Status == statusValid && f.KeyType.validationStrategy() == skipTemporary:
+		return severityHigh
+	case f.Status == statusValid:
+		return severityCritical
+	case f.Status == statusInvalid:
+		return severityLow
+	case f.Status == statusSkipped && f.AccessKeyID != "" && f.KeyType.validationStrategy() == skipTemporary:
+		return severityHigh
+	case f.Status == statusSkipped && f.KeyType != unknownKeyType && f.KeyType.validationStrategy() == skipNotCredential:
+		return severityLow
+	default:
+		return severityMedium
+	}
+}
+
+// assignSeverities sets the severity of every validated finding. Findings under allowed paths are
+// informational and invalid keys keep their default, while the severity of a rule, when set,
+// replaces the default of its other findings. Keys removed from HEAD are one level below their default,
+// and live keys in a public repository are always critical.
+func assignSeverities(findings []Finding, rules *ruleSet) {
+	overrides := rules.severities()
+	for i := range findings {
+		f := &findings[i]
+		switch {
+		case f.Exposure == exposurePublic:
+			f.Severity = severityCritical
+		case f.Allowed:
+			f.Severity = severityInfo
+		case f.Status != statusInvalid && overrides[f.Rule] != "":
+			f.Severity = overrides[f.Rule]
+		case f.AtHead == headRemoved:
+			f.Severity = lowerSeverity(defaultSeverity(*f))
+		default:
+			f.Severity = defaultSeverity(*f)
+		}
+	}
+}
+
+// lowerSeverity returns the severity one level below severity, but no lower than low.
+func lowerSeverity(severity string) string {
+	switch severity {
+	case severityCritical:
+		return severityHigh
+	case severityHigh:
+		return severityMedium
+	case severityMedium:
+		return severityLow
+	default:
+		return severity
+	}
+}
+
+// checkSeverity returns an error unless severity is a known severity level.
+func checkSeverity(severity string) error {
+	if _, ok := severityRank[severity]; !ok {
+		return fmt.Errorf("invalid severity %q: must be info, low, medium, high or critical", severity)
+	}
+
+	return nil
+}
+
+// severityFilter drops validated findings below a minimum severity.
+type severityFilter struct {
+	minSeverity string
+}
+
+// apply returns the findings at or above the minimum severity and counts the dropped ones in stats.
+func (f severityFilter) apply(findings []Finding, stats *ScanStats) []Finding {
+	if f.minSeverity == "" {
+		return findings
+	}
+
+	var kept []Finding
+	for _, finding := range findings {
+		if severityRank[finding.Severity] < severityRank[f.minSeverity] {
+			stats.SuppressedBySeverity++
+			continue
+		}
+		kept = append(kept, finding)
+	}
+
+	return kept
+}
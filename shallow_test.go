@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// shallowClone makes a clone of the fixture holding only its latest commit, and returns its path.
+func shallowClone(t *testing.T, repo *fixtureRepo) string {
+	dir := filepath.Join(t.TempDir(), "shallow")
+	repo.git("clone", "-q", "--depth", "1", "file://"+repo.dir, dir)
+
+	return dir
+}
+
+func TestSearchCommitBeyondShallowBoundary(t *testing.T) {
+	repo := newFixtureRepo(t)
+	old := repo.commit("add old key", map[string]string{"old.env": keyFile(testAccessKeyID2, testSecretAccessKey2)})
+	repo.commit("add key", map[string]string{"config.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+	dir := shallowClone(t, repo)
+
+	for _, diff := range []bool{false, true} {
+		_, err := searchCommit(dir, old, diff, walkOptions{}, &ScanStats{})
+		var missing *MissingCommitError
+		if !errors.As(err, &missing) || missing.Commit != old {
+			t.Errorf("diff %v: got %v, want a MissingCommitError for %s", diff, err, old)
+		}
+	}
+
+	// The failed checkout leaves the branch checked out
+	if checkout, err := currentCheckout(dir); err != nil || checkout != "main" {
+		t.Errorf("got checkout %q, %v, want main", checkout, err)
+	}
+}
+
+func TestScanShallowLocalClone(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("add old key", map[string]string{"old.env": keyFile(testAccessKeyID2, testSecretAccessKey2)})
+	tip := repo.commit("add key", map[string]string{"config.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+	dir := shallowClone(t, repo)
+
+	result, err := Scan(context.Background(), ScanOptions{LocalClone: dir, NoValidate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Commits != 1 {
+		t.Errorf("scanned %d commits, want only the one in the shallow clone", result.Commits)
+	}
+	for _, f := range result.Findings {
+		if f.Commit != tip {
+			t.Errorf("got finding in %s, want only findings in %s", f.Commit, tip)
+		}
+	}
+	if len(result.Findings) != 2 {
+		t.Errorf("got %d findings, want both keys of the tip's tree", len(result.Findings))
+	}
+
+	if checkout, err := currentCheckout(dir); err != nil || checkout != "main" {
+		t.Errorf("got checkout %q, %v after the scan, want main", checkout, err)
+	}
+}
+
+func TestRestoreDetachedCheckout(t *testing.T) {
+	repo := newFixtureRepo(t)
+	first := repo.commit("first", map[string]string{"a.txt": "a\n"})
+	repo.commit("second", map[string]string{"b.txt": "b\n"})
+	repo.git("checkout", "-q", first)
+
+	checkout, err := currentCheckout(repo.dir)
+	if err != nil || checkout != first {
+		t.Fatalf("got checkout %q, %v, want the detached commit %s", checkout, err, first)
+	}
+	if err := checkoutCommit(repo.dir, "main"); err != nil {
+		t.Fatal(err)
+	}
+	if err := restoreCheckout(repo.dir, checkout); err != nil {
+		t.Fatal(err)
+	}
+	if head, err := headCommit(repo.dir); err != nil || head != first {
+		t.Errorf("got HEAD %s, %v, want the detached commit %s restored", head, err, first)
+	}
+}
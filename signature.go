@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// signatureStatuses maps git's %G? signature codes to the values recorded in Finding.Signature.
+var signatureStatuses = map[string]string{
+	"G": "verified",
+	"U": "verified-untrusted",
+	"B": "bad",
+	"X": "expired",
+	"Y": "expired-key",
+	"R": "revoked",
+	"E": "unverifiable",
+	"N": "unsigned",
+}
+
+// commitSignatures returns the signature status of each of the given commits.
+func commitSignatures(repoPath string, commitHashes []string) (map[string]string, error) {
+	cmd := exec.Command("git", "log", "--no-walk=unsorted", "--stdin", "--format=%H %G?")
+	cmd.Dir = repoPath
+	cmd.Stdin = strings.NewReader(strings.Join(commitHashes, "\n") + "\n")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify commit signatures: %w", commandError(err))
+	}
+
+	signatures := make(map[string]string)
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if status, ok := signatureStatuses[fields[1]]; ok {
+			signatures[fields[0]] = status
+		}
+	}
+
+	return signatures, nil
+}
+
+// annotateSignatures records the signature status of the commit of every finding.
+func annotateSignatures(repoPath string, findings []Finding) error {
+	var commitHashes []string
+	seen := make(map[string]bool)
+	for _, f := range findings {
+		if f.Commit != "" && !seen[f.Commit] {
+			seen[f.Commit] = true
+			commitHashes = append(commitHashes, f.Commit)
+		}
+	}
+	if len(commitHashes) == 0 {
+		return nil
+	}
+
+	signatures, err := commitSignatures(repoPath, commitHashes)
+	if err != nil {
+		return err
+	}
+
+	for i := range findings {
+		findings[i].Signature = signatures[findings[i].Commit]
+	}
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestVerifySignaturesUnsigned(t *testing.T) {
+	repo := newFixtureRepo(t)
+	first := repo.commit("first", map[string]string{"a.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+	second := repo.commit("second", map[string]string{"b.env": keyFile(testAccessKeyID2, testSecretAccessKey2)})
+
+	signatures, err := commitSignatures(repo.dir, []string{second, first})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signatures) != 2 || signatures[first] != "unsigned" || signatures[second] != "unsigned" {
+		t.Errorf("got signatures %v, want both commits unsigned", signatures)
+	}
+
+	for _, verify := range []bool{false, true} {
+		result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, NoValidate: true, Diff: true, VerifySignatures: verify})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Findings) != 2 {
+			t.Fatalf("got %d findings, want 2", len(result.Findings))
+		}
+		want := ""
+		if verify {
+			want = "unsigned"
+		}
+		for _, f := range result.Findings {
+			if f.Signature != want {
+				t.Errorf("verify %v: finding of %s has signature %q, want %q", verify, f.Commit, f.Signature, want)
+			}
+		}
+	}
+}
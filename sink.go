@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultSinkSubject is the NATS subject findings are published to when the sink URL names none.
+const defaultSinkSubject = "aws-iam-keys-finder.findings"
+
+// Bounds of the sink: how many findings wait to be published before new ones are dropped, how long
+// connecting and publishing may take, and how long the sink waits for the queued findings on close.
+const (
+	sinkQueueSize    = 1024
+	sinkTimeout      = 5 * time.Second
+	sinkDrainTimeout = 10 * time.Second
+)
+
+// sinkMessage is a finding as published to the sink: its JSON report entry with the secret redacted.
+type sinkMessage struct {
+	plainFinding
+	Fingerprint string `json:"fingerprint"`
+	Secret      string `json:"secret,omitempty"`
+}
+
+// plainFinding is a finding without its MarshalJSON method, so it can be embedded in sinkMessage.
+type plainFinding Finding
+
+// natsSink publishes every finding as a JSON message to a subject of a NATS server, speaking the NATS
+// client protocol over TCP. Publishing is best effort and never blocks a scan: findings are queued
+// and published from a goroutine of its own, and dropped when the queue is full or the server cannot
+// be reached once reconnected.
+type natsSink struct {
+	addr    string
+	subject string
+	connect string
+
+	// mu guards the connection, which the reader goroutine writes to as well to answer pings.
+	mu   sync.Mutex
+	conn net.Conn
+	w    *bufio.Writer
+	pong chan struct{}
+
+	queue   chan []byte
+	done    chan struct{}
+	dropped int
+}
+
+// newSink connects to the sink at target, a nats://[user:password@]host[:port][/subject] URL, and
+// starts publishing. The port defaults to 4222, and a user without a password is sent as a token.
+func newSink(target string) (*natsSink, error) {
+	u, err := url.Parse(target)
+	if err == nil && u.Scheme == "kafka" {
+		return nil, fmt.Errorf("invalid sink %q: Kafka is not supported, only nats://host:port/subject", target)
+	}
+	if err != nil || u.Scheme != "nats" || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid sink %q: must be nats://host:port/subject", target)
+	}
+
+	s := &natsSink{
+		addr:    u.Host,
+		subject: strings.Trim(u.Path, "/"),
+		queue:   make(chan []byte, sinkQueueSize),
+		done:    make(chan struct{}),
+	}
+	if u.Port() == "" {
+		s.addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	if s.subject == "" {
+		s.subject = defaultSinkSubject
+	}
+	if strings.ContainsAny(s.subject, " \t\r\n/") {
+		return nil, fmt.Errorf("invalid sink subject %q: must not hold whitespace or slashes", s.subject)
+	}
+
+	options := map[string]interface{}{"verbose": false, "pedantic": false, "name": "aws-iam-keys-finder", "lang": "go", "version": scannerVersion()}
+	if u.User != nil {
+		password, ok := u.User.Password()
+		if ok {
+			options["user"], options["pass"] = u.User.Username(), password
+			logScrubber.add(password)
+		} else {
+			options["auth_token"] = u.User.Username()
+			logScrubber.add(u.User.Username())
+		}
+	}
+	connect, err := json.Marshal(options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode NATS connect options: %v", err)
+	}
+	s.connect = "CONNECT " + string(connect) + "\r\n"
+
+	if err := s.dial(); err != nil {
+		return nil, err
+	}
+	go s.run()
+
+	return s, nil
+}
+
+// dial connects to the server, and waits for it to confirm the connection, so bad credentials are
+// reported rather than every finding silently dropped.
+func (s *natsSink) dial() error {
+	conn, err := net.DialTimeout("tcp", s.addr, sinkTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to NATS at %s: %v", s.addr, err)
+	}
+	conn.SetDeadline(time.Now().Add(sinkTimeout))
+	r := bufio.NewReader(conn)
+
+	line, err := r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return fmt.Errorf("failed to connect to NATS at %s: no INFO from the server", s.addr)
+	}
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to parse NATS server INFO: %v", err)
+	}
+	if info.TLSRequired {
+		conn.Close()
+		return fmt.Errorf("NATS server at %s requires TLS, which the sink does not support", s.addr)
+	}
+
+	if _, err := conn.Write([]byte(s.connect + "PING\r\n")); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to connect to NATS at %s: %v", s.addr, err)
+	}
+	if line, err = r.ReadString('\n'); err != nil || strings.TrimSpace(line) != "PONG" {
+		conn.Close()
+		return fmt.Errorf("NATS server at %s rejected the connection: %s", s.addr, strings.TrimSpace(line))
+	}
+	conn.SetDeadline(time.Time{})
+
+	pong := make(chan struct{}, 1)
+	s.mu.Lock()
+	s.conn, s.w, s.pong = conn, bufio.NewWriter(conn), pong
+	s.mu.Unlock()
+	go s.read(conn, r, pong)
+
+	return nil
+}
+
+// read answers the pings of the server on conn, which it sends to tell live clients from dead ones,
+// signals its pongs on pong and logs its errors, until the connection is closed.
+func (s *natsSink) read(conn net.Conn, r *bufio.Reader, pong chan struct{}) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		switch line = strings.TrimSpace(line); {
+		case line == "PING":
+			s.mu.Lock()
+			if s.conn == conn {
+				s.w.WriteString("PONG\r\n")
+				s.w.Flush()
+			}
+			s.mu.Unlock()
+		case line == "PONG":
+			select {
+			case pong <- struct{}{}:
+			default:
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			log.Printf("Warning: NATS sink error: %s", logScrubber.scrub(line))
+		}
+	}
+}
+
+// publish queues the finding, dropping it when the queue is full.
+func (s *natsSink) publish(f Finding) {
+	msg, err := json.Marshal(sinkMessage{plainFinding(f), f.fingerprint(), redact(f.SecretAccessKey)})
+	if err != nil {
+		log.Printf("Warning: failed to encode finding for the sink: %v", err)
+		return
+	}
+
+	select {
+	case s.queue <- msg:
+	default:
+		s.mu.Lock()
+		s.dropped++
+		s.mu.Unlock()
+	}
+}
+
+// run publishes the queued findings until the sink is closed.
+func (s *natsSink) run() {
+	defer close(s.done)
+	for msg := range s.queue {
+		if err := s.send(msg); err != nil {
+			log.Printf("Warning: %v; finding not published", err)
+			s.mu.Lock()
+			s.dropped++
+			s.mu.Unlock()
+		}
+	}
+}
+
+// send publishes a message, reconnecting once when the connection has been lost.
+func (s *natsSink) send(msg []byte) error {
+	err := s.write(msg)
+	if err == nil {
+		return nil
+	}
+
+	if dialErr := s.dial(); dialErr != nil {
+		return dialErr
+	}
+
+	return s.write(msg)
+}
+
+// write publishes a message on the current connection.
+func (s *natsSink) write(msg []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return fmt.Errorf("not connected to NATS at %s", s.addr)
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(sinkTimeout))
+	fmt.Fprintf(s.w, "PUB %s %d\r\n", s.subject, len(msg))
+	s.w.Write(msg)
+	s.w.WriteString("\r\n")
+	if err := s.w.Flush(); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return fmt.Errorf("failed to publish to NATS at %s: %v", s.addr, err)
+	}
+
+	return nil
+}
+
+// close waits for the queued findings to be published, and for the server to have received them,
+// for at most sinkDrainTimeout, then closes the connection and reports the findings dropped.
+func (s *natsSink) close() {
+	close(s.queue)
+	deadline := time.After(sinkDrainTimeout)
+	select {
+	case <-s.done:
+	case <-deadline:
+		log.Printf("Warning: timed out publishing findings to NATS at %s", s.addr)
+	}
+
+	s.mu.Lock()
+	conn, pong := s.conn, s.pong
+	if conn != nil {
+		s.w.WriteString("PING\r\n")
+		s.w.Flush()
+	}
+	s.mu.Unlock()
+	if conn != nil {
+		// The server answers in order, so its pong follows every message published before the ping
+		select {
+		case <-pong:
+		case <-deadline:
+		}
+		conn.Close()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dropped > 0 {
+		log.Printf("Warning: %d findings were not published to NATS at %s", s.dropped, s.addr)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// natsMessage is a message published to the NATS stub.
+type natsMessage struct {
+	subject string
+	payload []byte
+}
+
+// natsStub is a NATS server speaking enough of the client protocol for the sink: it sends its INFO,
+// answers pings, unless it rejects the connection, and records the CONNECT options and messages.
+type natsStub struct {
+	addr string
+	info string
+	// reject answers the ping confirming the connection with an authorization error.
+	reject bool
+
+	mu       sync.Mutex
+	connects []map[string]interface{}
+	messages []natsMessage
+}
+
+// newNATSStub starts a NATS stub sending the INFO, closed when the test ends.
+func newNATSStub(t *testing.T, info string) *natsStub {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	stub := &natsStub{addr: ln.Addr().String(), info: info}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go stub.serve(conn)
+		}
+	}()
+
+	return stub
+}
+
+// serve speaks the protocol on one connection until it is closed.
+func (s *natsStub) serve(conn net.Conn) {
+	defer conn.Close()
+	fmt.Fprintf(conn, "INFO %s\r\n", s.info)
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		switch fields := strings.Fields(line); {
+		case len(fields) == 0:
+		case fields[0] == "CONNECT":
+			var options map[string]interface{}
+			json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(line), "CONNECT ")), &options)
+			s.mu.Lock()
+			s.connects = append(s.connects, options)
+			s.mu.Unlock()
+		case fields[0] == "PING" && s.reject:
+			io.WriteString(conn, "-ERR 'Authorization Violation'\r\n")
+			return
+		case fields[0] == "PING":
+			io.WriteString(conn, "PONG\r\n")
+		case fields[0] == "PUB" && len(fields) == 3:
+			n, _ := strconv.Atoi(fields[2])
+			payload := make([]byte, n+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, natsMessage{subject: fields[1], payload: payload[:n]})
+			s.mu.Unlock()
+		}
+	}
+}
+
+// published returns the messages published so far.
+func (s *natsStub) published() []natsMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]natsMessage(nil), s.messages...)
+}
+
+func TestSinkPublishesFindings(t *testing.T) {
+	withRedactFormat(t, redactPartial)
+	stub := newNATSStub(t, `{"server_id":"stub","max_payload":1048576}`)
+	sink, err := newSink("nats://scanner:s3cretpass@" + stub.addr + "/security.findings")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	findings := []Finding{
+		newFinding("abc123", "a.env", keyMatch{AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey}),
+		newFinding("abc123", "b.env", keyMatch{AccessKeyID: testAccessKeyID2, SecretAccessKey: testSecretAccessKey2}),
+		newFinding("def456", "c.env", keyMatch{AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey}),
+	}
+	for _, f := range findings {
+		sink.publish(f)
+	}
+	sink.close()
+
+	messages := stub.published()
+	if len(messages) != len(findings) {
+		t.Fatalf("got %d messages, want one per finding", len(messages))
+	}
+	for i, msg := range messages {
+		if msg.subject != "security.findings" {
+			t.Errorf("message %d: got subject %q", i, msg.subject)
+		}
+		if strings.Contains(string(msg.payload), findings[i].SecretAccessKey) {
+			t.Errorf("message %d: got the secret in %s", i, msg.payload)
+		}
+		var got struct {
+			File        string `json:"file"`
+			AccessKeyID string `json:"access_key_id"`
+			Fingerprint string `json:"fingerprint"`
+			Secret      string `json:"secret"`
+		}
+		if err := json.Unmarshal(msg.payload, &got); err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		if got.File != findings[i].File || got.AccessKeyID != findings[i].AccessKeyID || got.Fingerprint != findings[i].fingerprint() || got.Secret != redact(findings[i].SecretAccessKey) {
+			t.Errorf("message %d: got %+v, want finding %s with its fingerprint and redacted secret", i, got, findings[i].File)
+		}
+	}
+
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if len(stub.connects) != 1 || stub.connects[0]["user"] != "scanner" || stub.connects[0]["pass"] != "s3cretpass" || stub.connects[0]["verbose"] != false {
+		t.Errorf("got connects %v, want one with the user and password", stub.connects)
+	}
+}
+
+func TestSinkDefaults(t *testing.T) {
+	stub := newNATSStub(t, `{}`)
+	sink, err := newSink("nats://ghp_sinktoken@" + stub.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.publish(newFinding("", "a.env", keyMatch{AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey}))
+	sink.close()
+
+	if messages := stub.published(); len(messages) != 1 || messages[0].subject != defaultSinkSubject {
+		t.Errorf("got messages %v, want one on %s", messages, defaultSinkSubject)
+	}
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if stub.connects[0]["auth_token"] != "ghp_sinktoken" {
+		t.Errorf("got connect %v, want the user sent as a token", stub.connects[0])
+	}
+}
+
+func TestSinkDropsFindingsWhenFull(t *testing.T) {
+	// Nothing publishes from the queue, as if the server were too slow
+	sink := &natsSink{addr: "127.0.0.1:4222", queue: make(chan []byte, 1)}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 3; i++ {
+			sink.publish(newFinding("", "a.env", keyMatch{AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey}))
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("got publish blocked on a full queue")
+	}
+	if sink.dropped != 2 {
+		t.Errorf("got %d findings dropped, want 2", sink.dropped)
+	}
+}
+
+func TestNewSinkInvalid(t *testing.T) {
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closed.Close()
+	rejecting := newNATSStub(t, `{}`)
+	rejecting.reject = true
+
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"kafka://broker:9092/findings", "Kafka is not supported"},
+		{"http://localhost:4222", "must be nats://host:port/subject"},
+		{"nats:///findings", "must be nats://host:port/subject"},
+		{"nats://localhost:4222/a%20b", "must not hold whitespace or slashes"},
+		{"nats://" + closed.Addr().String(), "failed to connect to NATS"},
+		{"nats://" + newNATSStub(t, `{"tls_required":true}`).addr, "requires TLS"},
+		{"nats://" + newNATSStub(t, `not json`).addr, "failed to parse NATS server INFO"},
+		{"nats://" + rejecting.addr, "rejected the connection: -ERR 'Authorization Violation'"},
+	}
+	for _, tt := range tests {
+		if _, err := newSink(tt.target); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want %q", tt.target, err, tt.want)
+		}
+	}
+}
+
+func TestCLISink(t *testing.T) {
+	stub := newNATSStub(t, `{}`)
+	repo := newFixtureRepo(t)
+	repo.commit("add key", map[string]string{"config.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+
+	res := runScanner(t, "-no-validate", "-repo", repo.dir, "-sink", "nats://"+stub.addr+"/ci.findings")
+	if res.code != exitKeysFound {
+		t.Errorf("got exit code %d, want %d\n%s", res.code, exitKeysFound, res.stderr)
+	}
+	messages := stub.published()
+	if len(messages) != 1 || messages[0].subject != "ci.findings" || !strings.Contains(string(messages[0].payload), `"file":"config.env"`) {
+		t.Errorf("got messages %v, want the finding published", messages)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// walkedFile is a file to search, with the repository relative path it is found and reported under.
+type walkedFile struct {
+	path, relPath string
+	info          os.FileInfo
+}
+
+// walkFiles stats the files listed under repoPath. Symlinks are skipped and counted in stats, unless
+// opts follows them, in which case those resolving inside the repository are replaced by the file or
+// the files of the directory they point to, found under the path of the link. Symlinks pointing
+// outside the repository, broken ones and ones leading back into a directory already walked, which
+// would otherwise loop forever, are always skipped. Directories and deleted files are left out.
+func walkFiles(repoPath string, relPaths []string, opts walkOptions, stats *ScanStats) ([]walkedFile, error) {
+	root, err := filepath.EvalSymlinks(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %v", repoPath, err)
+	}
+	visited := map[string]bool{root: true}
+
+	var files []walkedFile
+	var walk func(relPath string, listed bool) error
+	walk = func(relPath string, listed bool) error {
+		path := filepath.Join(repoPath, filepath.FromSlash(relPath))
+
+		// Skip directories such as submodules, and tracked files deleted from the working tree
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			stats.FilesSeen++
+			return opts.unreadable(fmt.Errorf("failed to stat file %s: %v", relPath, err), stats)
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			switch {
+			case !info.IsDir():
+				files = append(files, walkedFile{path: path, relPath: relPath, info: info})
+			case !listed:
+				return walkDir(relPath, path, walk, opts, stats)
+			}
+			return nil
+		}
+
+		target, err := filepath.EvalSymlinks(path)
+		if !opts.FollowSymlinks || err != nil || !withinDir(root, target) || visited[target] {
+			stats.FilesSeen++
+			stats.SkippedSymlinks++
+			return nil
+		}
+
+		if info, err = os.Stat(path); err != nil {
+			stats.FilesSeen++
+			return opts.unreadable(fmt.Errorf("failed to stat file %s: %v", relPath, err), stats)
+		}
+		if !info.IsDir() {
+			files = append(files, walkedFile{path: path, relPath: relPath, info: info})
+			return nil
+		}
+		visited[target] = true
+
+		return walkDir(relPath, path, walk, opts, stats)
+	}
+
+	for _, relPath := range relPaths {
+		if err := walk(relPath, true); err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// walkDir walks every entry of the directory at path, reached through a symlink at relPath, except
+// the .git directory.
+func walkDir(relPath, path string, walk func(relPath string, listed bool) error, opts walkOptions, stats *ScanStats) error {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		// The directory is counted as seen like an unreadable file, so scanned and skipped add up to seen
+		stats.FilesSeen++
+		return opts.unreadable(fmt.Errorf("failed to read directory %s: %v", relPath, err), stats)
+	}
+
+	for _, entry := range entries {
+		if entry.Name() == ".git" {
+			continue
+		}
+		if err := walk(relPath+"/"+entry.Name(), false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// withinDir reports whether path is dir or inside it. Both must be resolved.
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
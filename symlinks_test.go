@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// symlinkFixture commits a repository holding a key in real/creds.env, a symlink to it, symlinks
+// forming cycles, a broken symlink, and a symlink to a file with another key outside the repository.
+func symlinkFixture(t *testing.T) *fixtureRepo {
+	t.Helper()
+
+	outside := filepath.Join(t.TempDir(), "outside.env")
+	if err := ioutil.WriteFile(outside, []byte(keyFile(testAccessKeyID2, testSecretAccessKey2)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := newFixtureRepo(t)
+	repo.write(map[string]string{"real/creds.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+	for link, target := range map[string]string{
+		"linked.env":  "real/creds.env",
+		"loop":        ".",
+		"real/parent": "..",
+		"real/sub":    "../real",
+		"escape.env":  outside,
+		"escape-dir":  filepath.Dir(outside),
+		"broken.env":  "missing.env",
+	} {
+		if err := os.Symlink(target, filepath.Join(repo.dir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repo.commit("add symlinks", nil)
+
+	return repo
+}
+
+func TestWalkFilesSymlinks(t *testing.T) {
+	repo := symlinkFixture(t)
+	listed := []string{"broken.env", "escape-dir", "escape.env", "linked.env", "loop", "real/creds.env", "real/parent", "real/sub"}
+
+	tests := []struct {
+		follow  bool
+		files   []string
+		skipped int
+	}{
+		{false, []string{"real/creds.env"}, 7},
+		// Links back into a directory already walked, such as the root, are skipped rather than looped through
+		{true, []string{"linked.env", "real/creds.env", "real/sub/creds.env"}, 7},
+	}
+
+	for _, tt := range tests {
+		walk, err := ScanOptions{FollowSymlinks: tt.follow}.walkOptions()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		done := make(chan struct{})
+		var files []walkedFile
+		stats := &ScanStats{}
+		go func() {
+			defer close(done)
+			files, err = walkFiles(repo.dir, listed, walk, stats)
+		}()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("follow %v: walk did not finish, want symlink cycles detected", tt.follow)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		for _, f := range files {
+			got = append(got, f.relPath)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.files) {
+			t.Errorf("follow %v: got files %v, want %v", tt.follow, got, tt.files)
+		}
+		if stats.SkippedSymlinks != tt.skipped {
+			t.Errorf("follow %v: got %d symlinks skipped, want %d", tt.follow, stats.SkippedSymlinks, tt.skipped)
+		}
+	}
+}
+
+func TestScanSkipsSymlinksOutsideRepository(t *testing.T) {
+	repo := symlinkFixture(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, follow := range []bool{false, true} {
+		result, err := ScanPath(ctx, repo.dir, ScanOptions{NoValidate: true, FollowSymlinks: follow})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range result.Findings {
+			if f.AccessKeyID == testAccessKeyID2 {
+				t.Errorf("follow %v: got the key outside the repository scanned in %s", follow, f.File)
+			}
+		}
+		if len(result.Findings) == 0 {
+			t.Errorf("follow %v: got no findings, want the key of real/creds.env", follow)
+		}
+	}
+}
+
+func TestWalkDirCountsUnreadableDirectoryAsSeen(t *testing.T) {
+	captureLog(t)
+	walk, err := ScanOptions{FollowSymlinks: true}.walkOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A directory that cannot be listed, here because it is gone, is skipped as unreadable
+	stats := &ScanStats{}
+	if err := walkDir("linked-dir", filepath.Join(t.TempDir(), "missing"), nil, walk, stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.SkippedUnreadable != 1 || stats.FilesSeen != 1 {
+		t.Errorf("got %d seen and %d skipped as unreadable, want the directory counted in both", stats.FilesSeen, stats.SkippedUnreadable)
+	}
+}
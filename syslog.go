@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// syslogFacility is the facility findings are logged under: security/authorization messages.
+const syslogFacility = 4
+
+// syslogEnterpriseID qualifies the structured data ID of findings, as RFC 5424 requires of custom IDs.
+const syslogEnterpriseID = "32473"
+
+// syslogLocalSockets are the sockets of the local syslog daemon, tried in order.
+var syslogLocalSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// syslogSeverities maps finding severities to syslog severities: critical, error, warning, notice
+// and informational.
+var syslogSeverities = map[string]int{
+	severityCritical: 2,
+	severityHigh:     3,
+	severityMedium:   4,
+	severityLow:      5,
+	severityInfo:     6,
+}
+
+// syslogWriter sends findings to a syslog daemon as RFC 5424 messages. It is safe for concurrent use.
+type syslogWriter struct {
+	mu       sync.Mutex
+	network  string
+	addr     string
+	conn     net.Conn
+	hostname string
+	app      string
+}
+
+// newSyslogWriter connects to the syslog daemon at target: "local" for the daemon of this host, or a
+// udp://host:port or tcp://host:port URL. The port defaults to 514.
+func newSyslogWriter(target string) (*syslogWriter, error) {
+	w := &syslogWriter{app: filepath.Base(os.Args[0])}
+	w.hostname, _ = os.Hostname()
+	if w.hostname == "" {
+		w.hostname = "-"
+	}
+
+	if target == "local" {
+		var err error
+		for _, socket := range syslogLocalSockets {
+			for _, network := range []string{"unixgram", "unix"} {
+				if w.conn, err = net.Dial(network, socket); err == nil {
+					w.network, w.addr = network, socket
+					return w, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("failed to connect to the local syslog daemon: %v", err)
+	}
+
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid syslog address %q: must be local, udp://host:port or tcp://host:port", target)
+	}
+	w.network, w.addr = u.Scheme, u.Host
+	if u.Port() == "" {
+		w.addr = net.JoinHostPort(u.Hostname(), "514")
+	}
+
+	if w.conn, err = net.Dial(w.network, w.addr); err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog at %s: %v", target, err)
+	}
+
+	return w, nil
+}
+
+// syslogValue escapes a structured data parameter value.
+func syslogValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
+
+// message formats the finding as an RFC 5424 message. The finding's fields are structured data, and
+// the secret is redacted.
+func (w *syslogWriter) message(f Finding, now time.Time) string {
+	severity, ok := syslogSeverities[f.Severity]
+	if !ok {
+		severity = syslogSeverities[severityMedium]
+	}
+
+	params := []struct{ name, value string }{
+		{"rule", f.Rule},
+		{"status", f.Status},
+		{"severity", f.Severity},
+		{"confidence", f.Confidence},
+		{"repo", f.Repo},
+		{"commit", f.Commit},
+		{"file", f.File},
+		{"line", strconv.Itoa(f.Line)},
+		{"resource", joinPath(f.Resource, f.Attribute)},
+		{"source", f.Source},
+		{"access_key_id", f.AccessKeyID},
+		{"secret", redact(f.SecretAccessKey)},
+		{"allowed", strconv.FormatBool(f.Allowed)},
+	}
+	var data strings.Builder
+	data.WriteString("[finding@" + syslogEnterpriseID)
+	for _, param := range params {
+		if param.value != "" {
+			fmt.Fprintf(&data, ` %s="%s"`, param.name, syslogValue(param.value))
+		}
+	}
+	data.WriteString("]")
+
+	text := fmt.Sprintf("%s finding of rule %s %s", f.Status, f.Rule, f.where())
+	if f.AccessKeyID != "" {
+		text = fmt.Sprintf("%s key %s %s", f.Status, f.AccessKeyID, f.where())
+	}
+
+	return fmt.Sprintf("<%d>1 %s %s %s %d finding %s %s", syslogFacility*8+severity, now.UTC().Format(time.RFC3339Nano),
+		w.hostname, w.app, os.Getpid(), data.String(), logScrubber.scrub(text))
+}
+
+// write sends the finding, reconnecting once when a stream connection has been closed. TCP messages
+// are framed by octet counting as RFC 6587 describes, and local stream messages end with a newline.
+func (w *syslogWriter) write(f Finding) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	msg := w.message(f, time.Now())
+	switch w.network {
+	case "tcp":
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	case "unix":
+		msg += "\n"
+	}
+
+	_, err := w.conn.Write([]byte(msg))
+	if err != nil && w.network != "udp" && w.network != "unixgram" {
+		conn, dialErr := net.Dial(w.network, w.addr)
+		if err = dialErr; err == nil {
+			w.conn.Close()
+			w.conn = conn
+			_, err = w.conn.Write([]byte(msg))
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write to syslog: %v", err)
+	}
+
+	return nil
+}
+
+// close closes the connection to the syslog daemon.
+func (w *syslogWriter) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.conn.Close()
+}
+
+// writeSyslog sends every finding of the result to syslog.
+func writeSyslog(target string, result *ScanResult) error {
+	w, err := newSyslogWriter(target)
+	if err != nil {
+		return err
+	}
+	defer w.close()
+
+	for _, f := range result.Findings {
+		if err := w.write(f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// listenSyslogUDP starts a UDP listener standing in for a syslog daemon, returning its udp:// URL and
+// a function receiving the next message.
+func listenSyslogUDP(t *testing.T) (string, func() string) {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	receive := func() string {
+		t.Helper()
+		buf := make([]byte, 64<<10)
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("no syslog message received: %v", err)
+		}
+		return string(buf[:n])
+	}
+
+	return "udp://" + conn.LocalAddr().String(), receive
+}
+
+// syslogHeader matches the header of an RFC 5424 message up to its structured data.
+var syslogHeader = regexp.MustCompile(`^<([0-9]+)>1 [0-9T:.\-]+Z \S+ \S+ [0-9]+ finding \[finding@` + syslogEnterpriseID + ` `)
+
+func TestWriteSyslogUDP(t *testing.T) {
+	target, receive := listenSyslogUDP(t)
+	result := &ScanResult{Findings: []Finding{{
+		Repo: "https://github.com/acme/app", Commit: "0123456", File: "config.env", Line: 3, Rule: ruleAWSLabelled,
+		AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey, Status: statusValid, Severity: severityCritical,
+	}}}
+
+	if err := writeSyslog(target, result); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := receive()
+	header := syslogHeader.FindStringSubmatch(msg)
+	if header == nil {
+		t.Fatalf("got message %q, want an RFC 5424 finding", msg)
+	}
+	if pri, _ := strconv.Atoi(header[1]); pri != syslogFacility*8+2 {
+		t.Errorf("got priority %d, want security facility at critical severity", pri)
+	}
+	for _, want := range []string{`status="valid"`, `file="config.env"`, `line="3"`, `access_key_id="` + testAccessKeyID + `"`, `secret="` + redact(testSecretAccessKey) + `"`} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("got message %q, want it to hold %s", msg, want)
+		}
+	}
+	if strings.Contains(msg, testSecretAccessKey) {
+		t.Errorf("got message %q holding the secret", msg)
+	}
+}
+
+func TestSyslogMessageSeverityAndEscaping(t *testing.T) {
+	w := &syslogWriter{hostname: "host", app: "scanner"}
+	msg := w.message(Finding{File: `a"b].env`, Rule: "custom", SecretAccessKey: "s3cr3t-value", Status: statusUnverified, Severity: severityLow}, time.Unix(0, 0))
+
+	if !strings.HasPrefix(msg, "<37>1 1970-01-01T00:00:00Z host scanner ") {
+		t.Errorf("got message %q, want notice severity", msg)
+	}
+	if !strings.Contains(msg, `file="a\"b\].env"`) {
+		t.Errorf("got message %q, want the file name escaped", msg)
+	}
+}
+
+func TestSyslogWriterConcurrentTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	const count = 50
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- nil
+			return
+		}
+		defer conn.Close()
+
+		// Every message is framed by its length, so interleaved writes would break the framing
+		var msgs []string
+		r := bufio.NewReader(conn)
+		for len(msgs) < count {
+			var n int
+			if _, err := fmt.Fscanf(r, "%d ", &n); err != nil {
+				break
+			}
+			buf := make([]byte, n)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				break
+			}
+			msgs = append(msgs, string(buf))
+		}
+		received <- msgs
+	}()
+
+	w, err := newSyslogWriter("tcp://" + listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := w.write(Finding{File: fmt.Sprintf("f%d.env", i), Rule: ruleAWSLabelled, AccessKeyID: testAccessKeyID}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	w.close()
+
+	msgs := <-received
+	if len(msgs) != count {
+		t.Fatalf("got %d messages, want %d", len(msgs), count)
+	}
+	for _, msg := range msgs {
+		if !syslogHeader.MatchString(msg) {
+			t.Errorf("got message %q, want an RFC 5424 finding", msg)
+		}
+	}
+}
+
+func TestNewSyslogWriterInvalid(t *testing.T) {
+	for _, target := range []string{"syslog.example.com", "http://syslog.example.com", "udp://"} {
+		if _, err := newSyslogWriter(target); err == nil || !strings.Contains(err.Error(), "invalid syslog address") {
+			t.Errorf("%s: got error %v, want an invalid address", target, err)
+		}
+	}
+}
+
+func TestCLISyslog(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("add key", map[string]string{"config.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+	target, receive := listenSyslogUDP(t)
+
+	got := runScanner(t, "-repo", repo.dir, "-no-validate", "-syslog", target)
+	if got.code != exitKeysFound {
+		t.Errorf("got exit code %d, want %d; stderr:\n%s", got.code, exitKeysFound, got.stderr)
+	}
+	if msg := receive(); !strings.Contains(msg, "unverified key "+testAccessKeyID) || !strings.Contains(msg, `file="config.env"`) {
+		t.Errorf("got message %q, want the finding in config.env", msg)
+	}
+}
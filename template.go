@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// templateFinding is the data a -template is rendered with for every finding. The secret is always
+// redacted so templates cannot leak it.
+type templateFinding struct {
+	Commit      string
+	File        string
+	Line        int
+	Cell        int
+	Resource    string
+	Attribute   string
+	SecretFile  string
+	Encoding    string
+	RuleName    string
+	Source      string
+	Ref         string
+	AccessKeyID string
+	Secret      string
+	KeyType     string
+	Confidence  string
+	Status      string
+	Severity    string
+	Signature   string
+	AtHead      string
+	Permalink   string
+	Remediation string
+	Exposure    string
+	// Owner is the IAM user of the key, found with -enrichment-profiles, or nil.
+	Owner   *KeyOwner
+	Allowed bool
+	// Synthetic marks test-only findings injected by -inject-findings.
+	Synthetic bool
+	Error     string
+	// Location is the human readable location used by the default output, e.g. "in commit X at file:line".
+	Location string
+}
+
+// newTemplateFinding returns the template data of the finding.
+func newTemplateFinding(f Finding) templateFinding {
+	return templateFinding{
+		Commit:      f.Commit,
+		File:        f.File,
+		Line:        f.Line,
+		Cell:        f.Cell,
+		Resource:    f.Resource,
+		Attribute:   f.Attribute,
+		SecretFile:  f.SecretFile,
+		Encoding:    f.Encoding,
+		RuleName:    f.Rule,
+		Source:      f.Source,
+		Ref:         f.Ref,
+		AccessKeyID: f.AccessKeyID,
+		Secret:      redact(f.SecretAccessKey),
+		KeyType:     f.KeyType.Name,
+		Confidence:  f.Confidence,
+		Status:      f.Status,
+		Severity:    f.Severity,
+		Signature:   f.Signature,
+		AtHead:      f.AtHead,
+		Permalink:   f.Permalink,
+		Remediation: f.Remediation,
+		Exposure:    f.Exposure,
+		Owner:       f.Owner,
+		Allowed:     f.Allowed,
+		Synthetic:   f.Synthetic,
+		Error:       f.Error,
+		Location:    f.where(),
+	}
+}
+
+// parseFindingTemplate parses the text template given to -template.
+func parseFindingTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("finding").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %v", err)
+	}
+
+	return tmpl, nil
+}
+
+// printTemplate renders every finding of the result through the template, one finding per line.
+func printTemplate(w io.Writer, tmpl *template.Template, result *ScanResult) error {
+	for _, f := range result.Findings {
+		var out strings.Builder
+		if err := tmpl.Execute(&out, newTemplateFinding(f)); err != nil {
+			return fmt.Errorf("failed to render template: %v", err)
+		}
+
+		line := out.String()
+		if !strings.HasSuffix(line, "\n") {
+			line += "\n"
+		}
+		if _, err := io.WriteString(w, line); err != nil {
+			return fmt.Errorf("failed to write output: %v", err)
+		}
+	}
+
+	return nil
+}
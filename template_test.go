@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPrintTemplate(t *testing.T) {
+	tmpl, err := parseFindingTemplate(`{{.File}}:{{.Line}} {{.RuleName}} {{.AccessKeyID}} {{.Status}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := &ScanResult{Findings: []Finding{
+		{File: "config.env", Line: 2, Rule: ruleAWSLabelled, AccessKeyID: testAccessKeyID, Status: statusValid},
+		{File: "app.py", Line: 10, Rule: ruleAWSAccessKeyID, AccessKeyID: testAccessKeyID2, Status: statusSkipped},
+	}}
+
+	var out bytes.Buffer
+	if err := printTemplate(&out, tmpl, result); err != nil {
+		t.Fatal(err)
+	}
+	want := "config.env:2 aws-labelled-key " + testAccessKeyID + " valid\napp.py:10 aws-access-key-id " + testAccessKeyID2 + " skipped\n"
+	if out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestTemplateRedactsSecret(t *testing.T) {
+	tmpl, err := parseFindingTemplate("{{.Secret}}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	printTemplate(&out, tmpl, &ScanResult{Findings: []Finding{{SecretAccessKey: testSecretAccessKey}}})
+	if strings.Contains(out.String(), testSecretAccessKey) || out.String() != redact(testSecretAccessKey)+"\n" {
+		t.Errorf("got %q, want the redacted secret", out.String())
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	if _, err := parseFindingTemplate("{{.File"); err == nil || !strings.HasPrefix(err.Error(), "invalid template") {
+		t.Errorf("got %v, want a parse error", err)
+	}
+
+	tmpl, err := parseFindingTemplate("{{.NoSuchField}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := printTemplate(&bytes.Buffer{}, tmpl, &ScanResult{Findings: []Finding{{}}}); err == nil {
+		t.Error("unknown field rendered without an error")
+	}
+}
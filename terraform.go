@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ruleTerraformState names the rule that reads the attributes of the resources in Terraform state
+// and plan JSON files.
+const ruleTerraformState = "terraform-state"
+
+// credentialAttributePattern matches the names of attributes that hold credentials, e.g. secret,
+// secret_key, password or private_key_pem, but not the IDs, ARNs or names of secrets.
+var credentialAttributePattern = regexp.MustCompile(`(?i)(secret|password|passwd|token|private_key|access_key)`)
+
+// nonCredentialSuffixes are attribute name endings naming something about a credential rather than the credential.
+var nonCredentialSuffixes = []string{"_id", "_arn", "_name", "_version", "_length", "_type", "_expiry", "_expiration"}
+
+// terraformWrappers are the keys of state and plan JSON that hold attributes without being part of
+// their path, e.g. the "values" of a planned resource or the "after" of a resource change.
+var terraformWrappers = map[string]bool{
+	"attributes":     true,
+	"values":         true,
+	"change":         true,
+	"before":         true,
+	"after":          true,
+	"expressions":    true,
+	"constant_value": true,
+}
+
+// isTerraformState reports whether the file is Terraform state, or a plan written with terraform show -json.
+func isTerraformState(path string, content []byte) bool {
+	name := strings.ToLower(filepath.Base(path))
+	if strings.HasSuffix(name, ".tfstate") || strings.HasSuffix(name, ".tfstate.backup") {
+		return true
+	}
+
+	return strings.HasSuffix(name, ".json") && bytes.Contains(content, []byte(`"terraform_version"`))
+}
+
+// terraformValue is a string attribute of a resource, at a dotted path such as "secret" or
+// "connection.password".
+type terraformValue struct {
+	path, value string
+}
+
+// terraformResources collects the string attributes of every resource instance by address.
+type terraformResources struct {
+	values map[string][]terraformValue
+	order  []string
+}
+
+// add records a value of the resource at the given address, once.
+func (r *terraformResources) add(address string, value terraformValue) {
+	if _, ok := r.values[address]; !ok {
+		r.order = append(r.order, address)
+	}
+	for _, existing := range r.values[address] {
+		if existing == value {
+			return
+		}
+	}
+	r.values[address] = append(r.values[address], value)
+}
+
+// walk records the string values under node. State resources and planned resources set the address
+// their attributes are recorded under.
+func (r *terraformResources) walk(node interface{}, address, path string) {
+	switch node := node.(type) {
+	case map[string]interface{}:
+		if instances, ok := node["instances"].([]interface{}); ok {
+			resource := stateAddress(node)
+			for _, instance := range instances {
+				if instance, ok := instance.(map[string]interface{}); ok {
+					r.walk(instance["attributes"], resource+indexSuffix(instance["index_key"]), "")
+				}
+			}
+			return
+		}
+		if planned, ok := node["address"].(string); ok {
+			address, path = planned, ""
+		}
+
+		keys := make([]string, 0, len(node))
+		for key := range node {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			child := path
+			if !terraformWrappers[key] {
+				child = joinPath(path, key)
+			}
+			r.walk(node[key], address, child)
+		}
+	case []interface{}:
+		for i, item := range node {
+			r.walk(item, address, fmt.Sprintf("%s[%d]", path, i))
+		}
+	case string:
+		if node != "" {
+			r.add(address, terraformValue{path: path, value: node})
+		}
+	}
+}
+
+// stateAddress returns the address of a resource in Terraform state, e.g. module.ci.aws_iam_access_key.deploy.
+func stateAddress(resource map[string]interface{}) string {
+	typ, _ := resource["type"].(string)
+	name, _ := resource["name"].(string)
+	address := typ + "." + name
+	if mode, _ := resource["mode"].(string); mode == "data" {
+		address = "data." + address
+	}
+	if module, _ := resource["module"].(string); module != "" {
+		address = module + "." + address
+	}
+
+	return address
+}
+
+// indexSuffix returns the address suffix of a resource instance created with count or for_each.
+func indexSuffix(key interface{}) string {
+	switch key := key.(type) {
+	case float64:
+		return fmt.Sprintf("[%d]", int(key))
+	case string:
+		return fmt.Sprintf("[%q]", key)
+	default:
+		return ""
+	}
+}
+
+// joinPath appends a key to a dotted attribute path.
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+// isCredentialAttribute reports whether the last key of the attribute path names a credential.
+func isCredentialAttribute(path string) bool {
+	name := strings.ToLower(path[strings.LastIndex(path, ".")+1:])
+	if i := strings.Index(name, "["); i >= 0 {
+		name = name[:i]
+	}
+	for _, suffix := range nonCredentialSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return false
+		}
+	}
+
+	return credentialAttributePattern.MatchString(name)
+}
+
+// searchTerraformState reports the credentials in the resources of Terraform state or plan JSON:
+// AWS access key IDs paired with the secret of the same resource, and the values of other
+// credential attributes. Matches carry the resource address and attribute path. It returns false
+// when the content is not JSON, so it can be searched as is.
+func searchTerraformState(content []byte) ([]keyMatch, bool) {
+	var document interface{}
+	if err := json.Unmarshal(content, &document); err != nil {
+		return nil, false
+	}
+
+	resources := &terraformResources{values: make(map[string][]terraformValue)}
+	resources.walk(document, "", "")
+
+	var matches []keyMatch
+	for _, address := range resources.order {
+		var ids, secrets []terraformValue
+		for _, value := range resources.values[address] {
+			switch {
+			case accessKeyIDShape.MatchString(value.value):
+				ids = append(ids, value)
+			case isCredentialAttribute(value.path):
+				secrets = append(secrets, value)
+			}
+		}
+
+		// Pair every access key ID with a secret of the same resource, preferring AWS-shaped ones
+		paired := make(map[int]bool)
+		for _, id := range ids {
+			match := keyMatch{AccessKeyID: id.value, Rule: ruleTerraformState, Line: valueLine(content, id.value), Resource: address, Attribute: id.path}
+			best := -1
+			for i, secret := range secrets {
+				if paired[i] {
+					continue
+				}
+				if best < 0 || (secretAccessKeyShape.MatchString(secret.value) && !secretAccessKeyShape.MatchString(secrets[best].value)) {
+					best = i
+				}
+			}
+			if best >= 0 {
+				paired[best] = true
+				match.SecretAccessKey = secrets[best].value
+				match.Attribute = secrets[best].path
+			}
+			matches = append(matches, match)
+		}
+
+		for i, secret := range secrets {
+			if paired[i] {
+				continue
+			}
+			matches = append(matches, keyMatch{
+				SecretAccessKey: secret.value,
+				Rule:            ruleTerraformState,
+				Line:            valueLine(content, secret.value),
+				Confidence:      confidenceMedium,
+				Resource:        address,
+				Attribute:       secret.path,
+			})
+		}
+	}
+
+	return matches, true
+}
+
+// valueLine returns the line of the first occurrence of the JSON string value in the content, or 1.
+func valueLine(content []byte, value string) int {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return 1
+	}
+	if i := bytes.Index(content, encoded); i >= 0 {
+		return lineNumber(content, i)
+	}
+
+	return 1
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// tfstateFixture is Terraform state with an access key of an IAM user, a provider configuration in a
+// module and a resource without credentials.
+const tfstateFixture = `{
+  "version": 4,
+  "terraform_version": "1.5.7",
+  "resources": [
+    {
+      "module": "module.ci",
+      "mode": "managed",
+      "type": "aws_iam_access_key",
+      "name": "deploy",
+      "instances": [
+        {
+          "attributes": {
+            "id": "` + testAccessKeyID + `",
+            "secret": "` + testSecretAccessKey + `",
+            "ses_smtp_password_v4": "BHZ4PB3Nq9u1S0zZgS4xnUiZER7aGHyRbhWZOFcy9w7o",
+            "user": "deploy"
+          }
+        }
+      ]
+    },
+    {
+      "mode": "managed",
+      "type": "aws_db_instance",
+      "name": "main",
+      "instances": [
+        {
+          "index_key": 0,
+          "attributes": {
+            "password": "hunter2-but-longer",
+            "password_length": "18",
+            "secret_arn": "arn:aws:secretsmanager:us-east-1:123456789012:secret:db"
+          }
+        }
+      ]
+    },
+    {
+      "mode": "managed",
+      "type": "aws_s3_bucket",
+      "name": "logs",
+      "instances": [{"attributes": {"bucket": "logs"}}]
+    }
+  ]
+}
+`
+
+func TestSearchTerraformState(t *testing.T) {
+	matches, ok := searchTerraformState([]byte(tfstateFixture))
+	if !ok {
+		t.Fatal("got not JSON, want the state searched")
+	}
+
+	want := []keyMatch{
+		{AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey, Rule: ruleTerraformState, Line: 13, Resource: "module.ci.aws_iam_access_key.deploy", Attribute: "secret"},
+		{SecretAccessKey: "BHZ4PB3Nq9u1S0zZgS4xnUiZER7aGHyRbhWZOFcy9w7o", Rule: ruleTerraformState, Line: 15, Confidence: confidenceMedium, Resource: "module.ci.aws_iam_access_key.deploy", Attribute: "ses_smtp_password_v4"},
+		{SecretAccessKey: "hunter2-but-longer", Rule: ruleTerraformState, Line: 29, Confidence: confidenceMedium, Resource: "aws_db_instance.main[0]", Attribute: "password"},
+	}
+	if len(matches) != len(want) {
+		t.Fatalf("got %d matches %+v, want %d", len(matches), matches, len(want))
+	}
+	for i := range want {
+		if matches[i] != want[i] {
+			t.Errorf("match %d: got %+v, want %+v", i, matches[i], want[i])
+		}
+	}
+}
+
+func TestSearchTerraformStateNotJSON(t *testing.T) {
+	if _, ok := searchTerraformState([]byte("terraform {\n}\n")); ok {
+		t.Error("got HCL searched as state, want it searched as is")
+	}
+}
+
+func TestScanFileTerraformState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "terraform.tfstate")
+	if err := ioutil.WriteFile(path, []byte(tfstateFixture), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := ScanFile(context.Background(), path, ScanOptions{NoValidate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found bool
+	for _, f := range result.Findings {
+		if f.AccessKeyID != testAccessKeyID {
+			continue
+		}
+		found = true
+		if f.Rule != ruleTerraformState || f.Resource != "module.ci.aws_iam_access_key.deploy" || f.Attribute != "secret" || f.SecretAccessKey != testSecretAccessKey {
+			t.Errorf("got finding %+v, want the secret of module.ci.aws_iam_access_key.deploy", f)
+		}
+	}
+	if !found {
+		t.Errorf("got findings %+v, want the access key of the state", result.Findings)
+	}
+}
+
+func TestIsCredentialAttribute(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"secret", true},
+		{"connection.password", true},
+		{"private_key_pem", true},
+		{"tokens[0]", true},
+		{"secret_arn", false},
+		{"kms_key_id", false},
+		{"password_length", false},
+		{"bucket", false},
+	}
+
+	for _, tt := range tests {
+		if got := isCredentialAttribute(tt.path); got != tt.want {
+			t.Errorf("isCredentialAttribute(%q): got %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// injectMixed is the -inject-status cycling synthetic findings through the valid, invalid and
+// unverified statuses.
+const injectMixed = "mixed"
+
+// hiddenFlags are test-only flags left out of the usage message and never set from the environment,
+// so synthetic findings are only ever reported when asked for on the command line.
+var hiddenFlags = map[string]bool{
+	"inject-findings": true,
+	"inject-status":   true,
+}
+
+// usage prints the usage message of the command line like the flag package does, without the hidden flags.
+func usage() {
+	visible := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	visible.SetOutput(flag.CommandLine.Output())
+	flag.VisitAll(func(f *flag.Flag) {
+		if !hiddenFlags[f.Name] {
+			visible.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
+	visible.PrintDefaults()
+}
+
+// InjectFindings returns a result of n synthetic findings with the given status, or cycling through
+// valid, invalid and unverified with mixed, without scanning or validating anything. The findings go
+// through severities, reports and exit codes like real ones, so integrations consuming the scanner's
+// output, such as SARIF uploads or alerts on live keys, can be tested without committing a secret.
+// They are marked synthetic in every output.
+func InjectFindings(n int, status string, opts ScanOptions) (*ScanResult, error) {
+	statuses := []string{status}
+	switch status {
+	case statusValid, statusInvalid, statusUnverified:
+	case injectMixed:
+		statuses = []string{statusValid, statusInvalid, statusUnverified}
+	default:
+		return nil, fmt.Errorf("invalid status %q for synthetic findings: must be valid, invalid, unverified or mixed", status)
+	}
+
+	started := time.Now()
+	findings := make([]Finding, 0, n)
+	for i := 1; i <= n; i++ {
+		// The key IDs have the shape of long-term keys so they are treated like them, but are never real
+		f := newFinding("", fmt.Sprintf("TEST-ONLY/synthetic-finding-%d.env", i), keyMatch{
+			AccessKeyID:     fmt.Sprintf("AKIATESTONLY%08d", i),
+			SecretAccessKey: fmt.Sprintf("TESTONLY/synthetic/not/a/secret/%08d", i),
+			Rule:            ruleAWSLabelled,
+			Line:            1,
+		})
+		f.Status = statuses[(i-1)%len(statuses)]
+		f.Synthetic = true
+		findings = append(findings, f)
+	}
+	assignSeverities(findings, nil)
+	assignRemediations(findings, nil)
+
+	result := &ScanResult{ScannerVersion: scannerVersion(), Repo: "synthetic", Synthetic: true, Findings: findings}
+	result.setMetadata(opts, started, "")
+
+	return result, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInjectFindings(t *testing.T) {
+	result, err := InjectFindings(4, injectMixed, ScanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Synthetic || len(result.Findings) != 4 {
+		t.Fatalf("got synthetic %v with %d findings, want 4 synthetic findings", result.Synthetic, len(result.Findings))
+	}
+
+	want := []string{statusValid, statusInvalid, statusUnverified, statusValid}
+	for i, f := range result.Findings {
+		if f.Status != want[i] || !f.Synthetic || f.Severity == "" || f.Remediation == "" {
+			t.Errorf("finding %d: got %+v, want a synthetic %s finding with a severity and remediation", i, f, want[i])
+		}
+		if f.KeyType.Name != "access-key" || !strings.HasPrefix(f.File, "TEST-ONLY/") || !strings.Contains(f.SecretAccessKey, "TESTONLY") {
+			t.Errorf("finding %d: got key %s of type %s in %s, want a marked long-term key", i, f.AccessKeyID, f.KeyType, f.File)
+		}
+	}
+
+	if _, err := InjectFindings(1, "live", ScanOptions{}); err == nil {
+		t.Error("got no error for an invalid status")
+	}
+}
+
+func TestCLIInjectFindings(t *testing.T) {
+	sarif := filepath.Join(t.TempDir(), "report.sarif")
+
+	res := runScanner(t, "-inject-findings", "3", "-inject-status", injectMixed, "-format", "json", "-output-sarif", sarif)
+	if res.code != exitKeysFound {
+		t.Errorf("got exit code %d, want %d for a valid synthetic key\n%s", res.code, exitKeysFound, res.stderr)
+	}
+	var result ScanResult
+	if err := json.Unmarshal([]byte(res.stdout), &result); err != nil {
+		t.Fatalf("got output %q: %v", res.stdout, err)
+	}
+	if !result.Synthetic || len(result.Findings) != 3 || !result.Findings[0].Synthetic {
+		t.Errorf("got result %+v, want 3 synthetic findings", result)
+	}
+	if !strings.Contains(res.stderr, "test mode, reporting 3 synthetic findings") {
+		t.Errorf("got log %q, want the test mode warning", res.stderr)
+	}
+	report, err := ioutil.ReadFile(sarif)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(report), `"synthetic": true`) {
+		t.Errorf("got SARIF report %s, want the findings marked synthetic", report)
+	}
+
+	res = runScanner(t, "-inject-findings", "2", "-inject-status", statusValid, "-format", "github-actions")
+	if n := strings.Count(res.stdout, "title=Synthetic test finding%3A "); n != 2 {
+		t.Errorf("got %d synthetic annotations in %q, want 2", n, res.stdout)
+	}
+
+	res = runScanner(t, "-inject-findings", "2", "-inject-status", statusInvalid)
+	if res.code != 0 || !strings.Contains(res.stdout, "Note: TEST MODE, the 2 findings are synthetic findings") {
+		t.Errorf("got exit code %d and output %q, want 0 and the test mode note", res.code, res.stdout)
+	}
+}
+
+func TestCLIInjectFindingsHidden(t *testing.T) {
+	if res := runScanner(t, "-h"); strings.Contains(res.stderr, "inject-findings") || !strings.Contains(res.stderr, "-repo") {
+		t.Errorf("got usage %q, want it without the test-only flags", res.stderr)
+	}
+
+	// The test-only flags are never taken from the environment
+	repo := newFixtureRepo(t)
+	repo.commit("add readme", map[string]string{"README.md": "# clean\n"})
+	res := runScannerEnv(t, []string{envName("inject-findings") + "=3"}, "-no-validate", "-repo", repo.dir)
+	if res.code != 0 || strings.Contains(res.stdout, "synthetic") {
+		t.Errorf("got exit code %d and output %q, want the repository scanned", res.code, res.stdout)
+	}
+
+	if res := runScanner(t, "-inject-findings", "1", "-repo", repo.dir); res.code != exitError {
+		t.Errorf("with a scan target: got exit code %d, want %d", res.code, exitError)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// uniqueSecret is a secret found by a scan with every location it was found at, as listed by -unique.
+type uniqueSecret struct {
+	// Fingerprint identifies the access key ID and secret, without holding the secret.
+	Fingerprint string  `json:"fingerprint"`
+	AccessKeyID string  `json:"access_key_id,omitempty"`
+	KeyType     keyType `json:"key_type"`
+	// Rules are the rules that matched the secret, in the order they first did.
+	Rules    []string `json:"rules"`
+	Status   string   `json:"status"`
+	Severity string   `json:"severity,omitempty"`
+	Error    string   `json:"error,omitempty"`
+	// Allowed marks secrets only found under allowed paths.
+	Allowed   bool             `json:"allowed,omitempty"`
+	Locations []secretLocation `json:"locations"`
+	secret    string
+}
+
+// secretLocation is where a unique secret was found.
+type secretLocation struct {
+	Repo    string `json:"repo,omitempty"`
+	Commit  string `json:"commit,omitempty"`
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Cell    int    `json:"cell,omitempty"`
+	Source  string `json:"source,omitempty"`
+	Ref     string `json:"ref,omitempty"`
+	Allowed bool   `json:"allowed,omitempty"`
+	where   string
+}
+
+// uniqueReport is the JSON report of -unique.
+type uniqueReport struct {
+	Metadata *ReportMetadata `json:"metadata,omitempty"`
+	Secrets  []uniqueSecret  `json:"secrets"`
+}
+
+// uniqueSecrets collapses the findings to one entry per access key ID and secret, in the order they
+// were first found. Every finding of a secret is validated by the same call, so they share its status;
+// where rules validate it differently, the most severe finding is the one reported.
+func uniqueSecrets(findings []Finding) []uniqueSecret {
+	var secrets []uniqueSecret
+	index := make(map[string]int)
+	for _, f := range findings {
+		fingerprint := credentialFingerprint("", f.AccessKeyID, f.SecretAccessKey)[:16]
+		i, seen := index[fingerprint]
+		if !seen {
+			i = len(secrets)
+			index[fingerprint] = i
+			secrets = append(secrets, uniqueSecret{
+				Fingerprint: fingerprint,
+				AccessKeyID: f.AccessKeyID,
+				KeyType:     f.KeyType,
+				Status:      f.Status,
+				Severity:    f.Severity,
+				Error:       f.Error,
+				Allowed:     true,
+				secret:      f.SecretAccessKey,
+			})
+		}
+
+		s := &secrets[i]
+		if seen && severityRank[f.Severity] > severityRank[s.Severity] {
+			s.Status, s.Severity, s.Error = f.Status, f.Severity, f.Error
+		}
+		if !containsString(s.Rules, f.Rule) {
+			s.Rules = append(s.Rules, f.Rule)
+		}
+		s.Allowed = s.Allowed && f.Allowed
+		s.Locations = append(s.Locations, secretLocation{
+			Repo:    f.Repo,
+			Commit:  f.Commit,
+			File:    f.File,
+			Line:    f.Line,
+			Cell:    f.Cell,
+			Source:  f.Source,
+			Ref:     f.Ref,
+			Allowed: f.Allowed,
+			where:   f.where(),
+		})
+	}
+
+	return secrets
+}
+
+// containsString reports whether s is one of values.
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeUniqueJSON writes the unique secrets of the result as JSON.
+func writeUniqueJSON(w io.Writer, result *ScanResult) error {
+	report := uniqueReport{Metadata: result.Metadata, Secrets: uniqueSecrets(result.Findings)}
+	if report.Secrets == nil {
+		report.Secrets = []uniqueSecret{}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return fmt.Errorf("failed to write unique secrets: %v", err)
+	}
+
+	return nil
+}
+
+// printUnique reports the unique secrets of the result to the console, each with the locations it
+// was found at. Invalid keys are left out like in the default output.
+func printUnique(result *ScanResult) {
+	var shown []uniqueSecret
+	for _, s := range uniqueSecrets(result.Findings) {
+		if s.Status != statusInvalid {
+			shown = append(shown, s)
+		}
+	}
+	if len(shown) == 0 {
+		fmt.Println("No secrets found.")
+		return
+	}
+
+	fmt.Printf("Found %d unique secrets:\n", len(shown))
+	for _, s := range shown {
+		status := s.Status
+		if s.Severity != "" {
+			status += ", " + s.Severity
+		}
+		if s.Allowed {
+			status += ", allowed path"
+		}
+
+		if s.AccessKeyID == "" {
+			fmt.Printf("\nSecret %s matching rule %s (%s):\n", redact(s.secret), s.Rules[0], status)
+		} else {
+			fmt.Printf("\n%s (%s) (%s):\n", s.AccessKeyID, s.KeyType, status)
+		}
+		for _, location := range s.Locations {
+			fmt.Printf("  %s\n", location.where)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// uniqueFindings returns findings of one key pair in three files, and of another pair in one.
+func uniqueFindings() []Finding {
+	pair := keyMatch{AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey}
+	var findings []Finding
+	for i, file := range []string{"a.env", "config/b.yml", "c.json"} {
+		pair.Line = i + 1
+		f := newFinding("abc123", file, pair)
+		f.Status, f.Severity = statusValid, severityCritical
+		findings = append(findings, f)
+	}
+	other := newFinding("abc123", "d.env", keyMatch{AccessKeyID: testAccessKeyID2, SecretAccessKey: testSecretAccessKey2, Line: 4})
+	other.Status = statusInvalid
+
+	return append(findings, other)
+}
+
+func TestUniqueSecrets(t *testing.T) {
+	secrets := uniqueSecrets(uniqueFindings())
+
+	if len(secrets) != 2 {
+		t.Fatalf("got %d unique secrets, want 2", len(secrets))
+	}
+	s := secrets[0]
+	if s.AccessKeyID != testAccessKeyID || s.Status != statusValid || s.Severity != severityCritical {
+		t.Errorf("got secret %+v, want the valid critical pair", s)
+	}
+	var files []string
+	for _, location := range s.Locations {
+		files = append(files, location.File)
+	}
+	if want := []string{"a.env", "config/b.yml", "c.json"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("got locations %v, want %v", files, want)
+	}
+	if secrets[1].AccessKeyID != testAccessKeyID2 || len(secrets[1].Locations) != 1 {
+		t.Errorf("got secret %+v, want the other pair at one location", secrets[1])
+	}
+	if s.Fingerprint == secrets[1].Fingerprint || strings.Contains(s.Fingerprint, testSecretAccessKey) {
+		t.Errorf("got fingerprints %q and %q, want distinct ones not holding the secret", s.Fingerprint, secrets[1].Fingerprint)
+	}
+}
+
+func TestUniqueSecretsKeepsMostSevere(t *testing.T) {
+	findings := uniqueFindings()[:2]
+	findings[0].Severity, findings[0].Rule = severityLow, "aws-access-key"
+	findings[1].Severity, findings[1].Rule = severityHigh, "aws-labelled-key"
+	findings[1].Allowed = true
+
+	secrets := uniqueSecrets(findings)
+	if len(secrets) != 1 {
+		t.Fatalf("got %d unique secrets, want 1", len(secrets))
+	}
+	if s := secrets[0]; s.Severity != severityHigh || !reflect.DeepEqual(s.Rules, []string{"aws-access-key", "aws-labelled-key"}) || s.Allowed {
+		t.Errorf("got secret %+v, want high severity, both rules and not allowed", s)
+	}
+}
+
+func TestWriteUniqueJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeUniqueJSON(&buf, &ScanResult{Findings: uniqueFindings()}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), testSecretAccessKey) {
+		t.Error("got the secret in the report")
+	}
+
+	var report uniqueReport
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Secrets) != 2 || len(report.Secrets[0].Locations) != 3 || report.Secrets[0].Locations[1].Line != 2 {
+		t.Errorf("got report %+v, want 2 secrets, the first at 3 locations", report)
+	}
+
+	buf.Reset()
+	writeUniqueJSON(&buf, &ScanResult{})
+	if !strings.Contains(buf.String(), `"secrets": []`) {
+		t.Errorf("got report %s, want an empty list of secrets", buf.String())
+	}
+}
+
+func TestPrintUnique(t *testing.T) {
+	output := captureStdout(t, func() { printUnique(&ScanResult{Findings: uniqueFindings()}) })
+
+	want := "Found 1 unique secrets:\n\n" + testAccessKeyID + " (long-term IAM user access key) (valid, critical):\n" +
+		"  in commit abc123 at a.env:1\n  in commit abc123 at config/b.yml:2\n  in commit abc123 at c.json:3\n"
+	if output != want {
+		t.Errorf("got output %q, want %q", output, want)
+	}
+
+	if output := captureStdout(t, func() { printUnique(&ScanResult{}) }); output != "No secrets found.\n" {
+		t.Errorf("got output %q without findings", output)
+	}
+}
+
+func TestCLIUnique(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("add keys", map[string]string{
+		"a.env": keyFile(testAccessKeyID, testSecretAccessKey),
+		"b.env": keyFile(testAccessKeyID, testSecretAccessKey),
+		"c.env": keyFile(testAccessKeyID, testSecretAccessKey),
+	})
+
+	res := runScanner(t, "-no-validate", "-unique", "-format", "json", "-repo", repo.dir)
+	var report uniqueReport
+	if err := json.Unmarshal([]byte(res.stdout), &report); err != nil {
+		t.Fatalf("got output %q: %v\n%s", res.stdout, err, res.stderr)
+	}
+	if len(report.Secrets) != 1 || len(report.Secrets[0].Locations) != 3 {
+		t.Errorf("got report %+v, want one secret at three locations", report)
+	}
+
+	if res := runScanner(t, "-unique", "-count", "-repo", repo.dir); res.code != exitError {
+		t.Errorf("with -count: got exit code %d, want %d", res.code, exitError)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// urlPattern matches URL-like tokens such as s3://user:pass@bucket or https://host/?key=value.
+var urlPattern = regexp.MustCompile(`[A-Za-z][A-Za-z0-9+.\-]*://[^\x00-\x20"'<>` + "`" + `\x7f-\x{10FFFF}]+`)
+
+// rawUserinfoPattern matches the userinfo of a URL-like token whose secret holds an unescaped slash,
+// e.g. s3://AKIA...:abc/def@bucket, which URL parsers read as the end of the host.
+var rawUserinfoPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.\-]*://([A-Z0-9]{20}):([^@]+)@`)
+
+// searchURLKeys finds access key pairs embedded in the userinfo or query string of URLs and connection strings.
+// Components are URL-decoded before they are matched against the shape of AWS keys.
+func searchURLKeys(content []byte) []keyMatch {
+	var matches []keyMatch
+	for _, loc := range urlPattern.FindAllIndex(content, -1) {
+		token := string(content[loc[0]:loc[1]])
+		var accessKeyID, secretAccessKey string
+
+		// Credentials in the userinfo, e.g. s3://AKIA...:secret@bucket
+		if raw := rawUserinfoPattern.FindStringSubmatch(token); raw != nil && accessKeyIDShape.MatchString(raw[1]) {
+			if secret, err := url.PathUnescape(raw[2]); err == nil {
+				accessKeyID, secretAccessKey = raw[1], secret
+				token = token[:strings.Index(token, "://")+3] + token[len(raw[0]):]
+			}
+		}
+		u, err := url.Parse(token)
+		if err != nil {
+			continue
+		}
+		if u.User != nil && accessKeyID == "" {
+			if accessKeyIDShape.MatchString(u.User.Username()) {
+				accessKeyID = u.User.Username()
+				secretAccessKey, _ = u.User.Password()
+			}
+		}
+
+		// Credentials in the query string, e.g. ?aws_access_key_id=AKIA...&aws_secret_access_key=...
+		// The parameters are read in the order of the URL, so the first of several secrets is the one
+		// reported on every scan.
+		for _, param := range strings.Split(u.RawQuery, "&") {
+			name, value := param, ""
+			if i := strings.Index(param, "="); i >= 0 {
+				name, value = param[:i], param[i+1:]
+			}
+			name, nameErr := url.QueryUnescape(name)
+			value, valueErr := url.QueryUnescape(value)
+			if nameErr != nil || valueErr != nil {
+				continue
+			}
+			switch {
+			case accessKeyID == "" && accessKeyIDShape.MatchString(value):
+				accessKeyID = value
+			case secretAccessKey == "" && strings.Contains(strings.ToLower(name), "secret"):
+				secretAccessKey = value
+			}
+		}
+
+		if accessKeyID == "" || secretAccessKey == "" {
+			continue
+		}
+
+		matches = append(matches, keyMatch{
+			AccessKeyID:     accessKeyID,
+			SecretAccessKey: secretAccessKey,
+			Rule:            ruleAWSURL,
+			Line:            lineNumber(content, loc[0]),
+		})
+	}
+
+	return matches
+}
@@ -0,0 +1,466 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// keyValidator checks whether an access key pair is live.
+type keyValidator interface {
+	Validate(ctx context.Context, accessKeyID, secretAccessKey string) (bool, error)
+}
+
+// Methods AWS keys can be validated with.
+const (
+	// validationMethodSTS signs an STS GetCallerIdentity request with the key itself.
+	validationMethodSTS = "sts"
+	// validationMethodIAM looks the key up with IAM GetAccessKeyLastUsed, using the scanner's own credentials.
+	validationMethodIAM = "iam"
+)
+
+// awsValidator returns the validator of AWS keys for the validation method configured by opts.
+func (opts ScanOptions) awsValidator() keyValidator {
+	switch opts.ValidationMethod {
+	case "", validationMethodSTS:
+		return opts.stsValidator()
+	case validationMethodIAM:
+		return opts.iamValidator()
+	default:
+		return stsValidator{err: fmt.Errorf("unknown validation method %q: must be sts or iam", opts.ValidationMethod)}
+	}
+}
+
+// stsValidator validates keys by signing an STS GetCallerIdentity request with the key being
+// validated, which any live key may call, so the scanner needs no credentials or IAM permissions of
+// its own. err records why the session could not be created.
+type stsValidator struct {
+	sess *session.Session
+	err  error
+}
+
+// stsValidator returns the validator making STS calls in the region and endpoint configured by opts.
+func (opts ScanOptions) stsValidator() stsValidator {
+	config, err := opts.awsConfig()
+	if err != nil {
+		return stsValidator{err: err}
+	}
+
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return stsValidator{err: fmt.Errorf("failed to create AWS session: %v", err)}
+	}
+
+	return stsValidator{sess: sess}
+}
+
+// stsRejectedCodes are the STS error codes meaning the key itself was rejected: an unknown or
+// deactivated key ID, or a secret that does not belong to it.
+var stsRejectedCodes = map[string]bool{
+	"InvalidClientTokenId":  true,
+	"SignatureDoesNotMatch": true,
+}
+
+// Validate implements keyValidator.
+func (v stsValidator) Validate(ctx context.Context, accessKeyID, secretAccessKey string) (bool, error) {
+	if v.err != nil {
+		return false, &ValidationError{AccessKeyID: accessKeyID, Err: v.err}
+	}
+
+	svc := sts.New(v.sess, &aws.Config{Credentials: credentials.NewStaticCredentials(accessKeyID, secretAccessKey, "")})
+	if _, err := svc.GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{}); err != nil {
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && stsRejectedCodes[awsErr.Code()] {
+			return false, nil
+		}
+		return false, &ValidationError{AccessKeyID: accessKeyID, Err: err}
+	}
+
+	return true, nil
+}
+
+// Available reports an error when the session could not be created, in which case no key can be
+// validated. No credentials of the scanner's own are needed.
+func (v stsValidator) Available(ctx context.Context) error {
+	return v.err
+}
+
+// iamValidator validates keys with the IAM GetAccessKeyLastUsed API, calling it with the credentials
+// of the session. err records why the session could not be created.
+type iamValidator struct {
+	sess *session.Session
+	err  error
+}
+
+// iamValidator returns the validator making IAM calls with the caller credentials configured by opts.
+func (opts ScanOptions) iamValidator() iamValidator {
+	sess, err := opts.awsSession()
+	return iamValidator{sess: sess, err: err}
+}
+
+// Validate implements keyValidator.
+func (v iamValidator) Validate(ctx context.Context, accessKeyID, secretAccessKey string) (bool, error) {
+	if v.err != nil {
+		return false, &ValidationError{AccessKeyID: accessKeyID, Err: v.err}
+	}
+
+	return validateIAMKey(ctx, v.sess, accessKeyID, secretAccessKey)
+}
+
+// Available reports an error when no AWS credentials are configured to call IAM with, in which case
+// no key can be validated.
+func (v iamValidator) Available(ctx context.Context) error {
+	if v.err != nil {
+		return v.err
+	}
+
+	_, err := v.sess.Config.Credentials.GetWithContext(ctx)
+	return err
+}
+
+// availabilityChecker is implemented by validators that can tell up front whether they can run at all.
+type availabilityChecker interface {
+	Available(ctx context.Context) error
+}
+
+// commandValidator validates the secrets of a custom rule by running an external command.
+type commandValidator struct {
+	rule string
+	argv []string
+}
+
+// Validate implements keyValidator. The secret is written to the command's standard input, the
+// rule name is passed in SCANNER_RULE and the ID paired with the secret, if any, in SCANNER_ID; exit
+// code 0 means live, 1 means not live and anything else is an error.
+func (v commandValidator) Validate(ctx context.Context, accessKeyID, secretAccessKey string) (bool, error) {
+	cmd := exec.CommandContext(ctx, v.argv[0], v.argv[1:]...)
+	cmd.Stdin = strings.NewReader(secretAccessKey)
+	cmd.Env = append(os.Environ(), "SCANNER_RULE="+v.rule, "SCANNER_ID="+accessKeyID)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+		return false, nil
+	case errors.As(err, &exitErr):
+		return false, fmt.Errorf("validator for rule %s failed: %v. Output: %s", v.rule, err, strings.TrimSpace(stderr.String()))
+	default:
+		return false, fmt.Errorf("failed to run validator for rule %s: %v", v.rule, err)
+	}
+}
+
+// validationPool validates key pairs concurrently, bounding each call by a timeout.
+type validationPool struct {
+	validator keyValidator
+	// byRule holds the validators of rules that are not validated with AWS, keyed by rule name.
+	byRule      map[string]keyValidator
+	concurrency int
+	timeout     time.Duration
+	// adaptive reduces the concurrency while calls are throttled, retrying throttled calls.
+	adaptive bool
+	verbose  bool
+	// cache holds the results of earlier scans of the run, when the pool is shared by several scans.
+	cache *validationCache
+	// streamed holds the results of the keys validated while the scan was searching, if any.
+	streamed *validationStream
+}
+
+// validationResult is the status and error message a validation call ended with.
+type validationResult struct {
+	status, message string
+}
+
+// validationCache holds the conclusive validation results of a run, keyed by credential fingerprint.
+type validationCache struct {
+	mu      sync.Mutex
+	results map[string]validationResult
+}
+
+// newValidationCache returns an empty validation cache.
+func newValidationCache() *validationCache {
+	return &validationCache{results: make(map[string]validationResult)}
+}
+
+// credentialFingerprint identifies a key pair, and the rule validating it, without holding the secret.
+func credentialFingerprint(rule, accessKeyID, secretAccessKey string) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{rule, accessKeyID, secretAccessKey}, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// get returns the cached result for the credential. A nil cache holds nothing.
+func (c *validationCache) get(fingerprint string) (validationResult, bool) {
+	if c == nil {
+		return validationResult{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result, ok := c.results[fingerprint]
+	return result, ok
+}
+
+// put caches the result for the credential when it is conclusive, so timeouts and outages are
+// retried by later scans.
+func (c *validationCache) put(fingerprint string, result validationResult) {
+	if c == nil || (result.status != statusValid && result.status != statusInvalid) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.results[fingerprint] = result
+}
+
+// validationPool returns the pool used to validate the findings of a scan matched by the given rules.
+func (opts ScanOptions) validationPool(rules *ruleSet) validationPool {
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = defaultConcurrency
+	}
+	timeout := time.Duration(opts.ValidateTimeout)
+	if timeout <= 0 {
+		timeout = defaultValidateTimeout
+	}
+
+	byRule := rules.validators()
+	if opts.ValidateGitHub {
+		byRule[ruleGitHubToken] = githubValidator{baseURL: githubAPIURL, client: opts.httpClient()}
+	}
+
+	return validationPool{
+		validator:   opts.awsValidator(),
+		byRule:      byRule,
+		concurrency: concurrency,
+		timeout:     timeout,
+		adaptive:    opts.AdaptiveConcurrency,
+		verbose:     opts.Verbose,
+		cache:       opts.validations,
+		streamed:    opts.streamed,
+	}
+}
+
+// validateFindings sets the status of every finding using the validation pool configured by opts,
+// then its severity.
+func validateFindings(ctx context.Context, findings []Finding, opts ScanOptions, rules *ruleSet) {
+	defer assignRemediations(findings, rules)
+	defer assignSeverities(findings, rules)
+
+	// Secrets may be echoed back in validation errors, so make sure they never reach a log
+	for _, f := range findings {
+		opts.scrubs.add(f.SecretAccessKey, f.encoded)
+	}
+
+	pool := opts.validationPool(rules)
+	if opts.NoValidate {
+		for i := range findings {
+			findings[i].Status = statusSkipped
+			if pool.validatorFor(findings[i]) != nil {
+				findings[i].Status = statusUnverified
+			}
+		}
+		return
+	}
+
+	pool.run(ctx, findings)
+	enrichFindings(ctx, findings, opts)
+	markPublicExposure(ctx, findings, opts)
+}
+
+// validatorFor returns the validator that checks the finding, or nil when it cannot be validated.
+// Findings of a rule with its own validator use it; other findings are validated with AWS
+// when they are long-term keys.
+func (p validationPool) validatorFor(f Finding) keyValidator {
+	if validator, ok := p.byRule[f.Rule]; ok {
+		return validator
+	}
+	if f.KeyType.validationStrategy() == validateIAM {
+		return p.validator
+	}
+
+	return nil
+}
+
+// validatedRule returns the rule the finding's key pair is validated under: its own rule when the rule
+// has its own validator, or none, so AWS keys found by several rules are still validated once.
+func (p validationPool) validatedRule(f Finding) string {
+	if _, ok := p.byRule[f.Rule]; ok {
+		return f.Rule
+	}
+
+	return ""
+}
+
+// run sets the status of every finding, validating each unique key pair once and concurrently.
+func (p validationPool) run(ctx context.Context, findings []Finding) {
+	type keyPair struct{ rule, accessKeyID, secretAccessKey string }
+
+	pairOf := func(f Finding) keyPair {
+		return keyPair{rule: p.validatedRule(f), accessKeyID: f.AccessKeyID, secretAccessKey: f.SecretAccessKey}
+	}
+
+	// Collect the unique key pairs so each is only validated once
+	var pairs []keyPair
+	var validators []keyValidator
+	index := make(map[keyPair]int)
+	for _, f := range findings {
+		pair := pairOf(f)
+		if _, seen := index[pair]; !seen {
+			index[pair] = len(pairs)
+			pairs = append(pairs, pair)
+			validators = append(validators, p.validatorFor(f))
+		}
+	}
+
+	statuses := make([]string, len(pairs))
+	errs := make([]string, len(pairs))
+
+	// When AWS cannot be called, AWS keys are left unverified rather than reported invalid
+	if err := p.unavailable(ctx, validators); err != nil {
+		log.Printf("Warning: AWS validation unavailable, reporting keys as unverified: %v", err)
+		for i := range validators {
+			if validators[i] == p.validator {
+				validators[i] = nil
+				statuses[i] = statusUnverified
+				errs[i] = "validation unavailable: " + err.Error()
+			}
+		}
+	}
+
+	limiter := newConcurrencyLimiter(p.concurrency, p.adaptive, p.verbose)
+	var wg sync.WaitGroup
+	for i, pair := range pairs {
+		// Keys without a validator, such as temporary keys and IDs, are reported without validation
+		if validators[i] == nil {
+			if statuses[i] == "" {
+				statuses[i] = statusSkipped
+			}
+			continue
+		}
+
+		// Keys already validated by an earlier scan of the run, or while this one was searching, are not
+		// validated again
+		fingerprint := credentialFingerprint(pair.rule, pair.accessKeyID, pair.secretAccessKey)
+		if cached, ok := p.cache.get(fingerprint); ok {
+			statuses[i], errs[i] = cached.status, cached.message
+			continue
+		}
+		if streamed, ok := p.streamed.result(fingerprint); ok {
+			statuses[i], errs[i] = streamed.status, streamed.message
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, pair keyPair) {
+			defer wg.Done()
+
+			status, message := p.validateWithRetries(ctx, limiter, validators[i], pair.accessKeyID, pair.secretAccessKey)
+			statuses[i], errs[i] = status, logScrubber.scrub(message)
+			validationCalls.WithLabelValues(statuses[i]).Inc()
+			p.cache.put(fingerprint, validationResult{status: statuses[i], message: errs[i]})
+		}(i, pair)
+	}
+
+	wg.Wait()
+	if p.verbose && p.adaptive {
+		log.Printf("Validated %d keys, ending at a concurrency of %d of %d", len(pairs), limiter.current(), p.concurrency)
+	}
+
+	for i := range findings {
+		j := index[pairOf(findings[i])]
+		findings[i].Status = statuses[j]
+		findings[i].Error = errs[j]
+	}
+}
+
+// unavailable returns why the AWS validator cannot run, when any of the validators needs it.
+func (p validationPool) unavailable(ctx context.Context, validators []keyValidator) error {
+	checker, ok := p.validator.(availabilityChecker)
+	if !ok {
+		return nil
+	}
+
+	for _, validator := range validators {
+		if validator == p.validator {
+			return checker.Available(ctx)
+		}
+	}
+
+	return nil
+}
+
+// maxThrottleRetries is how many times an adaptive pool retries a throttled call.
+const maxThrottleRetries = 5
+
+// throttleBackoff is how long an adaptive pool waits before the first retry of a throttled call,
+// doubling on every further retry.
+const throttleBackoff = 200 * time.Millisecond
+
+// validateWithRetries runs a validation call once the limiter allows it. An adaptive pool retries
+// throttled calls with an exponential backoff for as long as the scan's context allows.
+func (p validationPool) validateWithRetries(ctx context.Context, limiter *concurrencyLimiter, validator keyValidator, accessKeyID, secretAccessKey string) (string, string) {
+	backoff := throttleBackoff
+	for attempt := 0; ; attempt++ {
+		limiter.acquire()
+		status, message, throttled := p.validate(ctx, validator, accessKeyID, secretAccessKey)
+		limiter.release(throttled)
+		if !throttled || !p.adaptive || attempt == maxThrottleRetries {
+			return status, message
+		}
+
+		select {
+		case <-ctx.Done():
+			return status, message
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// validate runs a single validation call with the given validator under the pool's timeout and
+// returns the status and error message, and whether the call was throttled. Only a key the validator
+// rejects is invalid: a call that runs out of time, is cancelled with the scan, is throttled, fails to
+// reach AWS, e.g. during an outage or on a DNS error, or fails for any other reason, such as AWS
+// rejecting the scanner's own credentials, leaves the key unverified.
+func (p validationPool) validate(ctx context.Context, validator keyValidator, accessKeyID, secretAccessKey string) (string, string, bool) {
+	callCtx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	valid, err := validator.Validate(callCtx, accessKeyID, secretAccessKey)
+	switch {
+	case ctx.Err() != nil:
+		return statusUnverified, "validation cancelled", false
+	case callCtx.Err() != nil:
+		return statusUnverified, "validation timed out", false
+	case validationThrottled(err):
+		return statusUnverified, "validation throttled: " + err.Error(), true
+	case validationUnavailable(err):
+		return statusUnverified, "validation unavailable: " + err.Error(), false
+	case err != nil:
+		return statusUnverified, "validation failed: " + err.Error(), false
+	case valid:
+		return statusValid, "", false
+	default:
+		return statusInvalid, "", false
+	}
+}
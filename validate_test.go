@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+func TestSTSValidatorCustomEndpoint(t *testing.T) {
+	stub := newSTSStub(t, testAccessKeyID)
+	validator := ScanOptions{AWSEndpoint: stub.URL}.awsValidator()
+
+	valid, err := validator.Validate(context.Background(), testAccessKeyID, testSecretAccessKey)
+	if err != nil || !valid {
+		t.Errorf("live key: valid %v, err %v, want valid", valid, err)
+	}
+
+	valid, err = validator.Validate(context.Background(), testAccessKeyID2, testSecretAccessKey2)
+	if err != nil || valid {
+		t.Errorf("rejected key: valid %v, err %v, want invalid without error", valid, err)
+	}
+}
+
+func TestScanValidatesAgainstCustomEndpoint(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("keys", map[string]string{
+		"live.env": keyFile(testAccessKeyID, testSecretAccessKey),
+		"dead.env": keyFile(testAccessKeyID2, testSecretAccessKey2),
+	})
+	stub := newSTSStub(t, testAccessKeyID)
+
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, AWSEndpoint: stub.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := make(map[string]string)
+	for _, f := range result.Findings {
+		statuses[f.AccessKeyID] = f.Status
+	}
+	if statuses[testAccessKeyID] != statusValid || statuses[testAccessKeyID2] != statusInvalid {
+		t.Errorf("got statuses %v, want %s valid and %s invalid", statuses, testAccessKeyID, testAccessKeyID2)
+	}
+}
+
+// blockingValidator hangs on every call until its context is done, like a request AWS never answers.
+type blockingValidator struct{}
+
+// Validate blocks until ctx is done.
+func (blockingValidator) Validate(ctx context.Context, accessKeyID, secretAccessKey string) (bool, error) {
+	<-ctx.Done()
+	return false, ctx.Err()
+}
+
+func TestValidateTimeoutLeavesKeyUnverified(t *testing.T) {
+	pool := validationPool{validator: blockingValidator{}, byRule: map[string]keyValidator{}, concurrency: 1, timeout: 50 * time.Millisecond}
+	findings := []Finding{newFinding("", "a", keyMatch{AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey})}
+
+	start := time.Now()
+	pool.run(context.Background(), findings)
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("validation took %v, want it cut at the 50ms call timeout", elapsed)
+	}
+	if f := findings[0]; f.Status != statusUnverified || f.Error != "validation timed out" {
+		t.Errorf("got status %q error %q, want unverified after a time out", f.Status, f.Error)
+	}
+}
+
+func TestValidateCancelledScanIsNotATimeout(t *testing.T) {
+	pool := validationPool{validator: blockingValidator{}, byRule: map[string]keyValidator{}, concurrency: 1, timeout: time.Minute}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	status, message, _ := pool.validate(ctx, blockingValidator{}, testAccessKeyID, testSecretAccessKey)
+	if status != statusUnverified || message != "validation cancelled" {
+		t.Errorf("got status %q error %q, want unverified after the scan was cancelled", status, message)
+	}
+}
+
+func TestValidateTimeoutIsPerCall(t *testing.T) {
+	blocking := blockingValidator{}
+	fast := &fakeValidator{valid: map[string]bool{testAccessKeyID2: true}}
+	pool := validationPool{validator: blocking, byRule: map[string]keyValidator{"fast": fast}, concurrency: 2, timeout: 50 * time.Millisecond}
+
+	findings := []Finding{
+		newFinding("", "a", keyMatch{AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey}),
+		newFinding("", "b", keyMatch{AccessKeyID: testAccessKeyID2, SecretAccessKey: testSecretAccessKey2, Rule: "fast"}),
+	}
+	pool.run(context.Background(), findings)
+
+	if findings[0].Status != statusUnverified || findings[1].Status != statusValid {
+		t.Errorf("got statuses %q and %q, want unverified and valid", findings[0].Status, findings[1].Status)
+	}
+}
+
+func TestCommandValidator(t *testing.T) {
+	// The validator is live for the secret "live" of rule custom-token paired with ID id-1
+	script := `read secret; [ "$SCANNER_RULE" = custom-token ] || exit 3; [ "$SCANNER_ID" = id-1 ] || exit 3; [ "$secret" = live ] && exit 0; [ "$secret" = dead ] && exit 1; echo broken >&2; exit 2`
+	validator := commandValidator{rule: "custom-token", argv: []string{"sh", "-c", script}}
+
+	tests := []struct {
+		secret  string
+		valid   bool
+		wantErr bool
+	}{
+		{"live", true, false},
+		{"dead", false, false},
+		{"other", false, true},
+	}
+	for _, tt := range tests {
+		valid, err := validator.Validate(context.Background(), "id-1", tt.secret+"\n")
+		if valid != tt.valid || (err != nil) != tt.wantErr {
+			t.Errorf("%s: got valid %v err %v, want valid %v and error %v", tt.secret, valid, err, tt.valid, tt.wantErr)
+		}
+		if err != nil && !strings.Contains(err.Error(), "broken") {
+			t.Errorf("%s: error %q does not hold the validator output", tt.secret, err)
+		}
+	}
+
+	if _, err := (commandValidator{rule: "custom-token", argv: []string{"/nonexistent/validator"}}).Validate(context.Background(), "", "live"); err == nil {
+		t.Error("missing validator command reported no error")
+	}
+}
+
+func TestScanWithCommandValidator(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("tokens", map[string]string{"tokens.txt": "token: tok_livelive\ntoken: tok_deaddead\n"})
+
+	rule := Rule{Name: "custom-token", Pattern: `\b(tok_[a-z]{8})\b`, Validator: []string{"sh", "-c", `read secret; [ "$secret" = tok_livelive ]`}}
+	result, err := Scan(context.Background(), ScanOptions{RepoURL: repo.dir, Rules: []Rule{rule}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := make(map[string]string)
+	for _, f := range result.Findings {
+		statuses[f.SecretAccessKey] = f.Status
+	}
+	if statuses["tok_livelive"] != statusValid || statuses["tok_deaddead"] != statusInvalid {
+		t.Errorf("got statuses %v, want the live token valid and the other invalid", statuses)
+	}
+}
+
+// withoutAWSCredentials clears every source of AWS credentials for the test.
+func withoutAWSCredentials(t *testing.T) {
+	dir := t.TempDir()
+	for name, value := range map[string]string{
+		"AWS_ACCESS_KEY_ID":                      "",
+		"AWS_SECRET_ACCESS_KEY":                  "",
+		"AWS_SESSION_TOKEN":                      "",
+		"AWS_PROFILE":                            "",
+		"AWS_SHARED_CREDENTIALS_FILE":            filepath.Join(dir, "credentials"),
+		"AWS_CONFIG_FILE":                        filepath.Join(dir, "config"),
+		"AWS_WEB_IDENTITY_TOKEN_FILE":            "",
+		"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI": "",
+		"AWS_CONTAINER_CREDENTIALS_FULL_URI":     "",
+		"AWS_EC2_METADATA_DISABLED":              "true",
+	} {
+		t.Setenv(name, value)
+	}
+}
+
+func TestMissingCredentialsLeaveKeysUnverified(t *testing.T) {
+	withoutAWSCredentials(t)
+	findings := []Finding{newFinding("", "a", keyMatch{AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey})}
+
+	validateFindings(context.Background(), findings, ScanOptions{ValidationMethod: validationMethodIAM, ValidateTimeout: Duration(time.Second)}, nil)
+
+	if f := findings[0]; f.Status != statusUnverified || !strings.HasPrefix(f.Error, "validation unavailable") {
+		t.Errorf("got status %q error %q, want unverified because validation is unavailable", f.Status, f.Error)
+	}
+}
+
+func TestValidationErrorsLeaveKeysUnverified(t *testing.T) {
+	validator := &fakeValidator{err: errors.New("dial tcp: lookup sts.amazonaws.com: no such host")}
+	pool := validationPool{validator: validator, byRule: map[string]keyValidator{}, concurrency: 1, timeout: time.Second}
+	findings := []Finding{newFinding("", "a", keyMatch{AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey})}
+
+	pool.run(context.Background(), findings)
+
+	if f := findings[0]; f.Status != statusUnverified || !strings.Contains(f.Error, "no such host") {
+		t.Errorf("got status %q error %q, want unverified with the error", f.Status, f.Error)
+	}
+}
+
+func TestUnreachableEndpointLeavesKeysUnverified(t *testing.T) {
+	closed := httptest.NewServer(nil)
+	closed.Close()
+	findings := []Finding{newFinding("", "a", keyMatch{AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey})}
+
+	validateFindings(context.Background(), findings, ScanOptions{AWSEndpoint: closed.URL}, nil)
+
+	if f := findings[0]; f.Status != statusUnverified {
+		t.Errorf("got status %q, want unverified when AWS cannot be reached", f.Status)
+	}
+}
+
+func TestPartitionEndpoints(t *testing.T) {
+	tests := []struct {
+		partition, region string
+		sts, iam          string
+	}{
+		{"", "", "https://sts." + defaultRegion + ".amazonaws.com", "https://iam.amazonaws.com"},
+		{"aws", "eu-west-1", "https://sts.eu-west-1.amazonaws.com", "https://iam.amazonaws.com"},
+		{"aws-us-gov", "", "https://sts.us-gov-west-1.amazonaws.com", "https://iam.us-gov.amazonaws.com"},
+		{"aws-us-gov", "us-gov-east-1", "https://sts.us-gov-east-1.amazonaws.com", "https://iam.us-gov.amazonaws.com"},
+		{"aws-cn", "", "https://sts.cn-north-1.amazonaws.com.cn", "https://iam.cn-north-1.amazonaws.com.cn"},
+		// The partition is that of the region when none is given
+		{"", "cn-northwest-1", "https://sts.cn-northwest-1.amazonaws.com.cn", "https://iam.cn-north-1.amazonaws.com.cn"},
+	}
+
+	for _, tt := range tests {
+		opts := ScanOptions{Partition: tt.partition, Region: tt.region}
+		v := opts.stsValidator()
+		if v.err != nil {
+			t.Errorf("%s %s: %v", tt.partition, tt.region, v.err)
+			continue
+		}
+		if got := sts.New(v.sess).Endpoint; got != tt.sts {
+			t.Errorf("%s %s: got STS endpoint %s, want %s", tt.partition, tt.region, got, tt.sts)
+		}
+		if got := iam.New(v.sess).Endpoint; got != tt.iam {
+			t.Errorf("%s %s: got IAM endpoint %s, want %s", tt.partition, tt.region, got, tt.iam)
+		}
+	}
+}
+
+func TestPartitionRegionMismatch(t *testing.T) {
+	for _, opts := range []ScanOptions{
+		{Partition: "aws-cn", Region: "us-east-1"},
+		{Partition: "aws-us-gov", Region: "cn-north-1"},
+		{Partition: "aws-iso"},
+	} {
+		if v := opts.stsValidator(); v.err == nil {
+			t.Errorf("partition %s with region %q accepted", opts.Partition, opts.Region)
+		}
+	}
+}
+
+func TestScanReposValidatesSharedKeyOnce(t *testing.T) {
+	first, second := newFixtureRepo(t), newFixtureRepo(t)
+	first.commit("add key", map[string]string{"config.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+	second.commit("add key", map[string]string{"deploy/.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+
+	stub := newSTSStub(t, testAccessKeyID)
+	var calls int32
+	counting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		stub.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer counting.Close()
+
+	result, err := ScanRepos(context.Background(), []string{first.dir, second.dir}, ScanOptions{AWSEndpoint: counting.URL}, func(repoURL string, err error) {
+		t.Errorf("scanning %s: %v", repoURL, err)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Findings) != 2 {
+		t.Fatalf("got %d findings, want the key in both repositories", len(result.Findings))
+	}
+	for _, f := range result.Findings {
+		if f.Status != statusValid {
+			t.Errorf("%s: got status %s, want valid", f.Repo, f.Status)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("got %d validation calls, want 1", n)
+	}
+}
+
+func TestCredentialFingerprint(t *testing.T) {
+	base := credentialFingerprint(ruleAWSLabelled, testAccessKeyID, testSecretAccessKey)
+	if base != credentialFingerprint(ruleAWSLabelled, testAccessKeyID, testSecretAccessKey) {
+		t.Error("fingerprint of the same credential differs")
+	}
+	for _, other := range []string{
+		credentialFingerprint(ruleAWSURL, testAccessKeyID, testSecretAccessKey),
+		credentialFingerprint(ruleAWSLabelled, testAccessKeyID, testSecretAccessKey2),
+		credentialFingerprint(ruleAWSLabelled, testAccessKeyID2, testSecretAccessKey),
+	} {
+		if other == base {
+			t.Error("different credentials share a fingerprint")
+		}
+	}
+	if strings.Contains(base, testSecretAccessKey) {
+		t.Error("fingerprint holds the secret")
+	}
+
+	// Only conclusive results are cached
+	cache := newValidationCache()
+	cache.put("unverified", validationResult{status: statusUnverified})
+	cache.put("valid", validationResult{status: statusValid})
+	if _, ok := cache.get("unverified"); ok {
+		t.Error("unverified result cached")
+	}
+	if result, ok := cache.get("valid"); !ok || result.status != statusValid {
+		t.Errorf("got cached result %+v %v, want valid", result, ok)
+	}
+}
+
+func TestSTSValidationNeedsNoCredentials(t *testing.T) {
+	withoutAWSCredentials(t)
+	stub := newSTSStub(t, testAccessKeyID)
+	findings := []Finding{
+		newFinding("", "live.env", keyMatch{AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey}),
+		newFinding("", "dead.env", keyMatch{AccessKeyID: testAccessKeyID2, SecretAccessKey: testSecretAccessKey2}),
+	}
+
+	// The default method signs with each discovered key, so it works where IAM lookups are unavailable
+	validateFindings(context.Background(), findings, ScanOptions{AWSEndpoint: stub.URL, ValidateTimeout: Duration(time.Second)}, nil)
+
+	if findings[0].Status != statusValid || findings[1].Status != statusInvalid {
+		t.Errorf("got statuses %q and %q, want valid and invalid", findings[0].Status, findings[1].Status)
+	}
+	if err := (ScanOptions{AWSEndpoint: stub.URL}).stsValidator().Available(context.Background()); err != nil {
+		t.Errorf("got STS validation unavailable without credentials: %v", err)
+	}
+}
+
+func TestSTSValidatorErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		code   string
+		valid  bool
+		err    bool
+	}{
+		{"wrong secret", http.StatusForbidden, "SignatureDoesNotMatch", false, false},
+		{"unknown key", http.StatusForbidden, "InvalidClientTokenId", false, false},
+		{"throttled", http.StatusBadRequest, "Throttling", false, true},
+	}
+
+	for _, tt := range tests {
+		stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/xml")
+			w.WriteHeader(tt.status)
+			w.Write([]byte(`<ErrorResponse><Error><Type>Sender</Type><Code>` + tt.code + `</Code><Message>no</Message></Error><RequestId>1</RequestId></ErrorResponse>`))
+		}))
+
+		valid, err := ScanOptions{AWSEndpoint: stub.URL, AdaptiveConcurrency: true}.awsValidator().Validate(context.Background(), testAccessKeyID, testSecretAccessKey)
+		stub.Close()
+		var validationErr *ValidationError
+		if valid != tt.valid || (err != nil) != tt.err || (err != nil && !errors.As(err, &validationErr)) {
+			t.Errorf("%s: got valid %v, err %v, want valid %v and error %v", tt.name, valid, err, tt.valid, tt.err)
+		}
+	}
+}
+
+func TestAWSValidatorMethods(t *testing.T) {
+	if _, ok := (ScanOptions{}).awsValidator().(stsValidator); !ok {
+		t.Error("got a default validator other than STS")
+	}
+	if _, ok := (ScanOptions{ValidationMethod: validationMethodIAM}).awsValidator().(iamValidator); !ok {
+		t.Error("got a validator other than IAM for the iam method")
+	}
+
+	_, err := ScanOptions{ValidationMethod: "ldap"}.awsValidator().Validate(context.Background(), testAccessKeyID, testSecretAccessKey)
+	if err == nil || !strings.Contains(err.Error(), `unknown validation method "ldap"`) {
+		t.Errorf("got error %v, want an unknown validation method", err)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build metadata, set at build time with
+//
+//	go build -ldflags "-X main.version=1.2.3 -X main.commit=$(git rev-parse HEAD)"
+var (
+	version = ""
+	commit  = ""
+)
+
+// scannerVersion returns the version the binary was built as, or "dev" when it was not set.
+func scannerVersion() string {
+	if version == "" {
+		return "dev"
+	}
+
+	return version
+}
+
+// scannerCommit returns the git commit the binary was built from, falling back to the VCS
+// information recorded by the Go toolchain.
+func scannerCommit() string {
+	if commit != "" {
+		return commit
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+
+	return "unknown"
+}
+
+// versionString describes the build for the version subcommand.
+func versionString() string {
+	return fmt.Sprintf("aws-iam-keys-finder %s (commit %s, %s)", scannerVersion(), scannerCommit(), runtime.Version())
+}
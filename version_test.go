@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setBuildVars sets the build metadata variables for the test, restoring them when it ends.
+func setBuildVars(t *testing.T, v, c string) {
+	oldVersion, oldCommit := version, commit
+	version, commit = v, c
+	t.Cleanup(func() { version, commit = oldVersion, oldCommit })
+}
+
+func TestScannerVersionFallsBackToDev(t *testing.T) {
+	setBuildVars(t, "", "")
+
+	if got := scannerVersion(); got != "dev" {
+		t.Errorf("scannerVersion() = %q, want dev", got)
+	}
+	if got := versionString(); !strings.Contains(got, "aws-iam-keys-finder dev ") {
+		t.Errorf("versionString() = %q, want the dev version", got)
+	}
+}
+
+func TestVersionString(t *testing.T) {
+	setBuildVars(t, "1.2.3", "0123abcd")
+
+	got := versionString()
+	for _, want := range []string{"1.2.3", "commit 0123abcd", runtime.Version()} {
+		if !strings.Contains(got, want) {
+			t.Errorf("versionString() = %q, want it to hold %q", got, want)
+		}
+	}
+}
+
+func TestReportsEmbedVersion(t *testing.T) {
+	setBuildVars(t, "1.2.3", "0123abcd")
+
+	result := &ScanResult{ScannerVersion: scannerVersion(), Findings: []Finding{}}
+	result.setMetadata(ScanOptions{}, time.Now(), "")
+	if result.Metadata.ScannerVersion != "1.2.3" || result.Metadata.ScannerCommit != "0123abcd" {
+		t.Errorf("got metadata %+v, want the build version and commit", result.Metadata)
+	}
+
+	var sarif bytes.Buffer
+	if err := writeSARIFReport(&sarif, result); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sarif.String(), `"version": "1.2.3"`) {
+		t.Errorf("SARIF report does not hold the version:\n%s", sarif.String())
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// exposurePublic classifies live keys found in a public repository, where anyone can use them and
+// scrapers of public commits find keys within minutes.
+const exposurePublic = "critical-public-exposure"
+
+// markPublicExposure classifies the live findings outside allowed paths as publicly exposed when the
+// repository is public: because opts.Public says so, or because GitHub reports a github.com repository
+// as public. GitHub is only asked when a key is live.
+func markPublicExposure(ctx context.Context, findings []Finding, opts ScanOptions) {
+	var live []*Finding
+	for i := range findings {
+		if findings[i].Status == statusValid && !findings[i].Allowed {
+			live = append(live, &findings[i])
+		}
+	}
+	if len(live) == 0 {
+		return
+	}
+
+	public := opts.Public
+	if !public {
+		var err error
+		if public, err = opts.githubRepoPublic(ctx); err != nil {
+			log.Printf("Warning: %v; live keys are not checked for public exposure", err)
+			return
+		}
+	}
+	if !public {
+		return
+	}
+
+	for _, f := range live {
+		f.Exposure = exposurePublic
+	}
+}
+
+// githubRepoPublic reports whether the repository scanned is a public github.com repository, asking
+// the GitHub API with the token when set. Repositories elsewhere are not known to be public. A
+// repository the API cannot see is private, or the token lacks access, so it is not public either.
+func (opts ScanOptions) githubRepoPublic(ctx context.Context) (bool, error) {
+	webURL := githubWebURL(opts.RepoURL)
+	if webURL == "" {
+		return false, nil
+	}
+
+	timeout := time.Duration(opts.ValidateTimeout)
+	if timeout <= 0 {
+		timeout = defaultValidateTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, githubAPIURL+"/repos/"+strings.TrimPrefix(webURL, "https://github.com/"), nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to build GitHub repository request: %v", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if opts.Token != "" {
+		req.Header.Set("Authorization", "token "+opts.Token)
+	}
+
+	resp, err := opts.httpClient().Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to get the visibility of %s: %v", webURL, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("failed to get the visibility of %s: unexpected status %s", webURL, resp.Status)
+	}
+
+	var repo struct {
+		Private bool `json:"private"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&repo); err != nil {
+		return false, fmt.Errorf("failed to parse GitHub repository response: %v", err)
+	}
+
+	return !repo.Private, nil
+}
+
+// exposureNote marks publicly exposed findings for console output.
+func exposureNote(f Finding) string {
+	if f.Exposure != exposurePublic {
+		return ""
+	}
+
+	return "CRITICAL PUBLIC EXPOSURE: "
+}
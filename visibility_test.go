@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// githubAPIStub is a RoundTripper answering GitHub API requests with a status and body, and recording them.
+type githubAPIStub struct {
+	status int
+	body   string
+
+	mu       sync.Mutex
+	requests []*http.Request
+}
+
+// RoundTrip records the request and answers it.
+func (s *githubAPIStub) RoundTrip(req *http.Request) (*http.Response, error) {
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	s.mu.Unlock()
+
+	return &http.Response{StatusCode: s.status, Status: http.StatusText(s.status), Body: ioutil.NopCloser(strings.NewReader(s.body)), Header: make(http.Header), Request: req}, nil
+}
+
+// liveFindings returns a live, an invalid and an allowed live finding.
+func liveFindings() []Finding {
+	findings := []Finding{
+		newFinding("abc123", "live.env", keyMatch{AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey, Rule: ruleAWSLabelled}),
+		newFinding("abc123", "dead.env", keyMatch{AccessKeyID: testAccessKeyID2, SecretAccessKey: testSecretAccessKey2, Rule: ruleAWSLabelled}),
+		newFinding("abc123", "test/fixture.env", keyMatch{AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey, Rule: ruleAWSLabelled}),
+	}
+	findings[0].Status, findings[1].Status, findings[2].Status = statusValid, statusInvalid, statusValid
+	findings[2].Allowed = true
+
+	return findings
+}
+
+func TestMarkPublicExposure(t *testing.T) {
+	findings := liveFindings()
+
+	markPublicExposure(context.Background(), findings, ScanOptions{RepoURL: "https://git.example.com/o/r.git", Public: true})
+	assignSeverities(findings, nil)
+	assignRemediations(findings, nil)
+
+	if f := findings[0]; f.Exposure != exposurePublic || f.Severity != severityCritical || !strings.HasPrefix(f.Remediation, "The repository is public") {
+		t.Errorf("live key: got exposure %q, severity %q and remediation %q, want it escalated", f.Exposure, f.Severity, f.Remediation)
+	}
+	for _, f := range findings[1:] {
+		if f.Exposure != "" {
+			t.Errorf("%s: got exposure %q, want none", f.File, f.Exposure)
+		}
+	}
+	if note := exposureNote(findings[0]); note != "CRITICAL PUBLIC EXPOSURE: " {
+		t.Errorf("got note %q", note)
+	}
+}
+
+func TestMarkPublicExposureAsksGitHub(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"public", http.StatusOK, `{"private": false}`, exposurePublic},
+		{"private", http.StatusOK, `{"private": true}`, ""},
+		{"not visible", http.StatusNotFound, `{"message": "Not Found"}`, ""},
+		{"failing", http.StatusInternalServerError, ``, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &githubAPIStub{status: tt.status, body: tt.body}
+			findings := liveFindings()
+
+			markPublicExposure(context.Background(), findings, ScanOptions{RepoURL: "https://github.com/octo/app.git", Token: "ghp_token", HTTPClient: &http.Client{Transport: api}})
+
+			if findings[0].Exposure != tt.want {
+				t.Errorf("got exposure %q, want %q", findings[0].Exposure, tt.want)
+			}
+			if len(api.requests) != 1 {
+				t.Fatalf("got %d requests, want 1", len(api.requests))
+			}
+			if req := api.requests[0]; req.URL.String() != "https://api.github.com/repos/octo/app" || req.Header.Get("Authorization") != "token ghp_token" {
+				t.Errorf("got request %s with authorization %q, want the repository with the token", req.URL, req.Header.Get("Authorization"))
+			}
+		})
+	}
+}
+
+func TestMarkPublicExposureSkipsGitHub(t *testing.T) {
+	api := &githubAPIStub{status: http.StatusOK, body: `{"private": false}`}
+	client := &http.Client{Transport: api}
+
+	// No key is live, so the visibility does not matter
+	findings := liveFindings()[1:2]
+	markPublicExposure(context.Background(), findings, ScanOptions{RepoURL: "https://github.com/octo/app", HTTPClient: client})
+	// Repositories outside github.com are not known to be public
+	markPublicExposure(context.Background(), liveFindings(), ScanOptions{RepoURL: "https://gitlab.com/octo/app", HTTPClient: client})
+
+	if len(api.requests) != 0 {
+		t.Errorf("got %d GitHub requests, want none", len(api.requests))
+	}
+}
+
+func TestCLIPublicExposure(t *testing.T) {
+	repo := newFixtureRepo(t)
+	repo.commit("add key", map[string]string{"live.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+	stub := newSTSStub(t, testAccessKeyID)
+
+	res := runScanner(t, "-repo", repo.dir, "-aws-endpoint", stub.URL, "-public")
+	if res.code != exitKeysFound {
+		t.Errorf("got exit code %d, want %d\n%s", res.code, exitKeysFound, res.stderr)
+	}
+	for _, want := range []string{
+		"!!! CRITICAL: 1 live keys are exposed in a public repository (critical-public-exposure). Rotate them now. !!!",
+		"CRITICAL PUBLIC EXPOSURE: Valid IAM key found",
+	} {
+		if !strings.Contains(res.stdout, want) {
+			t.Errorf("got output %q, want %q", res.stdout, want)
+		}
+	}
+}
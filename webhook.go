@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// maxWebhookPayload bounds the size of a webhook delivery read, which GitHub caps at 25 MB.
+const maxWebhookPayload = 25 << 20
+
+// zeroCommit is the before commit of a push creating a branch and the after commit of one deleting it.
+const zeroCommit = "0000000000000000000000000000000000000000"
+
+// pushEvent is the part of a GitHub push webhook payload a scan is made from.
+type pushEvent struct {
+	Ref        string `json:"ref"`
+	Before     string `json:"before"`
+	After      string `json:"after"`
+	Repository struct {
+		CloneURL      string `json:"clone_url"`
+		DefaultBranch string `json:"default_branch"`
+	} `json:"repository"`
+}
+
+// handleWebhook scans the commits of the GitHub push delivered in the request body, whose
+// X-Hub-Signature-256 header must be signed with the webhook secret. Only the lines the pushed
+// commits added are searched. The scan goes on when GitHub stops waiting for the response, which it
+// does after 10 seconds, so its findings are still counted in the metrics. Ping deliveries are
+// answered and other events ignored.
+func (s *server) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if s.webhookSecret == "" {
+		writeError(w, http.StatusNotFound, "webhook scanning is disabled: start the server with -webhook-secret")
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookPayload))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read request body: "+err.Error())
+		return
+	}
+	if !validWebhookSignature(s.webhookSecret, body, r.Header.Get("X-Hub-Signature-256")) {
+		writeError(w, http.StatusUnauthorized, "invalid webhook signature")
+		return
+	}
+
+	switch event := r.Header.Get("X-GitHub-Event"); event {
+	case "ping":
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		return
+	case "push":
+	default:
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "ignored", "event": event})
+		return
+	}
+
+	var push pushEvent
+	if err := json.Unmarshal(body, &push); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid push payload: "+err.Error())
+		return
+	}
+	if push.Repository.CloneURL == "" || push.After == "" {
+		writeError(w, http.StatusBadRequest, "push payload has no repository clone_url or after commit")
+		return
+	}
+	if push.After == zeroCommit {
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "ignored", "reason": "branch deleted"})
+		return
+	}
+
+	opts := ScanOptions{RepoURL: push.Repository.CloneURL, DiffRange: push.diffRange()}
+	if opts.DiffRange == "" {
+		// The first push of a repository brings its whole history
+		opts.Diff = true
+	}
+
+	s.runScan(w, context.Background(), opts)
+}
+
+// diffRange returns the range of the commits the push added: those between its before and after
+// commits, or, for a new branch, those of the branch that are not on the default branch. It returns
+// "" when the push created the default branch, whose whole history is new.
+func (push pushEvent) diffRange() string {
+	if push.Before != zeroCommit {
+		return push.Before + ".." + push.After
+	}
+
+	if push.Repository.DefaultBranch == "" || push.Ref == "refs/heads/"+push.Repository.DefaultBranch {
+		return ""
+	}
+
+	return push.Repository.DefaultBranch + ".." + push.After
+}
+
+// validWebhookSignature reports whether signature, an X-Hub-Signature-256 header, is the HMAC-SHA256
+// of the body with the secret, comparing them in constant time.
+func validWebhookSignature(secret string, body []byte, signature string) bool {
+	if !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return hmac.Equal(got, mac.Sum(nil))
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testWebhookSecret is the webhook secret of the servers of the tests.
+const testWebhookSecret = "webhook-secret"
+
+// deliver posts a GitHub webhook delivery of the event, signed with the secret, to the server.
+func deliver(t *testing.T, s *server, secret, event, payload string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(payload))
+	req.Header.Set("X-GitHub-Event", event)
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	return w
+}
+
+// pushPayload returns a push event payload of the repository.
+func pushPayload(cloneURL, ref, before, after string) string {
+	var push pushEvent
+	push.Ref, push.Before, push.After = ref, before, after
+	push.Repository.CloneURL, push.Repository.DefaultBranch = cloneURL, "main"
+	payload, _ := json.Marshal(push)
+
+	return string(payload)
+}
+
+func TestWebhookScansPushedCommits(t *testing.T) {
+	repo := newFixtureRepo(t)
+	before := repo.commit("add old key", map[string]string{"old.env": keyFile(testAccessKeyID2, testSecretAccessKey2)})
+	pushed := repo.commit("add key", map[string]string{"new.env": keyFile(testAccessKeyID, testSecretAccessKey)})
+	after := repo.commit("docs", map[string]string{"README.md": "# app\n"})
+	stub := newSTSStub(t, testAccessKeyID)
+	withoutAWSCredentials(t)
+
+	var scanned ScanOptions
+	s := newServer(func(ctx context.Context, opts ScanOptions) (*ScanResult, error) {
+		scanned = opts
+		opts.AWSEndpoint, opts.ValidationMethod = stub.URL, validationMethodSTS
+		return Scan(ctx, opts)
+	}, 1, testWebhookSecret)
+
+	w := deliver(t, s, testWebhookSecret, "push", pushPayload(repo.dir, "refs/heads/main", before, after))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d %s, want 200", w.Code, w.Body.String())
+	}
+	var result ScanResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+
+	if scanned.DiffRange != before+".."+after {
+		t.Errorf("got diff range %q, want the range of the push", scanned.DiffRange)
+	}
+	if result.Commits != 2 {
+		t.Errorf("scanned %d commits, want the 2 pushed", result.Commits)
+	}
+	if len(result.Findings) != 1 || result.Findings[0].Commit != pushed || result.Findings[0].Status != statusValid {
+		t.Errorf("got findings %+v, want only the live key of %s", result.Findings, pushed)
+	}
+}
+
+func TestPushDiffRange(t *testing.T) {
+	tests := []struct {
+		name, ref, before string
+		want              string
+	}{
+		{"push", "refs/heads/main", "aaa", "aaa..bbb"},
+		{"new branch", "refs/heads/feature", zeroCommit, "main..bbb"},
+		{"new default branch", "refs/heads/main", zeroCommit, ""},
+	}
+
+	for _, tt := range tests {
+		var push pushEvent
+		if err := json.Unmarshal([]byte(pushPayload("https://github.com/o/r.git", tt.ref, tt.before, "bbb")), &push); err != nil {
+			t.Fatal(err)
+		}
+		if got := push.diffRange(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookFirstPushScansWholeHistory(t *testing.T) {
+	var scanned ScanOptions
+	s := newServer(func(ctx context.Context, opts ScanOptions) (*ScanResult, error) {
+		scanned = opts
+		return &ScanResult{Findings: []Finding{}}, nil
+	}, 1, testWebhookSecret)
+
+	w := deliver(t, s, testWebhookSecret, "push", pushPayload("https://github.com/o/r.git", "refs/heads/main", zeroCommit, "bbb"))
+	if w.Code != http.StatusOK || scanned.DiffRange != "" || !scanned.Diff || scanned.RepoURL != "https://github.com/o/r.git" {
+		t.Errorf("got status %d and options %+v, want the added lines of the whole history scanned", w.Code, scanned)
+	}
+}
+
+func TestWebhookRejectsDeliveries(t *testing.T) {
+	s := newServer(func(ctx context.Context, opts ScanOptions) (*ScanResult, error) {
+		t.Errorf("scan run for %+v", opts)
+		return &ScanResult{}, nil
+	}, 1, testWebhookSecret)
+	push := pushPayload("https://github.com/o/r.git", "refs/heads/main", "aaa", "bbb")
+
+	tests := []struct {
+		name   string
+		w      *httptest.ResponseRecorder
+		status int
+	}{
+		{"bad signature", deliver(t, s, "other-secret", "push", push), http.StatusUnauthorized},
+		{"ping", deliver(t, s, testWebhookSecret, "ping", `{"zen": "Keep it logically awesome."}`), http.StatusOK},
+		{"other event", deliver(t, s, testWebhookSecret, "issues", `{}`), http.StatusAccepted},
+		{"deleted branch", deliver(t, s, testWebhookSecret, "push", pushPayload("https://github.com/o/r.git", "refs/heads/old", "aaa", zeroCommit)), http.StatusAccepted},
+		{"invalid payload", deliver(t, s, testWebhookSecret, "push", `{`), http.StatusBadRequest},
+		{"no repository", deliver(t, s, testWebhookSecret, "push", `{"after": "bbb"}`), http.StatusBadRequest},
+		{"disabled", deliver(t, newServer(nil, 1, ""), testWebhookSecret, "push", push), http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if tt.w.Code != tt.status {
+			t.Errorf("%s: status %d %s, want %d", tt.name, tt.w.Code, tt.w.Body.String(), tt.status)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/webhook", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status %d, want 405", w.Code)
+	}
+}
+
+func TestValidWebhookSignature(t *testing.T) {
+	body := []byte(`{"zen": "Design for failure."}`)
+	mac := hmac.New(sha256.New, []byte(testWebhookSecret))
+	mac.Write(body)
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		signature string
+		want      bool
+	}{
+		{"sha256=" + signature, true},
+		{signature, false},
+		{"sha1=" + signature, false},
+		{"sha256=not-hex", false},
+		{"sha256=" + strings.Repeat("0", 64), false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := validWebhookSignature(testWebhookSecret, body, tt.signature); got != tt.want {
+			t.Errorf("validWebhookSignature(%q) = %v, want %v", tt.signature, got, tt.want)
+		}
+	}
+}